@@ -3,6 +3,7 @@ package apihandler
 import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/sethjback/gobl/agent/manager"
+	"github.com/sethjback/gobl/goblerr"
 	"github.com/sethjback/gobl/httpapi"
 	"github.com/sethjback/gobl/model"
 )
@@ -39,6 +40,10 @@ func cancelJob(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
 
 	err := manager.Cancel(id)
 	if err != nil {
+		// the coordinator takes a missing job as already stopped
+		if gerr, ok := err.(*goblerr.Error); ok && gerr.Code == manager.ErrorFindJob {
+			return httpapi.Response{Error: err, HTTPCode: 404}
+		}
 		return httpapi.Response{Error: err, HTTPCode: 400}
 	}
 
@@ -56,3 +61,47 @@ func jobStatus(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
 
 	return httpapi.Response{Data: map[string]interface{}{id: jobStatus}, HTTPCode: 200}
 }
+
+func prune(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
+	var req model.PruneRequest
+	err := r.JsonBody(&req)
+	if err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	results, err := manager.Prune(req)
+	if err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	return httpapi.Response{Data: map[string]interface{}{"results": results}, HTTPCode: 200}
+}
+
+func pruneReferences(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
+	var refs model.PruneReferences
+	err := r.JsonBody(&refs)
+	if err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	if err = manager.AddPruneReferences(refs); err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	return httpapi.Response{HTTPCode: 200}
+}
+
+func stats(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
+	var req model.StatsRequest
+	err := r.JsonBody(&req)
+	if err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	results, err := manager.Stats(req)
+	if err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	return httpapi.Response{Data: map[string]interface{}{"results": results}, HTTPCode: 200}
+}
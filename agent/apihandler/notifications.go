@@ -0,0 +1,25 @@
+package apihandler
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"github.com/sethjback/gobl/agent/manager"
+	"github.com/sethjback/gobl/httpapi"
+)
+
+func deadLetters(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
+	dead, err := manager.DeadLetters()
+	if err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 500}
+	}
+
+	return httpapi.Response{Data: map[string]interface{}{"deadLetters": dead}, HTTPCode: 200}
+}
+
+func purgeDeadLetters(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
+	count, err := manager.PurgeDeadLetters()
+	if err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 500}
+	}
+
+	return httpapi.Response{Data: map[string]interface{}{"purged": count}, HTTPCode: 200}
+}
@@ -15,6 +15,11 @@ var Routes = []httpapi.Route{
 		Path:    "/key",
 		Handler: agentKey,
 	},
+	httpapi.Route{
+		Method:  "GET",
+		Path:    "/capabilities",
+		Handler: agentCapabilities,
+	},
 
 	// Jobs
 	httpapi.Route{
@@ -37,4 +42,31 @@ var Routes = []httpapi.Route{
 		Path:    "/jobs/:id",
 		Handler: cancelJob,
 	},
+	// Notifications
+	httpapi.Route{
+		Method:  "GET",
+		Path:    "/notifications/dead",
+		Handler: deadLetters,
+	},
+	httpapi.Route{
+		Method:  "DELETE",
+		Path:    "/notifications/dead",
+		Handler: purgeDeadLetters,
+	},
+	// Storage
+	httpapi.Route{
+		Method:  "POST",
+		Path:    "/prune",
+		Handler: prune,
+	},
+	httpapi.Route{
+		Method:  "POST",
+		Path:    "/prune/references",
+		Handler: pruneReferences,
+	},
+	httpapi.Route{
+		Method:  "POST",
+		Path:    "/stats",
+		Handler: stats,
+	},
 }
@@ -27,3 +27,7 @@ func agentKey(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
 
 	return httpapi.Response{Data: map[string]interface{}{"keyString": key}, HTTPCode: 200}
 }
+
+func agentCapabilities(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
+	return httpapi.Response{Data: map[string]interface{}{"capabilities": manager.Capabilities()}, HTTPCode: 200}
+}
@@ -0,0 +1,12 @@
+package apihandler
+
+import (
+	"github.com/sethjback/gobl/agent/manager"
+	"github.com/sethjback/gobl/httpapi"
+	"github.com/sethjback/gobl/keys"
+)
+
+// Verifier returns the coordinator's verifier: every request made to the agent must be signed by the coordinator
+func Verifier(r *httpapi.Request) (keys.Verifier, error) {
+	return manager.CoordinatorVerifier(), nil
+}
@@ -22,16 +22,22 @@ type Backup struct {
 	cancel      chan struct{}
 	MaxWorkers  int
 	Notifier    notification.Notifier
+	// BatchSize and BatchInterval control how file results are batched up for the coordinator
+	BatchSize     int
+	BatchInterval time.Duration
+	persistence
 }
 
 func NewBackup(job model.Job, coordinator config.Coordinator, notifier notification.Notifier) (*Backup, error) {
 	job.Meta = &model.JobMeta{}
 	return &Backup{
-		stateM:      &sync.Mutex{},
-		Job:         job,
-		Coordinator: coordinator,
-		Notifier:    notifier,
-		MaxWorkers:  3,
+		stateM:        &sync.Mutex{},
+		Job:           job,
+		Coordinator:   coordinator,
+		Notifier:      notifier,
+		MaxWorkers:    3,
+		BatchSize:     DefaultBatchSize,
+		BatchInterval: DefaultBatchInterval,
 	}, nil
 }
 
@@ -52,6 +58,15 @@ func (b *Backup) Cancel() {
 	b.stateM.Unlock()
 }
 
+// Interrupt for jobber interface
+func (b *Backup) Interrupt() {
+	log.Infof("job", "Interrupting backup: %v", b.Job.ID)
+	b.stateM.Lock()
+	b.interrupted = true
+	close(b.cancel)
+	b.stateM.Unlock()
+}
+
 func (b *Backup) SetState(state string) {
 	b.stateM.Lock()
 	b.Job.Meta.State = state
@@ -65,6 +80,13 @@ func (b *Backup) GetState() string {
 	return s
 }
 
+func (b *Backup) isInterrupted() bool {
+	b.stateM.Lock()
+	i := b.interrupted
+	b.stateM.Unlock()
+	return i
+}
+
 func (b *Backup) addTotal(num int) {
 	b.stateM.Lock()
 	b.Job.Meta.Total += num
@@ -85,6 +107,7 @@ func (b *Backup) Run(finished chan<- string) {
 	b.SetState(model.StateRunning)
 	b.cancel = make(chan struct{})
 	b.Job.Meta.Start = time.Now()
+	b.save(b.Job)
 
 	paths, errc := buildBackupFileList(b.cancel, b.Job.Definition.Paths)
 
@@ -94,7 +117,13 @@ func (b *Backup) Run(finished chan<- string) {
 	go func() {
 		totalFiles := 0
 		for path := range paths {
-			q.AddWork(work.Backup{File: path, Modifications: b.Job.Definition.Modifications, Engines: b.Job.Definition.To})
+			// sent before the job was interrupted
+			if b.done(path) {
+				b.addTotal(1)
+				b.addComplete(1)
+				continue
+			}
+			q.AddWork(work.Backup{File: path, Modifications: b.Job.Definition.Modifications, Engines: b.Job.Definition.To, Xattrs: b.Job.Definition.Xattrs})
 			totalFiles++
 			if totalFiles > 10 {
 				b.addTotal(totalFiles)
@@ -108,13 +137,14 @@ func (b *Backup) Run(finished chan<- string) {
 	}()
 
 	done := make(chan struct{})
+	batcher := newFileBatcher(b.Notifier, b.Coordinator.Address, b.Job.ID, b.BatchSize, b.BatchInterval)
+	b.track(b.Job.ID, batcher)
 
 	go func() {
 		processedFiles := 0
 		for result := range q.Results() {
-			//send to notification Q
 			jf := result.(model.JobFile)
-			b.Notifier.Send(&JobNotification{JF: &jf, host: b.Coordinator.Address, path: "/jobs/" + b.Job.ID + "/files"})
+			batcher.Add(jf)
 			processedFiles++
 			if processedFiles > 10 {
 				b.addComplete(processedFiles)
@@ -142,8 +172,20 @@ func (b *Backup) Run(finished chan<- string) {
 		//finished!
 	}
 
+	batches := batcher.Close()
+	if b.isInterrupted() {
+		// picked up again from its saved state when the agent restarts
+		log.Infof("backupJob", "job %s interrupted after %d batches", b.Job.ID, batches)
+		finished <- b.Job.ID
+		return
+	}
+
 	log.Debug("backupJob", "sending finish")
-	b.Notifier.Send(&JobNotification{host: b.Coordinator.Address, path: "/jobs/" + b.Job.ID + "/complete"})
+	// the coordinator finishes the job once it has every batch sent
+	if err := b.Notifier.Send(&JobNotification{host: b.Coordinator.Address, path: "/jobs/" + b.Job.ID + "/complete", body: model.JobComplete{Batches: batches}}); err != nil {
+		log.Errorf("backupJob", "Completion of job %s may not reach the coordinator: %v", b.Job.ID, err)
+	}
+	b.finish(b.Job.ID)
 
 	// notify our manager that we are done
 	finished <- b.Job.ID
@@ -165,6 +207,8 @@ func buildBackupFileList(cancel <-chan struct{}, paths []model.Path) (<-chan str
 
 			log.Debugf("backupJob", "Walking filepath: %v", path)
 
+			exclude := newExcluder(path.Excludes)
+
 			errc <- filepath.Walk(path.Root, func(filePath string, info os.FileInfo, err error) error {
 
 				log.Debugf("backupJob", "Walk Found: %v", filePath)
@@ -173,11 +217,20 @@ func buildBackupFileList(cancel <-chan struct{}, paths []model.Path) (<-chan str
 					return err
 				}
 
-				if !info.Mode().IsRegular() {
+				rel, err := filepath.Rel(path.Root, filePath)
+				if err != nil {
+					return err
+				}
+
+				if exclude.excluded(rel, info.IsDir()) {
+					// prune the whole subtree
+					if info.IsDir() {
+						return filepath.SkipDir
+					}
 					return nil
 				}
 
-				if shouldExclude(filePath, path.Excludes) {
+				if !info.Mode().IsRegular() {
 					return nil
 				}
 
@@ -197,9 +250,3 @@ func buildBackupFileList(cancel <-chan struct{}, paths []model.Path) (<-chan str
 
 	return files, errc
 }
-
-// ShouldExclude takes a file path string and compares it with the requested exclusions
-func shouldExclude(path string, excludes []string) bool {
-	// TODO: implement
-	return false
-}
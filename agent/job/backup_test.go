@@ -1,6 +1,7 @@
 package job
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -76,6 +77,20 @@ func TestBackup(t *testing.T) {
 
 	assert.Nil(err)
 	assert.Equal(20, fcount)
+
+	// the file results go in one batch, and the completion reports it
+	n := b.Notifier.(*tn)
+	if assert.Len(n.sent, 2) {
+		var batch model.FileBatch
+		assert.Nil(json.Unmarshal(n.sent[0].Body(), &batch))
+		assert.Equal(1, batch.Sequence)
+		assert.Len(batch.Files, 20)
+
+		var complete model.JobComplete
+		assert.Equal("/jobs/"+b.Job.ID+"/complete", n.sent[1].Path())
+		assert.Nil(json.Unmarshal(n.sent[1].Body(), &complete))
+		assert.Equal(1, complete.Batches)
+	}
 }
 
 func TestBuildBackupFileList(t *testing.T) {
@@ -117,6 +132,21 @@ func TestBuildBackupFileList(t *testing.T) {
 
 	wg.Wait()
 	assert.InDelta(10, fCount, 1)
+
+	// excluded directories are pruned
+	c = make(chan struct{})
+	path.Excludes = []string{"/test1/", "tfile1", "!/tfile1"}
+	in, errc = buildBackupFileList(c, []model.Path{path})
+	var found []string
+	for f := range in {
+		found = append(found, f)
+	}
+
+	assert.Nil(<-errc)
+	assert.Len(found, 10)
+	for _, f := range found {
+		assert.NotContains(f, "test1")
+	}
 }
 
 func buildDirectoryTree() error {
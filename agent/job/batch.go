@@ -0,0 +1,101 @@
+package job
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sethjback/gobl/agent/notification"
+	"github.com/sethjback/gobl/model"
+)
+
+const (
+	// DefaultBatchSize is the most file results sent to the coordinator in one request
+	DefaultBatchSize = 100
+	// DefaultBatchInterval is the longest a file result waits for its batch to be sent
+	DefaultBatchInterval = 5 * time.Second
+)
+
+// fileBatcher collects file results and sends them to the coordinator in batches numbered from 1.
+// A batch is sent once it holds size results, or interval after its first result was added
+type fileBatcher struct {
+	m        *sync.Mutex
+	notifier notification.Notifier
+	host     string
+	path     string
+	size     int
+	interval time.Duration
+	files    []model.JobFile
+	sequence int
+	timer    *time.Timer
+	// checkpoint, if set, is called with each batch once it has been handed to the notifier, along with
+	// the error if the notifier couldn't keep it
+	checkpoint func(sequence int, files []model.JobFile, err error)
+}
+
+func newFileBatcher(notifier notification.Notifier, host, jobID string, size int, interval time.Duration) *fileBatcher {
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	if interval <= 0 {
+		interval = DefaultBatchInterval
+	}
+
+	return &fileBatcher{
+		m:        &sync.Mutex{},
+		notifier: notifier,
+		host:     host,
+		path:     "/jobs/" + jobID + "/files",
+		size:     size,
+		interval: interval,
+	}
+}
+
+// Add queues the file result, sending the batch if it is full
+func (b *fileBatcher) Add(jf model.JobFile) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.files = append(b.files, jf)
+	if len(b.files) >= b.size {
+		b.flush()
+		return
+	}
+
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.interval, b.Flush)
+	}
+}
+
+// Flush sends the queued file results, if there are any
+func (b *fileBatcher) Flush() {
+	b.m.Lock()
+	b.flush()
+	b.m.Unlock()
+}
+
+// Close sends the queued file results and returns the number of batches sent
+func (b *fileBatcher) Close() int {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.flush()
+	return b.sequence
+}
+
+func (b *fileBatcher) flush() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	if len(b.files) == 0 {
+		return
+	}
+
+	b.sequence++
+	err := b.notifier.Send(&JobNotification{host: b.host, path: b.path, body: model.FileBatch{Sequence: b.sequence, Files: b.files}})
+	if b.checkpoint != nil {
+		b.checkpoint(b.sequence, b.files, err)
+	}
+	b.files = nil
+}
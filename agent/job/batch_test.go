@@ -0,0 +1,63 @@
+package job
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sethjback/gobl/files"
+	"github.com/sethjback/gobl/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func sentBatches(n *tn) []model.FileBatch {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	var batches []model.FileBatch
+	for _, note := range n.sent {
+		var b model.FileBatch
+		json.Unmarshal(note.Body(), &b)
+		batches = append(batches, b)
+	}
+	return batches
+}
+
+func TestFileBatcher(t *testing.T) {
+	assert := assert.New(t)
+
+	n := newTestNotifier()
+	b := newFileBatcher(n, "127.0.0.1", "job-1", 3, time.Hour)
+
+	for i := 0; i < 7; i++ {
+		b.Add(model.JobFile{File: files.File{Signature: files.Signature{Path: "/file"}}})
+	}
+
+	// full batches go straight away
+	batches := sentBatches(n)
+	if assert.Len(batches, 2) {
+		assert.Equal(1, batches[0].Sequence)
+		assert.Len(batches[0].Files, 3)
+		assert.Equal(2, batches[1].Sequence)
+		assert.Equal("/jobs/job-1/files", n.sent[0].Path())
+	}
+
+	assert.Equal(3, b.Close())
+	batches = sentBatches(n)
+	if assert.Len(batches, 3) {
+		assert.Equal(3, batches[2].Sequence)
+		assert.Len(batches[2].Files, 1)
+	}
+
+	// nothing left to send
+	assert.Equal(3, b.Close())
+
+	// partial batches are sent after the interval
+	n = newTestNotifier()
+	b = newFileBatcher(n, "127.0.0.1", "job-2", 100, 10*time.Millisecond)
+	b.Add(model.JobFile{})
+	assert.Empty(sentBatches(n))
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(sentBatches(n), 1)
+	assert.Equal(1, b.Close())
+}
@@ -0,0 +1,119 @@
+package job
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// excludeRule is a single compiled gitignore style pattern
+type excludeRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// excluder matches paths relative to a backup root against a list of gitignore style patterns:
+//   - blank lines and lines starting with # are ignored
+//   - a leading ! negates the pattern, re-including anything a previous pattern excluded
+//   - a trailing / only matches directories
+//   - a pattern containing a / (other than a trailing one) is anchored to the root, otherwise it matches at any depth
+//   - ** matches zero or more directories, * and ? do not match /
+//
+// As with git, the last matching pattern wins, and a file cannot be re-included if one of its parent
+// directories is excluded since the walk never descends into excluded directories.
+type excluder struct {
+	rules []excludeRule
+}
+
+func newExcluder(patterns []string) *excluder {
+	e := &excluder{}
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+
+		r := excludeRule{}
+		if strings.HasPrefix(p, "!") {
+			r.negate = true
+			p = p[1:]
+		} else if strings.HasPrefix(p, `\!`) || strings.HasPrefix(p, `\#`) {
+			p = p[1:]
+		}
+
+		if strings.HasSuffix(p, "/") {
+			r.dirOnly = true
+			p = strings.TrimRight(p, "/")
+		}
+
+		if p == "" {
+			continue
+		}
+
+		if !strings.Contains(p, "/") {
+			// unanchored patterns match at any depth
+			p = "**/" + p
+		}
+
+		r.segments = strings.Split(strings.TrimPrefix(p, "/"), "/")
+		e.rules = append(e.rules, r)
+	}
+
+	return e
+}
+
+// excluded reports whether the path, relative to the backup root, should be skipped
+func (e *excluder) excluded(rel string, isDir bool) bool {
+	rel = filepath.ToSlash(rel)
+	if rel == "." || rel == "" {
+		return false
+	}
+
+	parts := strings.Split(rel, "/")
+	excluded := false
+	for _, r := range e.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+
+		if matchSegments(r.segments, parts) {
+			excluded = !r.negate
+		}
+	}
+
+	return excluded
+}
+
+// matchSegments matches the pattern segments against the path segments, expanding ** to any number of directories
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				// trailing ** matches everything inside, but not the directory itself
+				return len(parts) > 0
+			}
+
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern, parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(parts) == 0 {
+			return false
+		}
+
+		if ok, err := path.Match(pattern[0], parts[0]); err != nil || !ok {
+			return false
+		}
+
+		pattern = pattern[1:]
+		parts = parts[1:]
+	}
+
+	return len(parts) == 0
+}
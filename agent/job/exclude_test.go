@@ -0,0 +1,46 @@
+package job
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExcluder(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		patterns []string
+		path     string
+		isDir    bool
+		excluded bool
+	}{
+		{[]string{}, "a/b", false, false},
+		{[]string{"# comment", ""}, "# comment", false, false},
+		{[]string{"node_modules"}, "node_modules", true, true},
+		{[]string{"node_modules"}, "src/web/node_modules", true, true},
+		{[]string{"*.log"}, "var/app.log", false, true},
+		{[]string{"*.log"}, "var/app.log.1", false, false},
+		{[]string{"/proc"}, "proc", true, true},
+		{[]string{"/proc"}, "home/proc", true, false},
+		{[]string{"cache/"}, "home/cache", true, true},
+		{[]string{"cache/"}, "home/cache", false, false},
+		{[]string{"home/*/tmp"}, "home/seth/tmp", true, true},
+		{[]string{"home/*/tmp"}, "home/seth/work/tmp", true, false},
+		{[]string{"home/**/tmp"}, "home/seth/work/tmp", true, true},
+		{[]string{"home/**/tmp"}, "home/tmp", true, true},
+		{[]string{"**/build"}, "build", true, true},
+		{[]string{"logs/**"}, "logs/a/b.txt", false, true},
+		{[]string{"logs/**"}, "logs", true, false},
+		{[]string{"*.log", "!keep.log"}, "var/keep.log", false, false},
+		{[]string{"!keep.log", "*.log"}, "var/keep.log", false, true},
+		{[]string{`\!important`}, "!important", false, true},
+		{[]string{"[abc].txt"}, "b.txt", false, true},
+		{[]string{"[", "ok"}, "ok", false, true},
+	}
+
+	for _, test := range tests {
+		e := newExcluder(test.patterns)
+		assert.Equal(test.excluded, e.excluded(test.path, test.isDir), "%v %s", test.patterns, test.path)
+	}
+}
@@ -2,21 +2,28 @@ package job
 
 import (
 	"encoding/json"
+	"fmt"
 
+	"github.com/sethjback/gobl/agent/notification"
+	"github.com/sethjback/gobl/config"
 	"github.com/sethjback/gobl/model"
+	"github.com/sethjback/gobl/util/log"
 )
 
 // Jobber
 type Jobber interface {
 	Run(done chan<- string)
 	Cancel()
+	// Interrupt stops the job without finishing it, so it can be resumed from its saved state
+	Interrupt()
 	Status() model.JobMeta
 }
 
+// JobNotification is sent to the coordinator about a job, e.g. a batch of file results
 type JobNotification struct {
-	JF   *model.JobFile
 	host string
 	path string
+	body interface{}
 }
 
 func (jn *JobNotification) Host() string {
@@ -29,8 +36,91 @@ func (jn *JobNotification) Path() string {
 
 func (jn *JobNotification) Body() []byte {
 	var b []byte
-	if jn.JF != nil {
-		b, _ = json.Marshal(jn.JF)
+	if jn.body != nil {
+		b, _ = json.Marshal(jn.body)
 	}
 	return b
 }
+
+// ReportFailed tells the coordinator a saved job won't be finished, along with how many file batches
+// had been sent for it
+func ReportFailed(notifier notification.Notifier, coordinator config.Coordinator, saved SavedJob, reason string) {
+	err := notifier.Send(&JobNotification{
+		host: coordinator.Address,
+		path: "/jobs/" + saved.Job.ID + "/complete",
+		body: model.JobComplete{Batches: saved.Progress.Sequence, Error: reason},
+	})
+	if err != nil {
+		log.Errorf("job", "Failure of job %s may not reach the coordinator: %v", saved.Job.ID, err)
+	}
+}
+
+// persistence is shared by backup and restore jobs to keep their state on disk
+type persistence struct {
+	// State, if set, keeps the job on disk so it can be resumed after a restart
+	State *State
+	// Progress is what the job had done before it last stopped
+	Progress Progress
+	// interrupted jobs keep their state and don't tell the coordinator they are complete
+	interrupted bool
+	// abandoned is set once a batch couldn't be kept by the notifier: the job can't be resumed
+	abandoned bool
+}
+
+// save the job before it starts
+func (p *persistence) save(job model.Job) {
+	if p.State == nil {
+		return
+	}
+	if err := p.State.Save(job); err != nil {
+		log.Errorf("job", "Unable to save state for job %s, it won't be resumed after a restart: %v", job.ID, err)
+	}
+}
+
+// track sets the batcher up to continue the job's batch numbering and checkpoint each batch it sends.
+// Only batches the notifier has spooled are checkpointed: once one isn't, the job is marked as
+// unable to resume, since the batch would be lost along with the agent
+func (p *persistence) track(jobID string, batcher *fileBatcher) {
+	batcher.sequence = p.Progress.Sequence
+	if p.State == nil {
+		return
+	}
+
+	// called with the batcher locked
+	batcher.checkpoint = func(sequence int, files []model.JobFile, err error) {
+		if p.abandoned {
+			return
+		}
+		if err != nil {
+			p.abandoned = true
+			reason := fmt.Sprintf("file batch %d could not be spooled: %v", sequence, err)
+			if err = p.State.Abandon(jobID, reason); err != nil {
+				log.Errorf("job", "Unable to mark job %s as unable to resume: %v", jobID, err)
+			}
+			return
+		}
+
+		paths := make([]string, len(files))
+		for i := range files {
+			paths[i] = files[i].File.Signature.Path
+		}
+		if err := p.State.Checkpoint(jobID, sequence, paths); err != nil {
+			log.Errorf("job", "Unable to checkpoint job %s: %v", jobID, err)
+		}
+	}
+}
+
+// done reports whether the file was already sent before the job was resumed
+func (p *persistence) done(path string) bool {
+	return p.Progress.Done[path]
+}
+
+// finish removes the job's state once the coordinator has been told it is complete
+func (p *persistence) finish(jobID string) {
+	if p.State == nil {
+		return
+	}
+	if err := p.State.Remove(jobID); err != nil {
+		log.Errorf("job", "Unable to remove state for job %s: %v", jobID, err)
+	}
+}
@@ -13,6 +13,8 @@ type tn struct {
 	m       *sync.Mutex
 	sent    []notification.Notification
 	started bool
+	// err, if set, is returned by Send and nothing is sent
+	err error
 }
 
 func newTestNotifier() *tn {
@@ -31,10 +33,20 @@ func (t *tn) Stop() {
 func (t *tn) Stopped() bool {
 	return t.started
 }
-func (t *tn) Send(note notification.Notification) {
+func (t *tn) DeadLetters() ([]notification.SpoolEntry, error) {
+	return nil, nil
+}
+func (t *tn) PurgeDeadLetters() (int, error) {
+	return 0, nil
+}
+func (t *tn) Send(note notification.Notification) error {
 	t.m.Lock()
+	defer t.m.Unlock()
+	if t.err != nil {
+		return t.err
+	}
 	t.sent = append(t.sent, note)
-	t.m.Unlock()
+	return nil
 }
 
 func TestMain(m *testing.M) {
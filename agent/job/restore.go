@@ -19,15 +19,21 @@ type Restore struct {
 	cancel      chan struct{}
 	MaxWorkers  int
 	Notifier    notification.Notifier
+	// BatchSize and BatchInterval control how file results are batched up for the coordinator
+	BatchSize     int
+	BatchInterval time.Duration
+	persistence
 }
 
 func NewRestore(job model.Job, coordinator config.Coordinator, notifier notification.Notifier) (*Restore, error) {
 	return &Restore{
-		stateM:      &sync.Mutex{},
-		Job:         job,
-		Coordinator: coordinator,
-		MaxWorkers:  3,
-		Notifier:    notifier,
+		stateM:        &sync.Mutex{},
+		Job:           job,
+		Coordinator:   coordinator,
+		MaxWorkers:    3,
+		Notifier:      notifier,
+		BatchSize:     DefaultBatchSize,
+		BatchInterval: DefaultBatchInterval,
 	}, nil
 }
 
@@ -48,6 +54,15 @@ func (r *Restore) Cancel() {
 	r.stateM.Unlock()
 }
 
+// Interrupt for jobber interface
+func (r *Restore) Interrupt() {
+	log.Infof("job", "Interrupting restore: %v", r.Job.ID)
+	r.stateM.Lock()
+	r.interrupted = true
+	close(r.cancel)
+	r.stateM.Unlock()
+}
+
 func (r *Restore) SetState(state string) {
 	r.stateM.Lock()
 	r.Job.Meta.State = state
@@ -61,6 +76,13 @@ func (r *Restore) GetState() string {
 	return s
 }
 
+func (r *Restore) isInterrupted() bool {
+	r.stateM.Lock()
+	i := r.interrupted
+	r.stateM.Unlock()
+	return i
+}
+
 func (r *Restore) addTotal(num int) {
 	r.stateM.Lock()
 	r.Job.Meta.Total += num
@@ -80,6 +102,7 @@ func (r *Restore) Run(finished chan<- string) {
 	r.SetState(model.StateRunning)
 	r.cancel = make(chan struct{})
 	r.Job.Meta.Start = time.Now()
+	r.save(r.Job)
 
 	q := gowork.NewQueue(100, r.MaxWorkers)
 	q.Start(r.MaxWorkers)
@@ -87,19 +110,25 @@ func (r *Restore) Run(finished chan<- string) {
 	go func() {
 		r.addTotal(len(r.Job.Definition.Files))
 		for _, f := range r.Job.Definition.Files {
+			// restored before the job was interrupted
+			if r.done(f.Signature.Path) {
+				r.addComplete(1)
+				continue
+			}
 			q.AddWork(work.Restore{File: f, From: *r.Job.Definition.From, To: r.Job.Definition.To, Modifications: r.Job.Definition.Modifications})
 		}
 		q.Finish()
 	}()
 
 	done := make(chan struct{})
+	batcher := newFileBatcher(r.Notifier, r.Coordinator.Address, r.Job.ID, r.BatchSize, r.BatchInterval)
+	r.track(r.Job.ID, batcher)
 
 	go func() {
 		processedFiles := 0
 		for result := range q.Results() {
-			//send to notification Q
 			jf := result.(model.JobFile)
-			r.Notifier.Send(&JobNotification{JF: &jf, host: r.Coordinator.Address, path: "/jobs/" + r.Job.ID + "/files"})
+			batcher.Add(jf)
 			processedFiles++
 			if processedFiles > 10 {
 				r.addComplete(processedFiles)
@@ -121,8 +150,20 @@ func (r *Restore) Run(finished chan<- string) {
 		//finished!
 	}
 
+	batches := batcher.Close()
+	if r.isInterrupted() {
+		// picked up again from its saved state when the agent restarts
+		log.Infof("restoreJob", "job %s interrupted after %d batches", r.Job.ID, batches)
+		finished <- r.Job.ID
+		return
+	}
+
 	log.Debug("restoreJob", "sending finish")
-	r.Notifier.Send(&JobNotification{host: r.Coordinator.Address, path: "/jobs/" + r.Job.ID + "/complete"})
+	// the coordinator finishes the job once it has every batch sent
+	if err := r.Notifier.Send(&JobNotification{host: r.Coordinator.Address, path: "/jobs/" + r.Job.ID + "/complete", body: model.JobComplete{Batches: batches}}); err != nil {
+		log.Errorf("restoreJob", "Completion of job %s may not reach the coordinator: %v", r.Job.ID, err)
+	}
+	r.finish(r.Job.ID)
 
 	// notify our manager that we are done
 	finished <- r.Job.ID
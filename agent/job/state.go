@@ -0,0 +1,222 @@
+package job
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/model"
+)
+
+const (
+	ErrorStateWrite = "JobStateWriteFailed"
+	ErrorStateRead  = "JobStateReadFailed"
+
+	stateJobFile        = "job.json"
+	stateCheckpointFile = "checkpoints"
+	stateAbandonedFile  = "abandoned"
+)
+
+// State keeps the jobs running on the agent on disk, so they can be picked up again after a restart.
+// Each job has a directory holding its definition and a checkpoint log. A checkpoint is written once a
+// batch of file results has been handed to the notifier, and records the batch sequence and the files
+// in it: those files don't need to be processed again
+type State struct {
+	m   *sync.Mutex
+	dir string
+}
+
+// Progress is what a saved job had done before it stopped
+type Progress struct {
+	// Sequence of the last file batch sent
+	Sequence int
+	// Done are the paths of the files already sent to the coordinator
+	Done map[string]bool
+}
+
+// SavedJob is a job read back from the state
+type SavedJob struct {
+	Job      model.Job
+	Progress Progress
+	// Abandoned is why the job can't be resumed, if it can't
+	Abandoned string
+}
+
+type checkpoint struct {
+	Sequence int      `json:"sequence"`
+	Files    []string `json:"files"`
+}
+
+// OpenState opens the job state in dir, creating it if needed
+func OpenState(dir string) (*State, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, goblerr.New("Unable to open job state", ErrorStateRead, err)
+	}
+	return &State{m: &sync.Mutex{}, dir: dir}, nil
+}
+
+// Save the job's definition. It is written to a temporary file and renamed into place
+func (s *State) Save(job model.Job) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return goblerr.New("Unable to save job state", ErrorStateWrite, err)
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	dir := filepath.Join(s.dir, job.ID)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return goblerr.New("Unable to save job state", ErrorStateWrite, err)
+	}
+
+	path := filepath.Join(dir, stateJobFile)
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return goblerr.New("Unable to save job state", ErrorStateWrite, err)
+	}
+	if _, err = f.Write(b); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return goblerr.New("Unable to save job state", ErrorStateWrite, err)
+	}
+
+	return nil
+}
+
+// Checkpoint records that the file batch with the given sequence has been sent
+func (s *State) Checkpoint(id string, sequence int, files []string) error {
+	b, err := json.Marshal(checkpoint{Sequence: sequence, Files: files})
+	if err != nil {
+		return goblerr.New("Unable to checkpoint job", ErrorStateWrite, err)
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(s.dir, id, stateCheckpointFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return goblerr.New("Unable to checkpoint job", ErrorStateWrite, err)
+	}
+
+	if _, err = f.Write(append(b, '\n')); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return goblerr.New("Unable to checkpoint job", ErrorStateWrite, err)
+	}
+
+	return nil
+}
+
+// Abandon records that the job can't be resumed, and why. It is kept so it can be reported
+func (s *State) Abandon(id, reason string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if err := ioutil.WriteFile(filepath.Join(s.dir, id, stateAbandonedFile), []byte(reason), 0600); err != nil {
+		return goblerr.New("Unable to abandon job", ErrorStateWrite, err)
+	}
+	return nil
+}
+
+// Remove the job once it is finished
+func (s *State) Remove(id string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if err := os.RemoveAll(filepath.Join(s.dir, id)); err != nil {
+		return goblerr.New("Unable to remove job state", ErrorStateWrite, err)
+	}
+	return nil
+}
+
+// Unfinished returns the saved jobs and what they had done. A job whose definition can't be read is
+// returned with just its ID, so it can still be reported
+func (s *State) Unfinished() ([]SavedJob, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, goblerr.New("Unable to read job state", ErrorStateRead, err)
+	}
+
+	var saved []SavedJob
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+
+		sj := SavedJob{Job: model.Job{ID: info.Name()}, Progress: Progress{Done: make(map[string]bool)}}
+
+		if b, err := ioutil.ReadFile(filepath.Join(s.dir, info.Name(), stateJobFile)); err == nil {
+			var job model.Job
+			if json.Unmarshal(b, &job) == nil && job.ID == info.Name() {
+				sj.Job = job
+			}
+		}
+
+		if b, err := ioutil.ReadFile(filepath.Join(s.dir, info.Name(), stateAbandonedFile)); err == nil {
+			sj.Abandoned = string(b)
+		}
+
+		if err = readCheckpoints(filepath.Join(s.dir, info.Name(), stateCheckpointFile), &sj.Progress); err != nil {
+			return nil, err
+		}
+
+		saved = append(saved, sj)
+	}
+
+	return saved, nil
+}
+
+// readCheckpoints loads the checkpoint log. A line left incomplete by a crash is ignored:
+// its files are processed again
+func readCheckpoints(path string, p *Progress) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return goblerr.New("Unable to read job state", ErrorStateRead, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var c checkpoint
+		if json.Unmarshal(scanner.Bytes(), &c) != nil {
+			continue
+		}
+		if c.Sequence > p.Sequence {
+			p.Sequence = c.Sequence
+		}
+		for _, f := range c.Files {
+			p.Done[f] = true
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return goblerr.New("Unable to read job state", ErrorStateRead, err)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sethjback/gobl/config"
+	"github.com/sethjback/gobl/engine"
+	"github.com/sethjback/gobl/files"
+	"github.com/sethjback/gobl/model"
+	"github.com/sethjback/gobl/util/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestState(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "gobl-state")
+	if !assert.Nil(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := OpenState(dir)
+	if !assert.Nil(err) {
+		return
+	}
+
+	job := model.Job{ID: uuid.New().String(), Definition: &model.JobDefinition{Type: model.TypeBackup}, Meta: &model.JobMeta{}}
+	assert.Nil(s.Save(job))
+	assert.Nil(s.Checkpoint(job.ID, 1, []string{"/a", "/b"}))
+	assert.Nil(s.Checkpoint(job.ID, 2, []string{"/c"}))
+
+	// a checkpoint cut short by a crash is ignored
+	f, err := os.OpenFile(filepath.Join(dir, job.ID, stateCheckpointFile), os.O_WRONLY|os.O_APPEND, 0600)
+	if assert.Nil(err) {
+		f.WriteString(`{"sequence":3,"files":["/d"`)
+		f.Close()
+	}
+
+	// a job whose definition was never written is still returned
+	assert.Nil(os.Mkdir(filepath.Join(dir, "broken"), 0700))
+
+	saved, err := s.Unfinished()
+	if assert.Nil(err) && assert.Len(saved, 2) {
+		for _, sj := range saved {
+			if sj.Job.ID == "broken" {
+				assert.Nil(sj.Job.Definition)
+				continue
+			}
+
+			assert.Equal(job.ID, sj.Job.ID)
+			assert.Equal(model.TypeBackup, sj.Job.Definition.Type)
+			assert.Equal(2, sj.Progress.Sequence)
+			assert.Equal(map[string]bool{"/a": true, "/b": true, "/c": true}, sj.Progress.Done)
+		}
+	}
+
+	assert.Nil(s.Remove(job.ID))
+	assert.Nil(s.Remove("broken"))
+	saved, err = s.Unfinished()
+	assert.Nil(err)
+	assert.Empty(saved)
+}
+
+func TestTrackUnspooled(t *testing.T) {
+	assert := assert.New(t)
+	log.Init(config.Log{Level: log.Level.Error})
+
+	dir, err := ioutil.TempDir("", "gobl-state")
+	if !assert.Nil(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := OpenState(dir)
+	if !assert.Nil(err) {
+		return
+	}
+
+	job := model.Job{ID: uuid.New().String(), Definition: &model.JobDefinition{Type: model.TypeBackup}, Meta: &model.JobMeta{}}
+	assert.Nil(s.Save(job))
+
+	n := newTestNotifier()
+	p := &persistence{State: s}
+	b := newFileBatcher(n, "127.0.0.1", job.ID, 1, time.Hour)
+	p.track(job.ID, b)
+
+	b.Add(model.JobFile{File: files.File{Signature: files.Signature{Path: "/a"}}})
+
+	// once a batch isn't spooled nothing more is checkpointed, and the job can't be resumed
+	n.err = errors.New("spool full")
+	b.Add(model.JobFile{File: files.File{Signature: files.Signature{Path: "/b"}}})
+	n.err = nil
+	b.Add(model.JobFile{File: files.File{Signature: files.Signature{Path: "/c"}}})
+
+	saved, err := s.Unfinished()
+	if assert.Nil(err) && assert.Len(saved, 1) {
+		assert.Equal(1, saved[0].Progress.Sequence)
+		assert.Equal(map[string]bool{"/a": true}, saved[0].Progress.Done)
+		assert.Contains(saved[0].Abandoned, "file batch 2")
+	}
+}
+
+func TestBackupResume(t *testing.T) {
+	assert := assert.New(t)
+	log.Init(config.Log{Level: log.Level.Warn})
+
+	dir, err := ioutil.TempDir("", "gobl-state")
+	if !assert.Nil(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := OpenState(dir)
+	if !assert.Nil(err) {
+		return
+	}
+
+	// two batches holding 5 files were sent before the agent stopped
+	progress := Progress{Sequence: 2, Done: make(map[string]bool)}
+	for i := 0; i < 5; i++ {
+		progress.Done[filepath.Join("test", "tfile"+strconv.Itoa(i))] = true
+	}
+
+	b := &Backup{
+		Job: model.Job{
+			ID:   uuid.New().String(),
+			Meta: &model.JobMeta{},
+			Definition: &model.JobDefinition{
+				Paths: []model.Path{model.Path{Root: "test"}},
+				To: []engine.Definition{
+					engine.Definition{
+						Name:    engine.NameLogger,
+						Options: map[string]interface{}{engine.LoggerOptionLogPath: "rtest.log", engine.LoggerOptionOverwrite: false}}},
+			},
+		},
+		stateM:      &sync.Mutex{},
+		Coordinator: config.Coordinator{Address: "127.0.0.1"},
+		Notifier:    newTestNotifier(),
+		MaxWorkers:  1,
+		persistence: persistence{State: s, Progress: progress},
+	}
+	defer os.RemoveAll("rtest.log")
+
+	finish := make(chan string)
+	go b.Run(finish)
+	assert.Equal(b.Job.ID, <-finish)
+
+	// only the remaining files are sent, numbered on from the last batch
+	n := b.Notifier.(*tn)
+	if assert.Len(n.sent, 2) {
+		var batch model.FileBatch
+		assert.Nil(json.Unmarshal(n.sent[0].Body(), &batch))
+		assert.Equal(3, batch.Sequence)
+		assert.Len(batch.Files, 15)
+		for _, jf := range batch.Files {
+			assert.False(progress.Done[jf.File.Signature.Path], jf.File.Signature.Path)
+		}
+
+		var complete model.JobComplete
+		assert.Nil(json.Unmarshal(n.sent[1].Body(), &complete))
+		assert.Equal(3, complete.Batches)
+	}
+
+	assert.Equal(20, b.Status().Total)
+
+	// the finished job no longer needs its state
+	saved, err := s.Unfinished()
+	assert.Nil(err)
+	assert.Empty(saved)
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/sethjback/gobl/agent/apihandler"
 	"github.com/sethjback/gobl/agent/manager"
+	"github.com/sethjback/gobl/agent/notification"
 	"github.com/sethjback/gobl/config"
 	"github.com/sethjback/gobl/httpapi"
 	"github.com/sethjback/gobl/util/log"
@@ -16,8 +19,11 @@ import (
 func main() {
 
 	var cPath string
+	var spoolList, spoolPurge bool
 
 	flag.StringVar(&cPath, "config", "", "Path to the config file")
+	flag.BoolVar(&spoolList, "spool-list", false, "List the notifications waiting in the spool and exit")
+	flag.BoolVar(&spoolPurge, "spool-purge", false, "Remove every notification from the spool and exit")
 	flag.Parse()
 
 	conf, err := config.Parse(cPath)
@@ -30,15 +36,58 @@ func main() {
 	log.Infof("main", "agent starting. Version: %s", version.Version.String())
 	log.Debug("main", "config:", *conf)
 
+	if spoolList || spoolPurge {
+		if err = spool(conf.Notifications, spoolPurge); err != nil {
+			log.Fatalf("main", "Error opening notification spool: %v", err)
+		}
+		os.Exit(0)
+	}
+
 	err = manager.Init(conf)
 	if err != nil {
 		log.Fatalf("main", "Error initializing manager: %v", err)
 	}
 
 	httpAPI := httpapi.New(apihandler.Routes)
+	httpAPI.Use(httpapi.NewVerify(apihandler.Verifier))
 
 	httpAPI.Start(conf.Server, func() {
 		log.Infof("main", "shutting down")
 		manager.Shutdown()
 	})
 }
+
+// spool lists the notifications waiting in the spool, or removes them if purge is set.
+// The agent must not be running
+func spool(c config.Notifications, purge bool) error {
+	if c.SpoolPath == "" {
+		return errors.New("no spool_path configured")
+	}
+
+	s, err := notification.OpenSpool(c.SpoolPath, c.SpoolMaxMessages, c.SpoolMaxBytes)
+	if err != nil {
+		return err
+	}
+
+	if purge {
+		count, err := s.Purge()
+		if err != nil {
+			return err
+		}
+		log.Infof("main", "purged %d notifications from %s", count, c.SpoolPath)
+		return nil
+	}
+
+	entries, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		fmt.Printf("%s\t%s\t%s%s\t%d bytes\n", e.ID, e.Created.Format(time.RFC3339), e.Host, e.Path, len(e.Body))
+	}
+
+	count, size := s.Len()
+	fmt.Printf("%d notifications, %d bytes\n", count, size)
+	return nil
+}
@@ -0,0 +1,17 @@
+package manager
+
+import (
+	"github.com/sethjback/gobl/engine"
+	"github.com/sethjback/gobl/model"
+	"github.com/sethjback/gobl/modification"
+	"github.com/sethjback/gobl/version"
+)
+
+// Capabilities returns the engines and modifications compiled into the agent, with their options
+func Capabilities() model.Capabilities {
+	return model.Capabilities{
+		Version:       version.Version.String(),
+		Engines:       engine.Capabilities(),
+		Modifications: modification.Capabilities(),
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/rsa"
 	"runtime"
 	"sync"
+	"time"
 
 	"github.com/sethjback/gobl/agent/job"
 	"github.com/sethjback/gobl/agent/notification"
@@ -31,6 +32,8 @@ var notifier notification.Notifier
 var finish chan string
 var running bool
 var akey *rsa.PrivateKey
+var coordinatorVerifier keys.Verifier
+var state *job.State
 
 // Init configures the manager
 func Init(c *config.Config) error {
@@ -42,7 +45,16 @@ func Init(c *config.Config) error {
 		return err
 	}
 
-	notifier = notification.New(&notification.Config{MaxWorkers: 3, MaxDepth: 6}, akey)
+	ckey, err := keys.OpenPublicKey(conf.Coordinator.PublicKey)
+	if err != nil {
+		return goblerr.New("Unable to open coordinator key", ErrorReadKey, err)
+	}
+	coordinatorVerifier = keys.NewVerifier(ckey)
+
+	notifier, err = notification.New(notificationConfig(conf.Notifications), akey)
+	if err != nil {
+		return err
+	}
 	notifier.Start()
 
 	finish = make(chan string)
@@ -50,9 +62,71 @@ func Init(c *config.Config) error {
 
 	go waiter()
 
+	if conf.Jobs.StatePath != "" {
+		state, err = job.OpenState(conf.Jobs.StatePath)
+		if err != nil {
+			return err
+		}
+		recoverJobs()
+	}
+
 	return nil
 }
 
+// recoverJobs picks up the jobs that were running when the agent last stopped. They are resumed, or
+// reported to the coordinator as failed if resume is off or the job can't be started again
+func recoverJobs() {
+	saved, err := state.Unfinished()
+	if err != nil {
+		log.Errorf("manager", "Unable to read saved jobs: %v", err)
+		return
+	}
+
+	for _, sj := range saved {
+		if sj.Job.Definition == nil {
+			failSaved(sj, "Agent restarted while the job was running and was unable to read the saved job")
+			continue
+		}
+
+		if !conf.Jobs.Resume {
+			failSaved(sj, "Agent restarted while the job was running")
+			continue
+		}
+
+		// without a spool the batches sent before the restart may never have been delivered
+		if conf.Notifications.SpoolPath == "" {
+			failSaved(sj, "Agent restarted while the job was running and can't resume jobs without a notification spool")
+			continue
+		}
+
+		if sj.Abandoned != "" {
+			failSaved(sj, "Agent restarted while the job was running and was unable to resume it: "+sj.Abandoned)
+			continue
+		}
+
+		log.Infof("manager", "Resuming job %s, %d files already sent", sj.Job.ID, len(sj.Progress.Done))
+		sj.Job.Meta = &model.JobMeta{}
+
+		if sj.Job.Definition.Type == model.TypeBackup {
+			err = newBackup(sj.Job, sj.Progress)
+		} else {
+			err = newRestore(sj.Job, sj.Progress)
+		}
+
+		if err != nil {
+			failSaved(sj, "Agent restarted while the job was running and was unable to resume it: "+err.Error())
+		}
+	}
+}
+
+func failSaved(sj job.SavedJob, reason string) {
+	log.Warnf("manager", "Job %s failed: %s", sj.Job.ID, reason)
+	job.ReportFailed(notifier, conf.Coordinator, sj, reason)
+	if err := state.Remove(sj.Job.ID); err != nil {
+		log.Errorf("manager", "Unable to remove saved job %s: %v", sj.Job.ID, err)
+	}
+}
+
 func Shutdown() {
 	stateMutex.Lock()
 	running = false
@@ -60,12 +134,45 @@ func Shutdown() {
 
 	jobMutex.Lock()
 	for _, j := range active {
-		j.Cancel()
+		// with saved state the job is resumed when the agent starts again
+		if state != nil {
+			j.Interrupt()
+		} else {
+			j.Cancel()
+		}
 	}
 	jobMutex.Unlock()
 
 	// will close once all jobs return
 	<-finish
+
+	// anything not yet delivered stays in the spool
+	notifier.Stop()
+}
+
+// notificationConfig returns the notifier config for the agent's notification settings
+func notificationConfig(c config.Notifications) *notification.Config {
+	return &notification.Config{
+		MaxWorkers:       3,
+		MaxDepth:         6,
+		SpoolPath:        c.SpoolPath,
+		SpoolMaxMessages: c.SpoolMaxMessages,
+		SpoolMaxBytes:    c.SpoolMaxBytes,
+		RetryBase:        time.Duration(c.RetryBase) * time.Second,
+		RetryMax:         time.Duration(c.RetryMax) * time.Second,
+		MaxRetries:       c.MaxRetries,
+		MaxAge:           time.Duration(c.MaxAge) * time.Second,
+	}
+}
+
+// DeadLetters returns the notifications the agent gave up sending to the coordinator
+func DeadLetters() ([]notification.SpoolEntry, error) {
+	return notifier.DeadLetters()
+}
+
+// PurgeDeadLetters removes the dead letters, returning how many there were
+func PurgeDeadLetters() (int, error) {
+	return notifier.PurgeDeadLetters()
 }
 
 // Status returns a list of information about the agent
@@ -83,12 +190,20 @@ func Status() map[string]interface{} {
 
 // NewRestore creates and starts a new restore job
 func NewRestore(restoreJob model.Job) error {
+	return newRestore(restoreJob, job.Progress{})
+}
+
+func newRestore(restoreJob model.Job, progress job.Progress) error {
 	r, err := job.NewRestore(restoreJob, conf.Coordinator, notifier)
 	if err != nil {
 		return goblerr.New("Unable to create job", ErrorCreateJob, err)
 	}
+	r.State = state
+	r.Progress = progress
 
-	addJob(restoreJob.ID, r)
+	if err = addJob(restoreJob.ID, r); err != nil {
+		return err
+	}
 	go r.Run(finish)
 
 	return nil
@@ -96,12 +211,20 @@ func NewRestore(restoreJob model.Job) error {
 
 // NewBackup creates a new Job worker and starts
 func NewBackup(backupJob model.Job) error {
+	return newBackup(backupJob, job.Progress{})
+}
+
+func newBackup(backupJob model.Job, progress job.Progress) error {
 	b, err := job.NewBackup(backupJob, conf.Coordinator, notifier)
 	if err != nil {
 		return goblerr.New("Unable to create job", ErrorCreateJob, err)
 	}
+	b.State = state
+	b.Progress = progress
 
-	addJob(backupJob.ID, b)
+	if err = addJob(backupJob.ID, b); err != nil {
+		return err
+	}
 	go b.Run(finish)
 
 	return nil
@@ -144,10 +267,16 @@ func removeJob(id string) {
 	jobMutex.Unlock()
 }
 
-func addJob(id string, job job.Jobber) {
+// addJob fails while a prune is running: the prune could remove the objects the job saves
+func addJob(id string, job job.Jobber) error {
 	jobMutex.Lock()
+	defer jobMutex.Unlock()
+
+	if pruning {
+		return goblerr.New("Unable to create job", ErrorCreateJob, "a prune is running")
+	}
 	active[id] = job
-	jobMutex.Unlock()
+	return nil
 }
 
 func JobStatus(id string) (model.JobMeta, error) {
@@ -182,3 +311,8 @@ func Key() (string, error) {
 
 	return pks, nil
 }
+
+// CoordinatorVerifier returns the verifier for the coordinator's public key
+func CoordinatorVerifier() keys.Verifier {
+	return coordinatorVerifier
+}
@@ -0,0 +1,196 @@
+package manager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sethjback/gobl/engine"
+	"github.com/sethjback/gobl/files"
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/model"
+	"github.com/sethjback/gobl/util/log"
+)
+
+const (
+	ErrorPrune = "PruneFailed"
+	ErrorStats = "StatsFailed"
+)
+
+// pruneSessionAge is how long the references sent ahead of a prune are kept waiting for it
+const pruneSessionAge = time.Hour
+
+type pruneSession struct {
+	created    time.Time
+	referenced []files.Signature
+}
+
+// pruneSessions hold the references sent ahead of each prune, by session
+var pruneSessions = make(map[string]*pruneSession)
+var pruneM sync.Mutex
+
+// pruning is set while a prune runs, so no job can start. Guarded by jobMutex
+var pruning bool
+
+// AddPruneReferences keeps a page of references for the prune request with the same session
+func AddPruneReferences(refs model.PruneReferences) error {
+	if refs.Session == "" {
+		return goblerr.New("Unable to add prune references", ErrorPrune, "session required")
+	}
+
+	pruneM.Lock()
+	defer pruneM.Unlock()
+
+	// sessions a coordinator never finished
+	for id, ps := range pruneSessions {
+		if time.Since(ps.created) > pruneSessionAge {
+			delete(pruneSessions, id)
+		}
+	}
+
+	ps, ok := pruneSessions[refs.Session]
+	if !ok {
+		ps = &pruneSession{created: time.Now()}
+		pruneSessions[refs.Session] = ps
+	}
+	ps.referenced = append(ps.referenced, refs.Referenced...)
+
+	return nil
+}
+
+// Prune removes the objects saved by the requested engines that are not in the referenced list, along with
+// the references sent for its session. Engines that can't list and delete their objects are skipped.
+// It is refused while any job is running, since a running job's objects haven't been reported yet
+func Prune(req model.PruneRequest) ([]model.PruneResult, error) {
+	if req.Session != "" {
+		pruneM.Lock()
+		ps, ok := pruneSessions[req.Session]
+		delete(pruneSessions, req.Session)
+		pruneM.Unlock()
+
+		// without them everything they reference would be removed
+		if !ok {
+			return nil, goblerr.New("Unable to prune", ErrorPrune, "no references sent for session "+req.Session)
+		}
+		req.Referenced = append(ps.referenced, req.Referenced...)
+	}
+
+	jobMutex.Lock()
+	if len(active) > 0 || pruning {
+		jobMutex.Unlock()
+		return nil, goblerr.New("Unable to prune", ErrorPrune, "jobs are running")
+	}
+	pruning = true
+	jobMutex.Unlock()
+
+	defer func() {
+		jobMutex.Lock()
+		pruning = false
+		jobMutex.Unlock()
+	}()
+
+	savers, err := engine.BuildSavers(req.Engines)
+	if err != nil {
+		return nil, goblerr.New("Unable to build engines", ErrorPrune, err)
+	}
+
+	results := make([]model.PruneResult, 0, len(savers))
+	for _, s := range savers {
+		p, ok := s.(engine.Pruner)
+		if !ok {
+			log.Debugf("prune", "%s does not support pruning", s.Name())
+			continue
+		}
+
+		result := model.PruneResult{Engine: s.Name()}
+		if err := prune(p, req, &result); err != nil {
+			log.Errorf("prune", "%s prune failed: %v", s.Name(), err)
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func prune(p engine.Pruner, req model.PruneRequest, result *model.PruneResult) error {
+	keep := make(map[string]bool, len(req.Referenced))
+	for _, sig := range req.Referenced {
+		key, err := p.StoredKey(sig)
+		if err != nil {
+			return err
+		}
+		keep[key] = true
+	}
+
+	stored, err := p.Stored()
+	if err != nil {
+		return err
+	}
+
+	// objects saved within the grace period may belong to a job that started after the references were gathered
+	cutoff := time.Now().Add(-engine.PruneGrace)
+	var removed []string
+	for key, o := range stored {
+		if keep[key] || o.Modified.After(cutoff) {
+			continue
+		}
+
+		result.Objects++
+		result.Bytes += o.Size
+		removed = append(removed, key)
+
+		if req.DryRun {
+			continue
+		}
+
+		if err := p.Delete(key); err != nil {
+			return err
+		}
+		result.Deleted++
+	}
+
+	// the data shared by the removed objects can only go once nothing else uses it
+	if s, ok := p.(engine.Sweeper); ok {
+		objects, bytes, err := s.Sweep(removed, req.DryRun)
+		if err != nil {
+			return err
+		}
+
+		result.Objects += objects
+		result.Bytes += bytes
+		if !req.DryRun {
+			result.Deleted += objects
+		}
+	}
+
+	return nil
+}
+
+// Stats reports on the space used by the requested engines. Engines that can't report are skipped
+func Stats(req model.StatsRequest) ([]model.StatsResult, error) {
+	savers, err := engine.BuildSavers(req.Engines)
+	if err != nil {
+		return nil, goblerr.New("Unable to build engines", ErrorStats, err)
+	}
+
+	results := make([]model.StatsResult, 0, len(savers))
+	for _, s := range savers {
+		st, ok := s.(engine.Statter)
+		if !ok {
+			log.Debugf("stats", "%s does not report stats", s.Name())
+			continue
+		}
+
+		result := model.StatsResult{Engine: s.Name()}
+		stats, err := st.Stats()
+		if err != nil {
+			log.Errorf("stats", "%s stats failed: %v", s.Name(), err)
+			result.Error = err.Error()
+		} else {
+			result.Stats = stats
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
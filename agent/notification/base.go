@@ -2,16 +2,21 @@ package notification
 
 import (
 	"crypto/rsa"
+	"fmt"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/eapache/queue"
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/httpapi"
 	"github.com/sethjback/gobl/keys"
 	"github.com/sethjback/gobl/util/log"
 	"github.com/sethjback/gowork"
 )
 
+const ErrorStopped = "NotifierStopped"
+
 // baseNotifier implements Notifier
 type baseNotifier struct {
 	signingKey *rsa.PrivateKey
@@ -26,6 +31,12 @@ type baseNotifier struct {
 	result     chan *Result
 	stop       bool
 	stopLock   *sync.Mutex
+	// stopc is closed on Stop to wake the queue manager
+	stopc chan struct{}
+	// spool keeps the messages on disk until they are delivered. nil if not configured
+	spool *Spool
+	// dead holds the messages that ran out of retries or were rejected
+	dead *deadLetters
 }
 
 func newBase(config *Config, key *rsa.PrivateKey) *baseNotifier {
@@ -37,10 +48,23 @@ func newBase(config *Config, key *rsa.PrivateKey) *baseNotifier {
 		config = &Config{MaxWorkers: 3, MaxDepth: 20}
 	}
 
+	if config.RetryBase <= 0 {
+		config.RetryBase = DefaultRetryBase
+	}
+	if config.RetryMax <= 0 {
+		config.RetryMax = DefaultRetryMax
+	}
+	if config.MaxRetries <= 0 {
+		config.MaxRetries = DefaultMaxRetries
+	}
+	if config.MaxAge <= 0 {
+		config.MaxAge = DefaultMaxAge
+	}
+
 	n := &baseNotifier{
 		config:     config,
 		signingKey: key,
-		hclient:    &http.Client{},
+		hclient:    httpapi.NewClient(),
 		pending:    queue.New(),
 		retry:      queue.New(),
 		waiter:     &sync.WaitGroup{},
@@ -49,13 +73,29 @@ func newBase(config *Config, key *rsa.PrivateKey) *baseNotifier {
 		send:       make(chan *Message),
 		result:     make(chan *Result),
 		stopLock:   &sync.Mutex{},
+		stopc:      make(chan struct{}),
+		dead:       newDeadLetters(),
 	}
 
 	n.waiter.Add(3)
 	return n
 }
 
+// Start sending notifications, beginning with any left in the spool
 func (n *baseNotifier) Start() {
+	if n.spool != nil {
+		msgs, err := n.spool.messages()
+		if err != nil {
+			log.Errorf("notifier", "Unable to read spooled notifications: %v", err)
+		}
+		if len(msgs) > 0 {
+			log.Infof("notifier", "sending %d spooled notifications", len(msgs))
+		}
+		for _, m := range msgs {
+			n.pending.Add(m)
+		}
+	}
+
 	go n.manageQs()
 	go n.manageResults()
 	go n.manageSender()
@@ -70,21 +110,36 @@ func (n *baseNotifier) Stopped() bool {
 	return s
 }
 
-// Stop the notifier. This will allow pending notifications to finish then flush any queued notifications to disk
+// Stop the notifier. This will allow notifications being sent to finish. Queued notifications are
+// already in the spool, if there is one, and are sent when the notifier next starts
 func (n *baseNotifier) Stop() {
 	n.stopLock.Lock()
-	n.stop = true
+	if !n.stop {
+		n.stop = true
+		close(n.stopc)
+	}
 	n.stopLock.Unlock()
 
-	//todo, wait on the waiter then flush pending and retry queue to disk
 	n.waiter.Wait()
 }
 
-// Send a message.
-func (n *baseNotifier) Send(note Notification) {
-	if !n.Stopped() {
-		n.in <- &Message{retry: 0, note: note}
+// Send a message. With a spool the message is on disk before Send returns
+func (n *baseNotifier) Send(note Notification) error {
+	if n.Stopped() {
+		return goblerr.New("Unable to send notification", ErrorStopped, note.Path())
+	}
+
+	m := &Message{retry: 0, note: note, created: time.Now().UTC()}
+	var err error
+	if n.spool != nil {
+		if err = n.spool.Add(m); err != nil {
+			// it is still sent, it just won't survive a restart
+			log.Errorf("notifier", "Unable to spool notification for %s: %v", note.Path(), err)
+		}
 	}
+	n.in <- m
+
+	return err
 }
 
 // infinite channel queue
@@ -95,14 +150,23 @@ func (n *baseNotifier) manageQs() {
 	// signal we are done
 	defer n.waiter.Done()
 
-	// every 2 minutes check the retry queue
-	t := time.NewTicker(2 * time.Minute)
+	// check the retry queue for messages that are due
+	t := time.NewTicker(retryInterval(n.config.RetryBase))
+	defer t.Stop()
 
 	var next *Message
 	var in, retry, send chan *Message
+	var sendClosed bool
 
 	in = n.in
 	retry = n.rin
+	stopc := n.stopc
+
+	// messages replayed from the spool are already pending
+	if n.pending.Length() > 0 {
+		send = n.send
+		next = n.pending.Peek().(*Message)
+	}
 
 	for in != nil || retry != nil || send != nil {
 		select {
@@ -123,16 +187,20 @@ func (n *baseNotifier) manageQs() {
 		case send <- next:
 			n.pending.Remove()
 
+		case <-stopc:
+			// only needs to wake the loop once
+			stopc = nil
+
 		case <-t.C:
-			//iterate over retry queue, add to pending if appropriate
+			//iterate over retry queue, add to pending if due
+			now := time.Now()
 			clength := n.retry.Length()
 			for i := 0; i < clength; i++ {
 				m := n.retry.Remove().(*Message)
-				if m.retry == 0 {
-					n.pending.Add(m)
-				} else {
-					m.retry--
+				if now.Before(m.next) {
 					n.retry.Add(m)
+				} else {
+					n.pending.Add(m)
 				}
 			}
 
@@ -142,8 +210,9 @@ func (n *baseNotifier) manageQs() {
 			// closing send will start the shut down process:
 			// it will cause the sending queue to stop and drain
 			log.Debug("notifier", "We are stopped")
-			if send != nil {
-				close(send)
+			if !sendClosed {
+				close(n.send)
+				sendClosed = true
 			}
 			send = nil
 			if in != nil {
@@ -173,14 +242,28 @@ func (n *baseNotifier) manageResults() {
 	for r := range n.result {
 		switch r.state {
 		case Retry:
-			if r.message.retry < 5 {
-				r.message.retry++
+			m := r.message
+			m.retry++
+			if m.retry > n.config.MaxRetries {
+				n.deadLetter(m, fmt.Sprintf("gave up after %d retries: %v", n.config.MaxRetries, r.err))
+				continue
+			}
+			if !m.created.IsZero() && time.Since(m.created) > n.config.MaxAge {
+				n.deadLetter(m, fmt.Sprintf("gave up after %s: %v", n.config.MaxAge, r.err))
+				continue
+			}
+
+			m.next = time.Now().Add(backoff(m.retry, n.config.RetryBase, n.config.RetryMax))
+			if n.spool != nil && m.id != "" {
+				if err := n.spool.Update(m); err != nil {
+					log.Errorf("notifier", "Unable to update spooled notification: %v", err)
+				}
 			}
-			n.rin <- r.message
+			n.rin <- m
 		case Fail:
-			log.Errorf("notifier", "Unable send message to: %s || %s", r.message.note.Host()+"/"+r.message.note.Path(), string(r.message.note.Body()))
+			n.deadLetter(r.message, fmt.Sprintf("rejected: %v", r.err))
 		default:
-			//move on
+			n.unspool(r.message)
 		}
 	}
 
@@ -225,3 +308,39 @@ func (n *baseNotifier) manageSender() {
 	log.Debug("notifier", "done done, close results")
 	close(n.result)
 }
+
+// DeadLetters returns the messages the notifier gave up on, oldest first
+func (n *baseNotifier) DeadLetters() ([]SpoolEntry, error) {
+	return n.dead.list()
+}
+
+// PurgeDeadLetters removes the dead letters, returning how many there were
+func (n *baseNotifier) PurgeDeadLetters() (int, error) {
+	return n.dead.purge()
+}
+
+// deadLetter gives up on the message, moving it from the spool to the dead letters
+func (n *baseNotifier) deadLetter(m *Message, reason string) {
+	log.Errorf("notifier", "Unable send message to: %s || %s", m.note.Host()+m.note.Path(), reason)
+	n.dead.add(m, reason)
+	n.unspool(m)
+}
+
+// retryInterval is how often the retry queue is checked: often enough that retries aren't held up
+// much past their backoff
+func retryInterval(base time.Duration) time.Duration {
+	if base > time.Second {
+		return time.Second
+	}
+	return base
+}
+
+// unspool removes the message from the spool once nothing more will be done with it
+func (n *baseNotifier) unspool(m *Message) {
+	if n.spool == nil || m == nil || m.id == "" {
+		return
+	}
+	if err := n.spool.Remove(m.id); err != nil {
+		log.Errorf("notifier", "Unable to remove notification from spool: %v", err)
+	}
+}
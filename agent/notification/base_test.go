@@ -10,6 +10,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/sethjback/gobl/config"
 	"github.com/sethjback/gobl/httpapi"
@@ -22,10 +23,14 @@ type testNotification struct {
 	b []byte
 }
 
-func (ts testNotification) Destination() string {
+func (ts testNotification) Host() string {
 	return ts.d
 }
 
+func (ts testNotification) Path() string {
+	return "/notify"
+}
+
 func (ts testNotification) Body() []byte {
 	return ts.b
 }
@@ -47,9 +52,12 @@ func TestNotificationQueue(t *testing.T) {
 				atomic.AddInt64(&msgCount, 1)
 				w.WriteHeader(200)
 				fmt.Fprintln(w, `{"message":"success"}`)
-			default:
+			case "reject":
 				w.WriteHeader(400)
 				fmt.Fprintln(w, `{"message":"invalid request"}`)
+			default:
+				w.WriteHeader(503)
+				fmt.Fprintln(w, `{"message":"unavailable"}`)
 			}
 		}
 
@@ -112,3 +120,92 @@ func TestNotificationQueue(t *testing.T) {
 	n.Stop()
 	assert.Equal(30, n.retry.Length()+n.pending.Length()+int(msgCount))
 }
+
+func TestNotificationRetries(t *testing.T) {
+	assert := assert.New(t)
+
+	log.Init(config.Log{Level: log.Level.Fatal})
+
+	var attempts int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bdy, err := ioutil.ReadAll(r.Body)
+		assert.Nil(err)
+		r.Body.Close()
+		atomic.AddInt64(&attempts, 1)
+		if string(bdy) == "reject" {
+			w.WriteHeader(400)
+			return
+		}
+		w.WriteHeader(503)
+	}))
+	defer ts.Close()
+
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.Nil(err) {
+		return
+	}
+
+	n := newBase(&Config{MaxWorkers: 3, MaxDepth: 20, RetryBase: 5 * time.Millisecond, RetryMax: 20 * time.Millisecond, MaxRetries: 3}, pk)
+	n.Start()
+
+	// rejected: sent once then dead lettered
+	n.Send(testNotification{d: ts.URL, b: []byte("reject")})
+	// unavailable: sent, retried 3 times, then dead lettered
+	n.Send(testNotification{d: ts.URL, b: []byte("unavailable")})
+
+	var dead []SpoolEntry
+	deadline := time.Now().Add(5 * time.Second)
+	for len(dead) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		dead, err = n.DeadLetters()
+		assert.Nil(err)
+	}
+	n.Stop()
+
+	assert.Equal(int64(5), atomic.LoadInt64(&attempts))
+	if assert.Len(dead, 2) {
+		assert.Equal("reject", string(dead[0].Body))
+		assert.Contains(dead[0].Reason, "rejected")
+		assert.Equal("unavailable", string(dead[1].Body))
+		assert.Contains(dead[1].Reason, "3 retries")
+		assert.Equal(4, dead[1].Retry)
+	}
+
+	count, err := n.PurgeDeadLetters()
+	assert.Nil(err)
+	assert.Equal(2, count)
+	dead, err = n.DeadLetters()
+	assert.Nil(err)
+	assert.Empty(dead)
+
+	// too old to retry
+	n = newBase(&Config{MaxWorkers: 3, MaxDepth: 20, MaxAge: time.Millisecond}, pk)
+	n.Start()
+	n.in <- &Message{note: testNotification{d: ts.URL, b: []byte("unavailable")}, created: time.Now().Add(-time.Hour)}
+
+	deadline = time.Now().Add(5 * time.Second)
+	for len(dead) < 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		dead, _ = n.DeadLetters()
+	}
+	n.Stop()
+
+	if assert.Len(dead, 1) {
+		assert.Contains(dead[0].Reason, "gave up after 1ms")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	for i := 0; i < 100; i++ {
+		d := backoff(1, time.Second, time.Minute)
+		assert.True(d >= 500*time.Millisecond && d <= time.Second, d)
+
+		d = backoff(4, time.Second, time.Minute)
+		assert.True(d >= 4*time.Second && d <= 8*time.Second, d)
+
+		d = backoff(30, time.Second, time.Minute)
+		assert.True(d >= 30*time.Second && d <= time.Minute, d)
+	}
+}
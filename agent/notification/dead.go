@@ -0,0 +1,93 @@
+package notification
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/sethjback/gobl/util/log"
+)
+
+// deadDir is the directory in the spool dead letters are kept in
+const deadDir = "dead"
+
+// deadLetters keeps the messages the notifier gave up on, so they can be inspected.
+// With a spool they are kept on disk, otherwise the most recent are kept in memory
+type deadLetters struct {
+	m       *sync.Mutex
+	spool   *Spool
+	entries []SpoolEntry
+	next    uint64
+}
+
+func newDeadLetters() *deadLetters {
+	return &deadLetters{m: &sync.Mutex{}}
+}
+
+// add the message to the dead letters, recording why it was given up on
+func (d *deadLetters) add(m *Message, reason string) {
+	e := m.entry()
+	e.Reason = reason
+
+	if d.spool != nil {
+		if _, err := d.spool.add(e); err != nil {
+			log.Errorf("notifier", "Unable to keep dead letter for %s: %v", e.Path, err)
+		}
+		return
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	e.ID = fmt.Sprintf("%020d", d.next)
+	d.next++
+	d.entries = append(d.entries, e)
+	if len(d.entries) > DefaultSpoolMaxMessages {
+		d.entries = d.entries[1:]
+	}
+}
+
+func (d *deadLetters) list() ([]SpoolEntry, error) {
+	if d.spool != nil {
+		return d.spool.List()
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	entries := make([]SpoolEntry, len(d.entries))
+	copy(entries, d.entries)
+	return entries, nil
+}
+
+func (d *deadLetters) purge() (int, error) {
+	if d.spool != nil {
+		return d.spool.Purge()
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	n := len(d.entries)
+	d.entries = nil
+	return n, nil
+}
+
+// backoff returns how long to wait before the given retry: the delay doubles each retry up to max,
+// less a random jitter of up to half
+func backoff(retry int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < retry && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	half := int64(d / 2)
+	if half <= 0 {
+		return d
+	}
+	return d - time.Duration(rand.Int63n(half+1))
+}
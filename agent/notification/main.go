@@ -1,6 +1,21 @@
 package notification
 
-import "crypto/rsa"
+import (
+	"crypto/rsa"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// DefaultRetryBase is the delay before the first retry if none is configured
+	DefaultRetryBase = 5 * time.Second
+	// DefaultRetryMax is the longest delay between retries if none is configured
+	DefaultRetryMax = 10 * time.Minute
+	// DefaultMaxRetries is how many times a message is retried if no limit is configured
+	DefaultMaxRetries = 20
+	// DefaultMaxAge is how long a message is retried for if no limit is configured
+	DefaultMaxAge = 24 * time.Hour
+)
 
 // Notification must be implemented on messages passed through the notifier
 type Notification interface {
@@ -14,8 +29,18 @@ type Notification interface {
 
 // Message contians the notification to send and a retry counter for delayed retries
 type Message struct {
+	// id of the message in the spool, if it was spooled
+	id    string
 	retry int
 	note  Notification
+	// created is when the message was first sent, used to enforce MaxAge
+	created time.Time
+	// next is the earliest the message should be retried
+	next time.Time
+}
+
+func (m *Message) entry() SpoolEntry {
+	return SpoolEntry{Host: m.note.Host(), Path: m.note.Path(), Body: m.note.Body(), Retry: m.retry, Created: m.created}
 }
 
 // Config options for the notifier.
@@ -24,15 +49,52 @@ type Config struct {
 	MaxWorkers int
 	// MaxDepth controls how many pending sends/results can be awaiting processing
 	MaxDepth int
+	// SpoolPath is the directory notifications are kept in until they are delivered.
+	// If empty they are only kept in memory, and lost if the agent stops
+	SpoolPath string
+	// SpoolMaxMessages and SpoolMaxBytes limit the size of the spool. 0 uses the defaults
+	SpoolMaxMessages int
+	SpoolMaxBytes    int64
+	// RetryBase is the delay before the first retry. Each retry doubles it, up to RetryMax,
+	// and a random jitter of up to half the delay is taken off so retries don't arrive together
+	RetryBase time.Duration
+	RetryMax  time.Duration
+	// MaxRetries and MaxAge limit how long a message is retried before it is moved to the dead letters
+	MaxRetries int
+	MaxAge     time.Duration
 }
 
 type Notifier interface {
 	Start()
 	Stop()
 	Stopped() bool
-	Send(note Notification)
+	// Send queues the notification. It returns an error if the notification won't survive a restart
+	// because the spool couldn't take it, or won't be sent at all because the notifier is stopped
+	Send(note Notification) error
+	// DeadLetters returns the messages the notifier gave up on, oldest first
+	DeadLetters() ([]SpoolEntry, error)
+	// PurgeDeadLetters removes the dead letters, returning how many there were
+	PurgeDeadLetters() (int, error)
 }
 
-func New(config *Config, key *rsa.PrivateKey) Notifier {
-	return newBase(config, key)
+// New returns a notifier. If the config has a spool path, the spool is opened and any notifications
+// left in it are sent once the notifier starts
+func New(config *Config, key *rsa.PrivateKey) (Notifier, error) {
+	n := newBase(config, key)
+
+	if config != nil && config.SpoolPath != "" {
+		spool, err := OpenSpool(config.SpoolPath, config.SpoolMaxMessages, config.SpoolMaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		n.spool = spool
+
+		dead, err := OpenSpool(filepath.Join(config.SpoolPath, deadDir), config.SpoolMaxMessages, config.SpoolMaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		n.dead.spool = dead
+	}
+
+	return n, nil
 }
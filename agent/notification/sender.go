@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/sethjback/gobl/goblerr"
 	"github.com/sethjback/gobl/httpapi"
 	"github.com/sethjback/gobl/keys"
+	"github.com/sethjback/gobl/util/log"
 )
 
 const (
+	ErrorNotAccepted = "NotificationNotAccepted"
+
 	Retry   = "SenderError"
 	Success = "SenderSuccess"
 	Fail    = "SenderFail"
@@ -36,13 +40,36 @@ func (s *Sender) Do() interface{} {
 		Method:  "POST",
 		Body:    bytes.NewReader(s.message.note.Body()),
 	}
-	fmt.Printf("Sending: %+v\n", req)
+	log.Debugf("sender", "sending to %s%s", req.Host, req.Path)
 
 	resp, err := req.Send(s.signer)
-	if err != nil || resp.HTTPCode != 200 {
-		fmt.Printf("err: %+v\n", resp, err)
+	if err != nil {
+		// network errors are worth retrying
+		log.Debugf("sender", "send to %s%s failed: %v", req.Host, req.Path, err)
 		return &Result{state: Retry, err: err, message: s.message}
 	}
 
-	return &Result{state: Success}
+	return &Result{state: resultState(resp.HTTPCode), err: resultError(resp.HTTPCode), message: s.message}
+}
+
+// resultState sorts the response code: the coordinator rejecting a message (4xx) won't change by
+// sending it again, so it fails, unless it is a timeout or rate limit. Server errors are retried, as is
+// an unauthorized response, which the coordinator gives while it doesn't know the agent's key yet
+func resultState(code int) string {
+	switch {
+	case code >= 200 && code < 300:
+		return Success
+	case code == http.StatusUnauthorized || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests:
+		return Retry
+	case code >= 400 && code < 500:
+		return Fail
+	}
+	return Retry
+}
+
+func resultError(code int) error {
+	if code >= 200 && code < 300 {
+		return nil
+	}
+	return goblerr.New("Notification not accepted", ErrorNotAccepted, fmt.Sprintf("coordinator returned %d", code))
 }
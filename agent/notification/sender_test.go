@@ -9,8 +9,10 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/sethjback/gobl/config"
 	"github.com/sethjback/gobl/httpapi"
 	"github.com/sethjback/gobl/keys"
+	"github.com/sethjback/gobl/util/log"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -19,16 +21,23 @@ type testNote struct {
 	b []byte
 }
 
-func (ts testNote) Destination() string {
+func (ts testNote) Host() string {
 	return ts.d
 }
 
+func (ts testNote) Path() string {
+	return "/notify"
+}
+
 func (ts testNote) Body() []byte {
 	return ts.b
 }
 
 func TestSender(t *testing.T) {
 	assert := assert.New(t)
+
+	log.Init(config.Log{Level: log.Level.Warn})
+
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		bdy, err := ioutil.ReadAll(r.Body)
 		assert.Nil(err)
@@ -39,6 +48,9 @@ func TestSender(t *testing.T) {
 			case "succeed":
 				w.WriteHeader(200)
 				fmt.Fprintln(w, `{"message":"success"}`)
+			case "unavailable":
+				w.WriteHeader(503)
+				fmt.Fprintln(w, `{"message":"unavailable"}`)
 			default:
 				w.WriteHeader(400)
 				fmt.Fprintln(w, `{"message":"invalid request"}`)
@@ -54,7 +66,7 @@ func TestSender(t *testing.T) {
 	}
 
 	s := &Sender{
-		client:  &http.Client{},
+		client:  httpapi.NewClient(),
 		message: &Message{retry: 0, note: testNote{d: ts.URL, b: []byte("succeed")}},
 		signer:  keys.NewSigner(pk),
 	}
@@ -63,9 +75,37 @@ func TestSender(t *testing.T) {
 
 	assert.Equal(Success, r.state)
 
-	s.message = &Message{retry: 0, note: testNote{d: ts.URL, b: []byte("fail")}}
+	s.message = &Message{retry: 0, note: testNote{d: ts.URL, b: []byte("unavailable")}}
 
 	r = s.Do().(*Result)
 	assert.Equal(Retry, r.state)
 	assert.Equal(r.message, s.message)
+	assert.Error(r.err)
+
+	// rejected messages aren't retried
+	s.message = &Message{retry: 0, note: testNote{d: ts.URL, b: []byte("fail")}}
+
+	r = s.Do().(*Result)
+	assert.Equal(Fail, r.state)
+	assert.Equal(r.message, s.message)
+
+	// nothing listening
+	s.message = &Message{retry: 0, note: testNote{d: "http://127.0.0.1:1", b: []byte("succeed")}}
+
+	r = s.Do().(*Result)
+	assert.Equal(Retry, r.state)
+}
+
+func TestResultState(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(Success, resultState(200))
+	assert.Equal(Success, resultState(201))
+	assert.Equal(Fail, resultState(400))
+	assert.Equal(Retry, resultState(401))
+	assert.Equal(Fail, resultState(404))
+	assert.Equal(Retry, resultState(408))
+	assert.Equal(Retry, resultState(429))
+	assert.Equal(Retry, resultState(500))
+	assert.Equal(Retry, resultState(503))
 }
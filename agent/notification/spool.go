@@ -0,0 +1,327 @@
+package notification
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/util/log"
+)
+
+const (
+	ErrorSpoolFull  = "SpoolFull"
+	ErrorSpoolWrite = "SpoolWriteFailed"
+	ErrorSpoolRead  = "SpoolReadFailed"
+
+	// DefaultSpoolMaxMessages is the most notifications a spool keeps if no limit is configured
+	DefaultSpoolMaxMessages = 10000
+	// DefaultSpoolMaxBytes is the most space a spool uses if no limit is configured
+	DefaultSpoolMaxBytes = 256 << 20
+
+	spoolExt = ".json"
+	// badExt is added to the name of spool files that can't be read, which takes them out of the spool
+	badExt = ".bad"
+)
+
+// Spool keeps notifications on disk until they are delivered, so they survive a restart.
+// Each notification is a file in the spool directory, named by a sequence number so they are replayed
+// in the order they were sent. Files are written to a temporary name, synced and renamed into place,
+// and the directory synced, before Add returns: once it has, the notification is on disk
+type Spool struct {
+	m           *sync.Mutex
+	dir         string
+	maxMessages int
+	maxBytes    int64
+	next        uint64
+	sizes       map[string]int64
+	bytes       int64
+}
+
+// SpoolEntry describes a spooled notification
+type SpoolEntry struct {
+	ID      string    `json:"id"`
+	Host    string    `json:"host"`
+	Path    string    `json:"path"`
+	Body    []byte    `json:"body"`
+	Retry   int       `json:"retry"`
+	Created time.Time `json:"created"`
+	// Reason the notifier gave up on the notification, for dead letters
+	Reason string `json:"reason,omitempty"`
+}
+
+// spooledNote is a notification read back from the spool
+type spooledNote struct {
+	host string
+	path string
+	body []byte
+}
+
+func (n *spooledNote) Host() string { return n.host }
+func (n *spooledNote) Path() string { return n.path }
+func (n *spooledNote) Body() []byte { return n.body }
+
+// OpenSpool opens the spool in dir, creating it if needed. Limits of 0 use the defaults
+func OpenSpool(dir string, maxMessages int, maxBytes int64) (*Spool, error) {
+	if maxMessages <= 0 {
+		maxMessages = DefaultSpoolMaxMessages
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultSpoolMaxBytes
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, goblerr.New("Unable to open spool", ErrorSpoolRead, err)
+	}
+
+	s := &Spool{
+		m:           &sync.Mutex{},
+		dir:         dir,
+		maxMessages: maxMessages,
+		maxBytes:    maxBytes,
+		sizes:       make(map[string]int64),
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, goblerr.New("Unable to open spool", ErrorSpoolRead, err)
+	}
+
+	for _, info := range infos {
+		name := info.Name()
+		// left over from a write that didn't finish
+		if strings.HasSuffix(name, ".tmp") {
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+
+		id := strings.TrimSuffix(name, spoolExt)
+		seq, err := strconv.ParseUint(id, 10, 64)
+		if err != nil || id == name || info.IsDir() {
+			continue
+		}
+
+		s.sizes[id] = info.Size()
+		s.bytes += info.Size()
+		if seq >= s.next {
+			s.next = seq + 1
+		}
+	}
+
+	return s, nil
+}
+
+// Add writes the message to the spool and sets its id. It fails if the spool is full
+func (s *Spool) Add(m *Message) error {
+	id, err := s.add(m.entry())
+	if err != nil {
+		return err
+	}
+	m.id = id
+	return nil
+}
+
+func (s *Spool) add(e SpoolEntry) (string, error) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", goblerr.New("Unable to spool notification", ErrorSpoolWrite, err)
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if len(s.sizes) >= s.maxMessages || s.bytes+int64(len(b)) > s.maxBytes {
+		return "", goblerr.New("Unable to spool notification", ErrorSpoolFull,
+			fmt.Sprintf("spool holds %d notifications, %d bytes", len(s.sizes), s.bytes))
+	}
+
+	id := fmt.Sprintf("%020d", s.next)
+	if err = s.write(id, b); err != nil {
+		return "", goblerr.New("Unable to spool notification", ErrorSpoolWrite, err)
+	}
+
+	s.next++
+	s.sizes[id] = int64(len(b))
+	s.bytes += int64(len(b))
+
+	return id, nil
+}
+
+// Update rewrites a spooled message, so its retry count survives a restart
+func (s *Spool) Update(m *Message) error {
+	b, err := json.Marshal(m.entry())
+	if err != nil {
+		return goblerr.New("Unable to update notification", ErrorSpoolWrite, err)
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	size, ok := s.sizes[m.id]
+	if !ok {
+		return nil
+	}
+
+	if err = s.write(m.id, b); err != nil {
+		return goblerr.New("Unable to update notification", ErrorSpoolWrite, err)
+	}
+
+	s.sizes[m.id] = int64(len(b))
+	s.bytes += int64(len(b)) - size
+	return nil
+}
+
+func (s *Spool) write(id string, b []byte) error {
+	path := filepath.Join(s.dir, id+spoolExt)
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(b); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err = os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return syncDir(s.dir)
+}
+
+// syncDir makes a rename or remove in the directory durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Remove deletes the delivered message from the spool. The directory isn't synced: if the removal is
+// lost the notification is sent again, which the coordinator ignores
+func (s *Spool) Remove(id string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	size, ok := s.sizes[id]
+	if !ok {
+		return nil
+	}
+
+	if err := os.Remove(filepath.Join(s.dir, id+spoolExt)); err != nil && !os.IsNotExist(err) {
+		return goblerr.New("Unable to remove notification", ErrorSpoolWrite, err)
+	}
+
+	delete(s.sizes, id)
+	s.bytes -= size
+	return nil
+}
+
+// List returns the spooled notifications, oldest first. A file that can't be read is renamed
+// out of the spool and logged, so it doesn't keep the rest from being replayed
+func (s *Spool) List() ([]SpoolEntry, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	ids := make([]string, 0, len(s.sizes))
+	for id := range s.sizes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	entries := make([]SpoolEntry, 0, len(ids))
+	for _, id := range ids {
+		e, err := s.read(id)
+		if err != nil {
+			log.Errorf("notifier", "Setting aside unreadable spooled notification %s: %v", id, err)
+			s.setAside(id)
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+func (s *Spool) read(id string) (SpoolEntry, error) {
+	var e SpoolEntry
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, id+spoolExt))
+	if err != nil {
+		return e, err
+	}
+
+	if err = json.Unmarshal(b, &e); err != nil {
+		return e, err
+	}
+	e.ID = id
+	return e, nil
+}
+
+// setAside takes the file out of the spool, keeping it under another name so it can be inspected
+func (s *Spool) setAside(id string) {
+	path := filepath.Join(s.dir, id+spoolExt)
+	if err := os.Rename(path, path+badExt); err != nil && !os.IsNotExist(err) {
+		log.Errorf("notifier", "Unable to set aside spooled notification %s: %v", id, err)
+	}
+
+	s.bytes -= s.sizes[id]
+	delete(s.sizes, id)
+}
+
+// messages returns the spooled notifications, oldest first, ready to be sent again
+func (s *Spool) messages() ([]*Message, error) {
+	entries, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make([]*Message, 0, len(entries))
+	for _, e := range entries {
+		msgs = append(msgs, &Message{id: e.ID, retry: e.Retry, created: e.Created, note: &spooledNote{host: e.Host, path: e.Path, body: e.Body}})
+	}
+	return msgs, nil
+}
+
+// Purge removes every spooled notification, returning how many there were
+func (s *Spool) Purge() (int, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	n := 0
+	for id, size := range s.sizes {
+		if err := os.Remove(filepath.Join(s.dir, id+spoolExt)); err != nil && !os.IsNotExist(err) {
+			return n, goblerr.New("Unable to purge spool", ErrorSpoolWrite, err)
+		}
+		delete(s.sizes, id)
+		s.bytes -= size
+		n++
+	}
+
+	return n, syncDir(s.dir)
+}
+
+// Len returns the number of spooled notifications and the space they use
+func (s *Spool) Len() (int, int64) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return len(s.sizes), s.bytes
+}
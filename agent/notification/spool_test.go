@@ -0,0 +1,199 @@
+package notification
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sethjback/gobl/config"
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/util/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpool(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "gobl-spool")
+	if !assert.Nil(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := OpenSpool(dir, 3, 0)
+	if !assert.Nil(err) {
+		return
+	}
+
+	for i := 0; i < 3; i++ {
+		m := &Message{note: testNote{d: "http://coordinator", b: []byte(fmt.Sprintf("note %d", i))}}
+		if !assert.Nil(s.Add(m)) {
+			return
+		}
+		assert.NotEmpty(m.id)
+	}
+
+	err = s.Add(&Message{note: testNote{d: "http://coordinator", b: []byte("too many")}})
+	if assert.Error(err) {
+		assert.Equal(ErrorSpoolFull, err.(*goblerr.Error).Code)
+	}
+
+	// a write that never finished is cleaned up
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, "00000000000000000009.json.tmp"), []byte("{"), 0600))
+
+	s, err = OpenSpool(dir, 0, 0)
+	if !assert.Nil(err) {
+		return
+	}
+
+	entries, err := s.List()
+	if assert.Nil(err) && assert.Len(entries, 3) {
+		for i, e := range entries {
+			assert.Equal("http://coordinator", e.Host)
+			assert.Equal("/notify", e.Path)
+			assert.Equal(fmt.Sprintf("note %d", i), string(e.Body))
+		}
+
+		assert.Nil(s.Remove(entries[0].ID))
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "00000000000000000009.json.tmp"))
+	assert.True(os.IsNotExist(err))
+
+	m := &Message{note: testNote{d: "http://coordinator", b: []byte("note 3")}}
+	assert.Nil(s.Add(m))
+	assert.Equal("00000000000000000003", m.id)
+
+	// a file that can't be read is set aside, the rest are still replayed
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, "00000000000000000002.json"), []byte("{"), 0600))
+
+	msgs, err := s.messages()
+	if assert.Nil(err) && assert.Len(msgs, 2) {
+		assert.Equal("note 1", string(msgs[0].note.Body()))
+		assert.Equal("note 3", string(msgs[1].note.Body()))
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "00000000000000000002.json.bad"))
+	assert.Nil(err)
+
+	n, err := s.Purge()
+	assert.Nil(err)
+	assert.Equal(2, n)
+
+	count, size := s.Len()
+	assert.Equal(0, count)
+	assert.Equal(int64(0), size)
+
+	s, err = OpenSpool(dir, 0, 10)
+	if assert.Nil(err) {
+		err = s.Add(&Message{note: testNote{d: "http://coordinator", b: []byte("bigger than the spool")}})
+		if assert.Error(err) {
+			assert.Equal(ErrorSpoolFull, err.(*goblerr.Error).Code)
+		}
+	}
+}
+
+func TestSpoolReplay(t *testing.T) {
+	assert := assert.New(t)
+
+	log.Init(config.Log{Level: log.Level.Warn})
+
+	dir, err := ioutil.TempDir("", "gobl-spool")
+	if !assert.Nil(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	var up int32
+	var received int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body.Close()
+		if atomic.LoadInt32(&up) == 0 {
+			w.WriteHeader(503)
+			return
+		}
+		atomic.AddInt64(&received, 1)
+		w.WriteHeader(200)
+		fmt.Fprintln(w, `{"message":"success"}`)
+	}))
+	defer ts.Close()
+
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.Nil(err) {
+		return
+	}
+
+	conf := &Config{MaxWorkers: 3, MaxDepth: 20, SpoolPath: dir}
+
+	// the coordinator is down: everything stays in the spool
+	n, err := New(conf, pk)
+	if !assert.Nil(err) {
+		return
+	}
+	n.Start()
+	for i := 0; i < 5; i++ {
+		n.Send(testNotification{d: ts.URL, b: []byte("succeed")})
+	}
+	n.Stop()
+
+	s, err := OpenSpool(dir, 0, 0)
+	if !assert.Nil(err) {
+		return
+	}
+	count, _ := s.Len()
+	assert.Equal(5, count)
+
+	// the coordinator is back: the restarted notifier delivers and empties the spool
+	atomic.StoreInt32(&up, 1)
+	n, err = New(conf, pk)
+	if !assert.Nil(err) {
+		return
+	}
+	n.Start()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&received) < 5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	n.Stop()
+
+	assert.Equal(int64(5), atomic.LoadInt64(&received))
+	count, _ = n.(*baseNotifier).spool.Len()
+	assert.Equal(0, count)
+
+	// dead letters are kept in the spool too
+	atomic.StoreInt32(&up, 0)
+	n, err = New(&Config{MaxWorkers: 3, MaxDepth: 20, SpoolPath: dir, MaxRetries: 1, RetryBase: time.Millisecond}, pk)
+	if !assert.Nil(err) {
+		return
+	}
+	n.Start()
+	n.Send(testNotification{d: ts.URL, b: []byte("succeed")})
+
+	var dead []SpoolEntry
+	deadline = time.Now().Add(5 * time.Second)
+	for len(dead) < 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		dead, _ = n.DeadLetters()
+	}
+	n.Stop()
+
+	s, err = OpenSpool(filepath.Join(dir, deadDir), 0, 0)
+	if assert.Nil(err) {
+		dead, err = s.List()
+		assert.Nil(err)
+		if assert.Len(dead, 1) {
+			assert.Contains(dead[0].Reason, "gave up after 1 retries")
+		}
+	}
+	count, _ = n.(*baseNotifier).spool.Len()
+	assert.Equal(0, count)
+}
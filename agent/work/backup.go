@@ -19,13 +19,42 @@ type Backup struct {
 	File          string
 	Modifications []modification.Definition
 	Engines       []engine.Definition
+	// Xattrs indicates extended attributes should be captured with the file metadata
+	Xattrs bool
 }
 
 // The Work interface from the worker package
 func (b Backup) Do() interface{} {
 	jf := model.JobFile{}
+	jf.File.Signature = files.Signature{Path: b.File}
 
-	jf.File.Signature = files.NewSignature(b.File, b.Modifications)
+	// before anything reads the file, which would change its access time
+	meta, err := files.MetaFromPath(b.File, b.Xattrs)
+	if err != nil {
+		log.Infof("backupWork", "(%s) metadata failed: %s", b.File, err)
+		jf.Error = goblerr.New("unable to read file metadata", ErrorFileOps, err).Error()
+		jf.State = StateErrors
+		return jf
+	}
+	jf.File.Meta = meta
+
+	header, err := readHeader(b.File)
+	if err != nil {
+		log.Infof("backupWork", "(%s) read failed: %s", b.File, err)
+		jf.Error = goblerr.New("unable to read file", ErrorFileOps, err).Error()
+		jf.State = StateErrors
+		return jf
+	}
+
+	// what some modifications do depends on the file, and the signature records what was actually done
+	modDefs, err := modification.ForFile(b.Modifications, b.File, header)
+	if err != nil {
+		jf.Error = goblerr.New("unable to resolve modifications", ErrorModifications, err).Error()
+		jf.State = StateErrors
+		return jf
+	}
+
+	jf.File.Signature = files.NewSignature(b.File, modDefs)
 
 	imoHash := imohash.NewCustom(24*1024, 3*1024*1024)
 	fileHash, err := imoHash.SumFile(b.File)
@@ -68,7 +97,7 @@ func (b Backup) Do() interface{} {
 	}
 	defer fileHandle.Close()
 
-	mods, err := modification.Build(b.Modifications, modification.Forward)
+	mods, err := modification.Build(modDefs, modification.Forward)
 	if err != nil {
 		jf.Error = goblerr.New("unable bulid modifications", ErrorModifications, err).Error()
 		jf.State = StateErrors
@@ -81,10 +110,13 @@ func (b Backup) Do() interface{} {
 
 	go func() {
 		_, err := io.Copy(eng, pipe.Tail)
+		if err == nil {
+			// the file isn't saved until every engine is done with it
+			err = eng.Finish()
+		}
 		if err != nil {
 			pipe.Erroc <- err
 		} else {
-			eng.Finish()
 			done <- struct{}{}
 		}
 	}()
@@ -100,3 +132,20 @@ func (b Backup) Do() interface{} {
 
 	return jf
 }
+
+// readHeader returns the first bytes of the file, enough to recognize its format
+func readHeader(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+
+	return header[:n], nil
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -86,4 +87,23 @@ func TestBackup(t *testing.T) {
 	}
 
 	os.Remove("btest.log")
+
+	// the metadata is from before the backup read the file
+	dir, err := ioutil.TempDir("", "gobl-backup")
+	if !assert.Nil(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "file")
+	old := time.Now().Add(-72 * time.Hour).Truncate(time.Second)
+	assert.Nil(ioutil.WriteFile(path, data, 0600))
+	assert.Nil(os.Chtimes(path, old, old))
+
+	b.File = path
+	b.Engines[0].Options[engine.LoggerOptionLogPath] = filepath.Join(dir, "btest.log")
+	jf, ok := b.Do().(model.JobFile)
+	if assert.True(ok) && assert.Equal(StateComplete, jf.State) {
+		assert.True(old.Equal(jf.File.Meta.AccessTime), jf.File.Meta.AccessTime)
+	}
 }
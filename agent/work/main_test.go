@@ -39,12 +39,12 @@ func (t *TestEngine) Save(input io.Reader, file files.File, errc chan<- error) {
 		return
 	}
 }
-func (t *TestEngine) Retrieve(file files.File) (io.Reader, error) {
+func (t *TestEngine) Retrieve(file files.File) (io.ReadCloser, error) {
 	if file.Path == "fail" || t.restore == nil {
 		return nil, errors.New("fail")
 	}
 
-	return bytes.NewReader(t.restore), nil
+	return ioutil.NopCloser(bytes.NewReader(t.restore)), nil
 }
 func (t *TestEngine) ShouldSave(file files.File) (bool, error) {
 	if file.Path == "failShouldSave" {
@@ -39,6 +39,7 @@ func (r Restore) Do() interface{} {
 		jf.Error = goblerr.New("unable to get from reader", ErrorRestoreEngines, err).Error()
 		return jf
 	}
+	defer reader.Close()
 
 	rers, err := engine.BuildRestorers(r.To)
 	if err != nil {
@@ -56,7 +57,8 @@ func (r Restore) Do() interface{} {
 		return jf
 	}
 
-	mods, err := modification.Build(r.Modifications, modification.Backward)
+	// each file is decoded the way its signature says it was stored
+	mods, err := modification.Build(modification.FromSignature(r.Modifications, r.File.Signature.Modifications), modification.Backward)
 	if err != nil {
 		jf.Error = goblerr.New("unable to build to modification pipeline", ErrorModifications, err).Error()
 		jf.State = StateErrors
@@ -69,10 +71,13 @@ func (r Restore) Do() interface{} {
 
 	go func() {
 		_, err := io.Copy(eng, pipe.Tail)
+		if err == nil {
+			// the file isn't restored until every engine is done with it
+			err = eng.Finish()
+		}
 		if err != nil {
 			pipe.Erroc <- err
 		} else {
-			eng.Finish()
 			done <- struct{}{}
 		}
 	}()
@@ -4,64 +4,128 @@ import (
 	"bytes"
 	"crypto/rand"
 	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
+	"fmt"
+	"strings"
 
 	"github.com/sethjback/gobl/goblerr"
+	"golang.org/x/crypto/argon2"
 )
 
 const (
 	ErrorPasswordHash = "PasswordHashFailed"
 )
 
-const saltLength = 4
+// argon2id parameters for new hashes. Existing hashes are verified with the parameters encoded in them
+const (
+	argonPrefix  = "$argon2id$"
+	argonMemory  = 64 * 1024
+	argonTime    = 3
+	argonThreads = 2
+	argonSaltLen = 16
+	argonKeyLen  = 32
+)
+
+// legacySaltLength is the length of the hex salt on the front of the old sha1 hashes
+const legacySaltLength = 4
+
+// PasswordHash hashes the password with argon2id and a random salt.
+// The result is self describing, in the form $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+// The function will only error if the install's secure random generator is not working
+func PasswordHash(password []byte) ([]byte, error) {
+	salt := make([]byte, argonSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, goblerr.New("Unable to generate password hash", ErrorPasswordHash, err)
+	}
+
+	key := argon2.IDKey(password, salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+	return []byte(fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argonPrefix, argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))), nil
+}
 
-// generateSalt generates a secure random hex encoded salt
-func generateSalt() ([]byte, error) {
-	b := make([]byte, saltLength/2)
-	_, err := rand.Read(b)
+// CheckPassword checks the provided password against the stored hash.
+// Both argon2id hashes and the legacy salted sha1 hashes are supported
+func CheckPassword(saved []byte, check []byte) bool {
+	if !bytes.HasPrefix(saved, []byte(argonPrefix)) {
+		return checkLegacyPassword(saved, check)
+	}
+
+	p, salt, key, err := decodeArgonHash(string(saved))
 	if err != nil {
-		return nil, err
+		return false
 	}
 
-	salt := make([]byte, hex.EncodedLen(len(b)))
+	computed := argon2.IDKey(check, salt, p.time, p.memory, p.threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, computed) == 1
+}
+
+// NeedsRehash is true if the stored hash is a legacy hash, or was made with different parameters than
+// new hashes are. It should be rehashed the next time the password is known to be correct
+func NeedsRehash(saved []byte) bool {
+	p, salt, key, err := decodeArgonHash(string(saved))
+	if err != nil {
+		return true
+	}
 
-	hex.Encode(salt, b)
+	return p != (argonParams{argonMemory, argonTime, argonThreads}) || len(salt) != argonSaltLen || len(key) != argonKeyLen
+}
 
-	return salt, nil
+type argonParams struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+func decodeArgonHash(encoded string) (argonParams, []byte, []byte, error) {
+	var p argonParams
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, goblerr.New("Invalid password hash", ErrorPasswordHash, "not an argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, goblerr.New("Invalid password hash", ErrorPasswordHash, "unsupported argon2 version")
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, nil, nil, goblerr.New("Invalid password hash", ErrorPasswordHash, err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, goblerr.New("Invalid password hash", ErrorPasswordHash, err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, goblerr.New("Invalid password hash", ErrorPasswordHash, "hash is empty or invalid")
+	}
+
+	return p, salt, key, nil
 }
 
 // createSaltedHash takes the random salt and the provided password and generates a hex encoded sha1 sum of the combined values
-// The returned []byte contans the salt followed by the sha1 sum
+// The returned []byte contans the salt followed by the sha1 sum. Only used to check legacy hashes
 func createSaltedHash(salt []byte, password []byte) []byte {
 	password = append(salt, password...)
-
 	sha1Sum := sha1.Sum(password)
-
 	hash := make([]byte, hex.EncodedLen(len(sha1Sum)))
 	hex.Encode(hash, sha1Sum[:])
-
 	return append(salt, hash[:]...)
 }
 
-// PasswordHash generates a hex encoded sha1 hash of the password with crypt/rand salt
-// The returned []byte contans the salt followed by the sha1 sum
-// The function will only error if the install's secure random generator is not working
-func PasswordHash(password []byte) ([]byte, error) {
-	salt, err := generateSalt()
-	if err != nil {
-		return nil, goblerr.New("Unable to generate password hash", ErrorPasswordHash, err)
+// checkLegacyPassword checks the password against a salted sha1 hash.
+// It extracts the salt from the front of the stored value, then adds it to the password and re-computes the hash
+func checkLegacyPassword(saved []byte, check []byte) bool {
+	if len(saved) != legacySaltLength+hex.EncodedLen(sha1.Size) {
+		return false
 	}
 
-	return createSaltedHash(salt, password), nil
-}
-
-// CheckPassword checks the provided password against the stored password
-// It extracts the salt from the front of the stored value, then adds it to the password and re-computes the hash
-func CheckPassword(saved []byte, check []byte) bool {
-	salt := make([]byte, saltLength)
+	salt := make([]byte, legacySaltLength)
 	copy(salt, saved)
-
 	hash := createSaltedHash(salt, check)
-
-	return bytes.Equal(saved, hash)
+	return subtle.ConstantTimeCompare(saved, hash) == 1
 }
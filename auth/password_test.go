@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/argon2"
+)
+
+func TestPassword(t *testing.T) {
+	assert := assert.New(t)
+
+	h, err := PasswordHash([]byte("correct horse"))
+	if !assert.Nil(err) {
+		return
+	}
+	assert.True(strings.HasPrefix(string(h), "$argon2id$v=19$m=65536,t=3,p=2$"))
+
+	assert.True(CheckPassword(h, []byte("correct horse")))
+	assert.False(CheckPassword(h, []byte("wrong horse")))
+	assert.False(NeedsRehash(h))
+
+	h2, err := PasswordHash([]byte("correct horse"))
+	assert.Nil(err)
+	assert.NotEqual(h, h2)
+
+	// hashes made with other parameters still verify, but should be upgraded
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte("correct horse"), salt, 1, 1024, 1, 32)
+	weaker := []byte("$argon2id$v=19$m=1024,t=1,p=1$" + base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(key))
+	assert.True(CheckPassword(weaker, []byte("correct horse")))
+	assert.True(NeedsRehash(weaker))
+
+	// parameters are part of the hash
+	tampered := strings.Replace(string(h), "t=3", "t=1", 1)
+	assert.False(CheckPassword([]byte(tampered), []byte("correct horse")))
+
+	assert.False(CheckPassword([]byte("$argon2id$garbage"), []byte("correct horse")))
+	assert.False(CheckPassword(nil, []byte("")))
+}
+
+func TestLegacyPassword(t *testing.T) {
+	assert := assert.New(t)
+
+	legacy := createSaltedHash([]byte("a1b2"), []byte("admin password"))
+	assert.True(CheckPassword(legacy, []byte("admin password")))
+	assert.False(CheckPassword(legacy, []byte("admin")))
+	assert.True(NeedsRehash(legacy))
+
+	assert.False(CheckPassword(legacy[:10], []byte("admin password")))
+}
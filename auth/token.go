@@ -97,7 +97,7 @@ func (t *Token) Parse(in string) error {
 		return goblerr.New("Token invalid", ErrorJWTTokenFormat, err)
 	}
 
-	if t.header.Algorithm != AlgHS256 || t.header.Algorithm != TypeJWT {
+	if t.header.Algorithm != AlgHS256 || t.header.TokenType != TypeJWT {
 		return goblerr.New("Token invalid", ErrorJWTALGInvalid, nil)
 	}
 
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToken(t *testing.T) {
+	assert := assert.New(t)
+
+	tok := NewToken([]byte("secret"), 60)
+	tok.Claims.Subject = "admin"
+	s, err := tok.Generate()
+	if !assert.Nil(err) {
+		return
+	}
+
+	p := NewToken([]byte("secret"), 0)
+	if assert.Nil(p.Parse(s)) {
+		assert.Equal("admin", p.Claims.Subject)
+	}
+
+	assert.NotNil(NewToken([]byte("other"), 0).Parse(s))
+	assert.NotNil(p.Parse(s[:len(s)-2]))
+	assert.NotNil(p.Parse("not.a.token"))
+
+	expired := NewToken([]byte("secret"), -10)
+	s, err = expired.Generate()
+	assert.Nil(err)
+	assert.NotNil(p.Parse(s))
+}
@@ -14,6 +14,13 @@ type Config struct {
 	Log         Log         `toml:"logging"`
 	Email       Email       `toml:"email"`
 	Coordinator Coordinator `toml:"coordinator"`
+	Auth        Auth        `toml:"auth"`
+	// Notifications is used by agents
+	Notifications Notifications `toml:"notifications"`
+	// Jobs is used by agents
+	Jobs Jobs `toml:"jobs"`
+	// Reconcile is used by the coordinator
+	Reconcile Reconcile `toml:"reconcile"`
 }
 
 // Server config
@@ -43,13 +50,75 @@ type Coordinator struct {
 	Address string `toml:"address"`
 }
 
+// Auth config.
+// Controls the tokens the coordinator issues to users
+type Auth struct {
+	// TokenSecret is the key tokens are signed with. If empty a random secret is generated
+	// at startup, and tokens will not survive a restart
+	TokenSecret string `toml:"token_secret"`
+
+	// TokenLifetime is the number of seconds an issued token is valid for
+	TokenLifetime int `toml:"token_lifetime"`
+}
+
+// Notifications config.
+// Controls how agents keep the notifications they send to the coordinator
+type Notifications struct {
+	// SpoolPath is the directory notifications are kept in until the coordinator receives them,
+	// so they survive a restart. If empty they are only kept in memory
+	SpoolPath string `toml:"spool_path"`
+
+	// SpoolMaxMessages is the most notifications the spool will hold. 0 uses the default (10000)
+	SpoolMaxMessages int `toml:"spool_max_messages"`
+
+	// SpoolMaxBytes is the most space the spool will use. 0 uses the default (256MB)
+	SpoolMaxBytes int64 `toml:"spool_max_bytes"`
+
+	// RetryBase is the number of seconds before a failed notification is first retried.
+	// The delay doubles with each retry, up to RetryMax seconds. 0 uses the defaults (5 and 600)
+	RetryBase int `toml:"retry_base"`
+	RetryMax  int `toml:"retry_max"`
+
+	// MaxRetries is how many times a notification is retried before it is moved to the dead letters.
+	// 0 uses the default (20)
+	MaxRetries int `toml:"max_retries"`
+
+	// MaxAge is the number of seconds a notification is retried for before it is moved to the dead letters.
+	// 0 uses the default (one day)
+	MaxAge int `toml:"max_age"`
+}
+
+// Jobs config.
+// Controls what agents do with the jobs they were running when they stopped
+type Jobs struct {
+	// StatePath is the directory running jobs and their progress are kept in. If empty jobs are only kept
+	// in memory, and lost if the agent stops
+	StatePath string `toml:"state_path"`
+
+	// Resume the jobs that were running when the agent stopped, skipping the files already sent to the
+	// coordinator. If false, or there is no notification spool, they are reported to the coordinator as failed
+	Resume bool `toml:"resume"`
+}
+
+// Reconcile config.
+// Controls how the coordinator checks its running jobs against the agents running them
+type Reconcile struct {
+	// Interval is the number of seconds between checks. 0 uses the default (60), less than 0 turns them off
+	Interval int `toml:"interval"`
+
+	// OrphanTimeout is the number of seconds a job can be missing from its agent, without any file batches
+	// arriving, before it is marked failed. 0 uses the default (1800). Keep it well above the agents'
+	// notification retry_max, or a job whose batches are being retried can be failed while they are on the way
+	OrphanTimeout int `toml:"orphan_timeout"`
+}
+
 // DB Config
 type DB struct {
 	// Path to the database file
 	Path string `toml:"path"`
 
 	// Driver
-	// Currently only leveldb is supported.
+	// Either leveldb (the default) or sqlite
 	Driver string `toml:"driver"`
 }
 
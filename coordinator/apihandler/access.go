@@ -0,0 +1,96 @@
+package apihandler
+
+import (
+	"errors"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/sethjback/gobl/coordinator/manager"
+	"github.com/sethjback/gobl/httpapi"
+	"github.com/sethjback/gobl/model"
+)
+
+// what the :id route parameter refers to when checking a user's agent groups
+const (
+	scopeNone = iota
+	scopeAgent
+	scopeJob
+)
+
+var errForbidden = errors.New("Permission denied")
+
+// allow only runs the handler for users whose role grants the permission.
+// For scoped routes the agent, or the job's agent, in the :id parameter must also be in one of the user's groups
+func allow(permission string, scope int, handler httpapi.RouteHandler) httpapi.RouteHandler {
+	return func(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
+		u, err := manager.Authorize(r.User, permission)
+		if err != nil {
+			return httpapi.Response{Error: errForbidden, HTTPCode: 403}
+		}
+
+		var agent *model.Agent
+		switch scope {
+		case scopeAgent:
+			agent, err = manager.GetAgent(ps.ByName("id"))
+		case scopeJob:
+			var job *model.Job
+			if job, err = manager.GetJob(ps.ByName("id")); err == nil {
+				agent = job.Agent
+			}
+		}
+
+		if err != nil {
+			return httpapi.Response{Error: err, HTTPCode: 400}
+		}
+
+		if agent != nil && !u.CanAccess(*agent) {
+			return httpapi.Response{Error: errForbidden, HTTPCode: 403}
+		}
+
+		return handler(r, ps)
+	}
+}
+
+// canAccessAgent checks the request's user can access the agent
+func canAccessAgent(r *httpapi.Request, agentID string) bool {
+	u, err := manager.GetUser(r.User)
+	if err != nil {
+		return false
+	}
+
+	if len(u.Groups) == 0 {
+		return true
+	}
+
+	agent, err := manager.GetAgent(agentID)
+	if err != nil {
+		return false
+	}
+
+	return u.CanAccess(*agent)
+}
+
+// agentFilter returns a function reporting whether the request's user can access an agent.
+// It loads the agents once so lists can be filtered without a lookup per entry
+func agentFilter(r *httpapi.Request) (func(agentID string) bool, error) {
+	u, err := manager.GetUser(r.User)
+	if err != nil {
+		return nil, err
+	}
+
+	agents, err := manager.GetAgents()
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make(map[string]bool)
+	for _, a := range agents {
+		allowed[a.ID] = u.CanAccess(a)
+	}
+
+	return func(agentID string) bool {
+		if len(u.Groups) == 0 {
+			return true
+		}
+		return allowed[agentID]
+	}, nil
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sethjback/gobl/coordinator/manager"
+	"github.com/sethjback/gobl/engine"
 	"github.com/sethjback/gobl/httpapi"
 	"github.com/sethjback/gobl/model"
 )
@@ -12,6 +13,8 @@ type UpdateAgentRequest struct {
 	Name      string `json:"name"`
 	Address   string `json:"address"`
 	UpdateKey bool   `json:"updateKey"`
+	// Groups replaces the agent's groups if set
+	Groups *[]string `json:"groups"`
 }
 
 func agentList(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
@@ -20,7 +23,19 @@ func agentList(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
 		return httpapi.Response{Error: err, HTTPCode: 400}
 	}
 
-	return httpapi.Response{Data: map[string]interface{}{"agents": list}, HTTPCode: 200}
+	u, err := manager.GetUser(r.User)
+	if err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	visible := make([]model.Agent, 0, len(list))
+	for _, a := range list {
+		if u.CanAccess(a) {
+			visible = append(visible, a)
+		}
+	}
+
+	return httpapi.Response{Data: map[string]interface{}{"agents": visible}, HTTPCode: 200}
 }
 
 func addAgent(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
@@ -30,6 +45,11 @@ func addAgent(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
 		return httpapi.Response{Error: err, HTTPCode: 400}
 	}
 
+	// users limited to groups can only add agents they will be able to access
+	if u, err := manager.GetUser(r.User); err != nil || !u.CanAccess(a) {
+		return httpapi.Response{Error: errForbidden, HTTPCode: 403}
+	}
+
 	id, e := manager.AddAgent(a)
 	if e != nil {
 		return httpapi.Response{Error: e, HTTPCode: 400}
@@ -56,6 +76,22 @@ func getAgent(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
 	return httpapi.Response{Data: map[string]interface{}{"agent": agent}, HTTPCode: 200}
 }
 
+func deleteAgent(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
+	id := ps.ByName("id")
+
+	_, e := uuid.Parse(id)
+	if e != nil {
+		return httpapi.Response{Error: e, HTTPCode: 400}
+	}
+
+	err := manager.DeleteAgent(id, r.Query.Get("force") == "true", r.Query.Get("purgeJobs") == "true")
+	if err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	return httpapi.Response{HTTPCode: 200}
+}
+
 func agentStatus(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
 	id := ps.ByName("id")
 
@@ -72,6 +108,22 @@ func agentStatus(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
 	return httpapi.Response{Data: map[string]interface{}{"status": status}, HTTPCode: 200}
 }
 
+func agentCapabilities(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
+	id := ps.ByName("id")
+
+	_, e := uuid.Parse(id)
+	if e != nil {
+		return httpapi.Response{Error: e, HTTPCode: 400}
+	}
+
+	caps, err := manager.GetAgentCapabilities(id)
+	if err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	return httpapi.Response{Data: map[string]interface{}{"capabilities": caps}, HTTPCode: 200}
+}
+
 func updateAgent(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
 	id := ps.ByName("id")
 
@@ -86,9 +138,80 @@ func updateAgent(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
 		return httpapi.Response{Error: err, HTTPCode: 400}
 	}
 
-	if err := manager.UpdateAgent(model.Agent{Name: ar.Name, Address: ar.Address, ID: id}, ar.UpdateKey); err != nil {
+	agent := model.Agent{Name: ar.Name, Address: ar.Address, ID: id}
+	if ar.Groups != nil {
+		// users limited to groups can't move agents between groups
+		if u, err := manager.GetUser(r.User); err != nil || len(u.Groups) != 0 {
+			return httpapi.Response{Error: errForbidden, HTTPCode: 403}
+		}
+		agent.Groups = *ar.Groups
+	} else {
+		current, err := manager.GetAgent(id)
+		if err != nil {
+			return httpapi.Response{Error: err, HTTPCode: 400}
+		}
+		agent.Groups = current.Groups
+	}
+
+	if err := manager.UpdateAgent(agent, ar.UpdateKey); err != nil {
 		return httpapi.Response{Error: err, HTTPCode: 400}
 	}
 
 	return httpapi.Response{HTTPCode: 200}
 }
+
+type PruneRequest struct {
+	Engines []engine.Definition `json:"engines"`
+	DryRun  bool                `json:"dryRun"`
+}
+
+// StatsRequest optionally limits the stats to the given engines
+type StatsRequest struct {
+	Engines []engine.Definition `json:"engines"`
+}
+
+func pruneAgent(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
+	id := ps.ByName("id")
+
+	_, e := uuid.Parse(id)
+	if e != nil {
+		return httpapi.Response{Error: e, HTTPCode: 400}
+	}
+
+	var pr PruneRequest
+	if r.Body != nil {
+		if err := r.JsonBody(&pr); err != nil {
+			return httpapi.Response{Error: err, HTTPCode: 400}
+		}
+	}
+
+	results, err := manager.Prune(id, pr.Engines, pr.DryRun)
+	if err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	return httpapi.Response{Data: map[string]interface{}{"results": results}, HTTPCode: 200}
+}
+
+func agentStats(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
+	id := ps.ByName("id")
+
+	_, e := uuid.Parse(id)
+	if e != nil {
+		return httpapi.Response{Error: e, HTTPCode: 400}
+	}
+
+	var sr StatsRequest
+	if r.Body != nil {
+		if err := r.JsonBody(&sr); err != nil {
+			return httpapi.Response{Error: err, HTTPCode: 400}
+		}
+	}
+
+	results, err := manager.Stats(id, sr.Engines)
+	if err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	return httpapi.Response{Data: map[string]interface{}{"results": results}, HTTPCode: 200}
+}
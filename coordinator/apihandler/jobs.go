@@ -13,10 +13,17 @@ import (
 type JobRequest struct {
 	Definition model.JobDefinition `json:"jobDefinition"`
 	Agent      string              `json:"agentId"`
+	// Job is the backup job a restore is restored from. Users who can't manage jobs must give it
+	Job string `json:"jobId,omitempty"`
 }
 
 func jobList(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
-	jobs, err := manager.JobList(queryToMap(r.Query))
+	allowed, err := agentFilter(r)
+	if err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	jobs, err := manager.VisibleJobList(queryToMap(r.Query), allowed)
 	if err != nil {
 		return httpapi.Response{Error: err, HTTPCode: 400}
 	}
@@ -67,12 +74,21 @@ func jobDirectories(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
 }
 
 func cancelJob(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
-	return httpapi.Response{Error: errors.New("Unimplemented"), HTTPCode: 400}
+	id, err := uuid.Parse(ps.ByName("id"))
+	if err != nil {
+		return httpapi.Response{Error: errors.New("Invalid job id"), HTTPCode: 400}
+	}
+
+	if err = manager.CancelJob(id.String()); err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	return httpapi.Response{HTTPCode: 200}
 }
 
-func addJobFile(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
-	var jf model.JobFile
-	gerr := r.JsonBody(&jf)
+func addJobFiles(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
+	var batch model.FileBatch
+	gerr := r.JsonBody(&batch)
 	if gerr != nil {
 		return httpapi.Response{Error: gerr, HTTPCode: 400}
 	}
@@ -82,8 +98,8 @@ func addJobFile(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
 		return httpapi.Response{Error: errors.New("Invalid job id"), HTTPCode: 400}
 	}
 
-	if err = manager.AddJobFile(id.String(), jf); err != nil {
-		return httpapi.Response{Error: err, HTTPCode: 400}
+	if err = manager.AddJobFiles(id.String(), batch); err != nil {
+		return httpapi.Response{Error: err, HTTPCode: updateCode(err)}
 	}
 
 	return httpapi.Response{HTTPCode: 201}
@@ -95,14 +111,28 @@ func finishJob(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
 		return httpapi.Response{Error: errors.New("Invalid job id"), HTTPCode: 400}
 	}
 
-	err = manager.FinishJob(id.String())
+	var complete model.JobComplete
+	if gerr := r.JsonBody(&complete); gerr != nil {
+		return httpapi.Response{Error: gerr, HTTPCode: 400}
+	}
+
+	err = manager.FinishJob(id.String(), complete)
 	if err != nil {
-		return httpapi.Response{Error: err, HTTPCode: 400}
+		return httpapi.Response{Error: err, HTTPCode: updateCode(err)}
 	}
 
 	return httpapi.Response{HTTPCode: 200}
 }
 
+// updateCode is the response code for an agent's job update that failed: 400 if the job refused it,
+// otherwise 500 so the agent sends it again
+func updateCode(err error) int {
+	if manager.IsRejected(err) {
+		return 400
+	}
+	return 500
+}
+
 func newJob(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
 	var jr JobRequest
 	gerr := r.JsonBody(&jr)
@@ -117,7 +147,28 @@ func newJob(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
 
 	jr.Agent = aID.String()
 
-	//TODO: validate jobRequest
+	// restores only need the restore permission, everything else needs manage
+	permission := model.PermManage
+	if jr.Definition.Type == model.TypeRestore {
+		permission = model.PermRestore
+	}
+
+	u, err := manager.Authorize(r.User, permission)
+	if err != nil || !canAccessAgent(r, jr.Agent) {
+		return httpapi.Response{Error: errForbidden, HTTPCode: 403}
+	}
+
+	// without the manage permission a restore is limited to what a backup the user can see saved
+	if jr.Definition.Type == model.TypeRestore && !u.Can(model.PermManage) {
+		allowed, err := agentFilter(r)
+		if err != nil {
+			return httpapi.Response{Error: err, HTTPCode: 400}
+		}
+		if err = manager.ScopeRestore(&jr.Definition, jr.Job, allowed); err != nil {
+			return httpapi.Response{Error: err, HTTPCode: 403}
+		}
+	}
+
 	id, err := manager.NewJob(jr.Definition, jr.Agent)
 	if err != nil {
 		return httpapi.Response{Error: err, HTTPCode: 400}
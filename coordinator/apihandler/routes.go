@@ -1,13 +1,50 @@
 package apihandler
 
-import "github.com/sethjback/gobl/httpapi"
+import (
+	"github.com/sethjback/gobl/httpapi"
+	"github.com/sethjback/gobl/model"
+)
 
 // Routes are the agent's routes
 var Routes = []httpapi.Route{
 	httpapi.Route{
 		Method:  "GET",
 		Path:    "/status",
-		Handler: coordinatorStatus},
+		Handler: allow(model.PermRead, scopeNone, coordinatorStatus)},
+
+	//
+	// USERS
+	//
+
+	httpapi.Route{
+		Method:  "POST",
+		Path:    "/login",
+		Handler: login},
+
+	httpapi.Route{
+		Method:  "GET",
+		Path:    "/users",
+		Handler: allow(model.PermUsers, scopeNone, userList)},
+
+	httpapi.Route{
+		Method:  "POST",
+		Path:    "/users",
+		Handler: allow(model.PermUsers, scopeNone, addUser)},
+
+	httpapi.Route{
+		Method:  "GET",
+		Path:    "/users/:email",
+		Handler: allow(model.PermUsers, scopeNone, getUser)},
+
+	httpapi.Route{
+		Method:  "PUT",
+		Path:    "/users/:email",
+		Handler: allow(model.PermUsers, scopeNone, updateUser)},
+
+	httpapi.Route{
+		Method:  "DELETE",
+		Path:    "/users/:email",
+		Handler: allow(model.PermUsers, scopeNone, deleteUser)},
 
 	//
 	//AGENTS
@@ -16,27 +53,47 @@ var Routes = []httpapi.Route{
 	httpapi.Route{
 		Method:  "GET",
 		Path:    "/agents",
-		Handler: agentList},
+		Handler: allow(model.PermRead, scopeNone, agentList)},
 
 	httpapi.Route{
 		Method:  "POST",
 		Path:    "/agents",
-		Handler: addAgent},
+		Handler: allow(model.PermManage, scopeNone, addAgent)},
 
 	httpapi.Route{
 		Method:  "GET",
 		Path:    "/agents/:id",
-		Handler: getAgent},
+		Handler: allow(model.PermRead, scopeAgent, getAgent)},
 
 	httpapi.Route{
 		Method:  "GET",
 		Path:    "/agents/:id/status",
-		Handler: agentStatus},
+		Handler: allow(model.PermRead, scopeAgent, agentStatus)},
+
+	httpapi.Route{
+		Method:  "GET",
+		Path:    "/agents/:id/capabilities",
+		Handler: allow(model.PermRead, scopeAgent, agentCapabilities)},
 
 	httpapi.Route{
 		Method:  "PUT",
 		Path:    "/agents/:id",
-		Handler: updateAgent},
+		Handler: allow(model.PermManage, scopeAgent, updateAgent)},
+
+	httpapi.Route{
+		Method:  "DELETE",
+		Path:    "/agents/:id",
+		Handler: allow(model.PermManage, scopeAgent, deleteAgent)},
+
+	httpapi.Route{
+		Method:  "POST",
+		Path:    "/agents/:id/prune",
+		Handler: allow(model.PermManage, scopeAgent, pruneAgent)},
+
+	httpapi.Route{
+		Method:  "POST",
+		Path:    "/agents/:id/stats",
+		Handler: allow(model.PermRead, scopeAgent, agentStats)},
 
 	//
 	//JOBS
@@ -45,17 +102,23 @@ var Routes = []httpapi.Route{
 	httpapi.Route{
 		Method:  "GET",
 		Path:    "/jobs/:id",
-		Handler: jobStatus},
+		Handler: allow(model.PermRead, scopeJob, jobStatus)},
 
+	// the permission needed depends on the job type, so it is checked in the handler
 	httpapi.Route{
 		Method:  "POST",
 		Path:    "/jobs",
 		Handler: newJob},
 
+	httpapi.Route{
+		Method:  "DELETE",
+		Path:    "/jobs/:id",
+		Handler: allow(model.PermManage, scopeJob, cancelJob)},
+
 	httpapi.Route{
 		Method:  "POST",
 		Path:    "/jobs/:id/files",
-		Handler: addJobFile},
+		Handler: addJobFiles},
 
 	httpapi.Route{
 		Method:  "POST",
@@ -65,17 +128,17 @@ var Routes = []httpapi.Route{
 	httpapi.Route{
 		Method:  "GET",
 		Path:    "/jobs",
-		Handler: jobList},
+		Handler: allow(model.PermRead, scopeNone, jobList)},
 
 	httpapi.Route{
 		Method:  "GET",
 		Path:    "/jobs/:id/files",
-		Handler: jobFiles},
+		Handler: allow(model.PermRead, scopeJob, jobFiles)},
 
 	httpapi.Route{
 		Method:  "GET",
 		Path:    "/jobs/:id/directories",
-		Handler: jobDirectories},
+		Handler: allow(model.PermRead, scopeJob, jobDirectories)},
 
 	//
 	// JOB DEFINITIONS
@@ -83,27 +146,27 @@ var Routes = []httpapi.Route{
 	httpapi.Route{
 		Method:  "GET",
 		Path:    "/job-definitions",
-		Handler: jobDefinitionList},
+		Handler: allow(model.PermRead, scopeNone, jobDefinitionList)},
 
 	httpapi.Route{
 		Method:  "GET",
 		Path:    "/job-definitions/:id",
-		Handler: getJobDefinition},
+		Handler: allow(model.PermRead, scopeNone, getJobDefinition)},
 
 	httpapi.Route{
 		Method:  "DELETE",
 		Path:    "/job-definitions/:id",
-		Handler: deleteJobDefinition},
+		Handler: allow(model.PermManage, scopeNone, deleteJobDefinition)},
 
 	httpapi.Route{
 		Method:  "PUT",
 		Path:    "/job-definitions/:id",
-		Handler: updateJobDefinition},
+		Handler: allow(model.PermManage, scopeNone, updateJobDefinition)},
 
 	httpapi.Route{
 		Method:  "POST",
 		Path:    "/job-definitions",
-		Handler: createJobDefinition},
+		Handler: allow(model.PermManage, scopeNone, createJobDefinition)},
 
 	//
 	// SCHEDULES
@@ -111,25 +174,25 @@ var Routes = []httpapi.Route{
 	httpapi.Route{
 		Method:  "GET",
 		Path:    "/schedules",
-		Handler: scheduleList},
+		Handler: allow(model.PermRead, scopeNone, scheduleList)},
 
 	httpapi.Route{
 		Method:  "POST",
 		Path:    "/schedules",
-		Handler: addSchedule},
+		Handler: allow(model.PermManage, scopeNone, addSchedule)},
 
 	httpapi.Route{
 		Method:  "DELETE",
-		Path:    "/schedules/{sID}",
-		Handler: deleteSchedule},
+		Path:    "/schedules/:id",
+		Handler: allow(model.PermManage, scopeNone, deleteSchedule)},
 
 	httpapi.Route{
 		Method:  "PUT",
-		Path:    "/schedules/{sID}",
-		Handler: updateSchedule},
+		Path:    "/schedules/:id",
+		Handler: allow(model.PermManage, scopeNone, updateSchedule)},
 
 	httpapi.Route{
 		Method:  "POST",
 		Path:    "/email",
-		Handler: testEmail},
+		Handler: allow(model.PermManage, scopeNone, testEmail)},
 }
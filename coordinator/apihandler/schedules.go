@@ -5,6 +5,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
+	"github.com/robfig/cron"
 	"github.com/sethjback/gobl/coordinator/manager"
 	"github.com/sethjback/gobl/httpapi"
 	"github.com/sethjback/gobl/model"
@@ -16,11 +17,27 @@ func scheduleList(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
 		return httpapi.Response{Error: err, HTTPCode: 400}
 	}
 
-	if list == nil {
-		list = make([]model.Schedule, 0)
+	allowed, err := agentFilter(r)
+	if err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	visible := make([]model.Schedule, 0, len(list))
+	for _, s := range list {
+		if allowed(s.AgentID) {
+			visible = append(visible, s)
+		}
 	}
 
-	return httpapi.Response{Data: map[string]interface{}{"stored": list, "active": manager.CronSchedules()}, HTTPCode: 200}
+	entries := manager.CronSchedules()
+	active := make([]*cron.Entry, 0, len(entries))
+	for _, e := range entries {
+		if sj, ok := e.Job.(*manager.ScheduledJob); ok && allowed(sj.Schedule.AgentID) {
+			active = append(active, e)
+		}
+	}
+
+	return httpapi.Response{Data: map[string]interface{}{"stored": visible, "active": active}, HTTPCode: 200}
 }
 
 func addSchedule(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
@@ -31,18 +48,22 @@ func addSchedule(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
 		return httpapi.Response{Error: err, HTTPCode: 400}
 	}
 
+	if !canAccessAgent(r, sched.AgentID) {
+		return httpapi.Response{Error: errForbidden, HTTPCode: 403}
+	}
+
 	sID, gerr := manager.NewSchedule(sched)
 	if gerr != nil {
-		return httpapi.Response{Error: err, HTTPCode: 400}
+		return httpapi.Response{Error: gerr, HTTPCode: 400}
 	}
 
 	return httpapi.Response{Data: map[string]interface{}{"id": sID}, HTTPCode: 201}
 }
 
 func updateSchedule(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
-	id, err := uuid.Parse(ps.ByName("jobID"))
+	id, err := uuid.Parse(ps.ByName("id"))
 	if err != nil {
-		return httpapi.Response{Error: errors.New("Invalid jobID"), HTTPCode: 400}
+		return httpapi.Response{Error: errors.New("Invalid schedule id"), HTTPCode: 400}
 	}
 
 	var sched model.Schedule
@@ -53,6 +74,12 @@ func updateSchedule(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
 
 	sched.ID = id.String()
 
+	if current, err := manager.GetSchedule(sched.ID); err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	} else if !canAccessAgent(r, current.AgentID) || !canAccessAgent(r, sched.AgentID) {
+		return httpapi.Response{Error: errForbidden, HTTPCode: 403}
+	}
+
 	if err := manager.UpdateSchedule(sched); err != nil {
 		return httpapi.Response{Error: err, HTTPCode: 400}
 	}
@@ -61,9 +88,15 @@ func updateSchedule(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
 }
 
 func deleteSchedule(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
-	id, err := uuid.Parse(ps.ByName("jobID"))
+	id, err := uuid.Parse(ps.ByName("id"))
 	if err != nil {
-		return httpapi.Response{Error: errors.New("Invalid jobID"), HTTPCode: 400}
+		return httpapi.Response{Error: errors.New("Invalid schedule id"), HTTPCode: 400}
+	}
+
+	if current, err := manager.GetSchedule(id.String()); err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	} else if !canAccessAgent(r, current.AgentID) {
+		return httpapi.Response{Error: errForbidden, HTTPCode: 403}
 	}
 
 	err = manager.DeleteSchedule(id.String())
@@ -0,0 +1,81 @@
+package apihandler
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"github.com/sethjback/gobl/coordinator/manager"
+	"github.com/sethjback/gobl/httpapi"
+	"github.com/sethjback/gobl/model"
+)
+
+type UserRequest struct {
+	Email    string   `json:"email"`
+	Password string   `json:"password"`
+	Role     string   `json:"role"`
+	Groups   []string `json:"groups"`
+}
+
+func login(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
+	var ur UserRequest
+	if err := r.JsonBody(&ur); err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	token, err := manager.Login(ur.Email, ur.Password)
+	if err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 401}
+	}
+
+	return httpapi.Response{Data: map[string]interface{}{"token": token}, HTTPCode: 200}
+}
+
+func userList(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
+	list, err := manager.UserList()
+	if err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	return httpapi.Response{Data: map[string]interface{}{"users": list}, HTTPCode: 200}
+}
+
+func getUser(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
+	u, err := manager.GetUser(ps.ByName("email"))
+	if err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	return httpapi.Response{Data: map[string]interface{}{"user": u}, HTTPCode: 200}
+}
+
+func addUser(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
+	var ur UserRequest
+	if err := r.JsonBody(&ur); err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	if err := manager.AddUser(model.User{Email: ur.Email, Password: ur.Password, Role: ur.Role, Groups: ur.Groups}); err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	return httpapi.Response{Data: map[string]interface{}{"email": ur.Email}, HTTPCode: 201}
+}
+
+func updateUser(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
+	var ur UserRequest
+	if err := r.JsonBody(&ur); err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	if err := manager.UpdateUser(model.User{Email: ps.ByName("email"), Password: ur.Password, Role: ur.Role, Groups: ur.Groups}); err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	return httpapi.Response{HTTPCode: 200}
+}
+
+func deleteUser(r *httpapi.Request, ps httprouter.Params) httpapi.Response {
+	if err := manager.DeleteUser(ps.ByName("email")); err != nil {
+		return httpapi.Response{Error: err, HTTPCode: 400}
+	}
+
+	return httpapi.Response{HTTPCode: 200}
+}
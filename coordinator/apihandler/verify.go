@@ -0,0 +1,46 @@
+package apihandler
+
+import (
+	"strings"
+
+	"github.com/sethjback/gobl/coordinator/manager"
+	"github.com/sethjback/gobl/httpapi"
+	"github.com/sethjback/gobl/keys"
+)
+
+// Verifier looks up the agent key for requests that must be signed.
+// Agents call back on POST /jobs/:id/files and POST /jobs/:id/complete, which are verified
+// against the public key of the agent the job was sent to
+func Verifier(r *httpapi.Request) (keys.Verifier, error) {
+	if jobID, ok := agentCallback(r); ok {
+		return manager.JobVerifier(jobID)
+	}
+
+	return nil, nil
+}
+
+// TokenRequired reports whether the request must carry a user token.
+// Everything except logging in and the signed agent callbacks does
+func TokenRequired(r *httpapi.Request) bool {
+	if r.Method == "POST" && strings.Trim(r.Path, "/") == "login" {
+		return false
+	}
+
+	_, ok := agentCallback(r)
+	return !ok
+}
+
+// agentCallback returns the job id if the request is one of the agent callbacks
+func agentCallback(r *httpapi.Request) (string, bool) {
+	ps := strings.Split(strings.Trim(r.Path, "/"), "/")
+	if r.Method != "POST" || len(ps) != 3 || ps[0] != "jobs" {
+		return "", false
+	}
+
+	switch ps[2] {
+	case "files", "complete":
+		return ps[1], true
+	}
+
+	return "", false
+}
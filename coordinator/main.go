@@ -1,15 +1,19 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/sethjback/gobl/auth"
 	"github.com/sethjback/gobl/config"
 	"github.com/sethjback/gobl/coordinator/apihandler"
 	"github.com/sethjback/gobl/coordinator/manager"
-	"github.com/sethjback/gobl/gobldb/leveldb"
+	"github.com/sethjback/gobl/gobldb"
 	"github.com/sethjback/gobl/httpapi"
 	"github.com/sethjback/gobl/model"
 	"github.com/sethjback/gobl/util/log"
@@ -18,10 +22,14 @@ import (
 
 func main() {
 
-	var cPath, admin string
+	var cPath, admin, reset, password, export, archive string
 
 	flag.StringVar(&cPath, "config", "", "Path to the config file")
 	flag.StringVar(&admin, "admin", "", "Set the admin password")
+	flag.StringVar(&reset, "reset-password", "", "Reset the password of the given user and exit")
+	flag.StringVar(&password, "password", "", "The new password for -reset-password. Read from stdin if not set")
+	flag.StringVar(&export, "export", "", "Export the database to the given JSON lines file and exit")
+	flag.StringVar(&archive, "import", "", "Import a file written by -export into the (empty) database and exit")
 	flag.Parse()
 
 	conf, err := config.Parse(cPath)
@@ -35,7 +43,7 @@ func main() {
 	log.Debug("main", "config:", *conf)
 
 	if admin != "" {
-		gDb, err := leveldb.New(conf.DB)
+		gDb, err := manager.OpenDB(conf.DB)
 		if err != nil {
 			log.Fatalf("main", "Error creating admin user: %v", err)
 		}
@@ -45,21 +53,126 @@ func main() {
 			log.Fatalf("main", "Error creating admin user: %v", err)
 		}
 
-		err = gDb.SaveUser(model.User{Email: "admin", Password: string(p)})
+		err = gDb.SaveUser(model.User{Email: "admin", Password: string(p), Role: model.RoleAdmin})
 		if err != nil {
 			log.Fatalf("main", "Error creating admin user: %v", err)
 		}
 		gDb.Close()
 	}
 
+	if reset != "" {
+		if err = resetPassword(conf.DB, reset, password); err != nil {
+			log.Fatalf("main", "Error resetting password: %v", err)
+		}
+		log.Infof("main", "password reset for %s", reset)
+		os.Exit(0)
+	}
+
+	if export != "" {
+		count, err := exportDB(conf.DB, export)
+		if err != nil {
+			log.Fatalf("main", "Error exporting database: %v", err)
+		}
+		log.Infof("main", "exported %d records to %s", count, export)
+		os.Exit(0)
+	}
+
+	if archive != "" {
+		count, err := importDB(conf.DB, archive)
+		if err != nil {
+			log.Fatalf("main", "Error importing database: %v", err)
+		}
+		log.Infof("main", "imported %d records from %s", count, archive)
+		os.Exit(0)
+	}
+
 	err = manager.Init(conf)
 	if err != nil {
 		log.Fatalf("main", "Error initializing manager: %v", err)
 	}
 
 	httpAPI := httpapi.New(apihandler.Routes)
+	httpAPI.Use(httpapi.NewVerify(apihandler.Verifier))
+	httpAPI.Use(httpapi.NewAuthenticate(apihandler.TokenRequired, manager.CheckToken))
 	httpAPI.Start(conf.Server, func() {
 		log.Infof("main", "shutting down")
 		manager.Shutdown()
 	})
 }
+
+// resetPassword replaces the user's password, keeping their role and groups
+func resetPassword(c config.DB, email, password string) error {
+	if password == "" {
+		fmt.Print("New password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	if password == "" {
+		return errors.New("password cannot be empty")
+	}
+
+	gDb, err := manager.OpenDB(c)
+	if err != nil {
+		return err
+	}
+	defer gDb.Close()
+
+	u, err := gDb.GetUser(email)
+	if err != nil {
+		return err
+	}
+
+	p, err := auth.PasswordHash([]byte(password))
+	if err != nil {
+		return err
+	}
+
+	u.Password = string(p)
+	return gDb.SaveUser(*u)
+}
+
+// exportDB writes the configured database to the archive at path
+func exportDB(c config.DB, path string) (int, error) {
+	gDb, err := manager.OpenDB(c)
+	if err != nil {
+		return 0, err
+	}
+	defer gDb.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+
+	w := bufio.NewWriter(f)
+	count, err := gobldb.Export(gDb, w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return count, err
+}
+
+// importDB reads the archive at path into the configured database, which can use a different driver than the export
+func importDB(c config.DB, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	gDb, err := manager.OpenDB(c)
+	if err != nil {
+		return 0, err
+	}
+	defer gDb.Close()
+
+	return gobldb.Import(gDb, f)
+}
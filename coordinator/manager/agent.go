@@ -1,7 +1,9 @@
 package manager
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 
 	"github.com/google/uuid"
 	"github.com/sethjback/gobl/httpapi"
@@ -37,7 +39,7 @@ func AddAgent(agent model.Agent) (string, error) {
 		return "", err
 	}
 
-	verifiers[agent.ID] = keys.NewVerifier(ks)
+	setVerifier(agent.ID, keys.NewVerifier(ks))
 	return agent.ID, nil
 }
 
@@ -66,6 +68,46 @@ func getAgentStatus(agent model.Agent, s keys.Signer) (map[string]interface{}, e
 	return response.Data, nil
 }
 
+// GetAgentCapabilities asks the agent which engines and modifications it supports, and their options
+func GetAgentCapabilities(agentID string) (*model.Capabilities, error) {
+	agent, err := gDb.GetAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return getAgentCapabilities(*agent, signer)
+}
+
+func getAgentCapabilities(agent model.Agent, s keys.Signer) (*model.Capabilities, error) {
+	aR := httpapi.NewRequest(agent.Address, "/capabilities", "GET")
+
+	response, err := aR.Send(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.HTTPCode != 200 {
+		return nil, fmt.Errorf("Agent capabilities failed: %d", response.HTTPCode)
+	}
+
+	data, ok := response.Data["capabilities"]
+	if !ok {
+		return nil, errors.New("Agent did not return its capabilities")
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	caps := &model.Capabilities{}
+	if err = json.Unmarshal(b, caps); err != nil {
+		return nil, err
+	}
+
+	return caps, nil
+}
+
 // agentKey contacts the given agentID and retrieves it's public key
 func getAgentKey(agent model.Agent, s keys.Signer) (string, error) {
 	aR := httpapi.NewRequest(agent.Address, "/key", "GET")
@@ -102,10 +144,108 @@ func UpdateAgent(agent model.Agent, loadKey bool) error {
 			return err
 		}
 		agent.PublicKey = key
-		verifiers[agent.ID] = keys.NewVerifier(ks)
+		setVerifier(agent.ID, keys.NewVerifier(ks))
 	} else {
 		agent.PublicKey = current.PublicKey
 	}
 
 	return gDb.SaveAgent(agent)
 }
+
+// DeleteAgent removes the agent, its schedules and its public key. Agents with jobs still in progress are
+// only removed if force is set. If purgeJobs is set the agent's jobs and their file records are removed as well
+func DeleteAgent(agentID string, force, purgeJobs bool) error {
+	if _, err := gDb.GetAgent(agentID); err != nil {
+		return err
+	}
+
+	// only the ids are collected: deleting the jobs while paging through them would skip some
+	var jobIDs []string
+	deleteM.RLock()
+	err := eachJob(map[string]string{"agent": agentID}, func(j model.Job) error {
+		if !force {
+			switch j.Meta.State {
+			case model.StateNew, model.StateRunning, model.StateCanceling, model.StateNotification:
+				return errors.New("Agent has running jobs")
+			}
+		}
+		jobIDs = append(jobIDs, j.ID)
+		return nil
+	})
+	deleteM.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	ss, err := gDb.ScheduleList()
+	if err != nil {
+		return err
+	}
+
+	removed := false
+	for _, s := range ss {
+		if s.AgentID != agentID {
+			continue
+		}
+		if err = gDb.DeleteSchedule(s.ID); err != nil {
+			return err
+		}
+		removed = true
+	}
+
+	if removed {
+		schedules.Stop()
+		if err = initCron(); err != nil {
+			return err
+		}
+	}
+
+	if purgeJobs {
+		deleteM.Lock()
+		for _, id := range jobIDs {
+			if err = gDb.DeleteJob(id); err != nil {
+				deleteM.Unlock()
+				return err
+			}
+		}
+		deleteM.Unlock()
+	}
+
+	if err = gDb.DeleteAgent(agentID); err != nil {
+		return err
+	}
+
+	verifierLock.Lock()
+	delete(verifiers, agentID)
+	verifierLock.Unlock()
+
+	return nil
+}
+
+// AgentVerifier returns the verifier for the agent's public key
+func AgentVerifier(agentID string) (keys.Verifier, error) {
+	verifierLock.RLock()
+	v, ok := verifiers[agentID]
+	verifierLock.RUnlock()
+	if !ok {
+		return nil, errors.New("No public key for agent: " + agentID)
+	}
+
+	return v, nil
+}
+
+// JobVerifier returns the verifier for the agent running the given job
+func JobVerifier(jobID string) (keys.Verifier, error) {
+	job, err := gDb.GetJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	return AgentVerifier(job.Agent.ID)
+}
+
+func setVerifier(agentID string, v keys.Verifier) {
+	verifierLock.Lock()
+	verifiers[agentID] = v
+	verifierLock.Unlock()
+}
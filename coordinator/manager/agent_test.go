@@ -7,8 +7,10 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/robfig/cron"
 	"github.com/sethjback/gobl/config"
 	"github.com/sethjback/gobl/keys"
 	"github.com/sethjback/gobl/model"
@@ -87,3 +89,114 @@ func TestGetAgentKey(t *testing.T) {
 	assert.Nil(err)
 	assert.NotEmpty(k)
 }
+
+func TestDeleteAgent(t *testing.T) {
+	assert := assert.New(t)
+	if !assert.Nil(testManager()) {
+		return
+	}
+	defer gDb.Close()
+	schedules = cron.New()
+	verifiers = make(map[string]keys.Verifier)
+
+	agent := model.Agent{ID: uuid.New().String(), Name: "agent", Address: "127.0.0.1:1"}
+	other := model.Agent{ID: uuid.New().String(), Name: "other", Address: "127.0.0.1:1"}
+	assert.Nil(gDb.SaveAgent(agent))
+	assert.Nil(gDb.SaveAgent(other))
+	setVerifier(agent.ID, keys.NewVerifier(nil))
+
+	sched := model.Schedule{ID: uuid.New().String(), AgentID: agent.ID, JobDefinitionID: uuid.New().String(), Seconds: "0", Minutes: "0", Hour: "1", DOM: "*", MON: "*", DOW: "*"}
+	otherSched := model.Schedule{ID: uuid.New().String(), AgentID: other.ID, JobDefinitionID: uuid.New().String(), Seconds: "0", Minutes: "0", Hour: "1", DOM: "*", MON: "*", DOW: "*"}
+	assert.Nil(gDb.SaveSchedule(sched))
+	assert.Nil(gDb.SaveSchedule(otherSched))
+
+	job := model.Job{
+		ID:         uuid.New().String(),
+		Agent:      &agent,
+		Definition: &model.JobDefinition{Type: model.TypeBackup},
+		Meta:       &model.JobMeta{State: model.StateRunning, Start: time.Now().UTC()}}
+	assert.Nil(gDb.SaveJob(job))
+
+	// more jobs than fit in a page, all newer than the running one
+	for i := 0; i <= jobPageSize; i++ {
+		assert.Nil(gDb.SaveJob(model.Job{
+			ID:         uuid.New().String(),
+			Agent:      &agent,
+			Definition: &model.JobDefinition{Type: model.TypeBackup},
+			Meta:       &model.JobMeta{State: model.StateFinished, Start: time.Now().UTC().Add(time.Duration(i+1) * time.Second)}}))
+	}
+
+	// running jobs block removal
+	assert.NotNil(DeleteAgent(agent.ID, false, true))
+	_, err := gDb.GetAgent(agent.ID)
+	assert.Nil(err)
+
+	assert.Nil(DeleteAgent(agent.ID, true, true))
+
+	_, err = gDb.GetAgent(agent.ID)
+	assert.NotNil(err)
+	_, err = gDb.GetJob(job.ID)
+	assert.NotNil(err)
+	jobs, err := gDb.JobList(map[string]string{"agent": agent.ID})
+	assert.Nil(err)
+	assert.Empty(jobs)
+	_, err = AgentVerifier(agent.ID)
+	assert.NotNil(err)
+
+	ss, err := gDb.ScheduleList()
+	assert.Nil(err)
+	assert.Equal([]model.Schedule{otherSched}, ss)
+	assert.Len(schedules.Entries(), 1)
+	schedules.Stop()
+
+	// jobs are kept unless purged
+	otherJob := model.Job{
+		ID:         uuid.New().String(),
+		Agent:      &other,
+		Definition: &model.JobDefinition{Type: model.TypeBackup},
+		Meta:       &model.JobMeta{State: model.StateFinished, End: time.Now().UTC()}}
+	assert.Nil(gDb.SaveJob(otherJob))
+	assert.Nil(DeleteAgent(other.ID, false, false))
+	_, err = gDb.GetJob(otherJob.ID)
+	assert.Nil(err)
+
+	assert.NotNil(DeleteAgent(other.ID, false, false))
+}
+
+func TestGetAgentCapabilities(t *testing.T) {
+	assert := assert.New(t)
+	if !assert.Nil(testManager()) {
+		return
+	}
+	defer gDb.Close()
+
+	var path string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write([]byte(`{"data":{"capabilities":{"version":"0.1.0","engines":[{"name":"localfile","save":true,"restore":true,"saveOptions":[{"name":"savePath","description":"","type":"string","required":true,"default":""}]}],"modifications":[{"name":"compress","options":[]}]}}}`))
+	}))
+	defer ts.Close()
+
+	agent := model.Agent{ID: uuid.New().String(), Name: "agent", Address: ts.URL}
+	assert.Nil(gDb.SaveAgent(agent))
+
+	caps, err := GetAgentCapabilities(agent.ID)
+	if assert.Nil(err) {
+		assert.Equal("/capabilities", path)
+		assert.Equal("0.1.0", caps.Version)
+		if assert.Len(caps.Engines, 1) {
+			assert.Equal("localfile", caps.Engines[0].Name)
+			assert.True(caps.Engines[0].Restore)
+			assert.Equal("savePath", caps.Engines[0].SaveOptions[0].Name)
+			assert.True(caps.Engines[0].SaveOptions[0].Required)
+		}
+		if assert.Len(caps.Modifications, 1) {
+			assert.Equal("compress", caps.Modifications[0].Name)
+		}
+	}
+
+	_, err = GetAgentCapabilities(uuid.New().String())
+	assert.NotNil(err)
+}
@@ -2,16 +2,39 @@ package manager
 
 import (
 	"github.com/google/uuid"
+	"github.com/sethjback/gobl/engine"
 	"github.com/sethjback/gobl/model"
+	"github.com/sethjback/gobl/modification"
+	"github.com/sethjback/gobl/version"
 )
 
 func CreateJobDefinition(jobDef model.JobDefinition) (string, error) {
+	if err := jobDef.Validate(localCapabilities()); err != nil {
+		return "", err
+	}
+
+	if jobDef.Retention != nil {
+		if err := jobDef.Retention.Validate(); err != nil {
+			return "", err
+		}
+	}
+
 	jobDef.ID = uuid.New().String()
 
 	return jobDef.ID, gDb.SaveJobDefinition(jobDef)
 }
 
 func UpdateJobDefinition(jobDef model.JobDefinition) error {
+	if err := jobDef.Validate(localCapabilities()); err != nil {
+		return err
+	}
+
+	if jobDef.Retention != nil {
+		if err := jobDef.Retention.Validate(); err != nil {
+			return err
+		}
+	}
+
 	return gDb.SaveJobDefinition(jobDef)
 }
 
@@ -30,3 +53,13 @@ func GetJobDefinitions() ([]model.JobDefinition, error) {
 	}
 	return jdefs, err
 }
+
+// localCapabilities are the engines and modifications compiled into the coordinator. Job definitions
+// aren't tied to an agent, so these are what they are checked against when they are saved
+func localCapabilities() model.Capabilities {
+	return model.Capabilities{
+		Version:       version.Version.String(),
+		Engines:       engine.Capabilities(),
+		Modifications: modification.Capabilities(),
+	}
+}
@@ -1,46 +1,60 @@
 package manager
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/sethjback/gobl/email"
+	"github.com/sethjback/gobl/engine"
+	"github.com/sethjback/gobl/files"
+	gerrors "github.com/sethjback/gobl/gobldb/errors"
+	"github.com/sethjback/gobl/goblerr"
 	"github.com/sethjback/gobl/httpapi"
 	"github.com/sethjback/gobl/model"
+	"github.com/sethjback/gobl/util/log"
 )
 
 // JobStatus reads the status from the DB
 func JobStatus(id string) (*model.JobMeta, error) {
-	var jobMeta *model.JobMeta
-	var rerr error
-
 	j, err := gDb.GetJob(id)
 	if err != nil {
 		return nil, err
 	}
 
-	if j.Meta.State == model.StateRunning || j.Meta.State == model.StateNotification {
-		aR := &httpapi.Request{Host: j.Agent.Address, Path: "/jobs/" + id, Method: "GET"}
-		response, err := aR.Send(signer)
-		if err != nil {
-			return nil, err
-		}
-		//todo: update status on our end if the job isn't found on the agent. Likely causes are the agent Shutdown
-		// uncleanly and wasn't able to persist the job
-		if response.Error != nil {
-			return nil, response.Error
-		}
+	if j.Meta.State != model.StateRunning && j.Meta.State != model.StateCanceling {
+		return j.Meta, nil
+	}
 
-		if jd, ok := response.Data[id]; ok {
-			jobMeta = jd.(*model.JobMeta)
-		} else {
-			rerr = errors.New("Unable to find job on agent")
-		}
+	aR := &httpapi.Request{Host: j.Agent.Address, Path: "/jobs/" + id, Method: "GET"}
+	response, err := aR.Send(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	// the agent doesn't have the job, e.g. it was restarted: the reconciler marks it failed if it doesn't
+	// turn up again, until then our own status is the best there is
+	jd, ok := response.Data[id]
+	if response.HTTPCode != 200 || !ok {
+		return j.Meta, nil
 	}
 
-	return jobMeta, rerr
+	b, err := json.Marshal(jd)
+	if err != nil {
+		return nil, err
+	}
+
+	jobMeta := &model.JobMeta{}
+	if err = json.Unmarshal(b, jobMeta); err != nil {
+		return nil, err
+	}
+
+	return jobMeta, nil
 }
 
 // JobList builds a list of jobs based on the given paramiters
@@ -53,41 +67,383 @@ func JobList(filters map[string]string) ([]model.Job, error) {
 	return list, err
 }
 
-// AddJobFile adds a file entry to the job
-func AddJobFile(jobID string, jobFile model.JobFile) error {
+// VisibleJobList is JobList limited to the jobs of the agents visible accepts. The limit and offset
+// apply to the visible jobs, so the jobs are read a page at a time until there are enough
+func VisibleJobList(filters map[string]string, visible func(agentID string) bool) ([]model.Job, error) {
+	limit, offset := 10, 0
+	f := make(map[string]string, len(filters))
+	for k, v := range filters {
+		switch k {
+		case "limit", "offset":
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, goblerr.New(k+" invalid", gerrors.ErrFilterOptions, err)
+			}
+			if k == "limit" {
+				limit = i
+			} else {
+				offset = i
+			}
+		default:
+			f[k] = v
+		}
+	}
+
+	list := make([]model.Job, 0)
+	if limit <= 0 {
+		return list, nil
+	}
+
+	deleteM.RLock()
+	defer deleteM.RUnlock()
+
+	errEnough := errors.New("enough jobs")
+	err := eachJob(f, func(j model.Job) error {
+		if j.Agent == nil || !visible(j.Agent.ID) {
+			return nil
+		}
+		if offset > 0 {
+			offset--
+			return nil
+		}
+		list = append(list, j)
+		if len(list) == limit {
+			return errEnough
+		}
+		return nil
+	})
+	if err != nil && err != errEnough {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// ErrorRestoreScope is the code of the errors given when a restore reaches beyond the backup it is restored from
+const ErrorRestoreScope = "RestoreOutOfScope"
+
+// ScopeRestore limits a restore to the backup job it is restored from, for users who can't manage jobs.
+// The backup must be on an agent visible accepts, the restore must retrieve from one of the engines the backup
+// saved to and only the files it recorded can be restored. The definition's files are replaced with the
+// recorded ones, so their metadata can't be changed. Overwriting existing files isn't allowed
+func ScopeRestore(jd *model.JobDefinition, jobID string, visible func(agentID string) bool) error {
+	if jobID == "" {
+		return goblerr.New("Restore not allowed", ErrorRestoreScope, "the backup job to restore from is required")
+	}
+
 	job, err := gDb.GetJob(jobID)
 	if err != nil {
 		return err
 	}
-	if job.Meta.State != model.StateRunning {
-		return errors.New("Cannot add files to completed job")
+
+	if job.Agent == nil || !visible(job.Agent.ID) || job.Definition == nil || job.Definition.Type != model.TypeBackup {
+		return goblerr.New("Restore not allowed", ErrorRestoreScope, "the job is not a backup you can restore from")
+	}
+
+	if jd.From == nil || !hasEngine(job.Definition.To, *jd.From) {
+		return goblerr.New("Restore not allowed", ErrorRestoreScope, "from must be an engine the backup saved to")
+	}
+
+	for _, e := range jd.To {
+		for k, v := range e.Options {
+			if strings.EqualFold(k, engine.LocalFileOptionOverwrite) && v == true {
+				return goblerr.New("Restore not allowed", ErrorRestoreScope, "overwriting existing files requires the manage permission")
+			}
+		}
+	}
+
+	jfs, err := gDb.JobFileList(jobID, map[string]string{"parent": "*"})
+	if err != nil {
+		return err
+	}
+
+	recorded := make(map[string]files.File, len(jfs))
+	for _, jf := range jfs {
+		recorded[signatureKey(jf.File.Signature)] = jf.File
 	}
 
-	return gDb.SaveJobFile(jobID, jobFile)
+	for i, f := range jd.Files {
+		rf, ok := recorded[signatureKey(f.Signature)]
+		if !ok {
+			return goblerr.New("Restore not allowed", ErrorRestoreScope, f.Path+" was not saved by the backup")
+		}
+		jd.Files[i] = rf
+	}
+
+	return nil
+}
+
+func signatureKey(sig files.Signature) string {
+	return sig.Path + "\x00" + sig.Hash + "\x00" + strings.Join(sig.Modifications, "\x00")
+}
+
+// jobsM serializes the updates the agent callbacks make to jobs, so batches arriving together don't
+// overwrite each other's record of what has been received
+var jobsM = &sync.Mutex{}
+
+// deleteM is held for reading while jobs are paged through and for writing while jobs are deleted,
+// since a deletion would shift the pages and skip a job
+var deleteM = &sync.RWMutex{}
+
+// jobPageSize is the number of jobs read at a time when paging through jobs
+const jobPageSize = 100
+
+// ErrorJobRejected is the code of the errors given when the agent reports something the job can't take,
+// as opposed to the job being unable to be updated
+const ErrorJobRejected = "JobUpdateRejected"
+
+// IsRejected is true if the error is the job refusing an update, or the job not existing.
+// Sending the update again won't change either
+func IsRejected(err error) bool {
+	gerr, ok := err.(*goblerr.Error)
+	return ok && (gerr.Code == ErrorJobRejected || gerr.Code == gerrors.ErrCodeNotFound)
+}
+
+// eachJob calls fn with every job matching the filters, a page at a time
+func eachJob(filters map[string]string, fn func(model.Job) error) error {
+	f := make(map[string]string, len(filters)+2)
+	for k, v := range filters {
+		f[k] = v
+	}
+	f["limit"] = strconv.Itoa(jobPageSize)
+
+	for offset := 0; ; offset += jobPageSize {
+		f["offset"] = strconv.Itoa(offset)
+		page, err := gDb.JobList(f)
+		if err != nil {
+			return err
+		}
+
+		for _, j := range page {
+			if err = fn(j); err != nil {
+				return err
+			}
+		}
+
+		if len(page) < jobPageSize {
+			return nil
+		}
+	}
+}
+
+// AddJobFiles records a batch of file results from the agent. Batches can arrive in any order, and more
+// than once when the agent retries one: a batch that was already recorded is ignored.
+// If the agent has already reported the job complete, the last batch to arrive finishes it
+func AddJobFiles(jobID string, batch model.FileBatch) error {
+	jobsM.Lock()
+	defer jobsM.Unlock()
+
+	job, err := gDb.GetJob(jobID)
+	if err != nil {
+		return err
+	}
+	// files already in flight when a job is canceled are still recorded
+	if job.Meta.State != model.StateRunning && job.Meta.State != model.StateCanceling && job.Meta.State != model.StateNotification {
+		return goblerr.New("Cannot add files to completed job", ErrorJobRejected, nil)
+	}
+
+	if batch.Sequence < 1 {
+		return goblerr.New("Batch sequence must start at 1", ErrorJobRejected, nil)
+	}
+
+	if job.Meta.Received.Has(batch.Sequence) {
+		return nil
+	}
+
+	for _, jf := range batch.Files {
+		if err = gDb.SaveJobFile(jobID, jf); err != nil {
+			return err
+		}
+	}
+
+	job.Meta.Received = job.Meta.Received.Add(batch.Sequence)
+
+	if job.Meta.Batches > 0 && job.Meta.Received.Complete(job.Meta.Batches) {
+		return finalizeJob(job)
+	}
+
+	return gDb.SaveJob(*job)
 }
 
-// FinishJob updates the job status in the DB and begins the file indexing process
-func FinishJob(id string) error {
+// FinishJob records that the agent has finished the job. The job is only finalized once every file batch
+// the agent reports sending has been received, until then it waits in the notifications state
+func FinishJob(id string, complete model.JobComplete) error {
+	jobsM.Lock()
+	defer jobsM.Unlock()
+
 	job, err := gDb.GetJob(id)
 	if err != nil {
 		return err
 	}
 
+	// a repeated or late report must not finish the job again
+	switch job.Meta.State {
+	case model.StateRunning, model.StateNotification, model.StateCanceling:
+	default:
+		log.Warnf("manager", "Ignoring completion of job %s: it is already %s", job.ID, job.Meta.State)
+		return nil
+	}
+
+	job.Meta.Batches = complete.Batches
+	if complete.Error != "" {
+		return failJob(job, complete.Error)
+	}
+
+	if !job.Meta.Received.Complete(complete.Batches) {
+		log.Infof("manager", "Job %s complete, waiting on file batches", job.ID)
+		// a canceled job stays canceling so it still ends up canceled
+		if job.Meta.State == model.StateRunning {
+			job.Meta.State = model.StateNotification
+		}
+		return gDb.SaveJob(*job)
+	}
+
+	return finalizeJob(job)
+}
+
+// finalizeJob moves the job to its final state and begins the file indexing process
+func finalizeJob(job *model.Job) error {
+	if job.Meta.State == model.StateCanceling {
+		return markCanceled(job)
+	}
+
 	job.Meta.State = model.StateFinished
 	job.Meta.End = time.Now().UTC()
 
-	gDb.SaveJob(*job)
+	if err := gDb.SaveJob(*job); err != nil {
+		return err
+	}
+
+	if err := applyRetention(job); err != nil {
+		log.Errorf("manager", "Unable to apply retention for job %s: %v", job.ID, err)
+	}
 
 	// Todo: index table for files lookup
 
-	if conf.Email.Configured() {
-		body := "Job Complete: " + job.ID + "\n"
-		body += "Agent: " + job.Agent.Name + "\n"
-		body += "Start: " + job.Meta.Start.String() + "\nEnd: " + job.Meta.End.String() + "\nDuration: " + fmt.Sprintf("%v", job.Meta.End.Sub(job.Meta.Start)) + "\n"
-		body += "Message: " + job.Meta.Message + "\n\n"
-		body += "Job Definition: " + fmt.Sprintf("%+v", job.Definition)
+	reportJob(job, "Job Complete")
+
+	return nil
+}
+
+// failJob marks the job failed, e.g. when the agent reports it couldn't finish it, and sends the job report
+func failJob(job *model.Job, reason string) error {
+	job.Meta.State = model.StateFailed
+	job.Meta.End = time.Now().UTC()
+	job.Meta.Message = reason
+
+	if err := gDb.SaveJob(*job); err != nil {
+		return err
+	}
+
+	if err := applyRetention(job); err != nil {
+		log.Errorf("manager", "Unable to apply retention for job %s: %v", job.ID, err)
+	}
+
+	reportJob(job, "Job Failed")
+
+	return nil
+}
+
+// reportJob emails the job report, if email is configured
+func reportJob(job *model.Job, heading string) {
+	if !conf.Email.Configured() {
+		return
+	}
+
+	body := heading + ": " + job.ID + "\n"
+	body += "Agent: " + job.Agent.Name + "\n"
+	body += "Start: " + job.Meta.Start.String() + "\nEnd: " + job.Meta.End.String() + "\nDuration: " + fmt.Sprintf("%v", job.Meta.End.Sub(job.Meta.Start)) + "\n"
+	body += "Message: " + job.Meta.Message + "\n\n"
+	body += "Job Definition: " + fmt.Sprintf("%+v", job.Definition)
+
+	email.SendEmail(conf.Email, body, "Job Report: "+job.ID)
+}
+
+// CancelJob asks the agent to stop the job. The job stays in the canceling state until the
+// agent reports it has finished, at which point it is marked canceled
+func CancelJob(id string) error {
+	job, previous, err := startCancel(id)
+	if err != nil || job == nil {
+		return err
+	}
+
+	// the agent is called without holding jobsM, so its callbacks for other jobs aren't held up
+	aR := httpapi.NewRequest(job.Agent.Address, "/jobs/"+id, "DELETE")
+	response, err := aR.Send(signer)
+	if err == nil && response.HTTPCode == 200 {
+		return nil
+	}
+	if err == nil && response.HTTPCode != 404 {
+		err = fmt.Errorf("Agent job cancel failed: %d", response.HTTPCode)
+	}
+
+	jobsM.Lock()
+	defer jobsM.Unlock()
+
+	// the job may have finished while the agent was asked
+	job, gerr := gDb.GetJob(id)
+	if gerr != nil {
+		return gerr
+	}
+	if job.Meta.State != model.StateCanceling {
+		return err
+	}
+
+	if err != nil {
+		job.Meta.State = previous
+		gDb.SaveJob(*job)
+		return err
+	}
+
+	// the agent doesn't know about the job (e.g. it was restarted): nothing is left to stop
+	return markCanceled(job)
+}
+
+// startCancel moves the job to the canceling state, returning it along with the state it was in.
+// No job is returned if it is already being canceled
+func startCancel(id string) (*model.Job, string, error) {
+	jobsM.Lock()
+	defer jobsM.Unlock()
+
+	job, err := gDb.GetJob(id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch job.Meta.State {
+	case model.StateCanceling:
+		return nil, "", nil
+	case model.StateNew, model.StateRunning, model.StateNotification:
+	default:
+		return nil, "", errors.New("Job is not running")
+	}
+
+	previous := job.Meta.State
+	job.Meta.State = model.StateCanceling
+	if err = gDb.SaveJob(*job); err != nil {
+		return nil, "", err
+	}
+
+	return job, previous, nil
+}
+
+// markCanceled moves the job to its final canceled state, recording how many files were processed
+func markCanceled(job *model.Job) error {
+	processed, err := gDb.JobFileList(job.ID, map[string]string{"parent": "*"})
+	if err != nil {
+		return err
+	}
+
+	job.Meta.State = model.StateCanceled
+	job.Meta.End = time.Now().UTC()
+	job.Meta.Message = fmt.Sprintf("Canceled after %d files processed", len(processed))
+
+	if err = gDb.SaveJob(*job); err != nil {
+		return err
+	}
 
-		email.SendEmail(conf.Email, body, "Job Report: "+job.ID)
+	if err := applyRetention(job); err != nil {
+		log.Errorf("manager", "Unable to apply retention for job %s: %v", job.ID, err)
 	}
 
 	return nil
@@ -122,6 +478,17 @@ func NewJob(jobDefinition model.JobDefinition, agentID string) (string, error) {
 		return "", err
 	}
 
+	// check the job against what the agent running it supports
+	caps, err := getAgentCapabilities(*agent, signer)
+	if err != nil {
+		log.Warnf("newJob", "unable to get capabilities for agent %s, checking the job against the coordinator's: %v", agent.ID, err)
+		local := localCapabilities()
+		caps = &local
+	}
+	if err = jobDefinition.Validate(*caps); err != nil {
+		return "", err
+	}
+
 	job := model.Job{
 		ID:         uuid.New().String(),
 		Meta:       &model.JobMeta{State: model.StateNew, Start: time.Now().UTC()},
@@ -138,27 +505,71 @@ func NewJob(jobDefinition model.JobDefinition, agentID string) (string, error) {
 	job.Agent = nil
 	err = aR.SetBody(job)
 	if err != nil {
-		job.Agent = agent
-		job.Meta.State = model.StateFailed
-		job.Meta.End = time.Now().UTC()
-		job.Meta.Message = "Unable to create job on agent: " + err.Error()
-		gDb.SaveJob(job)
+		failStart(job.ID, "Unable to create job on agent: "+err.Error())
+		return "", err
+	}
+
+	// mark the job running before the agent starts sending files for it, unless it was canceled while new
+	if err = markStarting(job.ID); err != nil {
 		return "", err
 	}
 
 	response, err := aR.Send(signer)
 	if err != nil {
-		job.Agent = agent
-		job.Meta.State = model.StateFailed
-		job.Meta.End = time.Now().UTC()
-		job.Meta.Message = "Unable to create job on agent: " + err.Error()
-		gDb.SaveJob(job)
+		failStart(job.ID, "Unable to create job on agent: "+err.Error())
 		return "", err
 	}
 
+	if response.HTTPCode != 201 {
+		message := fmt.Sprintf("Agent refused job: %d", response.HTTPCode)
+		failStart(job.ID, message)
+		return "", errors.New(message)
+	}
+
 	return job.ID, response.Error
 }
 
+// markStarting moves the new job to running
+func markStarting(jobID string) error {
+	jobsM.Lock()
+	defer jobsM.Unlock()
+
+	job, err := gDb.GetJob(jobID)
+	if err != nil {
+		return err
+	}
+
+	if job.Meta.State != model.StateNew {
+		return fmt.Errorf("Job is %s, not starting it", job.Meta.State)
+	}
+
+	job.Meta.State = model.StateRunning
+	return gDb.SaveJob(*job)
+}
+
+// failStart marks the job failed when the agent couldn't be given it, unless it has since been canceled
+func failStart(jobID, message string) {
+	jobsM.Lock()
+	defer jobsM.Unlock()
+
+	job, err := gDb.GetJob(jobID)
+	if err != nil {
+		log.Errorf("newJob", "Unable to fail job %s: %v", jobID, err)
+		return
+	}
+
+	if job.Meta.State != model.StateNew && job.Meta.State != model.StateRunning {
+		return
+	}
+
+	job.Meta.State = model.StateFailed
+	job.Meta.End = time.Now().UTC()
+	job.Meta.Message = message
+	if err = gDb.SaveJob(*job); err != nil {
+		log.Errorf("newJob", "Unable to fail job %s: %v", jobID, err)
+	}
+}
+
 func GetJob(jobID string) (*model.Job, error) {
 	return gDb.GetJob(jobID)
 }
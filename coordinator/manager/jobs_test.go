@@ -0,0 +1,442 @@
+package manager
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sethjback/gobl/config"
+	"github.com/sethjback/gobl/engine"
+	"github.com/sethjback/gobl/files"
+	"github.com/sethjback/gobl/gobldb/leveldb"
+	"github.com/sethjback/gobl/keys"
+	"github.com/sethjback/gobl/model"
+	"github.com/sethjback/gobl/util/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func testManager() error {
+	log.Init(config.Log{Level: log.Level.Warn})
+
+	pkb, _ := pem.Decode(testPrivateKey)
+	pk, err := x509.ParsePKCS1PrivateKey(pkb.Bytes)
+	if err != nil {
+		return err
+	}
+	signer = keys.NewSigner(pk)
+	conf = &config.Config{}
+
+	gDb, err = leveldb.New(config.DB{})
+	return err
+}
+
+func TestCancelJob(t *testing.T) {
+	assert := assert.New(t)
+	if !assert.Nil(testManager()) {
+		return
+	}
+	defer gDb.Close()
+
+	var deletes []string
+	var during func()
+	code := 200
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			deletes = append(deletes, r.URL.Path)
+			if during != nil {
+				during()
+			}
+			w.WriteHeader(code)
+			if code == 404 {
+				w.Write([]byte(`{"error":"I was unable to find that Job"}`))
+			}
+		}
+	}))
+	defer ts.Close()
+
+	agent := model.Agent{ID: uuid.New().String(), Name: "agent", Address: ts.URL}
+	assert.Nil(gDb.SaveAgent(agent))
+
+	job := model.Job{
+		ID:         uuid.New().String(),
+		Agent:      &agent,
+		Definition: &model.JobDefinition{Type: model.TypeBackup},
+		Meta:       &model.JobMeta{State: model.StateRunning, Start: time.Now().UTC()}}
+	assert.Nil(gDb.SaveJob(job))
+
+	// cancel goes through canceling until the agent reports it has finished
+	assert.Nil(CancelJob(job.ID))
+	assert.Equal([]string{"/jobs/" + job.ID}, deletes)
+
+	j, err := gDb.GetJob(job.ID)
+	if assert.Nil(err) {
+		assert.Equal(model.StateCanceling, j.Meta.State)
+	}
+
+	// files in flight are still recorded
+	assert.Nil(AddJobFiles(job.ID, model.FileBatch{Sequence: 1, Files: []model.JobFile{
+		model.JobFile{File: files.File{Signature: files.Signature{Path: "/test/file1"}}, State: "complete"},
+		model.JobFile{File: files.File{Signature: files.Signature{Path: "/test/file2"}}, State: "complete"}}}))
+
+	// canceling again is a no-op
+	assert.Nil(CancelJob(job.ID))
+	assert.Len(deletes, 1)
+
+	assert.Nil(FinishJob(job.ID, model.JobComplete{Batches: 1}))
+	j, err = gDb.GetJob(job.ID)
+	if assert.Nil(err) {
+		assert.Equal(model.StateCanceled, j.Meta.State)
+		assert.Contains(j.Meta.Message, "2 files")
+		assert.False(j.Meta.End.IsZero())
+	}
+
+	assert.NotNil(AddJobFiles(job.ID, model.FileBatch{Sequence: 2, Files: []model.JobFile{model.JobFile{File: files.File{Signature: files.Signature{Path: "/test/file3"}}}}}))
+
+	// finished jobs can't be canceled
+	assert.NotNil(CancelJob(job.ID))
+
+	// the agent lost track of the job: it is canceled straight away
+	code = 404
+	job.ID = uuid.New().String()
+	job.Meta = &model.JobMeta{State: model.StateRunning, Start: time.Now().UTC()}
+	assert.Nil(gDb.SaveJob(job))
+
+	assert.Nil(CancelJob(job.ID))
+	j, err = gDb.GetJob(job.ID)
+	if assert.Nil(err) {
+		assert.Equal(model.StateCanceled, j.Meta.State)
+	}
+
+	// the agent can report the job finished while it is being asked to cancel it
+	code = 200
+	job.ID = uuid.New().String()
+	job.Meta = &model.JobMeta{State: model.StateRunning, Start: time.Now().UTC()}
+	assert.Nil(gDb.SaveJob(job))
+
+	during = func() { assert.Nil(FinishJob(job.ID, model.JobComplete{})) }
+	assert.Nil(CancelJob(job.ID))
+	during = nil
+	j, err = gDb.GetJob(job.ID)
+	if assert.Nil(err) {
+		assert.Equal(model.StateCanceled, j.Meta.State)
+	}
+
+	// any other failure leaves the job as it was
+	code = 500
+	job.ID = uuid.New().String()
+	job.Meta = &model.JobMeta{State: model.StateNotification, Start: time.Now().UTC()}
+	assert.Nil(gDb.SaveJob(job))
+
+	assert.NotNil(CancelJob(job.ID))
+	j, err = gDb.GetJob(job.ID)
+	if assert.Nil(err) {
+		assert.Equal(model.StateNotification, j.Meta.State)
+	}
+
+	// agent unreachable: the job is left as it was
+	ts.Close()
+	job.ID = uuid.New().String()
+	job.Meta = &model.JobMeta{State: model.StateRunning, Start: time.Now().UTC()}
+	assert.Nil(gDb.SaveJob(job))
+
+	assert.NotNil(CancelJob(job.ID))
+	j, err = gDb.GetJob(job.ID)
+	if assert.Nil(err) {
+		assert.Equal(model.StateRunning, j.Meta.State)
+	}
+}
+
+func TestFileBatches(t *testing.T) {
+	assert := assert.New(t)
+	if !assert.Nil(testManager()) {
+		return
+	}
+	defer gDb.Close()
+
+	agent := model.Agent{ID: uuid.New().String(), Name: "agent"}
+	assert.Nil(gDb.SaveAgent(agent))
+
+	job := model.Job{
+		ID:         uuid.New().String(),
+		Agent:      &agent,
+		Definition: &model.JobDefinition{Type: model.TypeBackup},
+		Meta:       &model.JobMeta{State: model.StateRunning, Start: time.Now().UTC()}}
+	assert.Nil(gDb.SaveJob(job))
+
+	batch := func(seq int, paths ...string) model.FileBatch {
+		b := model.FileBatch{Sequence: seq}
+		for _, p := range paths {
+			b.Files = append(b.Files, model.JobFile{File: files.File{Signature: files.Signature{Path: p}}, State: model.StateFinished})
+		}
+		return b
+	}
+
+	assert.NotNil(AddJobFiles(job.ID, batch(0, "/a")))
+	assert.Nil(AddJobFiles(job.ID, batch(2, "/c", "/d")))
+	// a retried batch is only recorded once
+	assert.Nil(AddJobFiles(job.ID, batch(2, "/c", "/d")))
+
+	// the agent reports 3 batches, but batches 1 and 3 are still on their way
+	assert.Nil(FinishJob(job.ID, model.JobComplete{Batches: 3}))
+	j, err := gDb.GetJob(job.ID)
+	if assert.Nil(err) {
+		assert.Equal(model.StateNotification, j.Meta.State)
+		assert.Equal(3, j.Meta.Batches)
+		assert.True(j.Meta.End.IsZero())
+	}
+
+	assert.Nil(AddJobFiles(job.ID, batch(3, "/e")))
+	j, err = gDb.GetJob(job.ID)
+	if assert.Nil(err) {
+		assert.Equal(model.StateNotification, j.Meta.State)
+	}
+
+	// the last batch to arrive finishes the job
+	assert.Nil(AddJobFiles(job.ID, batch(1, "/a", "/b")))
+	j, err = gDb.GetJob(job.ID)
+	if assert.Nil(err) {
+		assert.Equal(model.StateFinished, j.Meta.State)
+		assert.Equal(5, j.Meta.Complete)
+		assert.False(j.Meta.End.IsZero())
+	}
+
+	// the agent isn't asked to send these again
+	err = AddJobFiles(job.ID, batch(4, "/f"))
+	assert.True(IsRejected(err), "%v", err)
+	err = AddJobFiles(uuid.New().String(), batch(1, "/f"))
+	assert.True(IsRejected(err), "%v", err)
+}
+
+func TestFinishJobFailed(t *testing.T) {
+	assert := assert.New(t)
+	if !assert.Nil(testManager()) {
+		return
+	}
+	defer gDb.Close()
+
+	agent := model.Agent{ID: uuid.New().String(), Name: "agent"}
+	assert.Nil(gDb.SaveAgent(agent))
+
+	job := model.Job{
+		ID:         uuid.New().String(),
+		Agent:      &agent,
+		Definition: &model.JobDefinition{Type: model.TypeBackup},
+		Meta:       &model.JobMeta{State: model.StateRunning, Start: time.Now().UTC()}}
+	assert.Nil(gDb.SaveJob(job))
+
+	// the agent restarted and couldn't resume the job: it fails even though a batch is missing
+	assert.Nil(FinishJob(job.ID, model.JobComplete{Batches: 1, Error: "Agent restarted while the job was running"}))
+	j, err := gDb.GetJob(job.ID)
+	if assert.Nil(err) {
+		assert.Equal(model.StateFailed, j.Meta.State)
+		assert.Equal("Agent restarted while the job was running", j.Meta.Message)
+		assert.Equal(1, j.Meta.Batches)
+		assert.False(j.Meta.End.IsZero())
+	}
+
+	// a late completion doesn't change the failed job
+	assert.Nil(FinishJob(job.ID, model.JobComplete{Batches: 0}))
+	j, err = gDb.GetJob(job.ID)
+	if assert.Nil(err) {
+		assert.Equal(model.StateFailed, j.Meta.State)
+		assert.Equal(1, j.Meta.Batches)
+	}
+}
+
+func TestNewJobValidation(t *testing.T) {
+	assert := assert.New(t)
+	if !assert.Nil(testManager()) {
+		return
+	}
+	defer gDb.Close()
+
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		// this agent only has the logger engine
+		w.Write([]byte(`{"data":{"capabilities":{"version":"0.1.0","engines":[{"name":"logger","save":true,"restore":true,"saveOptions":[{"name":"logPath","type":"string","required":true}]}],"modifications":[]}}}`))
+	}))
+	defer ts.Close()
+
+	agent := model.Agent{ID: uuid.New().String(), Name: "agent", Address: ts.URL}
+	assert.Nil(gDb.SaveAgent(agent))
+
+	jdef := model.JobDefinition{
+		Type:  model.TypeBackup,
+		Paths: []model.Path{model.Path{Root: "/data"}},
+		To:    []engine.Definition{engine.Definition{Name: engine.NameDedup, Options: map[string]interface{}{"savePath": "/backups"}}},
+	}
+
+	// the coordinator knows dedup, but the agent doesn't
+	assert.Nil(jdef.Validate(localCapabilities()))
+	_, err := NewJob(jdef, agent.ID)
+	if assert.NotNil(err) {
+		assert.Contains(err.Error(), "to[0].name: unknown engine dedup")
+	}
+	assert.Equal([]string{"/capabilities"}, paths)
+
+	jobs, err := gDb.JobList(map[string]string{"agent": agent.ID})
+	assert.Nil(err)
+	assert.Empty(jobs)
+
+	_, err = CreateJobDefinition(model.JobDefinition{Type: model.TypeBackup})
+	if assert.NotNil(err) {
+		assert.Contains(err.Error(), "paths")
+	}
+}
+
+func TestVisibleJobList(t *testing.T) {
+	assert := assert.New(t)
+	if !assert.Nil(testManager()) {
+		return
+	}
+	defer gDb.Close()
+
+	mine := model.Agent{ID: uuid.New().String(), Name: "mine"}
+	other := model.Agent{ID: uuid.New().String(), Name: "other"}
+	assert.Nil(gDb.SaveAgent(mine))
+	assert.Nil(gDb.SaveAgent(other))
+
+	// the other agent's jobs fill the first pages
+	start := time.Now().UTC().Add(-time.Hour)
+	var ids []string
+	for i := 0; i < 250; i++ {
+		agent := &other
+		if i%50 == 0 {
+			agent = &mine
+		}
+		j := model.Job{
+			ID:         uuid.New().String(),
+			Agent:      agent,
+			Definition: &model.JobDefinition{Type: model.TypeBackup},
+			Meta:       &model.JobMeta{State: model.StateFinished, Start: start.Add(time.Duration(i) * time.Second)}}
+		assert.Nil(gDb.SaveJob(j))
+		if agent == &mine {
+			ids = append(ids, j.ID)
+		}
+	}
+
+	visible := func(agentID string) bool { return agentID == mine.ID }
+
+	jobs, err := VisibleJobList(map[string]string{}, visible)
+	if assert.Nil(err) {
+		assert.ElementsMatch(ids, jobIDs(jobs))
+	}
+
+	jobs, err = VisibleJobList(map[string]string{"limit": "2", "offset": "1"}, visible)
+	if assert.Nil(err) && assert.Len(jobs, 2) {
+		for _, j := range jobs {
+			assert.Equal(mine.ID, j.Agent.ID)
+		}
+	}
+
+	_, err = VisibleJobList(map[string]string{"limit": "x"}, visible)
+	assert.NotNil(err)
+}
+
+func TestScopeRestore(t *testing.T) {
+	assert := assert.New(t)
+	if !assert.Nil(testManager()) {
+		return
+	}
+	defer gDb.Close()
+
+	mine := model.Agent{ID: uuid.New().String(), Name: "mine"}
+	other := model.Agent{ID: uuid.New().String(), Name: "other"}
+	assert.Nil(gDb.SaveAgent(mine))
+	assert.Nil(gDb.SaveAgent(other))
+	visible := func(agentID string) bool { return agentID == mine.ID }
+
+	saved := engine.Definition{Name: engine.NameLocalFile, Options: map[string]interface{}{"savePath": "/backups"}}
+	backup := model.Job{
+		ID:         uuid.New().String(),
+		Agent:      &mine,
+		Definition: &model.JobDefinition{Type: model.TypeBackup, To: []engine.Definition{saved}},
+		Meta:       &model.JobMeta{State: model.StateFinished}}
+	hidden := model.Job{
+		ID:         uuid.New().String(),
+		Agent:      &other,
+		Definition: &model.JobDefinition{Type: model.TypeBackup, To: []engine.Definition{saved}},
+		Meta:       &model.JobMeta{State: model.StateFinished}}
+	assert.Nil(gDb.SaveJob(backup))
+	assert.Nil(gDb.SaveJob(hidden))
+
+	file := files.File{Signature: files.Signature{Path: "/data/file", Hash: "1"}, Meta: files.Meta{Mode: 0600, UID: 1000}}
+	assert.Nil(gDb.SaveJobFile(backup.ID, model.JobFile{File: file, State: "complete"}))
+
+	restore := func(f files.File, overwrite bool) *model.JobDefinition {
+		return &model.JobDefinition{
+			Type:  model.TypeRestore,
+			From:  &saved,
+			Files: []files.File{f},
+			To: []engine.Definition{engine.Definition{
+				Name:    engine.NameLocalFile,
+				Options: map[string]interface{}{"restorePath": "/restore", "overwrite": overwrite}}}}
+	}
+
+	// the recorded metadata replaces what was sent
+	changed := file
+	changed.Meta.UID = 0
+	jd := restore(changed, false)
+	if assert.Nil(ScopeRestore(jd, backup.ID, visible)) {
+		assert.Equal(1000, jd.Files[0].Meta.UID)
+	}
+
+	assert.NotNil(ScopeRestore(restore(file, false), "", visible))
+	assert.NotNil(ScopeRestore(restore(file, false), hidden.ID, visible))
+	assert.NotNil(ScopeRestore(restore(file, true), backup.ID, visible))
+
+	unsaved := file
+	unsaved.Path = "/etc/shadow"
+	assert.NotNil(ScopeRestore(restore(unsaved, false), backup.ID, visible))
+
+	jd = restore(file, false)
+	jd.From = &engine.Definition{Name: engine.NameLocalFile, Options: map[string]interface{}{"savePath": "/elsewhere"}}
+	assert.NotNil(ScopeRestore(jd, backup.ID, visible))
+}
+
+func TestStartCanceled(t *testing.T) {
+	assert := assert.New(t)
+	if !assert.Nil(testManager()) {
+		return
+	}
+	defer gDb.Close()
+
+	agent := model.Agent{ID: uuid.New().String(), Name: "agent"}
+	assert.Nil(gDb.SaveAgent(agent))
+
+	job := model.Job{
+		ID:         uuid.New().String(),
+		Agent:      &agent,
+		Definition: &model.JobDefinition{Type: model.TypeBackup},
+		Meta:       &model.JobMeta{State: model.StateNew, Start: time.Now().UTC()}}
+	assert.Nil(gDb.SaveJob(job))
+
+	// canceled before it was sent to the agent
+	_, _, err := startCancel(job.ID)
+	assert.Nil(err)
+	assert.NotNil(markStarting(job.ID))
+
+	// a failure to start doesn't overwrite the cancel either
+	failStart(job.ID, "agent unreachable")
+	j, err := gDb.GetJob(job.ID)
+	if assert.Nil(err) {
+		assert.Equal(model.StateCanceling, j.Meta.State)
+	}
+
+	job.ID = uuid.New().String()
+	assert.Nil(gDb.SaveJob(job))
+	assert.Nil(markStarting(job.ID))
+	failStart(job.ID, "agent unreachable")
+	j, err = gDb.GetJob(job.ID)
+	if assert.Nil(err) {
+		assert.Equal(model.StateFailed, j.Meta.State)
+		assert.Equal("agent unreachable", j.Meta.Message)
+	}
+}
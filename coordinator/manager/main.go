@@ -1,25 +1,36 @@
 package manager
 
 import (
+	"crypto/rand"
+	"sync"
+
 	"github.com/robfig/cron"
 	"github.com/sethjback/gobl/config"
 	"github.com/sethjback/gobl/email"
 	"github.com/sethjback/gobl/gobldb"
+	"github.com/sethjback/gobl/gobldb/errors"
 	"github.com/sethjback/gobl/gobldb/leveldb"
+	"github.com/sethjback/gobl/gobldb/sqlite"
+	"github.com/sethjback/gobl/goblerr"
 	"github.com/sethjback/gobl/keys"
 	"github.com/sethjback/gobl/util/log"
 )
 
+// defaultTokenLifetime is the number of seconds login tokens are valid for if not configured
+const defaultTokenLifetime = 3600
+
 var gDb gobldb.Database
 var conf *config.Config
 var schedules *cron.Cron
 var signer keys.Signer
 var verifiers map[string]keys.Verifier
+var verifierLock sync.RWMutex
+var tokenSecret []byte
 
 // Init sets up the environement to run
 func Init(c *config.Config) error {
 	var err error
-	gDb, err = leveldb.New(c.DB)
+	gDb, err = OpenDB(c.DB)
 	if err != nil {
 		return err
 	}
@@ -35,6 +46,7 @@ func Init(c *config.Config) error {
 		return err
 	}
 
+	verifierLock.Lock()
 	verifiers = make(map[string]keys.Verifier)
 	for _, a := range agents {
 		akey, e := keys.DecodePublicKeyString(a.PublicKey)
@@ -45,13 +57,41 @@ func Init(c *config.Config) error {
 		}
 
 	}
+	verifierLock.Unlock()
 
 	conf = c
 
+	if c.Auth.TokenSecret != "" {
+		tokenSecret = []byte(c.Auth.TokenSecret)
+	} else {
+		log.Warn("manager", "no token secret configured: generating one, login tokens will not survive a restart")
+		tokenSecret = make([]byte, 32)
+		if _, err = rand.Read(tokenSecret); err != nil {
+			return err
+		}
+	}
+
 	//init existing schedules
 	err = initCron()
+	if err != nil {
+		return err
+	}
+
+	startReconciler(c.Reconcile)
+
+	return nil
+}
+
+// OpenDB opens the database with the configured driver
+func OpenDB(c config.DB) (gobldb.Database, error) {
+	switch c.Driver {
+	case "", gobldb.DriverLevelDB:
+		return leveldb.New(c)
+	case gobldb.DriverSQLite:
+		return sqlite.New(c)
+	}
 
-	return err
+	return nil, goblerr.New("Unknown database driver: "+c.Driver, errors.ErrDBDriver, "driver must be leveldb or sqlite")
 }
 
 func initCron() error {
@@ -85,6 +125,7 @@ func SendTestEmail() error {
 }
 
 func Shutdown() {
+	stopReconciler()
 	schedules.Stop()
 	gDb.Close()
 }
@@ -0,0 +1,283 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/google/uuid"
+	"github.com/sethjback/gobl/engine"
+	"github.com/sethjback/gobl/files"
+	"github.com/sethjback/gobl/httpapi"
+	"github.com/sethjback/gobl/model"
+)
+
+// pruneBlockingStates are the states of jobs that may still save objects
+var pruneBlockingStates = []string{model.StateNew, model.StateRunning, model.StateCanceling, model.StateNotification}
+
+// pruneReferenceBytes is roughly the most signature data sent to the agent in one request,
+// well under what the agent will read
+const pruneReferenceBytes = 512 << 10
+
+// Prune asks the agent to remove the objects in its save engines that are no longer referenced by any job.
+// If no engines are given every save engine used by the agent's jobs and the job definitions is pruned.
+// Objects referenced by any job in the database are kept, regardless of which agent ran it, since
+// agents can share a save location. For the same reason the prune is refused while any agent runs a backup
+// saving to one of the engines. The references are sent to the agent in pages ahead of the prune itself
+func Prune(agentID string, engines []engine.Definition, dryRun bool) ([]model.PruneResult, error) {
+	agent, err := gDb.GetAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// objects saved by a running job may not have been reported yet
+	for _, state := range pruneBlockingStates {
+		jobs, err := gDb.JobList(map[string]string{"agent": agentID, "state": state, "limit": "1"})
+		if err != nil {
+			return nil, err
+		}
+		if len(jobs) > 0 {
+			return nil, errors.New("Cannot prune while the agent has running jobs")
+		}
+	}
+
+	refs := &references{agent: *agent, session: uuid.New().String(), seen: make(map[string]bool)}
+	var agentEngines []engine.Definition
+
+	// no job can be deleted while the references are collected, or the pages would skip one
+	deleteM.RLock()
+	err = eachJob(nil, func(j model.Job) error {
+		if j.Definition != nil {
+			if j.Agent != nil && j.Agent.ID == agentID && j.Definition.Type == model.TypeBackup {
+				agentEngines = appendEngines(agentEngines, j.Definition.To)
+			}
+			for _, f := range j.Definition.Files {
+				if err := refs.add(f.Signature); err != nil {
+					return err
+				}
+			}
+		}
+
+		jfs, err := gDb.JobFileList(j.ID, map[string]string{"parent": "*"})
+		if err != nil {
+			return err
+		}
+		for _, jf := range jfs {
+			if err = refs.add(jf.File.Signature); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	deleteM.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	req := model.PruneRequest{Engines: engines, DryRun: dryRun, Referenced: refs.page}
+	if refs.sent {
+		req.Session = refs.session
+	}
+
+	if len(engines) == 0 {
+		if req.Engines, err = backupEngines(agentEngines); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(req.Engines) == 0 {
+		return []model.PruneResult{}, nil
+	}
+
+	if err = checkSaving(req.Engines); err != nil {
+		return nil, err
+	}
+
+	aR := httpapi.NewRequest(agent.Address, "/prune", "POST")
+	if err = aR.SetBody(req); err != nil {
+		return nil, err
+	}
+
+	response, err := aR.Send(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.HTTPCode != 200 {
+		return nil, fmt.Errorf("Agent prune failed: %d", response.HTTPCode)
+	}
+
+	// round trip the generic response data into the result type
+	b, err := json.Marshal(response.Data["results"])
+	if err != nil {
+		return nil, err
+	}
+
+	var results []model.PruneResult
+	if err = json.Unmarshal(b, &results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// references collects the referenced signatures for a prune, skipping duplicates, and sends them to the
+// agent a page at a time. The last page goes with the prune request
+type references struct {
+	agent   model.Agent
+	session string
+	seen    map[string]bool
+	page    []files.Signature
+	size    int
+	// sent is true once a page has been sent ahead of the prune
+	sent bool
+}
+
+func (r *references) add(sig files.Signature) error {
+	b, _ := json.Marshal(sig)
+	if r.seen[string(b)] {
+		return nil
+	}
+	r.seen[string(b)] = true
+
+	if r.size+len(b) > pruneReferenceBytes && len(r.page) > 0 {
+		if err := r.flush(); err != nil {
+			return err
+		}
+	}
+
+	r.page = append(r.page, sig)
+	r.size += len(b)
+	return nil
+}
+
+func (r *references) flush() error {
+	aR := httpapi.NewRequest(r.agent.Address, "/prune/references", "POST")
+	if err := aR.SetBody(model.PruneReferences{Session: r.session, Referenced: r.page}); err != nil {
+		return err
+	}
+
+	response, err := aR.Send(signer)
+	if err != nil {
+		return err
+	}
+
+	if response.HTTPCode != 200 {
+		return fmt.Errorf("Agent prune references failed: %d", response.HTTPCode)
+	}
+
+	r.page = nil
+	r.size = 0
+	r.sent = true
+	return nil
+}
+
+// Stats asks the agent how much space its save engines use, and for engines that deduplicate how well they do.
+// If no engines are given it reports on every save engine used by the agent's jobs and the job definitions
+func Stats(agentID string, engines []engine.Definition) ([]model.StatsResult, error) {
+	agent, err := gDb.GetAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(engines) == 0 {
+		err = eachJob(map[string]string{"agent": agentID}, func(j model.Job) error {
+			if j.Definition != nil && j.Definition.Type == model.TypeBackup {
+				engines = appendEngines(engines, j.Definition.To)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if engines, err = backupEngines(engines); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(engines) == 0 {
+		return []model.StatsResult{}, nil
+	}
+
+	aR := httpapi.NewRequest(agent.Address, "/stats", "POST")
+	if err = aR.SetBody(model.StatsRequest{Engines: engines}); err != nil {
+		return nil, err
+	}
+
+	response, err := aR.Send(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.HTTPCode != 200 {
+		return nil, fmt.Errorf("Agent stats failed: %d", response.HTTPCode)
+	}
+
+	b, err := json.Marshal(response.Data["results"])
+	if err != nil {
+		return nil, err
+	}
+
+	var results []model.StatsResult
+	if err = json.Unmarshal(b, &results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// backupEngines adds the save engines of every backup job definition to the engines of the agent's backup jobs
+func backupEngines(engines []engine.Definition) ([]engine.Definition, error) {
+	jdefs, err := gDb.JobDefinitionList()
+	if err != nil {
+		return nil, err
+	}
+	for _, jd := range jdefs {
+		if jd.Type == model.TypeBackup {
+			engines = appendEngines(engines, jd.To)
+		}
+	}
+
+	return engines, nil
+}
+
+// checkSaving fails if a backup on any agent that may still save objects is saving to one of the engines
+func checkSaving(engines []engine.Definition) error {
+	for _, state := range pruneBlockingStates {
+		err := eachJob(map[string]string{"state": state}, func(j model.Job) error {
+			if j.Definition == nil || j.Definition.Type != model.TypeBackup {
+				return nil
+			}
+			for _, d := range j.Definition.To {
+				if hasEngine(engines, d) {
+					return fmt.Errorf("Cannot prune while job %s is saving to %s", j.ID, d.Name)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendEngines adds the definitions not already in the list
+func appendEngines(list []engine.Definition, defs []engine.Definition) []engine.Definition {
+	for _, d := range defs {
+		if !hasEngine(list, d) {
+			list = append(list, d)
+		}
+	}
+	return list
+}
+
+func hasEngine(list []engine.Definition, d engine.Definition) bool {
+	for _, l := range list {
+		if l.Name == d.Name && reflect.DeepEqual(l.Options, d.Options) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sethjback/gobl/engine"
+	"github.com/sethjback/gobl/files"
+	"github.com/sethjback/gobl/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrune(t *testing.T) {
+	assert := assert.New(t)
+	if !assert.Nil(testManager()) {
+		return
+	}
+	defer gDb.Close()
+
+	var received model.PruneRequest
+	var pages []model.PruneReferences
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		// the agent reads at most 1MB
+		assert.True(len(b) < 1<<20, len(b))
+		if r.URL.Path == "/prune/references" {
+			var refs model.PruneReferences
+			json.Unmarshal(b, &refs)
+			pages = append(pages, refs)
+			w.WriteHeader(200)
+			return
+		}
+		received = model.PruneRequest{}
+		json.Unmarshal(b, &received)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write([]byte(`{"data":{"results":[{"engine":"LocalFile","objects":2,"bytes":300,"deleted":0}]}}`))
+	}))
+	defer ts.Close()
+
+	agent := model.Agent{ID: uuid.New().String(), Name: "agent", Address: ts.URL}
+	other := model.Agent{ID: uuid.New().String(), Name: "other", Address: ts.URL}
+	assert.Nil(gDb.SaveAgent(agent))
+	assert.Nil(gDb.SaveAgent(other))
+
+	to := []engine.Definition{engine.Definition{Name: engine.NameLocalFile, Options: map[string]interface{}{"savePath": "/backups"}}}
+	job := model.Job{
+		ID:         uuid.New().String(),
+		Agent:      &agent,
+		Definition: &model.JobDefinition{Type: model.TypeBackup, To: to},
+		Meta:       &model.JobMeta{State: model.StateFinished, End: time.Now().UTC()}}
+	otherJob := model.Job{
+		ID:         uuid.New().String(),
+		Agent:      &other,
+		Definition: &model.JobDefinition{Type: model.TypeBackup, To: to},
+		Meta:       &model.JobMeta{State: model.StateFinished, End: time.Now().UTC()}}
+	assert.Nil(gDb.SaveJob(job))
+	assert.Nil(gDb.SaveJob(otherJob))
+
+	sig1 := files.Signature{Path: "/test/file1", Hash: "1"}
+	sig2 := files.Signature{Path: "/test/file2", Hash: "2"}
+	assert.Nil(gDb.SaveJobFile(job.ID, model.JobFile{File: files.File{Signature: sig1}, State: "complete"}))
+	assert.Nil(gDb.SaveJobFile(otherJob.ID, model.JobFile{File: files.File{Signature: sig2}, State: "complete"}))
+
+	// files from every agent's jobs are kept, engines come from the agent's jobs
+	results, err := Prune(agent.ID, nil, true)
+	if assert.Nil(err) {
+		assert.Equal([]model.PruneResult{model.PruneResult{Engine: "LocalFile", Objects: 2, Bytes: 300}}, results)
+	}
+	assert.True(received.DryRun)
+	assert.Len(received.Engines, 1)
+	assert.ElementsMatch([]files.Signature{sig1, sig2}, received.Referenced)
+	// few enough references to go with the request
+	assert.Empty(pages)
+	assert.Empty(received.Session)
+
+	// explicit engines are used as given
+	explicit := []engine.Definition{engine.Definition{Name: engine.NameLocalFile, Options: map[string]interface{}{"savePath": "/elsewhere"}}}
+	_, err = Prune(agent.ID, explicit, false)
+	assert.Nil(err)
+	assert.False(received.DryRun)
+	assert.Equal("/elsewhere", received.Engines[0].Options["savePath"])
+
+	// running jobs on the agent block the prune
+	otherJob.Meta.State = model.StateRunning
+	assert.Nil(gDb.SaveJob(otherJob))
+	_, err = Prune(other.ID, nil, true)
+	assert.NotNil(err)
+
+	// as do backups on other agents saving to the same engine
+	received = model.PruneRequest{}
+	_, err = Prune(agent.ID, nil, true)
+	assert.NotNil(err)
+	assert.Empty(received.Engines)
+
+	// backups saving elsewhere do not
+	_, err = Prune(agent.ID, explicit, true)
+	assert.Nil(err)
+
+	otherJob.Meta.State = model.StateFinished
+	assert.Nil(gDb.SaveJob(otherJob))
+
+	// a big catalog is sent in pages ahead of the prune
+	big := model.Job{
+		ID:         uuid.New().String(),
+		Agent:      &agent,
+		Definition: &model.JobDefinition{Type: model.TypeBackup, To: to},
+		Meta:       &model.JobMeta{State: model.StateFinished, End: time.Now().UTC()}}
+	assert.Nil(gDb.SaveJob(big))
+	long := strings.Repeat("d", 200)
+	for i := 0; i < 6000; i++ {
+		sig := files.Signature{Path: fmt.Sprintf("/%s/file%d", long, i), Hash: strconv.Itoa(i)}
+		assert.Nil(gDb.SaveJobFile(big.ID, model.JobFile{File: files.File{Signature: sig}, State: "complete"}))
+	}
+
+	_, err = Prune(agent.ID, nil, true)
+	if assert.Nil(err) && assert.True(len(pages) > 1) {
+		total := len(received.Referenced)
+		for _, p := range pages {
+			assert.Equal(received.Session, p.Session)
+			total += len(p.Referenced)
+		}
+		assert.NotEmpty(received.Session)
+		assert.Equal(6002, total)
+	}
+}
+
+func TestStats(t *testing.T) {
+	assert := assert.New(t)
+	if !assert.Nil(testManager()) {
+		return
+	}
+	defer gDb.Close()
+
+	var path string
+	var received model.StatsRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		b, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(b, &received)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write([]byte(`{"data":{"results":[{"engine":"dedup","files":3,"bytes":3000,"storedBytes":1000,"chunks":10,"ratio":3}]}}`))
+	}))
+	defer ts.Close()
+
+	agent := model.Agent{ID: uuid.New().String(), Name: "agent", Address: ts.URL}
+	assert.Nil(gDb.SaveAgent(agent))
+
+	// nothing to report on without any engines
+	results, err := Stats(agent.ID, nil)
+	assert.Nil(err)
+	assert.Empty(results)
+	assert.Equal("", path)
+
+	to := []engine.Definition{engine.Definition{Name: engine.NameDedup, Options: map[string]interface{}{"savePath": "/backups"}}}
+	assert.Nil(gDb.SaveJobDefinition(model.JobDefinition{ID: uuid.New().String(), Type: model.TypeBackup, To: to}))
+
+	results, err = Stats(agent.ID, nil)
+	if assert.Nil(err) {
+		assert.Equal([]model.StatsResult{model.StatsResult{Engine: "dedup", Stats: engine.Stats{Files: 3, Bytes: 3000, StoredBytes: 1000, Chunks: 10, Ratio: 3}}}, results)
+	}
+	assert.Equal("/stats", path)
+	assert.Equal(to, received.Engines)
+
+	_, err = Stats(uuid.New().String(), nil)
+	assert.NotNil(err)
+}
@@ -0,0 +1,257 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sethjback/gobl/config"
+	"github.com/sethjback/gobl/httpapi"
+	"github.com/sethjback/gobl/model"
+	"github.com/sethjback/gobl/util/log"
+)
+
+const (
+	defaultReconcileInterval = time.Minute
+	// defaultOrphanTimeout is well above the agents' default retry_max, the longest a batch being retried
+	// can take to arrive
+	defaultOrphanTimeout = 30 * time.Minute
+)
+
+// orphan records when a job was first found missing from its agent, and how many file batches
+// had arrived for it then. Batches still arriving mean the job is only waiting on notifications
+type orphan struct {
+	since    time.Time
+	received int
+}
+
+var reconcileStop chan struct{}
+var reconcileDone chan struct{}
+
+// orphans are the active jobs their agents no longer know about. Only used by the reconciler
+var orphans = make(map[string]orphan)
+
+// startReconciler checks the active jobs against their agents every interval, until stopReconciler
+func startReconciler(c config.Reconcile) {
+	if c.Interval < 0 {
+		log.Info("reconcile", "job reconciliation is turned off")
+		return
+	}
+
+	interval := time.Duration(c.Interval) * time.Second
+	if interval == 0 {
+		interval = defaultReconcileInterval
+	}
+
+	reconcileStop = make(chan struct{})
+	reconcileDone = make(chan struct{})
+
+	go func() {
+		defer close(reconcileDone)
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				reconcile(time.Now().UTC())
+			case <-reconcileStop:
+				return
+			}
+		}
+	}()
+}
+
+func stopReconciler() {
+	if reconcileStop == nil {
+		return
+	}
+	close(reconcileStop)
+	<-reconcileDone
+	reconcileStop = nil
+}
+
+// reconcile checks each active job against the agent running it. Running jobs past their definition's
+// maximum runtime are canceled on the agent and marked failed. Jobs the agent no longer knows about are
+// marked failed once they have been missing, with no file batches arriving, for the orphan timeout.
+// Nothing is done about the jobs of an agent that can't be reached, other than enforcing the maximum runtime.
+// Jobs still new after the orphan timeout were never handed to their agent, e.g. the coordinator was
+// restarted while starting them, and are marked failed
+func reconcile(now time.Time) {
+	jobs, err := activeJobs()
+	if err != nil {
+		log.Errorf("reconcile", "Unable to list active jobs: %v", err)
+		return
+	}
+
+	timeout := defaultOrphanTimeout
+	if conf != nil && conf.Reconcile.OrphanTimeout > 0 {
+		timeout = time.Duration(conf.Reconcile.OrphanTimeout) * time.Second
+	}
+
+	// the jobs each agent is running, nil if it couldn't be reached
+	running := make(map[string]map[string]bool)
+	active := make(map[string]bool)
+
+	for _, job := range jobs {
+		active[job.ID] = true
+
+		if job.Meta.State == model.StateNew {
+			if now.Sub(job.Meta.Start) > timeout {
+				failActive(job.ID, "Job was never started on its agent")
+			}
+			continue
+		}
+
+		if job.Agent == nil {
+			continue
+		}
+
+		known, checked := running[job.Agent.ID]
+		if !checked {
+			known, err = agentJobs(*job.Agent)
+			if err != nil {
+				log.Warnf("reconcile", "Unable to get jobs from agent %s: %v", job.Agent.Name, err)
+			}
+			running[job.Agent.ID] = known
+		}
+
+		// a job waiting on notifications has already finished on the agent: its batches may still be retried
+		if limit := maxRuntime(job); limit > 0 && job.Meta.State != model.StateNotification && now.Sub(job.Meta.Start) > limit {
+			if known[job.ID] {
+				cancelOnAgent(job)
+			}
+			failActive(job.ID, fmt.Sprintf("Job exceeded its maximum runtime of %s", limit))
+			delete(orphans, job.ID)
+			continue
+		}
+
+		if known == nil {
+			continue
+		}
+
+		if known[job.ID] {
+			delete(orphans, job.ID)
+			continue
+		}
+
+		received := job.Meta.Received.Len()
+		o, seen := orphans[job.ID]
+		if !seen || o.received != received {
+			orphans[job.ID] = orphan{since: now, received: received}
+			continue
+		}
+
+		if now.Sub(o.since) < timeout {
+			continue
+		}
+
+		var reason string
+		if job.Meta.State == model.StateNotification {
+			reason = fmt.Sprintf("Agent %s finished the job but %d of its %d file batches never arrived", job.Agent.Name, job.Meta.Batches-received, job.Meta.Batches)
+		} else {
+			reason = fmt.Sprintf("Agent %s no longer has the job: it was likely restarted without saving its jobs", job.Agent.Name)
+		}
+		failActive(job.ID, reason)
+		delete(orphans, job.ID)
+	}
+
+	// forget jobs that have since finished
+	for id := range orphans {
+		if !active[id] {
+			delete(orphans, id)
+		}
+	}
+}
+
+// activeJobs returns the jobs the coordinator thinks are still running
+func activeJobs() ([]model.Job, error) {
+	var jobs []model.Job
+	for _, state := range []string{model.StateNew, model.StateRunning, model.StateNotification, model.StateCanceling} {
+		err := eachJob(map[string]string{"state": state}, func(j model.Job) error {
+			jobs = append(jobs, j)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return jobs, nil
+}
+
+// agentJobs returns the ids of the jobs the agent is running
+func agentJobs(agent model.Agent) (map[string]bool, error) {
+	aR := httpapi.NewRequest(agent.Address, "/jobs", "GET")
+
+	response, err := aR.Send(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.HTTPCode != 200 {
+		return nil, fmt.Errorf("Agent job list failed: %d", response.HTTPCode)
+	}
+
+	status, ok := response.Data["agent"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("Agent did not return its jobs")
+	}
+	ids, ok := status["jobs"].([]interface{})
+	if !ok {
+		return nil, errors.New("Agent did not return its jobs")
+	}
+
+	known := make(map[string]bool)
+	for _, id := range ids {
+		if s, ok := id.(string); ok {
+			known[s] = true
+		}
+	}
+	return known, nil
+}
+
+func maxRuntime(job model.Job) time.Duration {
+	if job.Definition == nil {
+		return 0
+	}
+	return time.Duration(job.Definition.MaxRuntime) * time.Second
+}
+
+// cancelOnAgent asks the agent to stop the job. The job is failed whether or not it does
+func cancelOnAgent(job model.Job) {
+	aR := httpapi.NewRequest(job.Agent.Address, "/jobs/"+job.ID, "DELETE")
+	if response, err := aR.Send(signer); err != nil {
+		log.Warnf("reconcile", "Unable to cancel job %s on agent %s: %v", job.ID, job.Agent.Name, err)
+	} else if response.HTTPCode != 200 {
+		log.Warnf("reconcile", "Unable to cancel job %s on agent %s: %d", job.ID, job.Agent.Name, response.HTTPCode)
+	}
+}
+
+// failActive fails the job, unless it finished while the reconciler was checking it.
+// A job that was being canceled is marked canceled instead
+func failActive(id, reason string) {
+	jobsM.Lock()
+	defer jobsM.Unlock()
+
+	job, err := gDb.GetJob(id)
+	if err != nil {
+		log.Errorf("reconcile", "Unable to get job %s: %v", id, err)
+		return
+	}
+
+	switch job.Meta.State {
+	case model.StateNew, model.StateRunning, model.StateNotification:
+		log.Warnf("reconcile", "Failing job %s: %s", id, reason)
+		err = failJob(job, reason)
+	case model.StateCanceling:
+		log.Warnf("reconcile", "Canceling job %s: %s", id, reason)
+		err = markCanceled(job)
+	default:
+		return
+	}
+
+	if err != nil {
+		log.Errorf("reconcile", "Unable to update job %s: %v", id, err)
+	}
+}
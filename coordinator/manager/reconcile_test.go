@@ -0,0 +1,176 @@
+package manager
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sethjback/gobl/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcile(t *testing.T) {
+	assert := assert.New(t)
+	if !assert.Nil(testManager()) {
+		return
+	}
+	defer gDb.Close()
+
+	activeJob := func(agent model.Agent, state string, started time.Time) model.Job {
+		job := model.Job{
+			ID:         uuid.New().String(),
+			Agent:      &agent,
+			Definition: &model.JobDefinition{Type: model.TypeBackup},
+			Meta:       &model.JobMeta{State: state, Start: started}}
+		return job
+	}
+
+	now := time.Now().UTC()
+
+	m := &sync.Mutex{}
+	var deletes []string
+	var known []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		switch r.Method {
+		case "DELETE":
+			deletes = append(deletes, r.URL.Path)
+		case "GET":
+			ids := "[]"
+			if len(known) > 0 {
+				ids = `["` + known[0] + `","` + known[1] + `"]`
+			}
+			fmt.Fprintf(w, `{"data":{"agent":{"goRoutines":10,"jobs":%s}}}`, ids)
+		}
+	}))
+	defer ts.Close()
+
+	agent := model.Agent{ID: uuid.New().String(), Name: "agent", Address: ts.URL}
+	assert.Nil(gDb.SaveAgent(agent))
+	down := model.Agent{ID: uuid.New().String(), Name: "down", Address: "http://127.0.0.1:1"}
+	assert.Nil(gDb.SaveAgent(down))
+
+	running := activeJob(agent, model.StateRunning, now)
+	lost := activeJob(agent, model.StateRunning, now)
+	// past its maximum runtime, but already finished on the agent
+	waiting := activeJob(agent, model.StateNotification, now.Add(-2*time.Hour))
+	waiting.Definition.MaxRuntime = 3600
+	waiting.Meta.Batches = 3
+	waiting.Meta.Received = model.Sequences{{1, 1}}
+	overdue := activeJob(agent, model.StateRunning, now.Add(-2*time.Hour))
+	overdue.Definition.MaxRuntime = 3600
+	unreachable := activeJob(down, model.StateRunning, now)
+	finished := activeJob(agent, model.StateFinished, now)
+	// never handed to the agent
+	stuck := activeJob(agent, model.StateNew, now)
+
+	for _, j := range []model.Job{running, lost, waiting, overdue, unreachable, finished, stuck} {
+		assert.Nil(gDb.SaveJob(j))
+	}
+	known = []string{running.ID, overdue.ID}
+
+	state := func(id string) *model.JobMeta {
+		j, err := gDb.GetJob(id)
+		if !assert.Nil(err) {
+			return &model.JobMeta{}
+		}
+		return j.Meta
+	}
+
+	// the overdue job is canceled on the agent and failed straight away
+	reconcile(now)
+	assert.Equal([]string{"/jobs/" + overdue.ID}, deletes)
+	assert.Equal(model.StateFailed, state(overdue.ID).State)
+	assert.Equal("Job exceeded its maximum runtime of 1h0m0s", state(overdue.ID).Message)
+
+	// the others missing from the agent are only failed once the orphan timeout has passed
+	assert.Equal(model.StateRunning, state(lost.ID).State)
+	assert.Equal(model.StateNotification, state(waiting.ID).State)
+	assert.Equal(model.StateNew, state(stuck.ID).State)
+
+	// a batch arriving shows the waiting job is still making progress
+	assert.Nil(AddJobFiles(waiting.ID, model.FileBatch{Sequence: 2}))
+
+	reconcile(now.Add(defaultOrphanTimeout))
+
+	assert.Equal(model.StateRunning, state(running.ID).State)
+	assert.Equal(model.StateRunning, state(unreachable.ID).State)
+	assert.Equal(model.StateFinished, state(finished.ID).State)
+
+	meta := state(lost.ID)
+	assert.Equal(model.StateFailed, meta.State)
+	assert.Equal("Agent agent no longer has the job: it was likely restarted without saving its jobs", meta.Message)
+	assert.False(meta.End.IsZero())
+
+	assert.Equal(model.StateNotification, state(waiting.ID).State)
+
+	reconcile(now.Add(2 * defaultOrphanTimeout))
+	meta = state(waiting.ID)
+	assert.Equal(model.StateFailed, meta.State)
+	assert.Equal("Agent agent finished the job but 1 of its 3 file batches never arrived", meta.Message)
+
+	meta = state(stuck.ID)
+	assert.Equal(model.StateFailed, meta.State)
+	assert.Equal("Job was never started on its agent", meta.Message)
+
+	assert.Equal(model.StateRunning, state(running.ID).State)
+	assert.Len(deletes, 1)
+	assert.Empty(orphans)
+}
+
+func TestJobStatus(t *testing.T) {
+	assert := assert.New(t)
+	if !assert.Nil(testManager()) {
+		return
+	}
+	defer gDb.Close()
+
+	var jobID string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/jobs/"+jobID {
+			fmt.Fprintf(w, `{"data":{"%s":{"state":"running","total":10,"complete":4}}}`, jobID)
+			return
+		}
+		w.WriteHeader(400)
+		w.Write([]byte(`{"error":"I was unable to find that Job"}`))
+	}))
+	defer ts.Close()
+
+	agent := model.Agent{ID: uuid.New().String(), Name: "agent", Address: ts.URL}
+	assert.Nil(gDb.SaveAgent(agent))
+
+	job := model.Job{
+		ID:         uuid.New().String(),
+		Agent:      &agent,
+		Definition: &model.JobDefinition{Type: model.TypeBackup},
+		Meta:       &model.JobMeta{State: model.StateRunning, Start: time.Now().UTC()}}
+	assert.Nil(gDb.SaveJob(job))
+	jobID = job.ID
+
+	// running jobs are read from the agent
+	meta, err := JobStatus(job.ID)
+	if assert.Nil(err) {
+		assert.Equal(10, meta.Total)
+		assert.Equal(4, meta.Complete)
+	}
+
+	// the agent lost the job: our own status is returned
+	jobID = "other"
+	meta, err = JobStatus(job.ID)
+	if assert.Nil(err) {
+		assert.Equal(model.StateRunning, meta.State)
+		assert.Equal(0, meta.Total)
+	}
+
+	job.Meta.State = model.StateFinished
+	assert.Nil(gDb.SaveJob(job))
+	meta, err = JobStatus(job.ID)
+	if assert.Nil(err) {
+		assert.Equal(model.StateFinished, meta.State)
+	}
+}
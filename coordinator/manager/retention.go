@@ -0,0 +1,56 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/sethjback/gobl/model"
+	"github.com/sethjback/gobl/util/log"
+)
+
+// applyRetention removes the jobs run from the same job definition on the same agent
+// that have expired under the definition's retention policy.
+// The current definition is used if it still exists so policy changes apply to older jobs
+func applyRetention(job *model.Job) error {
+	if job.Definition == nil || job.Definition.ID == "" {
+		return nil
+	}
+
+	retention := job.Definition.Retention
+	if jdef, err := gDb.GetJobDefinition(job.Definition.ID); err == nil {
+		retention = jdef.Retention
+	}
+
+	if retention == nil || retention.Empty() {
+		return nil
+	}
+
+	var candidates []model.Job
+	deleteM.RLock()
+	err := eachJob(map[string]string{"agent": job.Agent.ID}, func(j model.Job) error {
+		if j.Definition == nil || j.Definition.ID != job.Definition.ID {
+			return nil
+		}
+
+		switch j.Meta.State {
+		case model.StateFinished, model.StateFailed, model.StateCanceled:
+			candidates = append(candidates, j)
+		}
+		return nil
+	})
+	deleteM.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	deleteM.Lock()
+	defer deleteM.Unlock()
+
+	for _, j := range retention.Expired(candidates, time.Now().UTC()) {
+		log.Infof("retention", "Removing expired job: %s (ended %s)", j.ID, j.Meta.End)
+		if err := gDb.DeleteJob(j.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sethjback/gobl/engine"
+	"github.com/sethjback/gobl/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func retentionJobs(ends ...time.Time) []model.Job {
+	var jobs []model.Job
+	for _, e := range ends {
+		jobs = append(jobs, model.Job{ID: uuid.New().String(), Meta: &model.JobMeta{State: model.StateFinished, End: e}})
+	}
+	return jobs
+}
+
+func jobIDs(jobs []model.Job) []string {
+	var ids []string
+	for _, j := range jobs {
+		ids = append(ids, j.ID)
+	}
+	return ids
+}
+
+func TestRetentionExpired(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2016, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+	// one job a day at noon for 90 days, newest first
+	var ends []time.Time
+	for i := 0; i < 90; i++ {
+		ends = append(ends, now.AddDate(0, 0, -i))
+	}
+	jobs := retentionJobs(ends...)
+
+	assert.Nil(model.Retention{}.Expired(jobs, now))
+
+	expired := model.Retention{KeepLast: 5}.Expired(jobs, now)
+	assert.Len(expired, 85)
+	assert.NotContains(jobIDs(expired), jobs[4].ID)
+	assert.Contains(jobIDs(expired), jobs[5].ID)
+
+	expired = model.Retention{KeepDays: 10}.Expired(jobs, now)
+	assert.Len(expired, 80)
+	assert.NotContains(jobIDs(expired), jobs[9].ID)
+
+	// 7 daily + 4 weekly (sundays, this week already covered by today) + 3 monthly (month ends)
+	expired = model.Retention{Daily: 7, Weekly: 4, Monthly: 3}.Expired(jobs, now)
+	kept := 90 - len(expired)
+	assert.True(kept >= 7 && kept <= 14, "kept %d", kept)
+	for i := 0; i < 7; i++ {
+		assert.NotContains(jobIDs(expired), jobs[i].ID)
+	}
+	// the newest job of april is kept by the monthly rule
+	assert.NotContains(jobIDs(expired), jobs[46].ID)
+	assert.Equal(time.April, jobs[46].Meta.End.Month())
+	assert.Equal(30, jobs[46].Meta.End.Day())
+
+	// failed jobs don't count toward the rules, and the last finished job is kept
+	failed := retentionJobs(now, now.AddDate(0, 0, -1), now.AddDate(0, 0, -2), now.AddDate(0, 0, -30))
+	failed[1].Meta.State = model.StateFailed
+	failed[2].Meta.State = model.StateCanceled
+	expired = model.Retention{KeepLast: 2}.Expired(failed, now)
+	assert.ElementsMatch([]string{failed[1].ID, failed[2].ID}, jobIDs(expired))
+
+	// failures since the last finished job are kept along with it, however old it is
+	failed[0].Meta.State = model.StateFailed
+	assert.Empty(model.Retention{KeepDays: 1}.Expired(failed, now))
+
+	assert.NotNil(model.Retention{KeepLast: -1}.Validate())
+	assert.Nil(model.Retention{KeepLast: 1}.Validate())
+}
+
+func TestApplyRetention(t *testing.T) {
+	assert := assert.New(t)
+	if !assert.Nil(testManager()) {
+		return
+	}
+	defer gDb.Close()
+
+	agent := model.Agent{ID: uuid.New().String(), Name: "agent"}
+	assert.Nil(gDb.SaveAgent(agent))
+
+	jdef := model.JobDefinition{
+		Type:      model.TypeBackup,
+		Paths:     []model.Path{model.Path{Root: "/data"}},
+		To:        []engine.Definition{engine.Definition{Name: engine.NameLogger, Options: map[string]interface{}{engine.LoggerOptionLogPath: "/tmp/backup.log"}}},
+		Retention: &model.Retention{KeepLast: 2},
+	}
+	id, err := CreateJobDefinition(jdef)
+	if !assert.Nil(err) {
+		return
+	}
+	jdef.ID = id
+
+	invalid := jdef
+	invalid.Retention = &model.Retention{KeepDays: -1}
+	_, err = CreateJobDefinition(invalid)
+	assert.NotNil(err)
+
+	other := model.JobDefinition{ID: uuid.New().String()}
+
+	var ids []string
+	for i := 0; i < 4; i++ {
+		def := jdef
+		// later edits to the definition apply to jobs run before them
+		def.Retention = nil
+		j := model.Job{
+			ID:         uuid.New().String(),
+			Agent:      &agent,
+			Definition: &def,
+			Meta:       &model.JobMeta{State: model.StateRunning, Start: time.Now().UTC().Add(time.Duration(i) * time.Minute)}}
+		assert.Nil(gDb.SaveJob(j))
+		ids = append(ids, j.ID)
+	}
+
+	// jobs from other definitions are left alone
+	oj := model.Job{ID: uuid.New().String(), Agent: &agent, Definition: &other, Meta: &model.JobMeta{State: model.StateFinished}}
+	assert.Nil(gDb.SaveJob(oj))
+
+	// and push the definition's jobs past the first page
+	for i := 0; i < jobPageSize; i++ {
+		assert.Nil(gDb.SaveJob(model.Job{
+			ID:         uuid.New().String(),
+			Agent:      &agent,
+			Definition: &other,
+			Meta:       &model.JobMeta{State: model.StateFinished, Start: time.Now().UTC().Add(time.Hour)}}))
+	}
+
+	for _, id := range ids {
+		assert.Nil(FinishJob(id, model.JobComplete{}))
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	for i, id := range ids {
+		_, err := gDb.GetJob(id)
+		if i < 2 {
+			assert.NotNil(err, "job %d should have expired", i)
+		} else {
+			assert.Nil(err, "job %d should be kept", i)
+		}
+	}
+
+	_, err = gDb.GetJob(oj.ID)
+	assert.Nil(err)
+}
@@ -67,6 +67,10 @@ func DeleteSchedule(id string) error {
 	return gDb.DeleteSchedule(id)
 }
 
+func GetSchedule(id string) (*model.Schedule, error) {
+	return gDb.GetSchedule(id)
+}
+
 func ScheduleList() ([]model.Schedule, error) {
 	return gDb.ScheduleList()
 }
@@ -0,0 +1,183 @@
+package manager
+
+import (
+	"errors"
+
+	"github.com/sethjback/gobl/auth"
+	gerrors "github.com/sethjback/gobl/gobldb/errors"
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/model"
+	"github.com/sethjback/gobl/util/log"
+)
+
+// Login checks the user's password and returns a signed token for them.
+// Passwords stored with an outdated hash are rehashed now that we know the password
+func Login(email, password string) (string, error) {
+	u, err := gDb.GetUser(email)
+	if err != nil || !auth.CheckPassword([]byte(u.Password), []byte(password)) {
+		return "", errors.New("Invalid email or password")
+	}
+
+	if auth.NeedsRehash([]byte(u.Password)) {
+		u.Password = password
+		if err = saveUser(*u); err != nil {
+			log.Errorf("manager", "Unable to upgrade password hash for %s: %v", u.Email, err)
+		}
+	}
+
+	lifetime := conf.Auth.TokenLifetime
+	if lifetime <= 0 {
+		lifetime = defaultTokenLifetime
+	}
+
+	t := auth.NewToken(tokenSecret, lifetime)
+	t.Claims.Subject = u.Email
+	return t.Generate()
+}
+
+// CheckToken validates the token and returns the user it was issued to.
+// Tokens for users that have since been removed are rejected
+func CheckToken(token string) (string, error) {
+	t := auth.NewToken(tokenSecret, 0)
+	if err := t.Parse(token); err != nil {
+		return "", err
+	}
+
+	if _, err := gDb.GetUser(t.Claims.Subject); err != nil {
+		return "", errors.New("User no longer exists")
+	}
+
+	return t.Claims.Subject, nil
+}
+
+// UserList returns all users. Password hashes are never returned
+func UserList() ([]model.User, error) {
+	users, err := gDb.UserList()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]model.User, 0, len(users))
+	for _, u := range users {
+		u.Password = ""
+		list = append(list, u)
+	}
+
+	return list, nil
+}
+
+// GetUser returns the user without their password hash
+func GetUser(email string) (*model.User, error) {
+	u, err := gDb.GetUser(email)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Password = ""
+	return u, nil
+}
+
+// Authorize returns the user if their role grants the permission
+func Authorize(email, permission string) (*model.User, error) {
+	u, err := GetUser(email)
+	if err != nil {
+		return nil, err
+	}
+
+	if !u.Can(permission) {
+		return nil, errors.New("Permission denied")
+	}
+
+	return u, nil
+}
+
+// AddUser creates a new user. The password is given in plain text and hashed before it is saved
+func AddUser(user model.User) error {
+	if user.Email == "" || user.Password == "" {
+		return errors.New("Email and password are required")
+	}
+
+	if !model.ValidRole(user.Role) {
+		return errors.New("Invalid role: " + user.Role)
+	}
+
+	_, err := gDb.GetUser(user.Email)
+	if err == nil {
+		return errors.New("User already exists")
+	}
+	if !isNotFound(err) {
+		return err
+	}
+
+	return saveUser(user)
+}
+
+// UpdateUser changes the user's role and groups, and their password if one is given
+func UpdateUser(user model.User) error {
+	if !model.ValidRole(user.Role) {
+		return errors.New("Invalid role: " + user.Role)
+	}
+
+	current, err := gDb.GetUser(user.Email)
+	if err != nil {
+		return err
+	}
+
+	if current.Role == model.RoleAdmin && user.Role != model.RoleAdmin {
+		if err = checkOtherAdmin(user.Email); err != nil {
+			return err
+		}
+	}
+
+	if user.Password == "" {
+		user.Password = current.Password
+		return gDb.SaveUser(user)
+	}
+
+	return saveUser(user)
+}
+
+// DeleteUser removes the user. The last admin cannot be removed so the coordinator can't be locked out
+func DeleteUser(email string) error {
+	if _, err := gDb.GetUser(email); err != nil {
+		return err
+	}
+
+	if err := checkOtherAdmin(email); err != nil {
+		return err
+	}
+
+	return gDb.DeleteUser(email)
+}
+
+// checkOtherAdmin makes sure there is an admin other than the given user
+func checkOtherAdmin(email string) error {
+	users, err := gDb.UserList()
+	if err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		if u.Role == model.RoleAdmin && u.Email != email {
+			return nil
+		}
+	}
+
+	return errors.New("Cannot remove the last admin")
+}
+
+// saveUser hashes the user's plain text password and saves them
+func saveUser(user model.User) error {
+	p, err := auth.PasswordHash([]byte(user.Password))
+	if err != nil {
+		return err
+	}
+
+	user.Password = string(p)
+	return gDb.SaveUser(user)
+}
+
+func isNotFound(err error) bool {
+	gerr, ok := err.(*goblerr.Error)
+	return ok && gerr.Code == gerrors.ErrCodeNotFound
+}
@@ -0,0 +1,117 @@
+package manager
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/sethjback/gobl/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsers(t *testing.T) {
+	assert := assert.New(t)
+	if !assert.Nil(testManager()) {
+		return
+	}
+	defer gDb.Close()
+	tokenSecret = []byte("secret")
+
+	assert.Nil(AddUser(model.User{Email: "admin", Password: "password", Role: model.RoleAdmin}))
+	assert.NotNil(AddUser(model.User{Email: "admin", Password: "other", Role: model.RoleAdmin}))
+	assert.NotNil(AddUser(model.User{Email: "", Password: "password", Role: model.RoleAdmin}))
+	assert.NotNil(AddUser(model.User{Email: "norole", Password: "password"}))
+
+	u, err := GetUser("admin")
+	if assert.Nil(err) {
+		assert.Equal("admin", u.Email)
+		assert.Equal(model.RoleAdmin, u.Role)
+		assert.Empty(u.Password)
+	}
+
+	_, err = Login("admin", "wrong")
+	assert.NotNil(err)
+	_, err = Login("nobody", "password")
+	assert.NotNil(err)
+
+	token, err := Login("admin", "password")
+	if assert.Nil(err) {
+		user, err := CheckToken(token)
+		assert.Nil(err)
+		assert.Equal("admin", user)
+	}
+
+	_, err = CheckToken(token + "x")
+	assert.NotNil(err)
+
+	// password is only changed if given
+	assert.Nil(UpdateUser(model.User{Email: "admin", Role: model.RoleAdmin}))
+	_, err = Login("admin", "password")
+	assert.Nil(err)
+
+	assert.Nil(UpdateUser(model.User{Email: "admin", Password: "changed", Role: model.RoleAdmin}))
+	assert.NotNil(UpdateUser(model.User{Email: "nobody", Password: "changed", Role: model.RoleAdmin}))
+	_, err = Login("admin", "password")
+	assert.NotNil(err)
+	_, err = Login("admin", "changed")
+	assert.Nil(err)
+
+	// the last admin can't be removed or demoted
+	assert.NotNil(DeleteUser("admin"))
+	assert.NotNil(UpdateUser(model.User{Email: "admin", Role: model.RoleOperator}))
+
+	assert.Nil(AddUser(model.User{Email: "helpdesk", Password: "password", Role: model.RoleRestore, Groups: []string{"web"}}))
+	assert.NotNil(DeleteUser("admin"))
+
+	_, err = Authorize("helpdesk", model.PermRestore)
+	assert.Nil(err)
+	_, err = Authorize("helpdesk", model.PermManage)
+	assert.NotNil(err)
+	_, err = Authorize("nobody", model.PermRead)
+	assert.NotNil(err)
+
+	list, err := UserList()
+	if assert.Nil(err) {
+		assert.Len(list, 2)
+		for _, u := range list {
+			assert.Empty(u.Password)
+		}
+	}
+
+	assert.Nil(AddUser(model.User{Email: "other", Password: "password", Role: model.RoleAdmin}))
+	assert.Nil(DeleteUser("admin"))
+	_, err = CheckToken(token)
+	assert.NotNil(err)
+}
+
+func TestLoginUpgradesLegacyHash(t *testing.T) {
+	assert := assert.New(t)
+	if !assert.Nil(testManager()) {
+		return
+	}
+	defer gDb.Close()
+	tokenSecret = []byte("secret")
+
+	// salted sha1 as stored by earlier versions: 4 hex salt characters followed by the hex digest
+	sum := sha1.Sum([]byte("a1b2" + "password"))
+	legacy := "a1b2" + hex.EncodeToString(sum[:])
+	assert.Nil(gDb.SaveUser(model.User{Email: "admin", Password: legacy, Role: model.RoleAdmin}))
+
+	_, err := Login("admin", "wrong")
+	assert.NotNil(err)
+	u, _ := gDb.GetUser("admin")
+	assert.Equal(legacy, u.Password)
+
+	_, err = Login("admin", "password")
+	assert.Nil(err)
+
+	u, err = gDb.GetUser("admin")
+	if assert.Nil(err) {
+		assert.True(strings.HasPrefix(u.Password, "$argon2id$"))
+		assert.Equal(model.RoleAdmin, u.Role)
+	}
+
+	_, err = Login("admin", "password")
+	assert.Nil(err)
+}
@@ -0,0 +1,98 @@
+package engine
+
+import "io"
+
+// gearTable maps every byte to a random value for the rolling hash. It is generated from a fixed seed:
+// changing it changes where chunks are cut, and so loses deduplication against everything already stored
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	// splitmix64
+	seed := uint64(0x676f626c64656475)
+	for i := range table {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// chunker splits a stream into content defined chunks using a gear rolling hash.
+// Chunk boundaries depend only on the bytes around them, so an insert or change in the middle
+// of a file only changes the chunks around it and the rest still deduplicate
+type chunker struct {
+	r        io.Reader
+	buf      []byte
+	pos, end int
+	eof      bool
+	min, max int
+	mask     uint64
+}
+
+// newChunker returns a chunker whose chunks average roughly avg bytes, and are between avg/4 and avg*4 bytes long
+func newChunker(r io.Reader, avg int) *chunker {
+	bits := uint(0)
+	for 1<<(bits+1) <= avg {
+		bits++
+	}
+
+	return &chunker{
+		r:   r,
+		buf: make([]byte, avg*4),
+		min: avg / 4,
+		max: avg * 4,
+		// the high bits of the gear hash depend on the most bytes
+		mask: (1<<bits - 1) << (64 - bits),
+	}
+}
+
+// next returns the next chunk, or io.EOF once the stream is done.
+// The chunk is only valid until the next call
+func (c *chunker) next() ([]byte, error) {
+	if !c.eof && c.end-c.pos < c.max {
+		copy(c.buf, c.buf[c.pos:c.end])
+		c.end -= c.pos
+		c.pos = 0
+
+		n, err := io.ReadFull(c.r, c.buf[c.end:])
+		c.end += n
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			c.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	data := c.buf[c.pos:c.end]
+	if len(data) == 0 {
+		return nil, io.EOF
+	}
+
+	n := c.cut(data)
+	c.pos += n
+	return data[:n], nil
+}
+
+// cut returns the length of the chunk at the start of data
+func (c *chunker) cut(data []byte) int {
+	if len(data) <= c.min {
+		return len(data)
+	}
+
+	// the hash only depends on the last 64 bytes, so there is no need to start any earlier
+	i := c.min - 64
+	if i < 0 {
+		i = 0
+	}
+
+	var hash uint64
+	for ; i < len(data); i++ {
+		hash = hash<<1 + gearTable[data[i]]
+		if i >= c.min && hash&c.mask == 0 {
+			return i + 1
+		}
+	}
+
+	return len(data)
+}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func chunks(t *testing.T, data []byte, avg int) [][]byte {
+	var out [][]byte
+	c := newChunker(bytes.NewReader(data), avg)
+	for {
+		chunk, err := c.next()
+		if err == io.EOF {
+			return out
+		}
+		if !assert.Nil(t, err) {
+			return out
+		}
+		out = append(out, append([]byte{}, chunk...))
+	}
+}
+
+func TestChunker(t *testing.T) {
+	assert := assert.New(t)
+
+	data := make([]byte, 256*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	cs := chunks(t, data, 1024)
+	assert.Equal(data, bytes.Join(cs, nil))
+	for i, c := range cs {
+		assert.True(len(c) <= 4096, "chunk %d is %d bytes", i, len(c))
+		if i < len(cs)-1 {
+			assert.True(len(c) > 256, "chunk %d is %d bytes", i, len(c))
+		}
+	}
+
+	// roughly the average size
+	assert.InDelta(256, len(cs), 128)
+
+	// the same data is always cut the same way
+	assert.Equal(cs, chunks(t, data, 1024))
+
+	// inserting bytes only changes the chunks around the insert
+	shifted := append(append(append([]byte{}, data[:100000]...), []byte("inserted")...), data[100000:]...)
+	known := make(map[string]bool)
+	for _, c := range cs {
+		known[string(c)] = true
+	}
+	changed := 0
+	for _, c := range chunks(t, shifted, 1024) {
+		if !known[string(c)] {
+			changed++
+		}
+	}
+	assert.True(changed <= 2, "%d chunks changed", changed)
+
+	assert.Empty(chunks(t, []byte{}, 1024))
+	assert.Equal([][]byte{[]byte("small")}, chunks(t, []byte("small"), 1024))
+}
@@ -0,0 +1,459 @@
+package engine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sethjback/gobl/files"
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/util/log"
+)
+
+const (
+	// NameDedup is the name of the deduplicating engine
+	NameDedup = "dedup"
+	// DedupOptionSavePath is the savePath option name
+	DedupOptionSavePath = "savePath"
+	// DedupOptionChunkSize is the average chunk size option name, in KB
+	DedupOptionChunkSize = "chunkSize"
+
+	dedupDefaultChunkSize = 1024
+	dedupMaxChunkSize     = 64 * 1024
+
+	dedupChunkDir  = "chunks"
+	dedupRecipeDir = "recipes"
+
+	errorChunkCorrupt = "ChunkCorrupt"
+)
+
+// Dedup stores files as content defined chunks, keeping a single copy of each chunk by its SHA-256.
+// Every saved file gets a recipe listing its chunks in order, which is used to reassemble it.
+// Identical files at different paths, and files that only changed in places, share most of their chunks
+type Dedup struct {
+	savePath  string
+	chunkSize int
+}
+
+// chunkM keeps Sweep from removing a chunk while it is being reused. Saving takes it for reading
+var chunkM = &sync.RWMutex{}
+
+func init() {
+	Register(NameDedup, func() interface{} { return &Dedup{} })
+}
+
+// recipe is what is stored for each saved file
+type recipe struct {
+	// Size of the file
+	Size int64 `json:"size"`
+	// New is how many bytes of the file weren't already stored when it was saved
+	New int64 `json:"new"`
+	// Chunks are the SHA-256 of the file's chunks, in order
+	Chunks []string `json:"chunks"`
+}
+
+// Name returns "dedup"
+func (e *Dedup) Name() string {
+	return NameDedup
+}
+
+// SaveOptions lists the available options for the save operation
+func (e *Dedup) SaveOptions() []Option {
+	return []Option{
+		Option{
+			Name:     DedupOptionSavePath,
+			Type:     "string",
+			Required: true,
+			Default:  ""},
+		Option{
+			Name:        DedupOptionChunkSize,
+			Description: "average chunk size in KB. Smaller chunks find more duplicate data, but need more files and bigger recipes",
+			Type:        "int",
+			Required:    false,
+			Default:     dedupDefaultChunkSize}}
+}
+
+// ConfigureSave sets where the chunks and recipes are saved
+func (e *Dedup) ConfigureSave(options map[string]interface{}) error {
+	e.chunkSize = dedupDefaultChunkSize * 1024
+
+	for k, v := range options {
+		switch strings.ToLower(k) {
+
+		case strings.ToLower(DedupOptionSavePath):
+			vString, ok := v.(string)
+			if !ok {
+				return goblerr.New("Invalid option", ErrorInvalidOptionValue, fmt.Sprintf("%s must be a string", DedupOptionSavePath))
+			}
+			e.savePath = vString
+
+		case strings.ToLower(DedupOptionChunkSize):
+			var size int
+			switch vNum := v.(type) {
+			case int:
+				size = vNum
+			case float64:
+				size = int(vNum)
+			default:
+				return goblerr.New("Invalid option", ErrorInvalidOptionValue, fmt.Sprintf("%s must be an int", DedupOptionChunkSize))
+			}
+			if size < 1 || size > dedupMaxChunkSize {
+				return goblerr.New("Invalid option", ErrorInvalidOptionValue, fmt.Sprintf("%s must be between 1 and %d", DedupOptionChunkSize, dedupMaxChunkSize))
+			}
+			e.chunkSize = size * 1024
+		}
+	}
+
+	if e.savePath == "" {
+		return goblerr.New("Must provide save path", ErrorRequiredOptionMissing, fmt.Sprintf("%s is required", DedupOptionSavePath))
+	}
+
+	for _, dir := range []string{dedupChunkDir, dedupRecipeDir} {
+		if err := os.MkdirAll(filepath.Join(e.savePath, dir), 0744); err != nil {
+			return goblerr.New("Configuration failed", errorAccessSavePath, fmt.Sprintf("unable to create or access %s (%s)", DedupOptionSavePath, err))
+		}
+	}
+
+	return nil
+}
+
+// ShouldSave checks if there is already a recipe for the signature
+func (e *Dedup) ShouldSave(file files.File) (bool, error) {
+	fn, err := hashFileSig(file.Signature)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := os.Stat(e.recipePath(fn)); err == nil {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Save splits the stream into chunks, stores the ones not already saved and then writes the file's recipe
+func (e *Dedup) Save(reader io.Reader, file files.File, errc chan<- error) {
+	fn, err := hashFileSig(file.Signature)
+	if err != nil {
+		errc <- err
+		return
+	}
+
+	r := recipe{Chunks: []string{}}
+	c := newChunker(reader, e.chunkSize)
+	for {
+		chunk, err := c.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errc <- err
+			return
+		}
+
+		sum := sha256.Sum256(chunk)
+		hash := hex.EncodeToString(sum[:])
+
+		written, err := e.saveChunk(hash, chunk)
+		if err != nil {
+			errc <- err
+			return
+		}
+
+		r.Size += int64(len(chunk))
+		if written {
+			r.New += int64(len(chunk))
+		}
+		r.Chunks = append(r.Chunks, hash)
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		errc <- err
+		return
+	}
+
+	if err = writeFileAtomic(e.recipePath(fn), b); err != nil {
+		errc <- err
+		return
+	}
+
+	if r.Size > 0 {
+		log.Debugf("dedup", "%s: %d bytes in %d chunks, %d new (%.1f%% duplicate)",
+			file.Path, r.Size, len(r.Chunks), r.New, 100*float64(r.Size-r.New)/float64(r.Size))
+	}
+}
+
+// saveChunk writes the chunk unless it is already stored, and reports whether it was written.
+// A chunk already stored has its modification time updated so Sweep leaves it for the grace period
+func (e *Dedup) saveChunk(hash string, chunk []byte) (bool, error) {
+	chunkM.RLock()
+	defer chunkM.RUnlock()
+
+	p := e.chunkPath(hash)
+	now := time.Now()
+	if err := os.Chtimes(p, now, now); err == nil {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0744); err != nil {
+		return false, err
+	}
+
+	return true, writeFileAtomic(p, chunk)
+}
+
+// Retrieve returns a reader that reassembles the file from its chunks, checking each one against its hash
+func (e *Dedup) Retrieve(file files.File) (io.ReadCloser, error) {
+	fn, err := hashFileSig(file.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := e.readRecipe(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(&recipeReader{e: e, chunks: r.Chunks}), nil
+}
+
+// recipeReader reads the chunks of a recipe one after the other
+type recipeReader struct {
+	e      *Dedup
+	chunks []string
+	buf    *bytes.Reader
+}
+
+func (rr *recipeReader) Read(p []byte) (int, error) {
+	for rr.buf == nil || rr.buf.Len() == 0 {
+		if len(rr.chunks) == 0 {
+			return 0, io.EOF
+		}
+
+		hash := rr.chunks[0]
+		rr.chunks = rr.chunks[1:]
+
+		chunk, err := ioutil.ReadFile(rr.e.chunkPath(hash))
+		if err != nil {
+			return 0, err
+		}
+
+		sum := sha256.Sum256(chunk)
+		if hex.EncodeToString(sum[:]) != hash {
+			return 0, goblerr.New("Chunk does not match its hash", errorChunkCorrupt, hash)
+		}
+
+		rr.buf = bytes.NewReader(chunk)
+	}
+
+	return rr.buf.Read(p)
+}
+
+// StoredKey returns the name of the recipe the signature is saved as
+func (e *Dedup) StoredKey(signature files.Signature) (string, error) {
+	return hashFileSig(signature)
+}
+
+// Stored lists the saved recipes. The chunks are removed by Sweep
+func (e *Dedup) Stored() (map[string]StoredObject, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(e.savePath, dedupRecipeDir))
+	if err != nil {
+		return nil, goblerr.New("Unable to list saved files", errorAccessSavePath, err)
+	}
+
+	stored := make(map[string]StoredObject)
+	for _, info := range infos {
+		if info.Mode().IsRegular() && isSigHash(info.Name()) {
+			stored[info.Name()] = StoredObject{Size: info.Size(), Modified: info.ModTime()}
+		}
+	}
+
+	return stored, nil
+}
+
+// Delete removes the recipe. Its chunks stay until Sweep finds nothing else uses them
+func (e *Dedup) Delete(key string) error {
+	if !isSigHash(key) {
+		return goblerr.New("Invalid key", ErrorInvalidOptionValue, key+" is not a saved file")
+	}
+
+	return os.Remove(e.recipePath(key))
+}
+
+// Sweep removes the chunks that no recipe uses, apart from the removed ones.
+// Chunks saved or reused within the grace period are kept, as they may belong to a file still being saved
+func (e *Dedup) Sweep(removed []string, dryRun bool) (int, int64, error) {
+	skip := make(map[string]bool, len(removed))
+	for _, key := range removed {
+		skip[key] = true
+	}
+
+	stored, err := e.Stored()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	used := make(map[string]bool)
+	for key := range stored {
+		if skip[key] {
+			continue
+		}
+		r, err := e.readRecipe(key)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, hash := range r.Chunks {
+			used[hash] = true
+		}
+	}
+
+	count := 0
+	var size int64
+	cutoff := time.Now().Add(-PruneGrace)
+	err = e.walkChunks(func(hash, path string, info os.FileInfo) error {
+		if used[hash] || info.ModTime().After(cutoff) {
+			return nil
+		}
+
+		if dryRun {
+			count++
+			size += info.Size()
+			return nil
+		}
+
+		chunkM.Lock()
+		defer chunkM.Unlock()
+
+		// it may have been reused since the walk found it
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+		count++
+		size += info.Size()
+		return nil
+	})
+
+	return count, size, err
+}
+
+// Stats reports how much data the saved files hold and how much space their chunks take
+func (e *Dedup) Stats() (Stats, error) {
+	s := Stats{}
+
+	stored, err := e.Stored()
+	if err != nil {
+		return s, err
+	}
+
+	for key, o := range stored {
+		r, err := e.readRecipe(key)
+		if err != nil {
+			return s, err
+		}
+		s.Files++
+		s.Bytes += r.Size
+		s.StoredBytes += o.Size
+	}
+
+	err = e.walkChunks(func(hash, path string, info os.FileInfo) error {
+		s.Chunks++
+		s.StoredBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return s, err
+	}
+
+	if s.StoredBytes > 0 {
+		s.Ratio = float64(s.Bytes) / float64(s.StoredBytes)
+	}
+
+	return s, nil
+}
+
+func (e *Dedup) readRecipe(key string) (*recipe, error) {
+	b, err := ioutil.ReadFile(e.recipePath(key))
+	if err != nil {
+		return nil, err
+	}
+
+	var r recipe
+	if err = json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// walkChunks calls fn for every stored chunk. Anything not named like a chunk hash is ignored
+func (e *Dedup) walkChunks(fn func(hash, path string, info os.FileInfo) error) error {
+	return filepath.Walk(filepath.Join(e.savePath, dedupChunkDir), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || !isChunkHash(info.Name()) {
+			return nil
+		}
+		return fn(info.Name(), path, info)
+	})
+}
+
+func (e *Dedup) recipePath(key string) string {
+	return filepath.Join(e.savePath, dedupRecipeDir, key)
+}
+
+// chunkPath spreads the chunks over directories named for the first two characters of their hash
+func (e *Dedup) chunkPath(hash string) string {
+	return filepath.Join(e.savePath, dedupChunkDir, hash[:2], hash)
+}
+
+func isChunkHash(name string) bool {
+	if len(name) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// writeFileAtomic writes to a temporary file and renames it into place, so a concurrent reader
+// never sees a partly written file and an interrupted write leaves nothing behind
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return errors.New("unable to save " + path + ": " + err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package engine
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sethjback/gobl/config"
+	"github.com/sethjback/gobl/files"
+	"github.com/sethjback/gobl/util/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func dedupSave(t *testing.T, e *Dedup, file files.File, data []byte) {
+	errc := make(chan error, 1)
+	e.Save(bytes.NewReader(data), file, errc)
+	select {
+	case err := <-errc:
+		t.Fatalf("save %s failed: %v", file.Path, err)
+	default:
+	}
+}
+
+func dedupRetrieve(t *testing.T, e *Dedup, file files.File) []byte {
+	r, err := e.Retrieve(file)
+	if !assert.Nil(t, err) {
+		return nil
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	return b
+}
+
+// ageChunks makes every chunk older than the sweep grace period
+func ageChunks(t *testing.T, e *Dedup) {
+	old := time.Now().Add(-2 * PruneGrace)
+	err := e.walkChunks(func(hash, path string, info os.FileInfo) error {
+		return os.Chtimes(path, old, old)
+	})
+	assert.Nil(t, err)
+}
+
+func TestDedup(t *testing.T) {
+	assert := assert.New(t)
+	log.Init(config.Log{Level: log.Level.Error})
+
+	dir, err := ioutil.TempDir("", "gobl-dedup")
+	if !assert.Nil(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	e := &Dedup{}
+	assert.NotNil(e.ConfigureSave(map[string]interface{}{}))
+	assert.NotNil(e.ConfigureSave(map[string]interface{}{DedupOptionSavePath: dir, DedupOptionChunkSize: "big"}))
+	assert.NotNil(e.ConfigureSave(map[string]interface{}{DedupOptionSavePath: dir, DedupOptionChunkSize: float64(0)}))
+	if !assert.Nil(e.ConfigureSave(map[string]interface{}{DedupOptionSavePath: dir, DedupOptionChunkSize: float64(1)})) {
+		return
+	}
+
+	data := make([]byte, 128*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	f1 := files.File{Signature: files.Signature{Path: "/vm/disk1.img", Hash: "1"}}
+	ok, err := e.ShouldSave(f1)
+	assert.Nil(err)
+	assert.True(ok)
+
+	dedupSave(t, e, f1, data)
+
+	ok, err = e.ShouldSave(f1)
+	assert.Nil(err)
+	assert.False(ok)
+	assert.Equal(data, dedupRetrieve(t, e, f1))
+
+	stats, err := e.Stats()
+	assert.Nil(err)
+	assert.Equal(1, stats.Files)
+	assert.Equal(int64(len(data)), stats.Bytes)
+	chunks := stats.Chunks
+
+	// the same content at another path stores no new chunks
+	f2 := files.File{Signature: files.Signature{Path: "/vm/copy.img", Hash: "1"}}
+	dedupSave(t, e, f2, data)
+	assert.Equal(data, dedupRetrieve(t, e, f2))
+
+	// and one changed byte only a few
+	changed := append([]byte{}, data...)
+	changed[64*1024] ^= 0xff
+	f3 := files.File{Signature: files.Signature{Path: "/vm/disk1.img", Hash: "2"}}
+	dedupSave(t, e, f3, changed)
+	assert.Equal(changed, dedupRetrieve(t, e, f3))
+
+	key3, _ := e.StoredKey(f3.Signature)
+	r, err := e.readRecipe(key3)
+	if assert.Nil(err) {
+		assert.Equal(int64(len(data)), r.Size)
+		assert.True(r.New > 0 && r.New <= 8*1024, "%d new bytes", r.New)
+	}
+
+	stats, err = e.Stats()
+	assert.Nil(err)
+	assert.Equal(3, stats.Files)
+	assert.Equal(int64(3*len(data)), stats.Bytes)
+	assert.True(stats.Chunks-chunks <= 2, "%d new chunks", stats.Chunks-chunks)
+	assert.True(stats.Ratio > 2.5, "ratio %f", stats.Ratio)
+
+	// empty files have an empty recipe
+	empty := files.File{Signature: files.Signature{Path: "/empty"}}
+	dedupSave(t, e, empty, []byte{})
+	assert.Equal([]byte{}, dedupRetrieve(t, e, empty))
+
+	// corrupt chunks are caught on restore
+	r1, err := e.readRecipe(func() string { k, _ := e.StoredKey(f1.Signature); return k }())
+	if assert.Nil(err) {
+		assert.Nil(ioutil.WriteFile(e.chunkPath(r1.Chunks[0]), []byte("corrupt"), 0600))
+		rr, err := e.Retrieve(f1)
+		if assert.Nil(err) {
+			_, err = ioutil.ReadAll(rr)
+			assert.NotNil(err)
+		}
+	}
+}
+
+func TestDedupPrune(t *testing.T) {
+	assert := assert.New(t)
+	log.Init(config.Log{Level: log.Level.Error})
+
+	dir, err := ioutil.TempDir("", "gobl-dedup")
+	if !assert.Nil(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	e := &Dedup{}
+	if !assert.Nil(e.ConfigureSave(map[string]interface{}{DedupOptionSavePath: dir, DedupOptionChunkSize: 1})) {
+		return
+	}
+
+	shared := make([]byte, 32*1024)
+	rand.New(rand.NewSource(1)).Read(shared)
+	only := make([]byte, 32*1024)
+	rand.New(rand.NewSource(2)).Read(only)
+
+	f1 := files.File{Signature: files.Signature{Path: "/one", Hash: "1"}}
+	f2 := files.File{Signature: files.Signature{Path: "/two", Hash: "2"}}
+	dedupSave(t, e, f1, shared)
+	dedupSave(t, e, f2, append(append([]byte{}, shared...), only...))
+
+	key1, _ := e.StoredKey(f1.Signature)
+	key2, _ := e.StoredKey(f2.Signature)
+
+	stored, err := e.Stored()
+	if assert.Nil(err) {
+		assert.Len(stored, 2)
+		assert.Contains(stored, key1)
+	}
+
+	// chunks just saved are kept whether or not a recipe uses them
+	n, _, err := e.Sweep([]string{key1, key2}, true)
+	assert.Nil(err)
+	assert.Equal(0, n)
+	ageChunks(t, e)
+
+	// removing the first file frees at most its last chunk, which was cut short by the end of the file.
+	// The rest are used by the second
+	n, _, err = e.Sweep([]string{key1}, true)
+	assert.Nil(err)
+	assert.True(n <= 1, "%d chunks", n)
+
+	before, _ := e.Stats()
+	n, size, err := e.Sweep([]string{key2}, true)
+	assert.Nil(err)
+	assert.True(n > 0)
+
+	after, _ := e.Stats()
+	assert.Equal(before, after)
+
+	assert.NotNil(e.Delete("../" + key2))
+	assert.Nil(e.Delete(key2))
+	swept, sweptSize, err := e.Sweep(nil, false)
+	assert.Nil(err)
+	assert.Equal(n, swept)
+	assert.Equal(size, sweptSize)
+
+	assert.Equal(shared, dedupRetrieve(t, e, f1))
+
+	// reusing a chunk restarts its grace period
+	n, _, err = e.Sweep([]string{key1}, true)
+	assert.Nil(err)
+	assert.True(n > 0)
+	f3 := files.File{Signature: files.Signature{Path: "/three", Hash: "3"}}
+	dedupSave(t, e, f3, shared)
+	key3, _ := e.StoredKey(f3.Signature)
+	swept, _, err = e.Sweep([]string{key1, key3}, true)
+	assert.Nil(err)
+	assert.Equal(0, swept)
+
+	// stray files are left alone
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, dedupChunkDir, "notes.txt"), []byte("x"), 0600))
+	swept, _, err = e.Sweep(nil, false)
+	assert.Nil(err)
+	assert.Equal(0, swept)
+}
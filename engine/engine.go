@@ -2,6 +2,7 @@ package engine
 
 import (
 	"io"
+	"sync"
 
 	"github.com/sethjback/gobl/files"
 	"github.com/sethjback/gobl/goblerr"
@@ -18,8 +19,43 @@ type Engine interface {
 	io.Writer
 	// ErrorChan returns the channel that all writers will send errors over
 	ErrorChan() <-chan error
-	// Finish must be called to close the writers
-	Finish()
+	// Finish must be called to close the writers. It waits for them to be done with the data
+	// and returns the first error any of them reported
+	Finish() error
+}
+
+// start runs the saver or restorer in fn on the reader. An error it reports closes the reader, so writes to
+// the pipe fail rather than block, and is passed on over errc, which must have room for every writer
+func start(r *io.PipeReader, fn func(chan<- error), errc chan error, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ferr := make(chan error, 1)
+		fn(ferr)
+
+		select {
+		case err := <-ferr:
+			r.CloseWithError(err)
+			errc <- err
+		default:
+		}
+	}()
+}
+
+// finish closes the pipes, waits for their readers and returns the first error reported
+func finish(pipes []*io.PipeWriter, errc chan error, wg *sync.WaitGroup) error {
+	for _, w := range pipes {
+		w.Close()
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errc:
+		return err
+	default:
+		return nil
+	}
 }
 
 // backupEngine is the type that implements the Engine interface for backups
@@ -27,12 +63,13 @@ type backupEngine struct {
 	savers []Saver
 	pipes  []*io.PipeWriter
 	errc   chan error
+	wg     *sync.WaitGroup
 }
 
 // NewBackupEngine returns an engine configured
 func NewBackupEngine(file files.File, savers ...Saver) (Engine, bool, error) {
-	e := &backupEngine{savers: savers}
-	e.errc = make(chan error)
+	e := &backupEngine{savers: savers, wg: &sync.WaitGroup{}}
+	e.errc = make(chan error, len(savers))
 	for i := 0; i < len(e.savers); i++ {
 		ok, err := e.savers[i].ShouldSave(file)
 		if err != nil {
@@ -40,7 +77,8 @@ func NewBackupEngine(file files.File, savers ...Saver) (Engine, bool, error) {
 		}
 		if ok {
 			r, w := io.Pipe()
-			go e.savers[i].Save(r, file, e.errc)
+			s := e.savers[i]
+			start(r, func(errc chan<- error) { s.Save(r, file, errc) }, e.errc, e.wg)
 			e.pipes = append(e.pipes, w)
 		}
 	}
@@ -67,11 +105,9 @@ func (b *backupEngine) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
-// Closes all the engine pipes
-func (b *backupEngine) Finish() {
-	for _, w := range b.pipes {
-		w.Close()
-	}
+// Finish closes all the engine pipes and waits for the savers
+func (b *backupEngine) Finish() error {
+	return finish(b.pipes, b.errc, b.wg)
 }
 
 // restoreEngine is the type that implements the Engine interface to restore
@@ -79,11 +115,12 @@ type restoreEngine struct {
 	to    []Restorer
 	pipes []*io.PipeWriter
 	errc  chan error
+	wg    *sync.WaitGroup
 }
 
 func NewRestoreEngine(file files.File, to ...Restorer) (Engine, error) {
-	e := &restoreEngine{to: to}
-	e.errc = make(chan error)
+	e := &restoreEngine{to: to, wg: &sync.WaitGroup{}}
+	e.errc = make(chan error, len(to))
 	for i := 0; i < len(e.to); i++ {
 		ok, err := e.to[i].ShouldRestore(file)
 		if err != nil {
@@ -91,7 +128,8 @@ func NewRestoreEngine(file files.File, to ...Restorer) (Engine, error) {
 		}
 		if ok {
 			r, w := io.Pipe()
-			go e.to[i].Restore(r, file, e.errc)
+			rs := e.to[i]
+			start(r, func(errc chan<- error) { rs.Restore(r, file, errc) }, e.errc, e.wg)
 			e.pipes = append(e.pipes, w)
 		}
 	}
@@ -116,8 +154,6 @@ func (r *restoreEngine) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
-func (r *restoreEngine) Finish() {
-	for _, w := range r.pipes {
-		w.Close()
-	}
+func (r *restoreEngine) Finish() error {
+	return finish(r.pipes, r.errc, r.wg)
 }
@@ -39,7 +39,7 @@ func (t *TestEngine) Save(input io.Reader, file files.File, errc chan<- error) {
 		return
 	}
 }
-func (t *TestEngine) Retrieve(file files.File) (io.Reader, error) {
+func (t *TestEngine) Retrieve(file files.File) (io.ReadCloser, error) {
 	return nil, nil
 }
 func (t *TestEngine) ShouldSave(file files.File) (bool, error) {
@@ -102,24 +102,16 @@ func TestBackupEngine(t *testing.T) {
 	file.Path = "failSave"
 
 	toSave := []byte("This is the data that we want to save")
-	donec := make(chan bool)
 
+	// a saver that gives up doesn't leave the writer blocked, and its error comes back from Finish
 	egn, ok, err = NewBackupEngine(file, t1)
 	assert.Nil(err)
 	assert.True(ok)
-	go func() {
-		_, cerr := io.Copy(egn, bytes.NewReader(toSave))
-		donec <- assert.Nil(cerr)
-	}()
-	errc := egn.ErrorChan()
+	_, err = io.Copy(egn, bytes.NewReader(make([]byte, 1<<20)))
+	assert.NotNil(err)
+	assert.NotNil(egn.Finish())
 
-	select {
-	case e := <-errc:
-		assert.NotNil(e)
-	case d := <-donec:
-		assert.False(d)
-		egn.Finish()
-	}
+	donec := make(chan bool)
 
 	t2 := &TestEngine{sMutex: &sync.Mutex{}}
 	t3 := &TestEngine{sMutex: &sync.Mutex{}}
@@ -135,7 +127,7 @@ func TestBackupEngine(t *testing.T) {
 		donec <- assert.Nil(cerr)
 	}()
 
-	errc = egn.ErrorChan()
+	errc := egn.ErrorChan()
 
 	select {
 	case e := <-errc:
@@ -144,7 +136,7 @@ func TestBackupEngine(t *testing.T) {
 		assert.True(d)
 	}
 
-	egn.Finish()
+	assert.Nil(egn.Finish())
 
 	assert.Equal(toSave, t1.GetSaved())
 	assert.Equal(toSave, t2.GetSaved())
@@ -167,23 +159,14 @@ func TestRestoreEngine(t *testing.T) {
 	file.Path = "failRestore"
 
 	toSave := []byte("This is the data that we want to restore")
-	donec := make(chan bool)
 
 	egn, err = NewRestoreEngine(file, t1)
 	assert.Nil(err)
-	go func() {
-		_, cerr := io.Copy(egn, bytes.NewReader(toSave))
-		donec <- assert.Nil(cerr)
-	}()
-	errc := egn.ErrorChan()
+	_, err = io.Copy(egn, bytes.NewReader(make([]byte, 1<<20)))
+	assert.NotNil(err)
+	assert.NotNil(egn.Finish())
 
-	select {
-	case e := <-errc:
-		assert.NotNil(e)
-	case d := <-donec:
-		assert.False(d)
-		egn.Finish()
-	}
+	donec := make(chan bool)
 
 	t2 := &TestEngine{sMutex: &sync.Mutex{}}
 	t3 := &TestEngine{sMutex: &sync.Mutex{}}
@@ -198,7 +181,7 @@ func TestRestoreEngine(t *testing.T) {
 		donec <- assert.Nil(cerr)
 	}()
 
-	errc = egn.ErrorChan()
+	errc := egn.ErrorChan()
 
 	select {
 	case e := <-errc:
@@ -7,7 +7,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/sethjback/gobl/files"
@@ -23,6 +25,8 @@ const (
 	LocalFileOptionOverwrite = "overwrite"
 	// LocalFileOptionRestorePath is the restore path option name
 	LocalFileOptionRestorePath = "restorePath"
+	// LocalFileOptionSkipOwnership is the skip ownership flag option name
+	LocalFileOptionSkipOwnership = "skipOwnership"
 
 	errorAccessSavePath    = "AccessSavePathFailed"
 	errorAccessRestorePath = "AccessRestorePathFailed"
@@ -34,6 +38,11 @@ type LocalFile struct {
 	restorePath      string
 	overWrite        bool
 	originalLocation bool
+	skipOwnership    bool
+}
+
+func init() {
+	Register(NameLocalFile, func() interface{} { return &LocalFile{} })
 }
 
 // Name returns "LocalFile"
@@ -130,7 +139,7 @@ func (e *LocalFile) Save(reader io.Reader, file files.File, errc chan<- error) {
 }
 
 // Retrieve grabs the file from the save location and reaturns a reader to it
-func (e *LocalFile) Retrieve(file files.File) (io.Reader, error) {
+func (e *LocalFile) Retrieve(file files.File) (io.ReadCloser, error) {
 	fn, err := hashFileSig(file.Signature)
 	if err != nil {
 		return nil, err
@@ -144,6 +153,37 @@ func (e *LocalFile) Retrieve(file files.File) (io.Reader, error) {
 	return restoreFile, nil
 }
 
+// StoredKey returns the name of the file the signature is saved as
+func (e *LocalFile) StoredKey(signature files.Signature) (string, error) {
+	return hashFileSig(signature)
+}
+
+// Stored lists the saved files in the save path. Anything not named like a signature hash is ignored
+func (e *LocalFile) Stored() (map[string]StoredObject, error) {
+	infos, err := ioutil.ReadDir(e.savePath)
+	if err != nil {
+		return nil, goblerr.New("Unable to list saved files", errorAccessSavePath, err)
+	}
+
+	stored := make(map[string]StoredObject)
+	for _, info := range infos {
+		if info.Mode().IsRegular() && isSigHash(info.Name()) {
+			stored[info.Name()] = StoredObject{Size: info.Size(), Modified: info.ModTime()}
+		}
+	}
+
+	return stored, nil
+}
+
+// Delete removes the saved file
+func (e *LocalFile) Delete(key string) error {
+	if !isSigHash(key) {
+		return goblerr.New("Invalid key", ErrorInvalidOptionValue, key+" is not a saved file")
+	}
+
+	return os.Remove(e.savePath + string(os.PathSeparator) + key)
+}
+
 func hashFileSig(fileSig files.Signature) (string, error) {
 	sig, err := json.Marshal(fileSig)
 	if err != nil {
@@ -154,6 +194,15 @@ func hashFileSig(fileSig files.Signature) (string, error) {
 	return hex.EncodeToString(hash[:]), nil
 }
 
+// isSigHash checks the name is one hashFileSig could have produced
+func isSigHash(name string) bool {
+	if len(name) != md5.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
 // RestoreOptions lists the available options for the restore
 func (e *LocalFile) RestoreOptions() []Option {
 	return []Option{
@@ -168,13 +217,20 @@ func (e *LocalFile) RestoreOptions() []Option {
 			Description: "whether we should overwrite the existing file if it already exists",
 			Type:        "bool",
 			Required:    true,
-			Default:     ""}}
+			Default:     ""},
+		Option{
+			Name:        LocalFileOptionSkipOwnership,
+			Description: "don't restore the file owner and group. Restoring ownership generally requires running as root, so it is skipped by default otherwise",
+			Type:        "bool",
+			Required:    false,
+			Default:     !canChown()}}
 }
 
 // ConfigureRestore configures the necessary options to run a local disk restore
 func (e *LocalFile) ConfigureRestore(options map[string]interface{}) error {
 	oProvided := false
 	rpProvided := false
+	e.skipOwnership = !canChown()
 	for k, v := range options {
 		switch strings.ToLower(k) {
 		case strings.ToLower(LocalFileOptionOverwrite):
@@ -194,6 +250,12 @@ func (e *LocalFile) ConfigureRestore(options map[string]interface{}) error {
 				e.restorePath = vString
 				rpProvided = true
 			}
+		case strings.ToLower(LocalFileOptionSkipOwnership):
+			if vBool, ok := v.(bool); !ok {
+				return goblerr.New("Invalid option", ErrorInvalidOptionValue, LocalFileOptionSkipOwnership+" must be a bool")
+			} else {
+				e.skipOwnership = vBool
+			}
 		}
 	}
 
@@ -204,6 +266,11 @@ func (e *LocalFile) ConfigureRestore(options map[string]interface{}) error {
 	return nil
 }
 
+// canChown is true if the agent can give files to other users, which needs root
+func canChown() bool {
+	return os.Geteuid() == 0
+}
+
 // ShouldRestore checks to see if the we should restore the file
 func (e *LocalFile) ShouldRestore(file files.File) (bool, error) {
 	var fPath string
@@ -224,6 +291,7 @@ func (e *LocalFile) ShouldRestore(file files.File) (bool, error) {
 }
 
 // Restore takes the given input stream and restores the file to the local disk
+// Once the data is written the file's recorded mode, ownership and timestamps are applied
 func (e *LocalFile) Restore(reader io.Reader, file files.File, errc chan<- error) {
 	var fPath string
 	var fFlags int
@@ -237,14 +305,13 @@ func (e *LocalFile) Restore(reader io.Reader, file files.File, errc chan<- error
 	if e.originalLocation {
 		fPath = file.Path
 	} else {
+		fPath = e.restorePath + string(os.PathSeparator) + file.Path
 
-		err := os.MkdirAll(e.restorePath+string(os.PathSeparator)+file.Path, 0744)
+		err := os.MkdirAll(filepath.Dir(fPath), 0744)
 		if err != nil {
 			errc <- err
 			return
 		}
-
-		fPath = e.restorePath + string(os.PathSeparator) + file.Path
 	}
 
 	rFile, err := os.OpenFile(fPath, fFlags, 0744)
@@ -252,10 +319,23 @@ func (e *LocalFile) Restore(reader io.Reader, file files.File, errc chan<- error
 		errc <- err
 		return
 	}
-	defer rFile.Close()
 
 	if _, err := io.Copy(rFile, reader); err != nil {
+		rFile.Close()
 		errc <- err
 		return
 	}
+
+	if err := rFile.Close(); err != nil {
+		errc <- err
+		return
+	}
+
+	if !file.Meta.Captured() {
+		return
+	}
+
+	if err := file.Meta.Apply(fPath, !e.skipOwnership); err != nil {
+		errc <- err
+	}
 }
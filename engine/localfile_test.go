@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/sethjback/gobl/files"
 	"github.com/stretchr/testify/assert"
@@ -84,3 +86,93 @@ func TestLocalFile(t *testing.T) {
 	err = os.Remove(fHash2)
 	assert.Nil(err)
 }
+
+func TestLocalFileRestore(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "gobl-restore")
+	if !assert.Nil(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	l := LocalFile{}
+	assert.NotNil(l.ConfigureRestore(map[string]interface{}{LocalFileOptionRestorePath: dir}))
+	assert.NotNil(l.ConfigureRestore(map[string]interface{}{LocalFileOptionRestorePath: dir, LocalFileOptionOverwrite: false, LocalFileOptionSkipOwnership: "yes"}))
+	// ownership is only restored by default when running as root
+	assert.Nil(l.ConfigureRestore(map[string]interface{}{LocalFileOptionRestorePath: dir, LocalFileOptionOverwrite: false}))
+	assert.Equal(os.Geteuid() != 0, l.skipOwnership)
+	assert.Nil(l.ConfigureRestore(map[string]interface{}{LocalFileOptionRestorePath: dir, LocalFileOptionOverwrite: false, LocalFileOptionSkipOwnership: true}))
+
+	mtime := time.Date(2016, time.March, 4, 12, 30, 0, 0, time.UTC)
+	file := files.File{
+		Signature: files.Signature{Path: "/etc/app/config"},
+		Meta:      files.Meta{Mode: 0600, UID: 12345, GID: 12345, ModTime: mtime, AccessTime: mtime}}
+
+	restore, err := l.ShouldRestore(file)
+	assert.Nil(err)
+	assert.True(restore)
+
+	data := []byte("key = value")
+	errc := make(chan error, 3)
+	l.Restore(bytes.NewReader(data), file, errc)
+
+	select {
+	case e := <-errc:
+		assert.Nil(e)
+	default:
+		//good
+	}
+
+	fPath := filepath.Join(dir, "etc", "app", "config")
+	fData, err := ioutil.ReadFile(fPath)
+	assert.Nil(err)
+	assert.Equal(data, fData)
+
+	info, err := os.Stat(fPath)
+	if assert.Nil(err) {
+		assert.Equal(os.FileMode(0600), info.Mode().Perm())
+		assert.True(mtime.Equal(info.ModTime()))
+	}
+
+	restore, err = l.ShouldRestore(file)
+	assert.Nil(err)
+	assert.False(restore)
+}
+
+func TestLocalFilePrune(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "gobl-prune")
+	if !assert.Nil(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	l := LocalFile{}
+	if !assert.Nil(l.ConfigureSave(map[string]interface{}{LocalFileOptionSavePath: dir})) {
+		return
+	}
+
+	sig := files.Signature{Path: "/the/test/path/test1", Hash: "asdf"}
+	key, err := l.StoredKey(sig)
+	assert.Nil(err)
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, key), []byte("saved"), 0600))
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a backup"), 0600))
+	assert.Nil(os.Mkdir(filepath.Join(dir, "0123456789abcdef0123456789abcdef"), 0700))
+
+	stored, err := l.Stored()
+	if assert.Nil(err) {
+		if assert.Len(stored, 1) {
+			assert.Equal(int64(5), stored[key].Size)
+			assert.WithinDuration(time.Now(), stored[key].Modified, time.Minute)
+		}
+	}
+
+	assert.NotNil(l.Delete("notes.txt"))
+	assert.NotNil(l.Delete("../" + key))
+	assert.Nil(l.Delete(key))
+
+	_, err = os.Stat(filepath.Join(dir, key))
+	assert.True(os.IsNotExist(err))
+}
@@ -25,6 +25,10 @@ type Logger struct {
 	overWrite bool
 }
 
+func init() {
+	Register(NameLogger, func() interface{} { return &Logger{} })
+}
+
 type LogLine struct {
 	Start         string   `json:"start"`
 	End           string   `json:"end"`
@@ -62,7 +66,7 @@ func (e *Logger) Save(reader io.Reader, file files.File, errc chan<- error) {
 }
 
 // Retrieve does nothing
-func (e *Logger) Retrieve(file files.File) (io.Reader, error) {
+func (e *Logger) Retrieve(file files.File) (io.ReadCloser, error) {
 	return nil, errors.New("Cannot use Logger to restore files")
 }
 
@@ -1,9 +1,8 @@
 package engine
 
 import (
-	"errors"
 	"io"
-	"strings"
+	"time"
 
 	"github.com/sethjback/gobl/files"
 )
@@ -43,8 +42,8 @@ type Saver interface {
 	// Save process the input bytes. Signauture gives information about the file being saved
 	// any errors encountered during the write should be sent over errc
 	Save(input io.Reader, signature files.File, errc chan<- error)
-	// Retrieve the file represented by signature
-	Retrieve(signature files.File) (io.Reader, error)
+	// Retrieve the file represented by signature. The caller closes the reader once done with it
+	Retrieve(signature files.File) (io.ReadCloser, error)
 	// ShouldBackup indicates whether the engine needs to process the file
 	ShouldSave(signature files.File) (bool, error)
 	// Name of the backup engine
@@ -55,6 +54,53 @@ type Saver interface {
 	ConfigureSave(options map[string]interface{}) error
 }
 
+// Pruner is an optional interface for savers that can list and remove the objects they have stored.
+// It is used to garbage collect objects no longer referenced by any job
+type Pruner interface {
+	// StoredKey returns the key the saver stores the file signature under
+	StoredKey(signature files.Signature) (string, error)
+	// Stored lists every object the saver has stored
+	Stored() (map[string]StoredObject, error)
+	// Delete removes the stored object
+	Delete(key string) error
+}
+
+// StoredObject describes an object a pruner has stored
+type StoredObject struct {
+	Size     int64
+	Modified time.Time
+}
+
+// PruneGrace is how long a stored object is kept after it was last saved, whether or not a job references it:
+// a running job saves objects it has not reported yet
+const PruneGrace = 24 * time.Hour
+
+// Sweeper is an optional interface for pruners whose stored objects share data, like chunks.
+// Sweep removes the shared data that no stored object uses, ignoring the objects in removed.
+// With dryRun set nothing is removed, it only counts what would be
+type Sweeper interface {
+	Sweep(removed []string, dryRun bool) (objects int, bytes int64, err error)
+}
+
+// Statter is an optional interface for savers that can report on the space they use
+type Statter interface {
+	Stats() (Stats, error)
+}
+
+// Stats describes what a saver has stored
+type Stats struct {
+	// Files saved
+	Files int `json:"files"`
+	// Bytes is the total size of the saved files
+	Bytes int64 `json:"bytes"`
+	// StoredBytes is the space the saver is using for them
+	StoredBytes int64 `json:"storedBytes"`
+	// Chunks is the number of distinct chunks, for savers that deduplicate
+	Chunks int `json:"chunks,omitempty"`
+	// Ratio of Bytes to StoredBytes: 4 means the files take a quarter of their size
+	Ratio float64 `json:"ratio"`
+}
+
 // Restorer is the interface an engine needs to satisfy for restoring data
 type Restorer interface {
 	// Restore processes the input. Signature gives information aobut the file
@@ -69,61 +115,3 @@ type Restorer interface {
 	// ConfigureRestore sets the appropriate options
 	ConfigureRestore(map[string]interface{}) error
 }
-
-// BuildSavers returns a slice of configured savers
-func BuildSavers(definitions []Definition) ([]Saver, error) {
-	var sers []Saver
-	for _, d := range definitions {
-		switch strings.ToLower(d.Name) {
-		case NameLocalFile:
-			localFile := &LocalFile{}
-
-			if err := localFile.ConfigureSave(d.Options); err != nil {
-				return nil, err
-			}
-
-			sers = append(sers, localFile)
-
-		case NameLogger:
-			logger := &Logger{}
-
-			if err := logger.ConfigureSave(d.Options); err != nil {
-				return nil, err
-			}
-
-			sers = append(sers, logger)
-
-		default:
-			return nil, errors.New("I don't understand engine type: " + d.Name)
-		}
-	}
-	return sers, nil
-}
-
-// BuildRestorers returns a slice of configured restorers
-func BuildRestorers(definitions []Definition) ([]Restorer, error) {
-	var rers []Restorer
-	for _, d := range definitions {
-		switch strings.ToLower(d.Name) {
-		case NameLocalFile:
-			localFile := &LocalFile{}
-			if err := localFile.ConfigureRestore(d.Options); err != nil {
-				return nil, err
-			}
-			rers = append(rers, localFile)
-
-		case NameLogger:
-			logger := &Logger{}
-			if err := logger.ConfigureRestore(d.Options); err != nil {
-				return nil, err
-			}
-			rers = append(rers, logger)
-
-		default:
-			return nil, errors.New("I don't understand restore engine type: " + d.Name)
-
-		}
-	}
-
-	return rers, nil
-}
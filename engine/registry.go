@@ -0,0 +1,157 @@
+package engine
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Capability describes a registered engine: whether it can save and restore, and the options for each
+type Capability struct {
+	Name           string   `json:"name"`
+	Save           bool     `json:"save"`
+	Restore        bool     `json:"restore"`
+	SaveOptions    []Option `json:"saveOptions,omitempty"`
+	RestoreOptions []Option `json:"restoreOptions,omitempty"`
+}
+
+// Factory returns a new, unconfigured engine. The engine must be a Saver, a Restorer, or both
+type Factory func() interface{}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes an engine available to jobs under name. Engines register themselves from an init function,
+// so engines in other packages are available once the package is imported.
+// Register panics if the name is already taken or factory is nil
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	name = strings.ToLower(name)
+	if factory == nil {
+		panic("engine: Register factory is nil for " + name)
+	}
+	if _, ok := registry[name]; ok {
+		panic("engine: Register called twice for " + name)
+	}
+	registry[name] = factory
+}
+
+// newEngine returns a new instance of the registered engine
+func newEngine(name string) (interface{}, bool) {
+	registryMu.RLock()
+	factory, ok := registry[strings.ToLower(name)]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+	return factory(), true
+}
+
+// registered returns the registered engine names, sorted
+func registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BuildSavers returns a slice of configured savers
+func BuildSavers(definitions []Definition) ([]Saver, error) {
+	var sers []Saver
+	for _, d := range definitions {
+		e, ok := newEngine(d.Name)
+		if !ok {
+			return nil, errors.New("I don't understand engine type: " + d.Name)
+		}
+
+		saver, ok := e.(Saver)
+		if !ok {
+			return nil, errors.New("engine can't be used to save: " + d.Name)
+		}
+
+		if err := saver.ConfigureSave(d.Options); err != nil {
+			return nil, err
+		}
+
+		sers = append(sers, saver)
+	}
+	return sers, nil
+}
+
+// BuildRestorers returns a slice of configured restorers
+func BuildRestorers(definitions []Definition) ([]Restorer, error) {
+	var rers []Restorer
+	for _, d := range definitions {
+		e, ok := newEngine(d.Name)
+		if !ok {
+			return nil, errors.New("I don't understand restore engine type: " + d.Name)
+		}
+
+		restorer, ok := e.(Restorer)
+		if !ok {
+			return nil, errors.New("engine can't be used to restore: " + d.Name)
+		}
+
+		if err := restorer.ConfigureRestore(d.Options); err != nil {
+			return nil, err
+		}
+
+		rers = append(rers, restorer)
+	}
+
+	return rers, nil
+}
+
+// AvailableSavers returns an unconfigured instance of every registered engine that can save, sorted by name
+func AvailableSavers() []Saver {
+	var sers []Saver
+	for _, name := range registered() {
+		e, _ := newEngine(name)
+		if saver, ok := e.(Saver); ok {
+			sers = append(sers, saver)
+		}
+	}
+	return sers
+}
+
+// AvailableRestorers returns an unconfigured instance of every registered engine that can restore, sorted by name
+func AvailableRestorers() []Restorer {
+	var rers []Restorer
+	for _, name := range registered() {
+		e, _ := newEngine(name)
+		if restorer, ok := e.(Restorer); ok {
+			rers = append(rers, restorer)
+		}
+	}
+	return rers
+}
+
+// Capabilities describes every registered engine, sorted by name
+func Capabilities() []Capability {
+	caps := []Capability{}
+	for _, name := range registered() {
+		e, _ := newEngine(name)
+		c := Capability{Name: name}
+		if saver, ok := e.(Saver); ok {
+			c.Save = true
+			c.SaveOptions = saver.SaveOptions()
+		}
+		if restorer, ok := e.(Restorer); ok {
+			c.Restore = true
+			c.RestoreOptions = restorer.RestoreOptions()
+		}
+		caps = append(caps, c)
+	}
+	return caps
+}
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// saveOnly is an engine that can save but not restore
+type saveOnly struct {
+	Saver
+}
+
+func (e *saveOnly) Name() string {
+	return "saveonly"
+}
+
+func TestRegister(t *testing.T) {
+	assert := assert.New(t)
+
+	Register("SaveOnly", func() interface{} { return &saveOnly{&Logger{}} })
+
+	assert.Panics(func() { Register("saveonly", func() interface{} { return &saveOnly{&Logger{}} }) })
+	assert.Panics(func() { Register("nilfactory", nil) })
+
+	sers, err := BuildSavers([]Definition{{Name: "saveOnly", Options: map[string]interface{}{LoggerOptionLogPath: "registry.log"}}})
+	assert.Nil(err)
+	if assert.Len(sers, 1) {
+		assert.Equal("saveonly", sers[0].Name())
+	}
+
+	_, err = BuildRestorers([]Definition{{Name: "saveonly"}})
+	assert.NotNil(err)
+
+	_, err = BuildSavers([]Definition{{Name: "nothere"}})
+	assert.NotNil(err)
+
+	var names []string
+	for _, s := range AvailableSavers() {
+		names = append(names, s.Name())
+	}
+	assert.Equal([]string{NameDedup, NameLocalFile, "Logger", NameS3, "saveonly"}, names)
+
+	names = nil
+	for _, r := range AvailableRestorers() {
+		names = append(names, r.Name())
+	}
+	assert.Equal([]string{NameLocalFile, "Logger", NameS3}, names)
+}
+
+func TestCapabilities(t *testing.T) {
+	assert := assert.New(t)
+
+	caps := map[string]Capability{}
+	for _, c := range Capabilities() {
+		caps[c.Name] = c
+	}
+
+	dedup, ok := caps[NameDedup]
+	if assert.True(ok) {
+		assert.True(dedup.Save)
+		assert.False(dedup.Restore)
+		assert.Equal((&Dedup{}).SaveOptions(), dedup.SaveOptions)
+		assert.Empty(dedup.RestoreOptions)
+	}
+
+	local, ok := caps[NameLocalFile]
+	if assert.True(ok) {
+		assert.True(local.Save)
+		assert.True(local.Restore)
+		assert.Equal((&LocalFile{}).RestoreOptions(), local.RestoreOptions)
+	}
+}
@@ -0,0 +1,407 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sethjback/gobl/files"
+	"github.com/sethjback/gobl/goblerr"
+)
+
+const (
+	// NameS3 is the name of the S3 engine
+	NameS3 = "s3"
+	// S3OptionEndpoint is the endpoint option name. Leave empty for AWS
+	S3OptionEndpoint = "endpoint"
+	// S3OptionBucket is the bucket option name
+	S3OptionBucket = "bucket"
+	// S3OptionPrefix is the key prefix option name
+	S3OptionPrefix = "prefix"
+	// S3OptionRegion is the region option name
+	S3OptionRegion = "region"
+	// S3OptionAccessKey is the access key id option name
+	S3OptionAccessKey = "accessKey"
+	// S3OptionSecretKey is the secret access key option name
+	S3OptionSecretKey = "secretKey"
+	// S3OptionSessionToken is the session token option name
+	S3OptionSessionToken = "sessionToken"
+	// S3OptionStorageClass is the storage class option name
+	S3OptionStorageClass = "storageClass"
+	// S3OptionPartSize is the multipart part size option name, in MB
+	S3OptionPartSize = "partSize"
+	// S3OptionOverwrite is the overwrite flag option name
+	S3OptionOverwrite = "overwrite"
+
+	s3DefaultRegion       = "us-east-1"
+	s3DefaultStorageClass = "STANDARD"
+	// S3 will not accept parts smaller than 5MB (apart from the last one)
+	s3MinPartSize = 5
+)
+
+// S3 saves files to an S3 compatible bucket
+// Saved files are keyed by the file signature, the same as LocalFile, under the configured prefix.
+// Restored files are written to the bucket under the prefix using their original path
+type S3 struct {
+	client       *s3Client
+	prefix       string
+	storageClass string
+	partSize     int
+	overWrite    bool
+}
+
+func init() {
+	Register(NameS3, func() interface{} { return &S3{} })
+}
+
+// Name returns "s3"
+func (e *S3) Name() string {
+	return NameS3
+}
+
+// SaveOptions lists the available options for saving
+func (e *S3) SaveOptions() []Option {
+	return append(s3ConnectionOptions(), s3UploadOptions()...)
+}
+
+// ConfigureSave configures the bucket connection and upload options
+func (e *S3) ConfigureSave(options map[string]interface{}) error {
+	return e.configure(options)
+}
+
+// ShouldSave issues a HEAD request on the signature key: if it exists we don't need to save it again
+func (e *S3) ShouldSave(file files.File) (bool, error) {
+	key, err := e.saveKey(file.Signature)
+	if err != nil {
+		return false, err
+	}
+
+	exists, err := e.client.exists(key)
+	if err != nil {
+		return false, err
+	}
+
+	return !exists, nil
+}
+
+// Save uploads the stream to the bucket
+func (e *S3) Save(reader io.Reader, file files.File, errc chan<- error) {
+	key, err := e.saveKey(file.Signature)
+	if err != nil {
+		errc <- err
+		return
+	}
+
+	if err := e.upload(key, reader, http.Header{}); err != nil {
+		errc <- err
+		return
+	}
+}
+
+// Retrieve returns a reader to the saved object
+func (e *S3) Retrieve(file files.File) (io.ReadCloser, error) {
+	key, err := e.saveKey(file.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.client.get(key)
+}
+
+// RestoreOptions lists the available options for restoring
+func (e *S3) RestoreOptions() []Option {
+	return append(append(s3ConnectionOptions(), s3UploadOptions()...),
+		Option{
+			Name:        S3OptionOverwrite,
+			Description: "whether we should overwrite the object if it already exists",
+			Type:        "bool",
+			Required:    false,
+			Default:     false})
+}
+
+// ConfigureRestore configures the bucket connection and upload options
+func (e *S3) ConfigureRestore(options map[string]interface{}) error {
+	return e.configure(options)
+}
+
+// ShouldRestore checks if the object already exists
+func (e *S3) ShouldRestore(file files.File) (bool, error) {
+	exists, err := e.client.exists(e.restoreKey(file.Path))
+	if err != nil {
+		return false, err
+	}
+
+	if exists {
+		return e.overWrite, nil
+	}
+
+	return true, nil
+}
+
+// Restore uploads the stream to the bucket using the original file path
+// Recorded file metadata is stored as user defined object metadata
+func (e *S3) Restore(reader io.Reader, file files.File, errc chan<- error) {
+	headers := http.Header{}
+	if file.Meta.Captured() {
+		headers.Set(s3HeaderMeta+"Mode", fmt.Sprintf("%o", file.Mode))
+		headers.Set(s3HeaderMeta+"Uid", strconv.Itoa(file.UID))
+		headers.Set(s3HeaderMeta+"Gid", strconv.Itoa(file.GID))
+		headers.Set(s3HeaderMeta+"Mtime", strconv.FormatInt(file.ModTime.Unix(), 10))
+		headers.Set(s3HeaderMeta+"Atime", strconv.FormatInt(file.AccessTime.Unix(), 10))
+	}
+
+	if err := e.upload(e.restoreKey(file.Path), reader, headers); err != nil {
+		errc <- err
+		return
+	}
+}
+
+// upload sends the stream as a single PUT if it fits in one part, otherwise as a multipart upload
+func (e *S3) upload(key string, reader io.Reader, headers http.Header) error {
+	headers.Set(s3HeaderClass, e.storageClass)
+
+	buf := make([]byte, e.partSize)
+	n, err := io.ReadFull(reader, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return e.client.put(key, headers, buf[:n])
+	}
+	if err != nil {
+		return err
+	}
+
+	uploadID, err := e.client.initiateMultipart(key, headers)
+	if err != nil {
+		return err
+	}
+
+	var parts []s3CompletePart
+	for n > 0 {
+		etag, err := e.client.uploadPart(key, uploadID, len(parts)+1, buf[:n])
+		if err != nil {
+			e.client.abortMultipart(key, uploadID)
+			return err
+		}
+		parts = append(parts, s3CompletePart{PartNumber: len(parts) + 1, ETag: etag})
+
+		n, err = io.ReadFull(reader, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			e.client.abortMultipart(key, uploadID)
+			return err
+		}
+	}
+
+	if err := e.client.completeMultipart(key, uploadID, parts); err != nil {
+		e.client.abortMultipart(key, uploadID)
+		return err
+	}
+
+	return nil
+}
+
+// StoredKey returns the object key the signature is saved as, without the prefix
+func (e *S3) StoredKey(signature files.Signature) (string, error) {
+	return hashFileSig(signature)
+}
+
+// Stored lists the saved objects under the prefix. Anything not named like a signature hash is ignored
+func (e *S3) Stored() (map[string]StoredObject, error) {
+	objects, err := e.client.list(e.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make(map[string]StoredObject)
+	for key, o := range objects {
+		name := strings.TrimPrefix(key, e.prefix)
+		if isSigHash(name) {
+			stored[name] = o
+		}
+	}
+
+	return stored, nil
+}
+
+// Delete removes the saved object
+func (e *S3) Delete(key string) error {
+	if !isSigHash(key) {
+		return goblerr.New("Invalid key", ErrorInvalidOptionValue, key+" is not a saved object")
+	}
+
+	return e.client.delete(e.prefix + key)
+}
+
+func (e *S3) saveKey(sig files.Signature) (string, error) {
+	fn, err := hashFileSig(sig)
+	if err != nil {
+		return "", err
+	}
+
+	return e.prefix + fn, nil
+}
+
+func (e *S3) restoreKey(path string) string {
+	return e.prefix + strings.TrimPrefix(path, "/")
+}
+
+func (e *S3) configure(options map[string]interface{}) error {
+	c := &s3Client{region: s3DefaultRegion, client: &http.Client{}}
+	e.storageClass = s3DefaultStorageClass
+	e.partSize = s3MinPartSize
+
+	for k, v := range options {
+		var err error
+		switch strings.ToLower(k) {
+		case strings.ToLower(S3OptionEndpoint):
+			c.endpoint, err = s3StringOption(S3OptionEndpoint, v)
+		case strings.ToLower(S3OptionBucket):
+			c.bucket, err = s3StringOption(S3OptionBucket, v)
+		case strings.ToLower(S3OptionPrefix):
+			e.prefix, err = s3StringOption(S3OptionPrefix, v)
+		case strings.ToLower(S3OptionRegion):
+			c.region, err = s3StringOption(S3OptionRegion, v)
+		case strings.ToLower(S3OptionAccessKey):
+			c.accessKey, err = s3StringOption(S3OptionAccessKey, v)
+		case strings.ToLower(S3OptionSecretKey):
+			c.secretKey, err = s3StringOption(S3OptionSecretKey, v)
+		case strings.ToLower(S3OptionSessionToken):
+			c.sessionToken, err = s3StringOption(S3OptionSessionToken, v)
+		case strings.ToLower(S3OptionStorageClass):
+			e.storageClass, err = s3StringOption(S3OptionStorageClass, v)
+			e.storageClass = strings.ToUpper(e.storageClass)
+		case strings.ToLower(S3OptionPartSize):
+			var size int
+			switch vNum := v.(type) {
+			case int:
+				size = vNum
+			case float64:
+				size = int(vNum)
+			default:
+				return goblerr.New("Invalid option", ErrorInvalidOptionValue, fmt.Sprintf("%s must be an int", S3OptionPartSize))
+			}
+			if size < s3MinPartSize {
+				return goblerr.New("Invalid option", ErrorInvalidOptionValue, fmt.Sprintf("%s must be at least %d", S3OptionPartSize, s3MinPartSize))
+			}
+			e.partSize = size
+
+		case strings.ToLower(S3OptionOverwrite):
+			vBool, ok := v.(bool)
+			if !ok {
+				return goblerr.New("Invalid option", ErrorInvalidOptionValue, fmt.Sprintf("%s must be a bool", S3OptionOverwrite))
+			}
+			e.overWrite = vBool
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.region == "" {
+		c.region = s3DefaultRegion
+	}
+
+	if e.storageClass == "" {
+		e.storageClass = s3DefaultStorageClass
+	}
+
+	if c.bucket == "" {
+		return goblerr.New("Must provide bucket", ErrorRequiredOptionMissing, fmt.Sprintf("%s is required", S3OptionBucket))
+	}
+
+	// fall back to the standard aws environment variables
+	if c.accessKey == "" && c.secretKey == "" {
+		c.accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		c.secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if c.sessionToken == "" {
+			c.sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		}
+	}
+
+	if c.accessKey == "" || c.secretKey == "" {
+		return goblerr.New("Must provide credentials", ErrorRequiredOptionMissing, fmt.Sprintf("%s and %s are required", S3OptionAccessKey, S3OptionSecretKey))
+	}
+
+	if e.prefix != "" && !strings.HasSuffix(e.prefix, "/") {
+		e.prefix += "/"
+	}
+	e.prefix = strings.TrimPrefix(e.prefix, "/")
+
+	e.partSize = e.partSize * 1024 * 1024
+	e.client = c
+
+	return nil
+}
+
+func s3StringOption(name string, v interface{}) (string, error) {
+	vString, ok := v.(string)
+	if !ok {
+		return "", goblerr.New("Invalid option", ErrorInvalidOptionValue, fmt.Sprintf("%s must be a string", name))
+	}
+	return vString, nil
+}
+
+// s3UploadOptions are the options for how objects are uploaded, both when saving and restoring
+func s3UploadOptions() []Option {
+	return []Option{
+		Option{
+			Name:        S3OptionStorageClass,
+			Description: "storage class to save objects with, e.g. STANDARD, STANDARD_IA, GLACIER",
+			Type:        "string",
+			Required:    false,
+			Default:     s3DefaultStorageClass},
+		Option{
+			Name:        S3OptionPartSize,
+			Description: "size in MB of each part when uploading large files. Must be at least 5",
+			Type:        "int",
+			Required:    false,
+			Default:     s3MinPartSize}}
+}
+
+func s3ConnectionOptions() []Option {
+	return []Option{
+		Option{
+			Name:        S3OptionEndpoint,
+			Description: "url of an S3 compatible endpoint, e.g. http://127.0.0.1:9000. Leave empty to use AWS",
+			Type:        "string",
+			Required:    false,
+			Default:     ""},
+		Option{
+			Name:        S3OptionBucket,
+			Description: "bucket to store the objects in",
+			Type:        "string",
+			Required:    true,
+			Default:     ""},
+		Option{
+			Name:        S3OptionPrefix,
+			Description: "prefix added to every object key",
+			Type:        "string",
+			Required:    false,
+			Default:     ""},
+		Option{
+			Name:        S3OptionRegion,
+			Description: "region the bucket is in",
+			Type:        "string",
+			Required:    false,
+			Default:     s3DefaultRegion},
+		Option{
+			Name:        S3OptionAccessKey,
+			Description: "access key id. Falls back to AWS_ACCESS_KEY_ID",
+			Type:        "string",
+			Required:    false,
+			Default:     ""},
+		Option{
+			Name:        S3OptionSecretKey,
+			Description: "secret access key. Falls back to AWS_SECRET_ACCESS_KEY",
+			Type:        "string",
+			Required:    false,
+			Default:     ""},
+		Option{
+			Name:        S3OptionSessionToken,
+			Description: "session token for temporary credentials. Falls back to AWS_SESSION_TOKEN",
+			Type:        "string",
+			Required:    false,
+			Default:     ""}}
+}
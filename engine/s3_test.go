@@ -0,0 +1,303 @@
+package engine
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sethjback/gobl/files"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 is an in memory stand in for an S3 compatible store. It supports the subset of the
+// api the engine uses: HEAD, GET, PUT, DELETE, ListObjectsV2 and multipart uploads with path style addressing
+type fakeS3 struct {
+	m        *sync.Mutex
+	objects  map[string][]byte
+	classes  map[string]string
+	meta     map[string]string
+	uploads  map[string]map[int][]byte
+	uploadID int
+	requests int
+	// modified is reported as every object's modification time
+	modified time.Time
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		m:        &sync.Mutex{},
+		objects:  make(map[string][]byte),
+		classes:  make(map[string]string),
+		meta:     make(map[string]string),
+		uploads:  make(map[string]map[int][]byte),
+		modified: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.requests++
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), s3Algorithm+" Credential=access/") {
+		w.WriteHeader(403)
+		fmt.Fprint(w, "<Error><Code>AccessDenied</Code><Message>unsigned</Message></Error>")
+		return
+	}
+
+	key := r.URL.Path
+	q := r.URL.Query()
+	body, _ := ioutil.ReadAll(r.Body)
+
+	switch {
+	case r.Method == "HEAD":
+		if _, ok := f.objects[key]; !ok {
+			w.WriteHeader(404)
+		}
+
+	case r.Method == "GET" && q.Get("list-type") == "2":
+		// one object per page to exercise continuation
+		bucket := strings.TrimSuffix(key, "/") + "/"
+		var keys []string
+		for k := range f.objects {
+			if strings.HasPrefix(k, bucket+q.Get("prefix")) && k > bucket+q.Get("continuation-token") {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		if len(keys) == 0 {
+			fmt.Fprint(w, "<ListBucketResult><IsTruncated>false</IsTruncated></ListBucketResult>")
+			return
+		}
+		k := strings.TrimPrefix(keys[0], bucket)
+		fmt.Fprintf(w, "<ListBucketResult><Contents><Key>%s</Key><Size>%d</Size><LastModified>%s</LastModified></Contents><IsTruncated>%t</IsTruncated><NextContinuationToken>%s</NextContinuationToken></ListBucketResult>",
+			k, len(f.objects[keys[0]]), f.modified.Format(time.RFC3339), len(keys) > 1, k)
+
+	case r.Method == "GET":
+		o, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(404)
+			fmt.Fprint(w, "<Error><Code>NoSuchKey</Code><Message>missing</Message></Error>")
+			return
+		}
+		w.Write(o)
+
+	case r.Method == "POST" && q.Get("uploadId") == "":
+		f.uploadID++
+		id := strconv.Itoa(f.uploadID)
+		f.uploads[id] = make(map[int][]byte)
+		f.classes[key] = r.Header.Get(s3HeaderClass)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+
+	case r.Method == "PUT" && q.Get("uploadId") != "":
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		f.uploads[q.Get("uploadId")][n] = body
+		sum := md5.Sum(body)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+
+	case r.Method == "POST":
+		var c s3CompleteMultipart
+		if err := xml.Unmarshal(body, &c); err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		var o []byte
+		for _, p := range c.Parts {
+			o = append(o, f.uploads[q.Get("uploadId")][p.PartNumber]...)
+		}
+		f.objects[key] = o
+		delete(f.uploads, q.Get("uploadId"))
+
+	case r.Method == "DELETE" && q.Get("uploadId") != "":
+		delete(f.uploads, q.Get("uploadId"))
+		w.WriteHeader(204)
+
+	case r.Method == "DELETE":
+		delete(f.objects, key)
+		w.WriteHeader(204)
+
+	case r.Method == "PUT":
+		f.objects[key] = body
+		f.classes[key] = r.Header.Get(s3HeaderClass)
+		f.meta[key] = r.Header.Get(s3HeaderMeta + "Mode")
+	}
+}
+
+func TestS3Configure(t *testing.T) {
+	assert := assert.New(t)
+	s := &S3{}
+
+	assert.NotNil(s.ConfigureSave(map[string]interface{}{S3OptionAccessKey: "a", S3OptionSecretKey: "b"}))
+	assert.NotNil(s.ConfigureSave(map[string]interface{}{S3OptionBucket: true, S3OptionAccessKey: "a", S3OptionSecretKey: "b"}))
+	assert.NotNil(s.ConfigureSave(map[string]interface{}{S3OptionBucket: "b", S3OptionAccessKey: "a", S3OptionSecretKey: "b", S3OptionPartSize: 1}))
+	assert.NotNil(s.ConfigureSave(map[string]interface{}{S3OptionBucket: "b", S3OptionAccessKey: "a", S3OptionSecretKey: "b", S3OptionPartSize: "10"}))
+
+	err := s.ConfigureSave(map[string]interface{}{
+		S3OptionBucket:       "b",
+		S3OptionAccessKey:    "a",
+		S3OptionSecretKey:    "b",
+		S3OptionPrefix:       "/backups",
+		S3OptionPartSize:     float64(10),
+		S3OptionStorageClass: "standard_ia"})
+	if assert.Nil(err) {
+		assert.Equal("backups/", s.prefix)
+		assert.Equal(10*1024*1024, s.partSize)
+		assert.Equal("STANDARD_IA", s.storageClass)
+		assert.Equal(s3DefaultRegion, s.client.region)
+		assert.Equal("https://b.s3.us-east-1.amazonaws.com/backups/key", s.client.objectURL("backups/key", nil).String())
+	}
+}
+
+func TestS3(t *testing.T) {
+	assert := assert.New(t)
+
+	fake := newFakeS3()
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	s := &S3{}
+	err := s.ConfigureSave(map[string]interface{}{
+		S3OptionEndpoint:     ts.URL,
+		S3OptionBucket:       "gobl",
+		S3OptionPrefix:       "agent1",
+		S3OptionAccessKey:    "access",
+		S3OptionSecretKey:    "secret",
+		S3OptionStorageClass: "REDUCED_REDUNDANCY"})
+	if !assert.Nil(err) {
+		return
+	}
+
+	file := files.File{Signature: files.Signature{Path: "/the/test/path/test1", Hash: "asdf"}}
+	key, err := s.saveKey(file.Signature)
+	assert.Nil(err)
+
+	save, err := s.ShouldSave(file)
+	assert.Nil(err)
+	assert.True(save)
+
+	// single put
+	small := []byte("This is some test data to save that really should be saved")
+	errc := make(chan error, 3)
+	s.Save(bytes.NewReader(small), file, errc)
+
+	select {
+	case e := <-errc:
+		assert.Nil(e)
+	default:
+		//good
+	}
+
+	assert.Equal(small, fake.objects["/gobl/"+key])
+	assert.Equal("REDUCED_REDUNDANCY", fake.classes["/gobl/"+key])
+
+	save, err = s.ShouldSave(file)
+	assert.Nil(err)
+	assert.False(save)
+
+	r, err := s.Retrieve(file)
+	if assert.Nil(err) {
+		b, err := ioutil.ReadAll(r)
+		assert.Nil(err)
+		assert.Equal(small, b)
+		assert.Nil(r.Close())
+	}
+
+	// multipart: drop the part size so we don't need to push 5MB through the test
+	s.partSize = 16
+	file.Hash = "large"
+	key, _ = s.saveKey(file.Signature)
+	large := bytes.Repeat([]byte("0123456789"), 10)
+	s.Save(bytes.NewReader(large), file, errc)
+
+	select {
+	case e := <-errc:
+		assert.Nil(e)
+	default:
+		//good
+	}
+
+	assert.Equal(large, fake.objects["/gobl/"+key])
+	assert.Len(fake.uploads, 0)
+
+	// stored lists everything under the prefix by key, other prefixes and non signature keys are ignored
+	fake.objects["/gobl/agent1/notes.txt"] = []byte("not a backup")
+	fake.objects["/gobl/other/"+strings.TrimPrefix(key, "agent1/")] = []byte("other agent")
+	smallKey, _ := s.saveKey(files.Signature{Path: "/the/test/path/test1", Hash: "asdf"})
+	stored, err := s.Stored()
+	if assert.Nil(err) {
+		assert.Len(stored, 2)
+		assert.Equal(StoredObject{Size: int64(len(small)), Modified: fake.modified}, stored[strings.TrimPrefix(smallKey, "agent1/")])
+		assert.Equal(StoredObject{Size: int64(len(large)), Modified: fake.modified}, stored[strings.TrimPrefix(key, "agent1/")])
+	}
+
+	sKey, err := s.StoredKey(file.Signature)
+	assert.Nil(err)
+	assert.Equal(key, "agent1/"+sKey)
+
+	assert.Nil(s.Delete(sKey))
+	assert.Nil(fake.objects["/gobl/"+key])
+	assert.NotNil(fake.objects["/gobl/other/"+sKey])
+	assert.NotNil(s.Delete("notes.txt"))
+
+	// missing objects error on retrieve
+	file.Hash = "missing"
+	_, err = s.Retrieve(file)
+	if assert.NotNil(err) {
+		assert.Contains(err.Error(), "NoSuchKey")
+	}
+
+	// restore writes to the original path under the prefix
+	rs := &S3{}
+	err = rs.ConfigureRestore(map[string]interface{}{
+		S3OptionEndpoint:  ts.URL,
+		S3OptionBucket:    "gobl",
+		S3OptionPrefix:    "restore/",
+		S3OptionAccessKey: "access",
+		S3OptionSecretKey: "secret"})
+	if !assert.Nil(err) {
+		return
+	}
+
+	restore, err := rs.ShouldRestore(file)
+	assert.Nil(err)
+	assert.True(restore)
+
+	file.Meta = files.Meta{Mode: 0644, ModTime: time.Now(), AccessTime: time.Now()}
+	rs.Restore(bytes.NewReader(small), file, errc)
+	select {
+	case e := <-errc:
+		assert.Nil(e)
+	default:
+		//good
+	}
+	assert.Equal(small, fake.objects["/gobl/restore/the/test/path/test1"])
+	assert.Equal("644", fake.meta["/gobl/restore/the/test/path/test1"])
+
+	restore, err = rs.ShouldRestore(file)
+	assert.Nil(err)
+	assert.False(restore)
+}
+
+// Test vector from the AWS signature version 4 test suite (get-vanilla)
+func TestSignV4(t *testing.T) {
+	assert := assert.New(t)
+
+	req, err := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	if !assert.Nil(err) {
+		return
+	}
+
+	signV4(req, s3EmptyBodyHash, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "", "us-east-1", "service", time.Date(2015, time.August, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal("AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", req.Header.Get("Authorization"))
+}
@@ -0,0 +1,371 @@
+package engine
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sethjback/gobl/goblerr"
+)
+
+const (
+	errorS3Request = "S3RequestFailed"
+
+	s3Service         = "s3"
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3TimeFormat      = "20060102T150405Z"
+	s3DateFormat      = "20060102"
+	s3HeaderDate      = "X-Amz-Date"
+	s3HeaderContent   = "X-Amz-Content-Sha256"
+	s3HeaderToken     = "X-Amz-Security-Token"
+	s3HeaderClass     = "X-Amz-Storage-Class"
+	s3HeaderMeta      = "X-Amz-Meta-"
+	s3EmptyBodyHash   = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	s3DefaultEndpoint = "s3.%s.amazonaws.com"
+)
+
+// s3Client is a minimal S3 REST client. It only implements the calls the S3 engine needs and
+// signs every request with AWS signature version 4, so it works against AWS as well as
+// S3 compatible stores such as MinIO
+type s3Client struct {
+	endpoint     string
+	bucket       string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type s3InitiateMultipart struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+type s3CompletePart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type s3CompleteMultipart struct {
+	XMLName xml.Name         `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletePart `xml:"Part"`
+}
+
+// objectURL builds the url for the key. Custom endpoints use path style addressing (endpoint/bucket/key),
+// AWS uses virtual host style (bucket.s3.region.amazonaws.com/key)
+func (c *s3Client) objectURL(key string, query url.Values) *url.URL {
+	u := &url.URL{}
+	if c.endpoint == "" {
+		u.Scheme = "https"
+		u.Host = c.bucket + "." + fmt.Sprintf(s3DefaultEndpoint, c.region)
+		u.Path = "/" + key
+	} else {
+		e, err := url.Parse(c.endpoint)
+		if err != nil || e.Host == "" {
+			e = &url.URL{Scheme: "https", Host: c.endpoint}
+		}
+		u.Scheme = e.Scheme
+		u.Host = e.Host
+		u.Path = strings.TrimSuffix(e.Path, "/") + "/" + c.bucket + "/" + key
+	}
+
+	u.RawPath = s3EncodePath(u.Path)
+	u.RawQuery = s3CanonicalQuery(query)
+	return u
+}
+
+// do sends a signed request and returns the response. Responses outside the 2xx range are closed and returned as errors
+// unless the status is listed in allow
+func (c *s3Client) do(method, key string, query url.Values, headers http.Header, body []byte, allow ...int) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.objectURL(key, query).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, goblerr.New("Invalid S3 request", errorS3Request, err)
+	}
+
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+
+	payloadHash := s3EmptyBodyHash
+	if len(body) != 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	req.Header.Set(s3HeaderContent, payloadHash)
+	req.ContentLength = int64(len(body))
+
+	signV4(req, payloadHash, c.accessKey, c.secretKey, c.sessionToken, c.region, s3Service, time.Now().UTC())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, goblerr.New("S3 request failed", errorS3Request, err)
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	for _, a := range allow {
+		if resp.StatusCode == a {
+			return resp, nil
+		}
+	}
+
+	defer resp.Body.Close()
+	var e s3Error
+	b, _ := ioutil.ReadAll(resp.Body)
+	if xml.Unmarshal(b, &e) != nil || e.Code == "" {
+		e.Code = resp.Status
+	}
+
+	return nil, goblerr.New("S3 request failed", errorS3Request, fmt.Sprintf("%s %s: %s %s", method, key, e.Code, e.Message))
+}
+
+// exists issues a HEAD on the key
+func (c *s3Client) exists(key string) (bool, error) {
+	resp, err := c.do("HEAD", key, nil, nil, nil, http.StatusNotFound)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode != http.StatusNotFound, nil
+}
+
+// get returns the object body. The caller is responsible for closing it
+func (c *s3Client) get(key string) (io.ReadCloser, error) {
+	resp, err := c.do("GET", key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func (c *s3Client) delete(key string) error {
+	resp, err := c.do("DELETE", key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// list returns the key, size and modification time of every object under the prefix, following continuation tokens
+func (c *s3Client) list(prefix string) (map[string]StoredObject, error) {
+	objects := make(map[string]StoredObject)
+	token := ""
+	for {
+		q := url.Values{"list-type": []string{"2"}, "prefix": []string{prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		resp, err := c.do("GET", "", q, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var lr s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&lr)
+		resp.Body.Close()
+		if err != nil {
+			return nil, goblerr.New("S3 request failed", errorS3Request, err)
+		}
+
+		for _, o := range lr.Contents {
+			objects[o.Key] = StoredObject{Size: o.Size, Modified: o.LastModified}
+		}
+
+		if !lr.IsTruncated || lr.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = lr.NextContinuationToken
+	}
+}
+
+func (c *s3Client) put(key string, headers http.Header, body []byte) error {
+	resp, err := c.do("PUT", key, nil, headers, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (c *s3Client) initiateMultipart(key string, headers http.Header) (string, error) {
+	resp, err := c.do("POST", key, url.Values{"uploads": []string{""}}, headers, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var im s3InitiateMultipart
+	if err := xml.NewDecoder(resp.Body).Decode(&im); err != nil {
+		return "", goblerr.New("S3 request failed", errorS3Request, err)
+	}
+
+	return im.UploadID, nil
+}
+
+func (c *s3Client) uploadPart(key, uploadID string, number int, body []byte) (string, error) {
+	q := url.Values{"partNumber": []string{fmt.Sprintf("%d", number)}, "uploadId": []string{uploadID}}
+	resp, err := c.do("PUT", key, q, nil, body)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	return resp.Header.Get("ETag"), nil
+}
+
+func (c *s3Client) completeMultipart(key, uploadID string, parts []s3CompletePart) error {
+	body, err := xml.Marshal(s3CompleteMultipart{Parts: parts})
+	if err != nil {
+		return goblerr.New("S3 request failed", errorS3Request, err)
+	}
+
+	resp, err := c.do("POST", key, url.Values{"uploadId": []string{uploadID}}, http.Header{"Content-Type": []string{"application/xml"}}, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// S3 can return a 200 with an error body if the complete fails part way through
+	b, _ := ioutil.ReadAll(resp.Body)
+	var e s3Error
+	if xml.Unmarshal(b, &e) == nil && e.Code != "" {
+		return goblerr.New("S3 request failed", errorS3Request, fmt.Sprintf("complete %s: %s %s", key, e.Code, e.Message))
+	}
+
+	return nil
+}
+
+func (c *s3Client) abortMultipart(key, uploadID string) error {
+	resp, err := c.do("DELETE", key, url.Values{"uploadId": []string{uploadID}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// signV4 adds the AWS signature version 4 headers to the request.
+// Every header already set on the request is included in the signature, along with host
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, sessionToken, region, service string, t time.Time) {
+	amzDate := t.Format(s3TimeFormat)
+	req.Header.Set(s3HeaderDate, amzDate)
+	if sessionToken != "" {
+		req.Header.Set(s3HeaderToken, sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders bytes.Buffer
+	for _, n := range names {
+		canonicalHeaders.WriteString(n + ":" + headers[n] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash}, "\n")
+
+	scope := strings.Join([]string{t.Format(s3DateFormat), region, service, "aws4_request"}, "/")
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{s3Algorithm, amzDate, scope, hex.EncodeToString(crHash[:])}, "\n")
+
+	key := s3HMAC([]byte("AWS4"+secretKey), t.Format(s3DateFormat))
+	key = s3HMAC(key, region)
+	key = s3HMAC(key, service)
+	key = s3HMAC(key, "aws4_request")
+
+	signature := hex.EncodeToString(s3HMAC(key, stringToSign))
+
+	req.Header.Set("Authorization", s3Algorithm+" Credential="+accessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3CanonicalQuery sorts and encodes the query string the way signature v4 expects
+func s3CanonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string{}, values[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, s3Encode(k, true)+"="+s3Encode(v, true))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+func s3EncodePath(path string) string {
+	return s3Encode(path, false)
+}
+
+// s3Encode uri encodes everything but the unreserved characters. Slashes are left alone in paths
+func s3Encode(s string, encodeSlash bool) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -1,6 +1,10 @@
 package files
 
-import "github.com/sethjback/gobl/modification"
+import (
+	"time"
+
+	"github.com/sethjback/gobl/modification"
+)
 
 // Signature contains all the data used to make an unique signature for a file
 // this signature is used to determine wether the actual file needs to be sent
@@ -13,9 +17,13 @@ type Signature struct {
 
 // Meta is information about the file as it was store on the drive
 type Meta struct {
-	Mode uint32
-	UID  int
-	GID  int
+	Mode       uint32
+	UID        int
+	GID        int
+	ModTime    time.Time
+	AccessTime time.Time
+	// Xattrs holds the extended attributes, if they were requested
+	Xattrs map[string][]byte
 }
 
 type File struct {
@@ -26,8 +34,7 @@ type File struct {
 func NewSignature(path string, mods []modification.Definition) Signature {
 	s := Signature{Path: path}
 	for i := 0; i < len(mods); i++ {
-		s.Modifications = append(s.Modifications, mods[i].Name)
+		s.Modifications = append(s.Modifications, modification.Applied(mods[i]))
 	}
-
 	return s
 }
@@ -0,0 +1,78 @@
+package files
+
+import (
+	"os"
+
+	"github.com/sethjback/gobl/goblerr"
+)
+
+const (
+	ErrorReadMeta  = "ReadMetaFailed"
+	ErrorApplyMeta = "ApplyMetaFailed"
+
+	modeMask = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+)
+
+// MetaFromPath reads the mode, ownership and timestamps of the file at path.
+// Extended attributes are only read if xattrs is true
+func MetaFromPath(path string, xattrs bool) (Meta, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return Meta{}, goblerr.New("Unable to stat file", ErrorReadMeta, err)
+	}
+
+	m := Meta{
+		Mode:       uint32(info.Mode() & modeMask),
+		UID:        -1,
+		GID:        -1,
+		ModTime:    info.ModTime(),
+		AccessTime: info.ModTime()}
+
+	statMeta(info, &m)
+
+	if xattrs {
+		m.Xattrs, err = getXattrs(path)
+		if err != nil {
+			return Meta{}, goblerr.New("Unable to read extended attributes", ErrorReadMeta, err)
+		}
+	}
+
+	return m, nil
+}
+
+// Captured indicates if the meta data was recorded at backup time.
+// Files backed up before metadata was captured will have an empty Meta
+func (m Meta) Captured() bool {
+	return !m.ModTime.IsZero()
+}
+
+// Apply sets the recorded metadata on the file at path. Ownership is only changed if
+// ownership is true, since it generally requires running as root
+func (m Meta) Apply(path string, ownership bool) error {
+	if !m.Captured() {
+		return nil
+	}
+
+	if ownership && m.UID >= 0 && m.GID >= 0 {
+		if err := os.Lchown(path, m.UID, m.GID); err != nil {
+			return goblerr.New("Unable to set ownership", ErrorApplyMeta, err)
+		}
+	}
+
+	// chmod after chown: changing ownership clears the setuid/setgid bits
+	if err := os.Chmod(path, os.FileMode(m.Mode)&modeMask); err != nil {
+		return goblerr.New("Unable to set permissions", ErrorApplyMeta, err)
+	}
+
+	if len(m.Xattrs) != 0 {
+		if err := setXattrs(path, m.Xattrs); err != nil {
+			return goblerr.New("Unable to set extended attributes", ErrorApplyMeta, err)
+		}
+	}
+
+	if err := os.Chtimes(path, m.AccessTime, m.ModTime); err != nil {
+		return goblerr.New("Unable to set timestamps", ErrorApplyMeta, err)
+	}
+
+	return nil
+}
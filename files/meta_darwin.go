@@ -0,0 +1,27 @@
+//go:build darwin
+// +build darwin
+
+package files
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func statMeta(info os.FileInfo, m *Meta) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		m.UID = int(st.Uid)
+		m.GID = int(st.Gid)
+		m.AccessTime = time.Unix(int64(st.Atimespec.Sec), int64(st.Atimespec.Nsec))
+	}
+}
+
+// extended attributes are only supported on linux for now
+func getXattrs(path string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+func setXattrs(path string, attrs map[string][]byte) error {
+	return nil
+}
@@ -0,0 +1,70 @@
+//go:build linux
+// +build linux
+
+package files
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"time"
+)
+
+func statMeta(info os.FileInfo, m *Meta) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		m.UID = int(st.Uid)
+		m.GID = int(st.Gid)
+		m.AccessTime = time.Unix(int64(st.Atim.Sec), int64(st.Atim.Nsec))
+	}
+}
+
+func getXattrs(path string) (map[string][]byte, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil {
+		if err == syscall.ENOTSUP {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if size == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := make(map[string][]byte)
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+
+		vSize, err := syscall.Getxattr(path, string(name), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		value := make([]byte, vSize)
+		if vSize > 0 {
+			vSize, err = syscall.Getxattr(path, string(name), value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		attrs[string(name)] = value[:vSize]
+	}
+
+	return attrs, nil
+}
+
+func setXattrs(path string, attrs map[string][]byte) error {
+	for name, value := range attrs {
+		if err := syscall.Setxattr(path, name, value, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package files
+
+import "os"
+
+// ownership and access times are not available on this platform: the mod time is used for both timestamps
+func statMeta(info os.FileInfo, m *Meta) {}
+
+// extended attributes are only supported on linux for now
+func getXattrs(path string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+func setXattrs(path string, attrs map[string][]byte) error {
+	return nil
+}
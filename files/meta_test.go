@@ -0,0 +1,64 @@
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeta(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "gobl-meta")
+	if !assert.Nil(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	assert.Nil(ioutil.WriteFile(src, []byte("data"), 0640))
+	assert.Nil(os.Chmod(src, 0640))
+
+	mtime := time.Date(2016, time.March, 4, 12, 30, 0, 0, time.UTC)
+	atime := time.Date(2016, time.March, 5, 8, 0, 0, 0, time.UTC)
+	assert.Nil(os.Chtimes(src, atime, mtime))
+
+	m, err := MetaFromPath(src, true)
+	if !assert.Nil(err) {
+		return
+	}
+	assert.True(m.Captured())
+	assert.Equal(uint32(0640), m.Mode)
+	assert.True(mtime.Equal(m.ModTime))
+
+	_, err = MetaFromPath(filepath.Join(dir, "missing"), false)
+	assert.NotNil(err)
+
+	dst := filepath.Join(dir, "dst")
+	assert.Nil(ioutil.WriteFile(dst, []byte("data"), 0600))
+	assert.Nil(m.Apply(dst, os.Geteuid() == 0))
+
+	info, err := os.Stat(dst)
+	if assert.Nil(err) {
+		assert.Equal(os.FileMode(0640), info.Mode().Perm())
+		assert.True(mtime.Equal(info.ModTime()))
+	}
+
+	restored, err := MetaFromPath(dst, false)
+	if assert.Nil(err) {
+		assert.Equal(m.UID, restored.UID)
+		assert.Equal(m.GID, restored.GID)
+		assert.True(m.AccessTime.Equal(restored.AccessTime))
+	}
+
+	// files saved without metadata are left alone
+	assert.Nil(Meta{}.Apply(dst, true))
+	info, err = os.Stat(dst)
+	if assert.Nil(err) {
+		assert.Equal(os.FileMode(0640), info.Mode().Perm())
+	}
+}
@@ -0,0 +1,296 @@
+package gobldb
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/sethjback/gobl/gobldb/errors"
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/model"
+)
+
+// ArchiveVersion is the version of the export format. Archives with a newer version can't be imported
+const ArchiveVersion = 1
+
+// Record types in an archive. The header is always the first record
+const (
+	RecordHeader        = "header"
+	RecordAgent         = "agent"
+	RecordJobDefinition = "jobDefinition"
+	RecordSchedule      = "schedule"
+	RecordUser          = "user"
+	RecordJob           = "job"
+	RecordJobFile       = "jobFile"
+)
+
+// exportPageSize is how many jobs are read from the database at a time
+const exportPageSize = 100
+
+// Record is one line of an archive
+type Record struct {
+	Type string `json:"type"`
+	// JobID is the job a jobFile record belongs to
+	JobID string          `json:"job,omitempty"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// ArchiveHeader describes where and when the archive was made
+type ArchiveHeader struct {
+	Version       int       `json:"version"`
+	SchemaVersion int       `json:"schemaVersion"`
+	Created       time.Time `json:"created"`
+}
+
+// Export writes the whole catalog to w as JSON lines, one record per line, and returns the number of records written.
+// The records only depend on the model structs, so the archive can be imported into any driver
+func Export(db Database, w io.Writer) (int, error) {
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return 0, err
+	}
+
+	enc := json.NewEncoder(w)
+	count := 0
+	write := func(rtype, jobID string, v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return goblerr.New("Unable to export "+rtype, errors.ErrCodeMarshal, err)
+		}
+		if err = enc.Encode(Record{Type: rtype, JobID: jobID, Data: data}); err != nil {
+			return goblerr.New("Unable to export "+rtype, errors.ErrCodeSave, err)
+		}
+		count++
+		return nil
+	}
+
+	if err = write(RecordHeader, "", ArchiveHeader{Version: ArchiveVersion, SchemaVersion: version, Created: time.Now().UTC()}); err != nil {
+		return count, err
+	}
+
+	agents, err := db.AgentList()
+	if err != nil {
+		return count, err
+	}
+	for _, a := range agents {
+		if err = write(RecordAgent, "", a); err != nil {
+			return count, err
+		}
+	}
+
+	jds, err := db.JobDefinitionList()
+	if err != nil {
+		return count, err
+	}
+	for _, jd := range jds {
+		if err = write(RecordJobDefinition, "", jd); err != nil {
+			return count, err
+		}
+	}
+
+	schedules, err := db.ScheduleList()
+	if err != nil {
+		return count, err
+	}
+	for _, s := range schedules {
+		if err = write(RecordSchedule, "", s); err != nil {
+			return count, err
+		}
+	}
+
+	users, err := db.UserList()
+	if err != nil {
+		return count, err
+	}
+	for _, u := range users {
+		if err = write(RecordUser, "", u); err != nil {
+			return count, err
+		}
+	}
+
+	for offset := 0; ; offset += exportPageSize {
+		jobs, err := db.JobList(map[string]string{"limit": strconv.Itoa(exportPageSize), "offset": strconv.Itoa(offset)})
+		if err != nil {
+			return count, err
+		}
+
+		for _, j := range jobs {
+			if err = write(RecordJob, "", j); err != nil {
+				return count, err
+			}
+
+			jfs, err := db.JobFileList(j.ID, map[string]string{"parent": "*"})
+			if err != nil {
+				return count, err
+			}
+			for _, jf := range jfs {
+				if err = write(RecordJobFile, j.ID, jf); err != nil {
+					return count, err
+				}
+			}
+		}
+
+		if len(jobs) < exportPageSize {
+			break
+		}
+	}
+
+	return count, nil
+}
+
+// Import reads an archive written by Export into db and returns the number of records read.
+// The database must be empty so nothing in it is silently overwritten
+func Import(db Database, r io.Reader) (int, error) {
+	if err := checkEmpty(db); err != nil {
+		return 0, err
+	}
+
+	scanner := bufio.NewScanner(r)
+	// job definitions and files with many modifications make for long lines
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	count := 0
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return count, goblerr.New(fmt.Sprintf("Unable to read record %d", count+1), errors.ErrCodeArchive, err)
+		}
+
+		if count == 0 && rec.Type != RecordHeader {
+			return count, goblerr.New("Unable to import archive", errors.ErrCodeArchive, "archive does not start with a header")
+		}
+
+		if err := importRecord(db, rec); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return count, goblerr.New("Unable to read archive", errors.ErrCodeArchive, err)
+	}
+
+	if count == 0 {
+		return count, goblerr.New("Unable to import archive", errors.ErrCodeArchive, "archive is empty")
+	}
+
+	return count, nil
+}
+
+func importRecord(db Database, rec Record) error {
+	decode := func(v interface{}) error {
+		if err := json.Unmarshal(rec.Data, v); err != nil {
+			return goblerr.New("Unable to import "+rec.Type, errors.ErrCodeUnMarshal, err)
+		}
+		return nil
+	}
+
+	switch rec.Type {
+	case RecordHeader:
+		var h ArchiveHeader
+		if err := decode(&h); err != nil {
+			return err
+		}
+		if h.Version > ArchiveVersion {
+			return goblerr.New("Unable to import archive", errors.ErrCodeArchive,
+				fmt.Sprintf("archive version %d is newer than the supported version %d", h.Version, ArchiveVersion))
+		}
+		return nil
+
+	case RecordAgent:
+		var a model.Agent
+		if err := decode(&a); err != nil {
+			return err
+		}
+		return db.SaveAgent(a)
+
+	case RecordJobDefinition:
+		var jd model.JobDefinition
+		if err := decode(&jd); err != nil {
+			return err
+		}
+		return db.SaveJobDefinition(jd)
+
+	case RecordSchedule:
+		var s model.Schedule
+		if err := decode(&s); err != nil {
+			return err
+		}
+		return db.SaveSchedule(s)
+
+	case RecordUser:
+		var u model.User
+		if err := decode(&u); err != nil {
+			return err
+		}
+		// archives written before there were roles: those users could do everything
+		if u.Role == "" {
+			u.Role = model.RoleAdmin
+		}
+		return db.SaveUser(u)
+
+	case RecordJob:
+		var j model.Job
+		if err := decode(&j); err != nil {
+			return err
+		}
+		if j.Agent == nil || j.Meta == nil {
+			return goblerr.New("Unable to import job", errors.ErrCodeArchive, "job "+j.ID+" has no agent or meta")
+		}
+		return db.SaveJob(j)
+
+	case RecordJobFile:
+		var jf model.JobFile
+		if err := decode(&jf); err != nil {
+			return err
+		}
+		return db.SaveJobFile(rec.JobID, jf)
+	}
+
+	return goblerr.New("Unable to import archive", errors.ErrCodeArchive, "unknown record type: "+rec.Type)
+}
+
+func checkEmpty(db Database) error {
+	notEmpty := func(what string) error {
+		return goblerr.New("Unable to import archive", errors.ErrCodeNotEmpty, "the database already has "+what)
+	}
+
+	if agents, err := db.AgentList(); err != nil {
+		return err
+	} else if len(agents) > 0 {
+		return notEmpty("agents")
+	}
+
+	if jds, err := db.JobDefinitionList(); err != nil {
+		return err
+	} else if len(jds) > 0 {
+		return notEmpty("job definitions")
+	}
+
+	if schedules, err := db.ScheduleList(); err != nil {
+		return err
+	} else if len(schedules) > 0 {
+		return notEmpty("schedules")
+	}
+
+	if users, err := db.UserList(); err != nil {
+		return err
+	} else if len(users) > 0 {
+		return notEmpty("users")
+	}
+
+	if jobs, err := db.JobList(map[string]string{"limit": "1"}); err != nil {
+		return err
+	} else if len(jobs) > 0 {
+		return notEmpty("jobs")
+	}
+
+	return nil
+}
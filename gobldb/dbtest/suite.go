@@ -0,0 +1,746 @@
+// Package dbtest holds the conformance suite every gobldb.Database driver is expected to pass.
+//
+// A driver proves it behaves the same as the others by running the suite from its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		dbtest.Run(t, func() (gobldb.Database, error) { return New(config.DB{}) })
+//	}
+package dbtest
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sethjback/gobl/engine"
+	"github.com/sethjback/gobl/files"
+	"github.com/sethjback/gobl/gobldb"
+	"github.com/sethjback/gobl/gobldb/errors"
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/model"
+	"github.com/sethjback/gobl/modification"
+	"github.com/stretchr/testify/assert"
+)
+
+// Factory returns a new, empty database. It is called once for every test in the suite
+type Factory func() (gobldb.Database, error)
+
+// Run runs the whole suite against the databases returned by newDB
+func Run(t *testing.T, newDB Factory) {
+	tests := []struct {
+		name string
+		test func(*testing.T, gobldb.Database)
+	}{
+		{"Agents", testAgents},
+		{"JobDefinitions", testJobDefinitions},
+		{"Schedules", testSchedules},
+		{"Users", testUsers},
+		{"Jobs", testJobs},
+		{"JobList", testJobList},
+		{"JobListPagination", testJobListPagination},
+		{"JobFileList", testJobFileList},
+		{"JobDirectories", testJobDirectories},
+		{"DeleteJob", testDeleteJob},
+		{"NotFound", testNotFound},
+		{"SchemaVersion", testSchemaVersion},
+		{"Archive", func(t *testing.T, db gobldb.Database) { testArchive(t, db, newDB) }},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := newDB()
+			if err != nil {
+				t.Fatalf("unable to open database: %v", err)
+			}
+			defer db.Close()
+
+			tc.test(t, db)
+		})
+	}
+}
+
+// errorCode returns the gobl error code, or an empty string if err isn't a gobl error
+func errorCode(err error) string {
+	if gerr, ok := err.(*goblerr.Error); ok {
+		return gerr.Code
+	}
+	return ""
+}
+
+// timestamp returns a time that survives a round trip through any driver
+func timestamp(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+func testAgents(t *testing.T, db gobldb.Database) {
+	assert := assert.New(t)
+
+	a := model.Agent{ID: "agent-1", Name: "Agent 1", Address: "127.0.0.1:8080", PublicKey: "key1", Groups: []string{"web"}}
+	a2 := model.Agent{ID: "agent-2", Name: "Agent 2", Address: "127.0.0.2:8080", PublicKey: "key2"}
+	assert.Nil(db.SaveAgent(a))
+	assert.Nil(db.SaveAgent(a2))
+
+	a1, err := db.GetAgent(a.ID)
+	if assert.Nil(err) {
+		assert.Equal(a, *a1)
+	}
+
+	a.Name = "Renamed"
+	a.Groups = []string{"web", "db"}
+	assert.Nil(db.SaveAgent(a))
+	a1, err = db.GetAgent(a.ID)
+	if assert.Nil(err) {
+		assert.Equal(a, *a1)
+	}
+
+	list, err := db.AgentList()
+	assert.Nil(err)
+	assert.ElementsMatch([]model.Agent{a, a2}, list)
+
+	assert.Nil(db.DeleteAgent(a2.ID))
+	_, err = db.GetAgent(a2.ID)
+	assert.Equal(errors.ErrCodeNotFound, errorCode(err))
+
+	list, err = db.AgentList()
+	assert.Nil(err)
+	assert.Equal([]model.Agent{a}, list)
+}
+
+func testJobDefinitions(t *testing.T, db gobldb.Database) {
+	assert := assert.New(t)
+
+	jd := model.JobDefinition{
+		ID:            "jd-1",
+		Type:          model.TypeBackup,
+		To:            []engine.Definition{engine.Definition{Name: "test", Options: map[string]interface{}{"test": float64(1)}}},
+		Modifications: []modification.Definition{modification.Definition{Name: "test", Options: map[string]interface{}{"test": float64(1)}}},
+		Paths:         []model.Path{model.Path{Root: "/dir1/dir2", Excludes: []string{"*.jpg"}}},
+	}
+	jd2 := model.JobDefinition{ID: "jd-2", Type: model.TypeBackup, Paths: []model.Path{model.Path{Root: "/home"}}}
+	assert.Nil(db.SaveJobDefinition(jd))
+	assert.Nil(db.SaveJobDefinition(jd2))
+
+	jd1, err := db.GetJobDefinition(jd.ID)
+	if assert.Nil(err) {
+		assert.Equal(jd, *jd1)
+	}
+
+	list, err := db.JobDefinitionList()
+	assert.Nil(err)
+	assert.ElementsMatch([]model.JobDefinition{jd, jd2}, list)
+
+	assert.Nil(db.DeleteJobDefinition(jd.ID))
+	_, err = db.GetJobDefinition(jd.ID)
+	assert.Equal(errors.ErrCodeNotFound, errorCode(err))
+
+	list, err = db.JobDefinitionList()
+	assert.Nil(err)
+	assert.Equal([]model.JobDefinition{jd2}, list)
+}
+
+func testSchedules(t *testing.T, db gobldb.Database) {
+	assert := assert.New(t)
+
+	s := model.Schedule{ID: "s-1", AgentID: "agent-1", JobDefinitionID: "jd-1", Seconds: "0", Minutes: "30", Hour: "2", DOM: "*", MON: "*", DOW: "1-5"}
+	s2 := model.Schedule{ID: "s-2", AgentID: "agent-2", JobDefinitionID: "jd-1", Seconds: "0", Minutes: "0", Hour: "*", DOM: "*", MON: "*", DOW: "*"}
+	assert.Nil(db.SaveSchedule(s))
+	assert.Nil(db.SaveSchedule(s2))
+
+	s.Hour = "3"
+	assert.Nil(db.SaveSchedule(s))
+	s1, err := db.GetSchedule(s.ID)
+	if assert.Nil(err) {
+		assert.Equal(s, *s1)
+	}
+
+	list, err := db.ScheduleList()
+	assert.Nil(err)
+	assert.ElementsMatch([]model.Schedule{s, s2}, list)
+
+	assert.Nil(db.DeleteSchedule(s.ID))
+	_, err = db.GetSchedule(s.ID)
+	assert.Equal(errors.ErrCodeNotFound, errorCode(err))
+
+	list, err = db.ScheduleList()
+	assert.Nil(err)
+	assert.Equal([]model.Schedule{s2}, list)
+}
+
+func testUsers(t *testing.T, db gobldb.Database) {
+	assert := assert.New(t)
+
+	u := model.User{Email: "admin@example.com", Password: "hash", Role: model.RoleAdmin}
+	u2 := model.User{Email: "help@example.com", Password: "hash", Role: model.RoleRestore, Groups: []string{"web", "db"}}
+	assert.Nil(db.SaveUser(u))
+	assert.Nil(db.SaveUser(u2))
+
+	u.Password = "new hash"
+	assert.Nil(db.SaveUser(u))
+	u1, err := db.GetUser(u.Email)
+	if assert.Nil(err) {
+		assert.Equal(u, *u1)
+	}
+
+	list, err := db.UserList()
+	assert.Nil(err)
+	assert.ElementsMatch([]model.User{u, u2}, list)
+
+	assert.Nil(db.DeleteUser(u2.Email))
+	_, err = db.GetUser(u2.Email)
+	assert.Equal(errors.ErrCodeNotFound, errorCode(err))
+
+	list, err = db.UserList()
+	assert.Nil(err)
+	assert.Equal([]model.User{u}, list)
+}
+
+func testJobs(t *testing.T, db gobldb.Database) {
+	assert := assert.New(t)
+
+	a := model.Agent{ID: "agent-1", Name: "Agent 1"}
+	assert.Nil(db.SaveAgent(a))
+
+	now := timestamp(time.Now())
+	j := model.Job{
+		ID:         "job-1",
+		Agent:      &a,
+		Definition: &model.JobDefinition{ID: "jd-1", Type: model.TypeBackup, Paths: []model.Path{model.Path{Root: "/home"}}},
+		Meta:       &model.JobMeta{State: model.StateRunning, Start: now, Total: 3},
+	}
+	assert.Nil(db.SaveJob(j))
+
+	j1, err := db.GetJob(j.ID)
+	if assert.Nil(err) {
+		assert.Equal(j, *j1)
+	}
+
+	// the file batches received are kept with the job
+	j.Meta.Batches = 5
+	j.Meta.Received = model.Sequences{{1, 3}, {5, 5}}
+	assert.Nil(db.SaveJob(j))
+
+	j1, err = db.GetJob(j.ID)
+	if assert.Nil(err) {
+		assert.Equal(j, *j1)
+	}
+
+	j.Meta.State = model.StateFinished
+	j.Meta.End = now.Add(time.Minute)
+	j.Meta.Message = "done"
+	assert.Nil(db.SaveJob(j))
+
+	j1, err = db.GetJob(j.ID)
+	if assert.Nil(err) {
+		assert.Equal(j, *j1)
+	}
+
+	// the file counts are derived from the saved files
+	assert.Nil(db.SaveJobFile(j.ID, jobFile("/home/a", model.StateFinished)))
+	assert.Nil(db.SaveJobFile(j.ID, jobFile("/home/b", model.StateFinished)))
+	assert.Nil(db.SaveJobFile(j.ID, jobFile("/home/c", model.StateFailed)))
+	j1, err = db.GetJob(j.ID)
+	if assert.Nil(err) {
+		assert.Equal(2, j1.Meta.Complete)
+		assert.Equal(1, j1.Meta.Errors)
+	}
+
+	// a job outlives its agent, keeping just the agent id
+	assert.Nil(db.DeleteAgent(a.ID))
+	j1, err = db.GetJob(j.ID)
+	if assert.Nil(err) {
+		assert.Equal(&model.Agent{ID: a.ID}, j1.Agent)
+	}
+
+	list, err := db.JobList(map[string]string{"agent": a.ID})
+	if assert.Nil(err) && assert.Len(list, 1) {
+		assert.Equal(&model.Agent{ID: a.ID}, list[0].Agent)
+	}
+}
+
+// saveJobs saves the fixtures used by the job list tests:
+//
+//	job-1 agent-1 finished Jan 1  - Jan 2
+//	job-2 agent-2 finished Jan 3  - Jan 4
+//	job-3 agent-2 failed   Jan 5  - Jan 6
+//	job-4 agent-1 finished Feb 1  - Feb 2
+//	job-5 agent-1 running  now
+//	job-6 agent-2 running  now + 1s
+func saveJobs(t *testing.T, db gobldb.Database) (model.Agent, model.Agent) {
+	assert := assert.New(t)
+
+	a := model.Agent{ID: "agent-1", Name: "Agent 1"}
+	a2 := model.Agent{ID: "agent-2", Name: "Agent 2"}
+	assert.Nil(db.SaveAgent(a))
+	assert.Nil(db.SaveAgent(a2))
+
+	jan := time.Date(2017, time.January, 1, 12, 12, 12, 0, time.UTC)
+	feb := time.Date(2017, time.February, 1, 12, 12, 12, 0, time.UTC)
+	now := timestamp(time.Now())
+
+	for i, f := range []struct {
+		agent      *model.Agent
+		state      string
+		start, end time.Time
+	}{
+		{&a, model.StateFinished, jan, jan.AddDate(0, 0, 1)},
+		{&a2, model.StateFinished, jan.AddDate(0, 0, 2), jan.AddDate(0, 0, 3)},
+		{&a2, model.StateFailed, jan.AddDate(0, 0, 4), jan.AddDate(0, 0, 5)},
+		{&a, model.StateFinished, feb, feb.AddDate(0, 0, 1)},
+		{&a, model.StateRunning, now, time.Time{}},
+		{&a2, model.StateRunning, now.Add(time.Second), time.Time{}},
+	} {
+		assert.Nil(db.SaveJob(model.Job{
+			ID:         "job-" + strconv.Itoa(i+1),
+			Agent:      f.agent,
+			Definition: &model.JobDefinition{ID: "jd-1", Type: model.TypeBackup},
+			Meta:       &model.JobMeta{State: f.state, Start: f.start, End: f.end},
+		}))
+	}
+
+	return a, a2
+}
+
+func jobIDs(jobs []model.Job) []string {
+	ids := []string{}
+	for _, j := range jobs {
+		ids = append(ids, j.ID)
+	}
+	return ids
+}
+
+func testJobList(t *testing.T, db gobldb.Database) {
+	assert := assert.New(t)
+
+	a, a2 := saveJobs(t, db)
+
+	for _, c := range []struct {
+		filters map[string]string
+		ids     []string
+	}{
+		{map[string]string{}, []string{"job-1", "job-2", "job-3", "job-4", "job-5", "job-6"}},
+		{map[string]string{"state": model.StateFinished}, []string{"job-1", "job-2", "job-4"}},
+		{map[string]string{"state": model.StateRunning}, []string{"job-5", "job-6"}},
+		{map[string]string{"state": model.StateCanceled}, []string{}},
+		{map[string]string{"agent": a.ID}, []string{"job-1", "job-4", "job-5"}},
+		{map[string]string{"agent": "missing"}, []string{}},
+		{map[string]string{"agent": a2.ID, "state": model.StateFinished}, []string{"job-2"}},
+		{map[string]string{"agent": a.ID, "state": model.StateFailed}, []string{}},
+		{map[string]string{"start": "2017-01-04 00:00"}, []string{"job-3", "job-4", "job-5", "job-6"}},
+		{map[string]string{"start": "2017-01-02 00:00", "end": "2017-01-31 00:00"}, []string{"job-2", "job-3"}},
+		{map[string]string{"start": "2017-01-02 00:00", "end": "2017-01-31 00:00", "agent": a2.ID, "state": model.StateFailed}, []string{"job-3"}},
+		{map[string]string{"end": "2017-01-05 00:00"}, []string{"job-1", "job-2"}},
+		{map[string]string{"end": "2017-01-05 00:00", "agent": a.ID}, []string{"job-1"}},
+		{map[string]string{"start": strconv.FormatInt(time.Date(2017, time.January, 31, 0, 0, 0, 0, time.UTC).Unix(), 10)}, []string{"job-4", "job-5", "job-6"}},
+	} {
+		jobs, err := db.JobList(c.filters)
+		if assert.Nil(err, "%v", c.filters) {
+			assert.Equal(c.ids, jobIDs(jobs), "%v", c.filters)
+		}
+	}
+
+	// a job that changes dates is only listed under its new dates
+	j, err := db.GetJob("job-1")
+	if assert.Nil(err) {
+		j.Meta.Start = time.Date(2017, time.March, 1, 12, 12, 12, 0, time.UTC)
+		j.Meta.End = j.Meta.Start.Add(time.Hour)
+		assert.Nil(db.SaveJob(*j))
+
+		jobs, err := db.JobList(map[string]string{"end": "2017-01-05 00:00"})
+		if assert.Nil(err) {
+			assert.Equal([]string{"job-2"}, jobIDs(jobs))
+		}
+
+		jobs, err = db.JobList(map[string]string{"agent": a.ID})
+		if assert.Nil(err) {
+			assert.Equal([]string{"job-4", "job-1", "job-5"}, jobIDs(jobs))
+		}
+	}
+
+	for _, filters := range []map[string]string{
+		{"unknown": "1"},
+		{"start": "yesterday"},
+		{"end": "2017-13-01"},
+		{"limit": "ten"},
+		{"offset": "two"},
+	} {
+		_, err := db.JobList(filters)
+		assert.Equal(errors.ErrFilterOptions, errorCode(err), "%v", filters)
+	}
+}
+
+func testJobListPagination(t *testing.T, db gobldb.Database) {
+	assert := assert.New(t)
+
+	a := model.Agent{ID: "agent-1", Name: "Agent 1"}
+	assert.Nil(db.SaveAgent(a))
+
+	start := time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+	var all []string
+	for i := 0; i < 15; i++ {
+		id := "job-" + strconv.Itoa(100+i)
+		all = append(all, id)
+		assert.Nil(db.SaveJob(model.Job{
+			ID:         id,
+			Agent:      &a,
+			Definition: &model.JobDefinition{ID: "jd-1"},
+			Meta:       &model.JobMeta{State: model.StateFinished, Start: start.Add(time.Duration(i) * time.Hour), End: start.Add(time.Duration(i)*time.Hour + time.Minute)},
+		}))
+	}
+
+	for _, c := range []struct {
+		limit, offset string
+		ids           []string
+	}{
+		// ten jobs are returned when there isn't a limit
+		{"", "", all[:10]},
+		{"", "10", all[10:]},
+		{"5", "", all[:5]},
+		{"5", "5", all[5:10]},
+		{"5", "12", all[12:]},
+		{"20", "", all},
+		{"5", "15", []string{}},
+		{"5", "30", []string{}},
+	} {
+		filters := map[string]string{}
+		if c.limit != "" {
+			filters["limit"] = c.limit
+		}
+		if c.offset != "" {
+			filters["offset"] = c.offset
+		}
+
+		jobs, err := db.JobList(filters)
+		if assert.Nil(err, "%v", filters) {
+			assert.NotNil(jobs, "%v", filters)
+			assert.Equal(c.ids, jobIDs(jobs), "%v", filters)
+		}
+	}
+
+	// pagination applies after the other filters
+	jobs, err := db.JobList(map[string]string{"start": "2017-01-01 05:00", "limit": "3", "offset": "2"})
+	if assert.Nil(err) {
+		assert.Equal(all[7:10], jobIDs(jobs))
+	}
+}
+
+func jobFile(path, state string) model.JobFile {
+	return model.JobFile{
+		State: state,
+		File: files.File{
+			Meta:      files.Meta{Mode: 0644, UID: 1, GID: 1},
+			Signature: files.Signature{Path: path, Hash: "hash-" + path, Modifications: []string{"compress"}},
+		},
+	}
+}
+
+func filePaths(jfs []model.JobFile) []string {
+	paths := []string{}
+	for _, f := range jfs {
+		paths = append(paths, f.File.Path)
+	}
+	return paths
+}
+
+func testJobFileList(t *testing.T, db gobldb.Database) {
+	assert := assert.New(t)
+
+	f := jobFile("/dir1/dir2/file1.jpg", model.StateFinished)
+	assert.Nil(db.SaveJobFile("job-1", f))
+
+	jfs, err := db.JobFileList("job-1", map[string]string{"parent": "*"})
+	if assert.Nil(err) {
+		assert.Equal([]model.JobFile{f}, jfs)
+	}
+
+	// saving the same path again replaces the record
+	f.State = model.StateFailed
+	f.Error = "unable to read file"
+	assert.Nil(db.SaveJobFile("job-1", f))
+	jfs, err = db.JobFileList("job-1", map[string]string{"parent": "*"})
+	if assert.Nil(err) {
+		assert.Equal([]model.JobFile{f}, jfs)
+	}
+
+	for _, p := range []struct{ path, state string }{
+		{"/dir1/dir2/file2.jpg", model.StateFinished},
+		{"/dir1/dir2.2/file1.jpg", model.StateFinished},
+		{"/dir1/dir2.2/file2.jpg", model.StateFailed},
+		{"/dir1/file3.jpg", model.StateFinished},
+		{"/root.txt", model.StateFinished},
+	} {
+		assert.Nil(db.SaveJobFile("job-1", jobFile(p.path, p.state)))
+	}
+
+	// files of other jobs are never listed
+	assert.Nil(db.SaveJobFile("job-2", jobFile("/dir1/dir2/file3.jpg", model.StateFailed)))
+
+	all := []string{"/dir1/dir2.2/file1.jpg", "/dir1/dir2.2/file2.jpg", "/dir1/dir2/file1.jpg", "/dir1/dir2/file2.jpg", "/dir1/file3.jpg", "/root.txt"}
+
+	for _, c := range []struct {
+		filters map[string]string
+		paths   []string
+	}{
+		{map[string]string{}, all},
+		{map[string]string{"parent": "*"}, all},
+		{map[string]string{"parent": "/"}, []string{"/root.txt"}},
+		{map[string]string{"parent": "/dir1"}, []string{"/dir1/file3.jpg"}},
+		{map[string]string{"dir": "/dir1/dir2"}, []string{"/dir1/dir2/file1.jpg", "/dir1/dir2/file2.jpg"}},
+		{map[string]string{"parent": "/dir1/dir2/file1.jpg"}, []string{}},
+		{map[string]string{"parent": "/missing"}, []string{}},
+		{map[string]string{"state": model.StateFailed}, []string{"/dir1/dir2.2/file2.jpg", "/dir1/dir2/file1.jpg"}},
+		{map[string]string{"state": model.StateFailed, "parent": "*"}, []string{"/dir1/dir2.2/file2.jpg", "/dir1/dir2/file1.jpg"}},
+		{map[string]string{"state": model.StateFailed, "parent": "/dir1/dir2.2"}, []string{"/dir1/dir2.2/file2.jpg"}},
+		{map[string]string{"state": model.StateFailed, "parent": "/dir1"}, []string{}},
+		{map[string]string{"State": model.StateFinished, "Parent": "/dir1/dir2"}, []string{"/dir1/dir2/file2.jpg"}},
+	} {
+		jfs, err := db.JobFileList("job-1", c.filters)
+		if assert.Nil(err, "%v", c.filters) {
+			assert.NotNil(jfs, "%v", c.filters)
+			assert.ElementsMatch(c.paths, filePaths(jfs), "%v", c.filters)
+		}
+	}
+
+	jfs, err = db.JobFileList("missing", map[string]string{"parent": "*"})
+	if assert.Nil(err) {
+		assert.Empty(jfs)
+	}
+
+	_, err = db.JobFileList("job-1", map[string]string{"size": "10"})
+	assert.Equal(errors.ErrFilterOptions, errorCode(err))
+}
+
+func testJobDirectories(t *testing.T, db gobldb.Database) {
+	assert := assert.New(t)
+
+	for _, p := range []string{
+		"/dir1/dir2/dir3/file1.jpg",
+		"/dir1/dir2/dir3/file2.jpg",
+		"/dir1/dir2/dir3.2/file1.jpg",
+		"/dir1/dir2/file1.jpg",
+		"/dir1.2/dir2.3/dir3.1/file2.jpg",
+		"/dir1.2/dir2.3/dir3.2/file2.jpg",
+		"/dir1.2/dir2.2/file2.jpg",
+		"/root.txt",
+	} {
+		assert.Nil(db.SaveJobFile("job-1", jobFile(p, model.StateFinished)))
+	}
+	assert.Nil(db.SaveJobFile("job-2", jobFile("/other/file.txt", model.StateFinished)))
+
+	for _, c := range []struct {
+		parent string
+		dirs   []string
+	}{
+		{"/", []string{"dir1", "dir1.2"}},
+		{"/dir1", []string{"dir2"}},
+		{"/dir1/dir2", []string{"dir3", "dir3.2"}},
+		{"/dir1.2", []string{"dir2.3", "dir2.2"}},
+		{"/dir1.2/dir2.3", []string{"dir3.1", "dir3.2"}},
+	} {
+		dirs, err := db.JobDirectories("job-1", c.parent)
+		if assert.Nil(err, c.parent) {
+			assert.ElementsMatch(c.dirs, dirs, c.parent)
+		}
+	}
+
+	// directories that only hold files, or that don't exist, have no sub directories
+	for _, parent := range []string{"/dir1/dir2/dir3", "/dir1.2/dir2.2", "/missing", "/other"} {
+		_, err := db.JobDirectories("job-1", parent)
+		assert.Equal(errors.ErrCodeNotFound, errorCode(err), parent)
+	}
+
+	_, err := db.JobDirectories("missing", "/")
+	assert.Equal(errors.ErrCodeNotFound, errorCode(err))
+}
+
+func testDeleteJob(t *testing.T, db gobldb.Database) {
+	assert := assert.New(t)
+
+	saveJobs(t, db)
+	for _, id := range []string{"job-1", "job-2"} {
+		assert.Nil(db.SaveJobFile(id, jobFile("/dir1/dir2/file1", model.StateFinished)))
+		assert.Nil(db.SaveJobFile(id, jobFile("/dir1/file2", model.StateFailed)))
+	}
+
+	assert.Nil(db.DeleteJob("job-1"))
+	assert.Equal(errors.ErrCodeNotFound, errorCode(db.DeleteJob("job-1")))
+
+	_, err := db.GetJob("job-1")
+	assert.Equal(errors.ErrCodeNotFound, errorCode(err))
+
+	jfs, err := db.JobFileList("job-1", map[string]string{"parent": "*"})
+	if assert.Nil(err) {
+		assert.Empty(jfs)
+	}
+
+	_, err = db.JobDirectories("job-1", "/")
+	assert.Equal(errors.ErrCodeNotFound, errorCode(err))
+
+	for _, filters := range []map[string]string{
+		{},
+		{"agent": "agent-1"},
+		{"state": model.StateFinished},
+		{"start": "2017-01-01 00:00"},
+		{"end": "2017-01-03 00:00"},
+	} {
+		jobs, err := db.JobList(filters)
+		if assert.Nil(err, "%v", filters) {
+			assert.NotContains(jobIDs(jobs), "job-1", "%v", filters)
+		}
+	}
+
+	// the other jobs are untouched
+	j, err := db.GetJob("job-2")
+	if assert.Nil(err) {
+		assert.Equal(1, j.Meta.Complete)
+		assert.Equal(1, j.Meta.Errors)
+	}
+
+	dirs, err := db.JobDirectories("job-2", "/")
+	if assert.Nil(err) {
+		assert.Equal([]string{"dir1"}, dirs)
+	}
+}
+
+func testNotFound(t *testing.T, db gobldb.Database) {
+	assert := assert.New(t)
+
+	_, err := db.GetAgent("missing")
+	assert.Equal(errors.ErrCodeNotFound, errorCode(err), "GetAgent")
+
+	_, err = db.GetJobDefinition("missing")
+	assert.Equal(errors.ErrCodeNotFound, errorCode(err), "GetJobDefinition")
+
+	_, err = db.GetJob("missing")
+	assert.Equal(errors.ErrCodeNotFound, errorCode(err), "GetJob")
+
+	_, err = db.GetSchedule("missing")
+	assert.Equal(errors.ErrCodeNotFound, errorCode(err), "GetSchedule")
+
+	_, err = db.GetUser("missing")
+	assert.Equal(errors.ErrCodeNotFound, errorCode(err), "GetUser")
+
+	assert.Equal(errors.ErrCodeNotFound, errorCode(db.DeleteJob("missing")), "DeleteJob")
+
+	// the lists of an empty database are empty, not errors
+	agents, err := db.AgentList()
+	assert.Nil(err)
+	assert.Empty(agents)
+
+	jds, err := db.JobDefinitionList()
+	assert.Nil(err)
+	assert.Empty(jds)
+
+	schedules, err := db.ScheduleList()
+	assert.Nil(err)
+	assert.Empty(schedules)
+
+	users, err := db.UserList()
+	assert.Nil(err)
+	assert.Empty(users)
+
+	jobs, err := db.JobList(map[string]string{})
+	if assert.Nil(err) {
+		assert.NotNil(jobs)
+		assert.Empty(jobs)
+	}
+}
+
+func testSchemaVersion(t *testing.T, db gobldb.Database) {
+	assert := assert.New(t)
+
+	// a new database is created at the current version
+	v, err := db.SchemaVersion()
+	assert.Nil(err)
+	assert.True(v > 0, "schema version %d", v)
+}
+
+func testArchive(t *testing.T, db gobldb.Database, newDB Factory) {
+	assert := assert.New(t)
+
+	saveJobs(t, db)
+	assert.Nil(db.SaveJobDefinition(model.JobDefinition{ID: "jd-1", Type: model.TypeBackup, Paths: []model.Path{model.Path{Root: "/home"}}}))
+	assert.Nil(db.SaveSchedule(model.Schedule{ID: "s-1", AgentID: "agent-1", JobDefinitionID: "jd-1", Seconds: "0", Minutes: "0", Hour: "1", DOM: "*", MON: "*", DOW: "*"}))
+	assert.Nil(db.SaveUser(model.User{Email: "admin", Password: "hash", Role: model.RoleAdmin}))
+	for _, p := range []string{"/home/a/file1", "/home/a/file2", "/home/b/file3", "/root.txt"} {
+		assert.Nil(db.SaveJobFile("job-1", jobFile(p, model.StateFinished)))
+	}
+	assert.Nil(db.SaveJobFile("job-4", jobFile("/home/a/file1", model.StateFailed)))
+
+	var buf bytes.Buffer
+	count, err := gobldb.Export(db, &buf)
+	if !assert.Nil(err) {
+		return
+	}
+	// header, 2 agents, 1 job definition, 1 schedule, 1 user, 6 jobs and 5 files
+	assert.Equal(17, count)
+	assert.Equal(count, strings.Count(buf.String(), "\n"))
+
+	dst, err := newDB()
+	if !assert.Nil(err) {
+		return
+	}
+	defer dst.Close()
+
+	archive := buf.String()
+	count, err = gobldb.Import(dst, strings.NewReader(archive))
+	assert.Nil(err)
+	assert.Equal(17, count)
+
+	agents, _ := db.AgentList()
+	imported, err := dst.AgentList()
+	assert.Nil(err)
+	assert.ElementsMatch(agents, imported)
+
+	jds, _ := db.JobDefinitionList()
+	importedJds, err := dst.JobDefinitionList()
+	assert.Nil(err)
+	assert.ElementsMatch(jds, importedJds)
+
+	schedules, _ := db.ScheduleList()
+	importedSchedules, err := dst.ScheduleList()
+	assert.Nil(err)
+	assert.ElementsMatch(schedules, importedSchedules)
+
+	users, _ := db.UserList()
+	importedUsers, err := dst.UserList()
+	assert.Nil(err)
+	assert.ElementsMatch(users, importedUsers)
+
+	jobs, _ := db.JobList(map[string]string{"limit": "100"})
+	importedJobs, err := dst.JobList(map[string]string{"limit": "100"})
+	assert.Nil(err)
+	assert.Equal(jobs, importedJobs)
+
+	for _, j := range jobs {
+		jfs, _ := db.JobFileList(j.ID, map[string]string{"parent": "*"})
+		importedJfs, err := dst.JobFileList(j.ID, map[string]string{"parent": "*"})
+		assert.Nil(err)
+		assert.ElementsMatch(jfs, importedJfs, j.ID)
+	}
+
+	dirs, err := dst.JobDirectories("job-1", "/home")
+	assert.Nil(err)
+	assert.ElementsMatch([]string{"a", "b"}, dirs)
+
+	// nothing is overwritten
+	_, err = gobldb.Import(dst, strings.NewReader(archive))
+	assert.Equal(errors.ErrCodeNotEmpty, errorCode(err))
+
+	for name, bad := range map[string]string{
+		"empty":     "",
+		"no header": archive[strings.Index(archive, "\n")+1:],
+		"newer":     `{"type":"header","data":{"version":1000}}`,
+		"unknown":   `{"type":"header","data":{"version":1}}` + "\n" + `{"type":"widget","data":{}}`,
+		"garbage":   `{"type":"header","data":{"version":1}}` + "\n" + `not json`,
+	} {
+		empty, err := newDB()
+		if !assert.Nil(err) {
+			return
+		}
+		_, err = gobldb.Import(empty, strings.NewReader(bad))
+		assert.Equal(errors.ErrCodeArchive, errorCode(err), name)
+		empty.Close()
+	}
+}
@@ -8,6 +8,10 @@ const (
 	ErrCodeDelete    = "DeleteDataFailed"
 	ErrCodeNotFound  = "EntityNotFound"
 	ErrFilterOptions = "InvalidFilterOptions"
+	ErrCodeSchema    = "UnsupportedSchemaVersion"
+	ErrCodeMigrate   = "MigrateDataFailed"
+	ErrCodeArchive   = "InvalidArchive"
+	ErrCodeNotEmpty  = "DatabaseNotEmpty"
 
 	ErrDBDriver = "InvalidDBDriver"
 )
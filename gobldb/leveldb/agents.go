@@ -41,6 +41,14 @@ func (l *Leveldb) GetAgent(id string) (*model.Agent, error) {
 	return &a, nil
 }
 
+func (l *Leveldb) DeleteAgent(id string) error {
+	err := l.Connection.Delete([]byte(keyTypeAgent+id), nil)
+	if err != nil {
+		return goblerr.New("Unable to delete agent", errors.ErrCodeDelete, err)
+	}
+	return nil
+}
+
 func (l *Leveldb) AgentList() ([]model.Agent, error) {
 	var alist []model.Agent
 	iter := l.Connection.NewIterator(util.BytesPrefix([]byte(keyTypeAgent)), nil)
@@ -78,4 +78,15 @@ func TestAgents(t *testing.T) {
 	assert.Contains(alist, a2)
 	assert.Contains(alist, a3)
 	assert.Contains(alist, a4)
+
+	err = s.DeleteAgent(a2.ID)
+	assert.Nil(err)
+
+	_, err = s.GetAgent(a2.ID)
+	assert.NotNil(err)
+
+	alist, err = s.AgentList()
+	assert.Nil(err)
+	assert.Len(alist, 3)
+	assert.NotContains(alist, a2)
 }
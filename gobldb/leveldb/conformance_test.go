@@ -0,0 +1,18 @@
+package leveldb
+
+import (
+	"testing"
+
+	"github.com/sethjback/gobl/config"
+	"github.com/sethjback/gobl/gobldb"
+	"github.com/sethjback/gobl/gobldb/dbtest"
+	"github.com/sethjback/gobl/util/log"
+)
+
+func TestConformance(t *testing.T) {
+	log.Init(config.Log{Level: log.Level.Error})
+
+	dbtest.Run(t, func() (gobldb.Database, error) {
+		return testDB()
+	})
+}
@@ -2,6 +2,7 @@ package leveldb
 
 import (
 	"encoding/json"
+	"path"
 	"strings"
 
 	"github.com/sethjback/gobl/gobldb/errors"
@@ -79,16 +80,16 @@ func (l *Leveldb) getFile(jobID, filePath string) (*model.JobFile, error) {
 func (l *Leveldb) jobFileCount(jobID string, filters map[string]string) (int, error) {
 	count := 0
 	dir := ""
+	parent := ""
 	state := ""
 	for k, v := range filters {
 		k = strings.ToLower(k)
 		switch k {
 		case "dir", "parent":
-			if v == "*" {
-				dir = jobID
-			} else {
-				dir = jobID + v + "/"
+			if v != "*" {
+				parent = v
 			}
+			dir = parentPrefix(jobID, v)
 		case "state":
 			state = v
 		default:
@@ -104,6 +105,9 @@ func (l *Leveldb) jobFileCount(jobID string, filters map[string]string) (int, er
 
 		if state != "" {
 			for _, iv := range vals {
+				if parent != "" && path.Dir(iv.value) != parent {
+					continue
+				}
 				f, err := l.getFile(jobID, iv.value)
 				if err == nil {
 					if state != "" && f.State != state {
@@ -115,7 +119,11 @@ func (l *Leveldb) jobFileCount(jobID string, filters map[string]string) (int, er
 				}
 			}
 		} else {
-			count = len(vals)
+			for _, iv := range vals {
+				if parent == "" || path.Dir(iv.value) == parent {
+					count++
+				}
+			}
 		}
 
 	} else if state != "" {
@@ -132,16 +140,16 @@ func (l *Leveldb) jobFileCount(jobID string, filters map[string]string) (int, er
 
 func (l *Leveldb) JobFileList(jobID string, filters map[string]string) ([]model.JobFile, error) {
 	dir := ""
+	parent := ""
 	state := ""
 	for k, v := range filters {
 		k = strings.ToLower(k)
 		switch k {
 		case "dir", "parent":
-			if v == "*" {
-				dir = jobID
-			} else {
-				dir = jobID + v + "/"
+			if v != "*" {
+				parent = v
 			}
+			dir = parentPrefix(jobID, v)
 		case "state":
 			state = v
 		default:
@@ -149,6 +157,11 @@ func (l *Leveldb) JobFileList(jobID string, filters map[string]string) ([]model.
 		}
 	}
 
+	// without any filters every file in the job is listed
+	if dir == "" && state == "" {
+		dir = jobID
+	}
+
 	jf := make([]model.JobFile, 0)
 
 	if dir != "" {
@@ -158,6 +171,9 @@ func (l *Leveldb) JobFileList(jobID string, filters map[string]string) ([]model.
 		}
 
 		for _, iv := range vals {
+			if parent != "" && path.Dir(iv.value) != parent {
+				continue
+			}
 			f, err := l.getFile(jobID, iv.value)
 			if err == nil {
 				if state != "" && f.State != state {
@@ -188,9 +204,22 @@ func (l *Leveldb) JobFileList(jobID string, filters map[string]string) ([]model.
 	return jf, nil
 }
 
+// parentPrefix returns the parent index prefix that covers the files directly under parent.
+// The index key is the job id, the file's parent and then its path, so the prefix can still match
+// files further down the tree: the caller needs to check the parent of every file it gets back
+func parentPrefix(jobID, parent string) string {
+	if parent == "*" || parent == "/" {
+		return jobID
+	}
+	return jobID + parent + parent + "/"
+}
+
 func (l *Leveldb) JobDirectories(jobID, parent string) ([]string, error) {
 	val, err := l.Connection.Get([]byte(keyTypeFileDir+jobID+parent+"/"), nil)
 	if err != nil {
+		if err == leveldb.ErrNotFound {
+			return nil, goblerr.New("No directories under that parent", errors.ErrCodeNotFound, err)
+		}
 		return nil, goblerr.New("Unable to get directory list", errors.ErrCodeGet, err)
 	}
 
@@ -66,3 +66,12 @@ func (l *Leveldb) indexRange(itype string, start, limit string) ([]index, error)
 	iter.Release()
 	return is, iter.Error()
 }
+
+// indexValues returns the set of values the indexes point at
+func indexValues(is []index) map[string]bool {
+	values := make(map[string]bool, len(is))
+	for _, i := range is {
+		values[i.value] = true
+	}
+	return values
+}
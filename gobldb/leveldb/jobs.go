@@ -9,6 +9,7 @@ import (
 	"github.com/sethjback/gobl/goblerr"
 	"github.com/sethjback/gobl/model"
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 func (l *Leveldb) SaveJob(j model.Job) error {
@@ -23,13 +24,32 @@ func (l *Leveldb) SaveJob(j model.Job) error {
 	if err != nil {
 		return goblerr.New("Unable to save job", errors.ErrCodeMarshal, err)
 	}
+
+	// drop the indexes of the previous save so the job isn't listed under dates or an agent it no longer has
+	if pbyte, err := l.Connection.Get([]byte(keyTypeJob+j.ID), nil); err == nil {
+		var prev job
+		if json.Unmarshal(pbyte, &prev) == nil && prev.Meta != nil {
+			if !prev.Meta.Start.Equal(j.Meta.Start) {
+				l.DeleteIndex(index{itype: indexTypeJobDate, key: "start-" + strconv.Itoa(int(prev.Meta.Start.UnixNano())) + j.ID})
+			}
+			if !prev.Meta.End.Equal(j.Meta.End) {
+				l.DeleteIndex(index{itype: indexTypeJobDate, key: "end-" + strconv.Itoa(int(prev.Meta.End.UnixNano())) + j.ID})
+			}
+			if prev.AgentId != j.Agent.ID {
+				l.DeleteIndex(index{itype: indexTypeJobAgent, key: prev.AgentId + j.ID})
+			}
+		}
+	}
 	err = l.Connection.Put([]byte(keyTypeJob+j.ID), jbyte, nil)
 	if err != nil {
 		return goblerr.New("Unable to save job", errors.ErrCodeSave, err)
 	}
 
 	l.NewIndex(index{itype: indexTypeJobDate, key: "start-" + strconv.Itoa(int(j.Meta.Start.UnixNano())) + j.ID, value: j.ID})
-	l.NewIndex(index{itype: indexTypeJobDate, key: "end-" + strconv.Itoa(int(j.Meta.End.UnixNano())) + j.ID, value: j.ID})
+	// jobs that haven't ended yet aren't listed by end date
+	if !j.Meta.End.IsZero() {
+		l.NewIndex(index{itype: indexTypeJobDate, key: "end-" + strconv.Itoa(int(j.Meta.End.UnixNano())) + j.ID, value: j.ID})
+	}
 	if i, _ := l.GetIndex(indexTypeJobState, j.ID); i != nil {
 		if i.value != j.Meta.State {
 			l.NewIndex(index{itype: indexTypeJobState, key: j.Meta.State + j.ID, value: j.ID})
@@ -69,7 +89,12 @@ func (l *Leveldb) GetJob(id string) (*model.Job, error) {
 
 	j.Agent, err = l.GetAgent(lj.AgentId)
 	if err != nil {
-		return nil, goblerr.New("Unable to get job", errors.ErrCodeUnMarshal, err)
+		gerr, ok := err.(*goblerr.Error)
+		if !ok || gerr.Code != errors.ErrCodeNotFound {
+			return nil, goblerr.New("Unable to get job", errors.ErrCodeUnMarshal, err)
+		}
+		// the agent has been removed but its job history was kept
+		j.Agent = &model.Agent{ID: lj.AgentId}
 	}
 
 	j.Meta.Errors, _ = l.jobFileCount(j.ID, map[string]string{"state": model.StateFailed})
@@ -78,6 +103,54 @@ func (l *Leveldb) GetJob(id string) (*model.Job, error) {
 	return j, nil
 }
 
+// DeleteJob removes the job record, its file and directory records, and every index that points at them
+func (l *Leveldb) DeleteJob(id string) error {
+	j, err := l.GetJob(id)
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Delete([]byte(keyTypeJob + id))
+
+	for _, prefix := range []string{
+		keyTypeFile + id,
+		keyTypeFileDir + id,
+		keyTypeIndex + indexTypeFileState + id,
+		keyTypeIndex + indexTypeFileParent + id} {
+
+		iter := l.Connection.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+		for iter.Next() {
+			batch.Delete(append([]byte{}, iter.Key()...))
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return goblerr.New("Unable to delete job", errors.ErrCodeDelete, err)
+		}
+	}
+
+	// the end date index is rewritten every time the job is saved, so there can be more than one
+	dates, err := l.indexQuery(indexTypeJobDate, "")
+	if err != nil {
+		return goblerr.New("Unable to delete job", errors.ErrCodeDelete, err)
+	}
+	for _, i := range dates {
+		if i.value == id {
+			batch.Delete([]byte(keyTypeIndex + indexTypeJobDate + i.key))
+		}
+	}
+
+	batch.Delete([]byte(keyTypeIndex + indexTypeJobState + j.Meta.State + id))
+	batch.Delete([]byte(keyTypeIndex + indexTypeJobState + id))
+	batch.Delete([]byte(keyTypeIndex + indexTypeJobAgent + j.Agent.ID + id))
+
+	if err := l.Connection.Write(batch, nil); err != nil {
+		return goblerr.New("Unable to delete job", errors.ErrCodeDelete, err)
+	}
+
+	return nil
+}
+
 func (l *Leveldb) JobList(filters map[string]string) ([]model.Job, error) {
 	limit := 10
 	offset := 0
@@ -116,101 +189,63 @@ func (l *Leveldb) JobList(filters map[string]string) ([]model.Job, error) {
 		}
 	}
 
-	if start != "" || end != "" {
-		startIds := make([]string, 0)
-		if start != "" {
-			is, err := l.indexRange(indexTypeJobDate, "start-"+start, "start-"+strconv.Itoa(int(time.Now().UTC().Unix())+500))
-			if err != nil {
-				return nil, goblerr.New("Unable to get job list", errors.ErrCodeGet, err)
-			}
-			for _, i := range is {
-				startIds = append(startIds, i.value)
-			}
-		}
+	// each filter narrows down the set of matching ids, nil means the filter wasn't set
+	var sets []map[string]bool
 
-		endIds := make([]string, 0)
-		if end != "" {
-			is, err := l.indexRange(indexTypeJobDate, "end-", "end-"+end)
-			if err != nil {
-				return nil, goblerr.New("Unable to get job list", errors.ErrCodeGet, err)
-			}
-
-			// if we set a start date, we only want the ids intersection of the slices
-			for _, i := range is {
-				endIds = append(endIds, i.value)
-			}
-		}
-
-		if start != "" && end == "" {
-			ids = startIds
-		}
-
-		if end != "" && start == "" {
-			ids = endIds
+	if start != "" {
+		is, err := l.indexRange(indexTypeJobDate, "start-"+start, "start-"+strconv.Itoa(int(time.Now().UTC().Unix())+500))
+		if err != nil {
+			return nil, goblerr.New("Unable to get job list", errors.ErrCodeGet, err)
 		}
+		sets = append(sets, indexValues(is))
+	}
 
-		if end != "" && start != "" {
-			ids = intersectSlice(startIds, endIds)
+	if end != "" {
+		is, err := l.indexRange(indexTypeJobDate, "end-", "end-"+end)
+		if err != nil {
+			return nil, goblerr.New("Unable to get job list", errors.ErrCodeGet, err)
 		}
-
+		sets = append(sets, indexValues(is))
 	}
 
 	if agent != "" {
-		if ids == nil {
-			is, err := l.indexQuery(indexTypeJobAgent, agent)
-			if err != nil {
-				return nil, goblerr.New("Unable to get job list", errors.ErrCodeGet, err)
-			}
-			for _, i := range is {
-				if !stringInSlice(ids, i.value) {
-					ids = append(ids, i.value)
-				}
-			}
-		} else {
-			for i := len(ids) - 1; i > 0; i-- {
-				if ids[i] != agent {
-					ids = append(ids[:i], ids[i+1:]...)
-				}
-			}
-		}
-
-		if ids == nil {
-			ids = make([]string, 0)
+		is, err := l.indexQuery(indexTypeJobAgent, agent)
+		if err != nil {
+			return nil, goblerr.New("Unable to get job list", errors.ErrCodeGet, err)
 		}
+		sets = append(sets, indexValues(is))
 	}
 
 	if state != "" {
-		if ids == nil {
-			is, err := l.indexQuery(indexTypeJobState, state)
-			if err != nil {
-				return nil, goblerr.New("Unable to get job list", errors.ErrCodeGet, err)
-			}
-			for _, i := range is {
-				if !stringInSlice(ids, i.value) {
-					ids = append(ids, i.value)
-				}
-			}
-		} else {
-			for i := len(ids) - 1; i > 0; i-- {
-				if ids[i] != agent {
-					ids = append(ids[:i], ids[i+1:]...)
-				}
-			}
+		is, err := l.indexQuery(indexTypeJobState, state)
+		if err != nil {
+			return nil, goblerr.New("Unable to get job list", errors.ErrCodeGet, err)
 		}
+		sets = append(sets, indexValues(is))
 	}
 
-	// there were not filters (apart from limit or count)
-	if start == "" && end == "" && state == "" && agent == "" {
-		is, err := l.indexQuery(indexTypeJobDate, "start-")
-		if err != nil {
-			return nil, goblerr.New("Unable to get job list", errors.ErrCodeGet, err)
+	// the start date index keeps the jobs ordered by when they started
+	is, err := l.indexQuery(indexTypeJobDate, "start-")
+	if err != nil {
+		return nil, goblerr.New("Unable to get job list", errors.ErrCodeGet, err)
+	}
+
+	seen := make(map[string]bool)
+	for _, i := range is {
+		match := !seen[i.value]
+		for _, set := range sets {
+			if !set[i.value] {
+				match = false
+				break
+			}
 		}
-		for _, i := range is {
+		if match {
+			seen[i.value] = true
 			ids = append(ids, i.value)
 		}
 	}
 
-	if len(ids) < offset {
+	if offset >= len(ids) {
 		return []model.Job{}, nil
 	}
 
@@ -220,7 +255,7 @@ func (l *Leveldb) JobList(filters map[string]string) ([]model.Job, error) {
 
 	jobs := []model.Job{}
 
-	for _, i := range ids[offset:limit] {
+	for _, i := range ids[offset : offset+limit] {
 		j, err := l.GetJob(i)
 		if err != nil {
 			return nil, goblerr.New("Unable to get job list", errors.ErrCodeGet, err)
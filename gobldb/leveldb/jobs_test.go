@@ -7,6 +7,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/sethjback/gobl/config"
 	"github.com/sethjback/gobl/engine"
+	"github.com/sethjback/gobl/files"
 	"github.com/sethjback/gobl/model"
 	"github.com/sethjback/gobl/modification"
 	"github.com/sethjback/gobl/util/log"
@@ -53,14 +54,17 @@ func TestJobs(t *testing.T) {
 		return
 	}
 
+	// the stored time has no monotonic clock reading and comes back in UTC
+	now := time.Now().UTC().Round(0)
+
 	j := model.Job{
 		ID:         uuid.New().String(),
 		Agent:      &a,
 		Definition: &jd,
 		Meta: &model.JobMeta{
 			State: "running",
-			Start: time.Now(),
-			End:   time.Now(),
+			Start: now,
+			End:   now,
 		},
 	}
 
@@ -148,8 +152,8 @@ func TestJobs(t *testing.T) {
 		Definition: &jd,
 		Meta: &model.JobMeta{
 			State: "running",
-			Start: time.Now(),
-			End:   time.Now(),
+			Start: now,
+			End:   now,
 		},
 	})
 	assert.Nil(err)
@@ -160,8 +164,8 @@ func TestJobs(t *testing.T) {
 		Definition: &jd,
 		Meta: &model.JobMeta{
 			State: "running",
-			Start: time.Now(),
-			End:   time.Now(),
+			Start: now,
+			End:   now,
 		},
 	})
 	assert.Nil(err)
@@ -206,3 +210,69 @@ func TestJobs(t *testing.T) {
 		assert.Len(jds, 3)
 	}
 }
+
+func TestDeleteJob(t *testing.T) {
+	assert := assert.New(t)
+	log.Init(config.Log{Level: log.Level.Error})
+
+	s, err := testDB()
+	if !assert.Nil(err) {
+		return
+	}
+	defer s.Close()
+
+	a := model.Agent{ID: uuid.New().String(), Name: "Test Agent 1"}
+	assert.Nil(s.SaveAgent(a))
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		j := model.Job{
+			ID:         uuid.New().String(),
+			Agent:      &a,
+			Definition: &model.JobDefinition{},
+			Meta:       &model.JobMeta{State: model.StateRunning, Start: time.Now()}}
+		assert.Nil(s.SaveJob(j))
+
+		assert.Nil(s.SaveJobFile(j.ID, model.JobFile{State: "complete", File: files.File{Signature: files.Signature{Path: "/dir1/dir2/file1"}}}))
+		assert.Nil(s.SaveJobFile(j.ID, model.JobFile{State: "errors", File: files.File{Signature: files.Signature{Path: "/dir1/file2"}}}))
+
+		// saving again with a new end date adds another date index
+		j.Meta.State = model.StateFinished
+		j.Meta.End = time.Now()
+		assert.Nil(s.SaveJob(j))
+
+		ids = append(ids, j.ID)
+	}
+
+	assert.Nil(s.DeleteJob(ids[0]))
+	assert.NotNil(s.DeleteJob(ids[0]))
+
+	_, err = s.GetJob(ids[0])
+	assert.NotNil(err)
+
+	// nothing referencing the deleted job is left
+	iter := s.Connection.NewIterator(nil, nil)
+	for iter.Next() {
+		assert.NotContains(string(iter.Key()), ids[0])
+		assert.NotEqual(ids[0], string(iter.Value()))
+	}
+	iter.Release()
+
+	// the other job is untouched
+	j, err := s.GetJob(ids[1])
+	if assert.Nil(err) {
+		assert.Equal(model.StateFinished, j.Meta.State)
+	}
+
+	fl, err := s.JobFileList(ids[1], map[string]string{"parent": "*"})
+	assert.Nil(err)
+	assert.Len(fl, 2)
+
+	dirs, err := s.JobDirectories(ids[1], "/")
+	assert.Nil(err)
+	assert.Equal([]string{"dir1"}, dirs)
+
+	jobs, err := s.JobList(map[string]string{"agent": a.ID})
+	assert.Nil(err)
+	assert.Len(jobs, 1)
+}
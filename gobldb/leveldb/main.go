@@ -24,6 +24,7 @@ type Leveldb struct {
 	Connection *leveldb.DB
 }
 
+// New opens the database at the configured path and migrates it to the current schema version
 func New(options config.DB) (*Leveldb, error) {
 	l := &Leveldb{}
 	o := &opt.Options{
@@ -38,8 +39,16 @@ func New(options config.DB) (*Leveldb, error) {
 	} else {
 		l.Connection, err = leveldb.OpenFile(options.Path, o)
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = l.migrate(); err != nil {
+		l.Connection.Close()
+		return nil, err
+	}
 
-	return l, err
+	return l, nil
 }
 
 func (l *Leveldb) Close() error {
@@ -0,0 +1,158 @@
+package leveldb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/sethjback/gobl/gobldb/errors"
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/model"
+	"github.com/sethjback/gobl/util/log"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// schemaVersion is the version of the key layout written by this driver.
+// Any change to the layout, or to how the model structs are stored, needs a new migration
+const schemaVersion = 2
+
+const keySchemaVersion = "mt-schema-version"
+
+type migration struct {
+	version     int
+	description string
+	run         func(*Leveldb) error
+}
+
+// migrations are run in order against databases with an older schema version
+var migrations = []migration{
+	{1, "rebuild the job date indexes", rebuildJobDateIndexes},
+	{2, "make the users created before roles admins", adminRolelessUsers},
+}
+
+func (l *Leveldb) SchemaVersion() (int, error) {
+	v, err := l.Connection.Get([]byte(keySchemaVersion), nil)
+	if err != nil {
+		if err == leveldb.ErrNotFound {
+			return 0, nil
+		}
+		return -1, goblerr.New("Unable to get schema version", errors.ErrCodeGet, err)
+	}
+
+	version, err := strconv.Atoi(string(v))
+	if err != nil {
+		return -1, goblerr.New("Unable to get schema version", errors.ErrCodeUnMarshal, err)
+	}
+
+	return version, nil
+}
+
+func (l *Leveldb) setSchemaVersion(version int) error {
+	err := l.Connection.Put([]byte(keySchemaVersion), []byte(strconv.Itoa(version)), nil)
+	if err != nil {
+		return goblerr.New("Unable to save schema version", errors.ErrCodeSave, err)
+	}
+	return nil
+}
+
+// migrate brings the database up to the current schema version.
+// Databases written before the version was recorded are at version 0
+func (l *Leveldb) migrate() error {
+	current, err := l.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if current > schemaVersion {
+		return goblerr.New("Unable to open database", errors.ErrCodeSchema,
+			fmt.Sprintf("schema version %d is newer than the supported version %d", current, schemaVersion))
+	}
+
+	if current == 0 {
+		iter := l.Connection.NewIterator(nil, nil)
+		empty := !iter.Next()
+		iter.Release()
+
+		// nothing to migrate in a new database
+		if empty {
+			return l.setSchemaVersion(schemaVersion)
+		}
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		log.Infof("leveldb", "migrating schema to version %d: %s", m.version, m.description)
+		if err = m.run(l); err != nil {
+			return goblerr.New(fmt.Sprintf("Unable to migrate schema to version %d", m.version), errors.ErrCodeMigrate, err)
+		}
+
+		if err = l.setSchemaVersion(m.version); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rebuildJobDateIndexes drops date indexes left behind when a job was saved with new dates,
+// indexes of deleted jobs, and the end date indexes of jobs that never ended
+func rebuildJobDateIndexes(l *Leveldb) error {
+	expected := make(map[string]bool)
+
+	iter := l.Connection.NewIterator(util.BytesPrefix([]byte(keyTypeJob)), nil)
+	for iter.Next() {
+		var j job
+		if err := json.Unmarshal(iter.Value(), &j); err != nil || j.Meta == nil {
+			log.Errorf("leveldb", "rebuildJobDateIndexes: Unable to read job: %s", iter.Key())
+			continue
+		}
+
+		expected["start-"+strconv.Itoa(int(j.Meta.Start.UnixNano()))+j.ID] = true
+		if !j.Meta.End.IsZero() {
+			expected["end-"+strconv.Itoa(int(j.Meta.End.UnixNano()))+j.ID] = true
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	dates, err := l.indexQuery(indexTypeJobDate, "")
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	for _, i := range dates {
+		if !expected[i.key] {
+			batch.Delete([]byte(keyTypeIndex + indexTypeJobDate + i.key))
+		}
+	}
+
+	return l.Connection.Write(batch, nil)
+}
+
+// adminRolelessUsers gives the admin role to the users created before there were roles,
+// who could do everything. Without a role they can't do anything
+func adminRolelessUsers(l *Leveldb) error {
+	users, err := l.UserList()
+	if err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		if u.Role != "" {
+			continue
+		}
+		u.Role = model.RoleAdmin
+		if err = l.SaveUser(u); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package leveldb
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sethjback/gobl/config"
+	"github.com/sethjback/gobl/gobldb/errors"
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/model"
+	"github.com/sethjback/gobl/util/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrate(t *testing.T) {
+	assert := assert.New(t)
+	log.Init(config.Log{Level: log.Level.Error})
+
+	s, err := testDB()
+	if !assert.Nil(err) {
+		return
+	}
+	defer s.Close()
+
+	v, err := s.SchemaVersion()
+	assert.Nil(err)
+	assert.Equal(schemaVersion, v)
+
+	a := model.Agent{ID: "agent-1"}
+	assert.Nil(s.SaveAgent(a))
+
+	start := time.Date(2017, time.January, 1, 12, 0, 0, 0, time.UTC)
+	assert.Nil(s.SaveJob(model.Job{ID: "job-1", Agent: &a, Definition: &model.JobDefinition{}, Meta: &model.JobMeta{State: model.StateRunning, Start: start}}))
+	assert.Nil(s.SaveJob(model.Job{ID: "job-2", Agent: &a, Definition: &model.JobDefinition{}, Meta: &model.JobMeta{State: model.StateFinished, Start: start, End: start.Add(time.Hour)}}))
+
+	// indexes older versions left behind: a job that never ended, a job saved with an earlier start, and a deleted job
+	nano := func(t time.Time) string { return strconv.Itoa(int(t.UnixNano())) }
+	stale := []index{
+		{indexTypeJobDate, "end-" + nano(time.Time{}) + "job-1", "job-1"},
+		{indexTypeJobDate, "start-" + nano(start.Add(-time.Hour)) + "job-2", "job-2"},
+		{indexTypeJobDate, "start-" + nano(start) + "job-3", "job-3"},
+	}
+	for _, i := range stale {
+		assert.Nil(s.NewIndex(i))
+	}
+	// a user created before there were roles
+	assert.Nil(s.SaveUser(model.User{Email: "admin", Password: "hash"}))
+	assert.Nil(s.SaveUser(model.User{Email: "reader", Password: "hash", Role: model.RoleReadOnly}))
+	assert.Nil(s.Connection.Delete([]byte(keySchemaVersion), nil))
+
+	assert.Nil(s.migrate())
+
+	u, err := s.GetUser("admin")
+	if assert.Nil(err) {
+		assert.Equal(model.RoleAdmin, u.Role)
+		assert.True(u.Can(model.PermUsers))
+	}
+	u, err = s.GetUser("reader")
+	if assert.Nil(err) {
+		assert.Equal(model.RoleReadOnly, u.Role)
+	}
+
+	v, err = s.SchemaVersion()
+	assert.Nil(err)
+	assert.Equal(schemaVersion, v)
+
+	for _, i := range stale {
+		_, err := s.GetIndex(i.itype, i.key)
+		assert.NotNil(err, i.key)
+	}
+
+	dates, err := s.indexQuery(indexTypeJobDate, "")
+	assert.Nil(err)
+	assert.Len(dates, 3)
+
+	jobs, err := s.JobList(map[string]string{"end": "2017-02-01 00:00"})
+	if assert.Nil(err) && assert.Len(jobs, 1) {
+		assert.Equal("job-2", jobs[0].ID)
+	}
+
+	// databases from newer versions are left alone
+	assert.Nil(s.setSchemaVersion(schemaVersion + 1))
+	err = s.migrate()
+	if assert.IsType(&goblerr.Error{}, err) {
+		assert.Equal(errors.ErrCodeSchema, err.(*goblerr.Error).Code)
+	}
+}
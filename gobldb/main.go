@@ -5,14 +5,25 @@ import "github.com/sethjback/gobl/model"
 // QueryDateFormat defines the format we want dates in
 const QueryDateFormat = "2006-01-02 15:04"
 
-// Database is the interface that must be implemented by the DB driver
+// Drivers that can be selected with the db driver config option
+const (
+	DriverLevelDB = "leveldb"
+	DriverSQLite  = "sqlite"
+)
+
+// Database is the interface that must be implemented by the DB driver.
+// Drivers prove they implement it the same way by running the dbtest conformance suite
 type Database interface {
 	Close() error
 
+	// SchemaVersion returns the version of the storage layout. Drivers migrate older layouts when they are opened
+	SchemaVersion() (int, error)
+
 	// AGENTS
 	SaveAgent(model.Agent) error
 	GetAgent(id string) (*model.Agent, error)
 	AgentList() ([]model.Agent, error)
+	DeleteAgent(id string) error
 
 	// Job Definitions
 	SaveJobDefinition(model.JobDefinition) error
@@ -23,7 +34,10 @@ type Database interface {
 	// JOBS
 	SaveJob(job model.Job) error
 	GetJob(id string) (*model.Job, error)
+	// JobList returns the jobs matching all of the filters, ordered by start date
 	JobList(filters map[string]string) ([]model.Job, error)
+	// DeleteJob removes the job along with all of its files and indexes
+	DeleteJob(id string) error
 
 	SaveJobFile(jobID string, jobfile model.JobFile) error
 	JobFileList(jobID string, filters map[string]string) ([]model.JobFile, error)
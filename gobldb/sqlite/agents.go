@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/sethjback/gobl/gobldb/errors"
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/model"
+)
+
+func (s *SQLite) SaveAgent(a model.Agent) error {
+	groups, err := json.Marshal(a.Groups)
+	if err != nil {
+		return goblerr.New("Unable to save agent", errors.ErrCodeMarshal, err)
+	}
+
+	_, err = s.Connection.Exec(`INSERT OR REPLACE INTO agents (id, name, address, public_key, group_names) VALUES (?, ?, ?, ?, ?)`,
+		a.ID, a.Name, a.Address, a.PublicKey, string(groups))
+	if err != nil {
+		return goblerr.New("Unable to save agent", errors.ErrCodeSave, err)
+	}
+	return nil
+}
+
+func (s *SQLite) GetAgent(id string) (*model.Agent, error) {
+	a, err := scanAgent(s.Connection.QueryRow(`SELECT id, name, address, public_key, group_names FROM agents WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, goblerr.New("No agent with that ID", errors.ErrCodeNotFound, err)
+		}
+		return nil, goblerr.New("Unable to get agent", errors.ErrCodeGet, err)
+	}
+
+	return a, nil
+}
+
+func (s *SQLite) AgentList() ([]model.Agent, error) {
+	rows, err := s.Connection.Query(`SELECT id, name, address, public_key, group_names FROM agents ORDER BY name, id`)
+	if err != nil {
+		return nil, goblerr.New("Unable to get agent list", errors.ErrCodeGet, err)
+	}
+	defer rows.Close()
+
+	var alist []model.Agent
+	for rows.Next() {
+		a, err := scanAgent(rows)
+		if err != nil {
+			return nil, goblerr.New("Unable to get agent list", errors.ErrCodeUnMarshal, err)
+		}
+		alist = append(alist, *a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, goblerr.New("Unable to get agent list", errors.ErrCodeGet, err)
+	}
+	return alist, nil
+}
+
+func (s *SQLite) DeleteAgent(id string) error {
+	_, err := s.Connection.Exec(`DELETE FROM agents WHERE id = ?`, id)
+	if err != nil {
+		return goblerr.New("Unable to delete agent", errors.ErrCodeDelete, err)
+	}
+	return nil
+}
+
+func scanAgent(row scanner) (*model.Agent, error) {
+	var a model.Agent
+	var groups string
+	if err := row.Scan(&a.ID, &a.Name, &a.Address, &a.PublicKey, &groups); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(groups), &a.Groups); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
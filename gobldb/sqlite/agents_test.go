@@ -0,0 +1,106 @@
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sethjback/gobl/config"
+	"github.com/sethjback/gobl/model"
+	"github.com/sethjback/gobl/util/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgents(t *testing.T) {
+	assert := assert.New(t)
+	log.Init(config.Log{Level: log.Level.Error})
+
+	s, err := testDB()
+	if !assert.Nil(err) {
+		return
+	}
+	defer s.Close()
+
+	a := model.Agent{ID: uuid.New().String(), Name: "Test Agent 1", Address: "127.0.0.1:8080", PublicKey: "asdf", Groups: []string{"web"}}
+	a2 := model.Agent{ID: uuid.New().String(), Name: "Test Agent 2", Address: "127.0.0.2:8080", PublicKey: "asdf"}
+	assert.Nil(s.SaveAgent(a))
+	assert.Nil(s.SaveAgent(a2))
+
+	a1, err := s.GetAgent(a.ID)
+	if assert.Nil(err) {
+		assert.Equal(a, *a1)
+	}
+
+	a.Name = "Different"
+	a.Groups = nil
+	assert.Nil(s.SaveAgent(a))
+	a1, err = s.GetAgent(a.ID)
+	if assert.Nil(err) {
+		assert.Equal(a, *a1)
+	}
+
+	alist, err := s.AgentList()
+	assert.Nil(err)
+	assert.Equal([]model.Agent{a, a2}, alist)
+
+	assert.Nil(s.DeleteAgent(a2.ID))
+	_, err = s.GetAgent(a2.ID)
+	assert.NotNil(err)
+}
+
+func TestUsers(t *testing.T) {
+	assert := assert.New(t)
+	log.Init(config.Log{Level: log.Level.Error})
+
+	s, err := testDB()
+	if !assert.Nil(err) {
+		return
+	}
+	defer s.Close()
+
+	u := model.User{Email: "admin", Password: "hash", Role: model.RoleAdmin}
+	u2 := model.User{Email: "help", Password: "hash", Role: model.RoleRestore, Groups: []string{"web", "db"}}
+	assert.Nil(s.SaveUser(u))
+	assert.Nil(s.SaveUser(u2))
+
+	u1, err := s.GetUser("help")
+	if assert.Nil(err) {
+		assert.Equal(u2, *u1)
+	}
+
+	ulist, err := s.UserList()
+	assert.Nil(err)
+	assert.Equal([]model.User{u, u2}, ulist)
+
+	assert.Nil(s.DeleteUser("admin"))
+	_, err = s.GetUser("admin")
+	assert.NotNil(err)
+}
+
+func TestSchedules(t *testing.T) {
+	assert := assert.New(t)
+	log.Init(config.Log{Level: log.Level.Error})
+
+	s, err := testDB()
+	if !assert.Nil(err) {
+		return
+	}
+	defer s.Close()
+
+	sc := model.Schedule{ID: uuid.New().String(), AgentID: "agent", JobDefinitionID: "jd", Seconds: "0", Minutes: "30", Hour: "2", DOM: "*", MON: "*", DOW: "1-5"}
+	assert.Nil(s.SaveSchedule(sc))
+
+	sc1, err := s.GetSchedule(sc.ID)
+	if assert.Nil(err) {
+		assert.Equal(sc, *sc1)
+	}
+
+	sc.Hour = "3"
+	assert.Nil(s.SaveSchedule(sc))
+	slist, err := s.ScheduleList()
+	assert.Nil(err)
+	assert.Equal([]model.Schedule{sc}, slist)
+
+	assert.Nil(s.DeleteSchedule(sc.ID))
+	_, err = s.GetSchedule(sc.ID)
+	assert.NotNil(err)
+}
@@ -0,0 +1,121 @@
+package sqlite
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/sethjback/gobl/gobldb/errors"
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/model"
+)
+
+// SaveJobFile saves the file record and adds its parent directories to the job's directory tree
+func (s *SQLite) SaveJobFile(jobID string, f model.JobFile) error {
+	fbyte, err := json.Marshal(f.File)
+	if err != nil {
+		return goblerr.New("Unable to save file", errors.ErrCodeMarshal, err)
+	}
+
+	tx, err := s.Connection.Begin()
+	if err != nil {
+		return goblerr.New("Unable to save file", errors.ErrCodeSave, err)
+	}
+
+	_, err = tx.Exec(`INSERT OR REPLACE INTO job_files (job_id, path, parent, state, error, file) VALUES (?, ?, ?, ?, ?, ?)`,
+		jobID, f.File.Path, path.Dir(f.File.Path), f.State, f.Error, string(fbyte))
+	if err != nil {
+		tx.Rollback()
+		return goblerr.New("Unable to save file", errors.ErrCodeSave, err)
+	}
+
+	split := strings.Split(f.File.Path, "/")
+	for i, v := range split[1 : len(split)-1] {
+		parent := "/" + strings.Join(split[1:i+1], "/")
+		if _, err = tx.Exec(`INSERT OR IGNORE INTO job_directories (job_id, parent, name) VALUES (?, ?, ?)`, jobID, parent, v); err != nil {
+			tx.Rollback()
+			return goblerr.New("Unable to save file", errors.ErrCodeSave, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goblerr.New("Unable to save file", errors.ErrCodeSave, err)
+	}
+
+	return nil
+}
+
+// JobFileList returns the job's files. The parent (or dir) filter limits it to the files directly in that directory,
+// or every file with "*". The state filter limits it to files in that state
+func (s *SQLite) JobFileList(jobID string, filters map[string]string) ([]model.JobFile, error) {
+	where := []string{"job_id = ?"}
+	args := []interface{}{jobID}
+	for k, v := range filters {
+		k = strings.ToLower(k)
+		switch k {
+		case "dir", "parent":
+			if v != "*" {
+				where = append(where, "parent = ?")
+				args = append(args, v)
+			}
+		case "state":
+			where = append(where, "state = ?")
+			args = append(args, v)
+		default:
+			return nil, goblerr.New("Invalid filter. Use state or parent", errors.ErrFilterOptions, nil)
+		}
+	}
+
+	rows, err := s.Connection.Query(`SELECT state, error, file FROM job_files WHERE `+strings.Join(where, " AND ")+` ORDER BY path`, args...)
+	if err != nil {
+		return nil, goblerr.New("Unable to get file list", errors.ErrCodeGet, err)
+	}
+	defer rows.Close()
+
+	jf := make([]model.JobFile, 0)
+	for rows.Next() {
+		var f model.JobFile
+		var fbyte string
+		if err = rows.Scan(&f.State, &f.Error, &fbyte); err != nil {
+			return nil, goblerr.New("Unable to get file list", errors.ErrCodeGet, err)
+		}
+
+		if err = json.Unmarshal([]byte(fbyte), &f.File); err != nil {
+			return nil, goblerr.New("Unable to get file list", errors.ErrCodeUnMarshal, err)
+		}
+		jf = append(jf, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, goblerr.New("Unable to get file list", errors.ErrCodeGet, err)
+	}
+	return jf, nil
+}
+
+// JobDirectories returns the names of the directories directly inside parent
+func (s *SQLite) JobDirectories(jobID, parent string) ([]string, error) {
+	rows, err := s.Connection.Query(`SELECT name FROM job_directories WHERE job_id = ? AND parent = ? ORDER BY name`, jobID, parent)
+	if err != nil {
+		return nil, goblerr.New("Unable to get directory list", errors.ErrCodeGet, err)
+	}
+	defer rows.Close()
+
+	var dirs []string
+	for rows.Next() {
+		var d string
+		if err = rows.Scan(&d); err != nil {
+			return nil, goblerr.New("Unable to get directory list", errors.ErrCodeGet, err)
+		}
+		dirs = append(dirs, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, goblerr.New("Unable to get directory list", errors.ErrCodeGet, err)
+	}
+
+	if len(dirs) == 0 {
+		return nil, goblerr.New("Unable to get directory list", errors.ErrCodeNotFound, "no directories under "+parent)
+	}
+
+	return dirs, nil
+}
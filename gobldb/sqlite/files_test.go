@@ -0,0 +1,100 @@
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sethjback/gobl/config"
+	"github.com/sethjback/gobl/files"
+	"github.com/sethjback/gobl/model"
+	"github.com/sethjback/gobl/util/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFiles(t *testing.T) {
+	assert := assert.New(t)
+	log.Init(config.Log{Level: log.Level.Error})
+
+	s, err := testDB()
+	if !assert.Nil(err) {
+		return
+	}
+	defer s.Close()
+
+	jobID := uuid.New().String()
+	f := model.JobFile{
+		State: "complete",
+		File: files.File{
+			Meta:      files.Meta{Mode: 0644, UID: 1, GID: 1},
+			Signature: files.Signature{Path: "/dir1/dir2/dir3/file1.jpg", Hash: "asdf", Modifications: []string{"mod1", "mod2"}}}}
+	assert.Nil(s.SaveJobFile(jobID, f))
+
+	jfs, err := s.JobFileList(jobID, map[string]string{"parent": "*"})
+	if assert.Nil(err) {
+		assert.Equal([]model.JobFile{f}, jfs)
+	}
+
+	// saving again replaces the record
+	f.State = "failed"
+	f.Error = "unable to write file: device busy"
+	assert.Nil(s.SaveJobFile(jobID, f))
+	jfs, err = s.JobFileList(jobID, map[string]string{"parent": "*"})
+	if assert.Nil(err) {
+		assert.Equal([]model.JobFile{f}, jfs)
+	}
+
+	for _, p := range []struct{ path, state string }{
+		{"/dir1/dir2/dir3/file2.jpg", "success"},
+		{"/dir1/dir2/dir3/file3.jpg", "success"},
+		{"/dir1/dir2/dir3.2/file1.jpg", "success"},
+		{"/dir1/dir2/dir3.2/file2.jpg", "success"},
+		{"/dir1/dir2/dir3.3/file1.jpg", "failed"},
+		{"/dir1/dir2/dir3.3/file2.jpg", "success"},
+		{"/dir1/dir2/dir3.3/file3.jpg", "failed"},
+		{"/dir1.2/dir2/dir3.2/file2.jpg", "success"},
+		{"/dir1.2/dir2.2/dir3.2/file2.jpg", "success"},
+		{"/dir1.2/dir2.3/dir3.1/file2.jpg", "success"},
+		{"/dir1.2/dir2.3/dir3.2/file2.jpg", "success"},
+		{"/root.txt", "success"},
+	} {
+		f.File.Path = p.path
+		f.State = p.state
+		assert.Nil(s.SaveJobFile(jobID, f))
+	}
+
+	for _, c := range []struct {
+		filters map[string]string
+		count   int
+	}{
+		{map[string]string{"state": "failed"}, 3},
+		{map[string]string{"state": "failed", "dir": "/dir1/dir2/dir3"}, 1},
+		{map[string]string{"state": "failed", "dir": "/dir1/dir2/dir3.2"}, 0},
+		{map[string]string{"dir": "/dir1/dir2/dir3"}, 3},
+		{map[string]string{"dir": "/dir1/dir2"}, 0},
+		{map[string]string{"parent": "/"}, 1},
+		{map[string]string{"parent": "*"}, 13},
+	} {
+		jfs, err := s.JobFileList(jobID, c.filters)
+		if assert.Nil(err, "%v", c.filters) {
+			assert.Len(jfs, c.count, "%v", c.filters)
+		}
+	}
+
+	_, err = s.JobFileList(jobID, map[string]string{"size": "1"})
+	assert.NotNil(err)
+
+	dirs, err := s.JobDirectories(jobID, "/dir1.2")
+	assert.Nil(err)
+	assert.Equal([]string{"dir2", "dir2.2", "dir2.3"}, dirs)
+
+	dirs, err = s.JobDirectories(jobID, "/dir1.2/dir2.3")
+	assert.Nil(err)
+	assert.Equal([]string{"dir3.1", "dir3.2"}, dirs)
+
+	dirs, err = s.JobDirectories(jobID, "/")
+	assert.Nil(err)
+	assert.Equal([]string{"dir1", "dir1.2"}, dirs)
+
+	_, err = s.JobDirectories(jobID, "/missing")
+	assert.NotNil(err)
+}
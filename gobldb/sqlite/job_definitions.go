@@ -0,0 +1,76 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/sethjback/gobl/gobldb/errors"
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/model"
+)
+
+func (s *SQLite) SaveJobDefinition(jd model.JobDefinition) error {
+	jdbyte, err := json.Marshal(jd)
+	if err != nil {
+		return goblerr.New("Unable to save job defintion", errors.ErrCodeMarshal, err)
+	}
+
+	_, err = s.Connection.Exec(`INSERT OR REPLACE INTO job_definitions (id, type, definition) VALUES (?, ?, ?)`, jd.ID, jd.Type, string(jdbyte))
+	if err != nil {
+		return goblerr.New("Unable to save jobdefinition", errors.ErrCodeSave, err)
+	}
+	return nil
+}
+
+func (s *SQLite) GetJobDefinition(id string) (*model.JobDefinition, error) {
+	var jdbyte string
+	err := s.Connection.QueryRow(`SELECT definition FROM job_definitions WHERE id = ?`, id).Scan(&jdbyte)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, goblerr.New("No job definition with that ID", errors.ErrCodeNotFound, err)
+		}
+		return nil, goblerr.New("Unable to get job definition", errors.ErrCodeGet, err)
+	}
+
+	var jd model.JobDefinition
+	if err = json.Unmarshal([]byte(jdbyte), &jd); err != nil {
+		return nil, goblerr.New("Unable to get job definition", errors.ErrCodeUnMarshal, err)
+	}
+
+	return &jd, nil
+}
+
+func (s *SQLite) DeleteJobDefinition(id string) error {
+	_, err := s.Connection.Exec(`DELETE FROM job_definitions WHERE id = ?`, id)
+	if err != nil {
+		return goblerr.New("Unable to delete job definition", errors.ErrCodeDelete, err)
+	}
+	return nil
+}
+
+func (s *SQLite) JobDefinitionList() ([]model.JobDefinition, error) {
+	rows, err := s.Connection.Query(`SELECT definition FROM job_definitions ORDER BY id`)
+	if err != nil {
+		return nil, goblerr.New("Unable to get job definition list", errors.ErrCodeGet, err)
+	}
+	defer rows.Close()
+
+	var jdlist []model.JobDefinition
+	for rows.Next() {
+		var jdbyte string
+		if err = rows.Scan(&jdbyte); err != nil {
+			return nil, goblerr.New("Unable to get job definition list", errors.ErrCodeGet, err)
+		}
+
+		var jd model.JobDefinition
+		if err = json.Unmarshal([]byte(jdbyte), &jd); err != nil {
+			return nil, goblerr.New("Unable to get job definition list", errors.ErrCodeUnMarshal, err)
+		}
+		jdlist = append(jdlist, jd)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, goblerr.New("Unable to get job definition list", errors.ErrCodeGet, err)
+	}
+	return jdlist, nil
+}
@@ -0,0 +1,227 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sethjback/gobl/gobldb/errors"
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/model"
+)
+
+// jobSelect loads the job along with its file counts
+const jobSelect = `SELECT j.id, j.agent_id, j.state, j.started, j.ended, j.message, j.total, j.batches, j.received, j.definition,
+	(SELECT COUNT(*) FROM job_files f WHERE f.job_id = j.id AND f.state = '` + model.StateFinished + `'),
+	(SELECT COUNT(*) FROM job_files f WHERE f.job_id = j.id AND f.state = '` + model.StateFailed + `')
+	FROM jobs j`
+
+func (s *SQLite) SaveJob(j model.Job) error {
+	def, err := json.Marshal(j.Definition)
+	if err != nil {
+		return goblerr.New("Unable to save job", errors.ErrCodeMarshal, err)
+	}
+
+	var defID, defType string
+	if j.Definition != nil {
+		defID = j.Definition.ID
+		defType = j.Definition.Type
+	}
+
+	var received string
+	if len(j.Meta.Received) > 0 {
+		b, err := json.Marshal(j.Meta.Received)
+		if err != nil {
+			return goblerr.New("Unable to save job", errors.ErrCodeMarshal, err)
+		}
+		received = string(b)
+	}
+
+	_, err = s.Connection.Exec(`INSERT OR REPLACE INTO jobs (id, agent_id, definition_id, type, state, started, ended, message, total, batches, received, definition)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		j.ID, j.Agent.ID, defID, defType, j.Meta.State, formatTime(j.Meta.Start), formatTime(j.Meta.End), j.Meta.Message, j.Meta.Total,
+		j.Meta.Batches, received, string(def))
+	if err != nil {
+		return goblerr.New("Unable to save job", errors.ErrCodeSave, err)
+	}
+
+	return nil
+}
+
+func (s *SQLite) GetJob(id string) (*model.Job, error) {
+	j, agentID, err := scanJob(s.Connection.QueryRow(jobSelect+` WHERE j.id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, goblerr.New("No job with that ID", errors.ErrCodeNotFound, err)
+		}
+		return nil, goblerr.New("Unable to get job", errors.ErrCodeUnMarshal, err)
+	}
+
+	if err = s.loadAgent(j, agentID); err != nil {
+		return nil, goblerr.New("Unable to get job", errors.ErrCodeGet, err)
+	}
+
+	return j, nil
+}
+
+// DeleteJob removes the job along with its file and directory records in a single transaction
+func (s *SQLite) DeleteJob(id string) error {
+	tx, err := s.Connection.Begin()
+	if err != nil {
+		return goblerr.New("Unable to delete job", errors.ErrCodeDelete, err)
+	}
+
+	res, err := tx.Exec(`DELETE FROM jobs WHERE id = ?`, id)
+	if err != nil {
+		tx.Rollback()
+		return goblerr.New("Unable to delete job", errors.ErrCodeDelete, err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return goblerr.New("No job with that ID", errors.ErrCodeNotFound, nil)
+	}
+
+	for _, q := range []string{`DELETE FROM job_files WHERE job_id = ?`, `DELETE FROM job_directories WHERE job_id = ?`} {
+		if _, err = tx.Exec(q, id); err != nil {
+			tx.Rollback()
+			return goblerr.New("Unable to delete job", errors.ErrCodeDelete, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return goblerr.New("Unable to delete job", errors.ErrCodeDelete, err)
+	}
+
+	return nil
+}
+
+// JobList returns jobs ordered by start time. Filters are the same as the leveldb driver:
+// state, agent, start (started at or after), end (ended at or before), limit and offset
+func (s *SQLite) JobList(filters map[string]string) ([]model.Job, error) {
+	limit := 10
+	offset := 0
+
+	var where []string
+	var args []interface{}
+
+	for k, v := range filters {
+		switch k {
+		case "state":
+			where = append(where, "j.state = ?")
+			args = append(args, v)
+		case "agent":
+			where = append(where, "j.agent_id = ?")
+			args = append(args, v)
+		case "start", "end":
+			t, err := parseDate(v)
+			if err != nil {
+				return nil, goblerr.New("date stamp invalid", errors.ErrFilterOptions, err)
+			}
+			if k == "start" {
+				where = append(where, "j.started >= ?")
+				args = append(args, formatTime(t))
+			} else {
+				// jobs that haven't ended yet aren't listed by end date
+				where = append(where, "j.ended <= ? AND j.ended > ?")
+				args = append(args, formatTime(t), formatTime(time.Time{}))
+			}
+		case "limit", "offset":
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, goblerr.New(k+" invalid", errors.ErrFilterOptions, err)
+			}
+			if k == "limit" {
+				limit = i
+			} else {
+				offset = i
+			}
+		default:
+			return nil, goblerr.New("unrecognized filter: "+k+"", errors.ErrFilterOptions, "Valid options are: state, start, end, agent, limit, and offset")
+		}
+	}
+
+	q := jobSelect
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	q += " ORDER BY j.started, j.id LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := s.Connection.Query(q, args...)
+	if err != nil {
+		return nil, goblerr.New("Unable to get job list", errors.ErrCodeGet, err)
+	}
+	defer rows.Close()
+
+	jobs := []model.Job{}
+	var agentIDs []string
+	for rows.Next() {
+		j, agentID, err := scanJob(rows)
+		if err != nil {
+			return nil, goblerr.New("Unable to get job list", errors.ErrCodeUnMarshal, err)
+		}
+		jobs = append(jobs, *j)
+		agentIDs = append(agentIDs, agentID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, goblerr.New("Unable to get job list", errors.ErrCodeGet, err)
+	}
+	rows.Close()
+
+	for i := range jobs {
+		if err = s.loadAgent(&jobs[i], agentIDs[i]); err != nil {
+			return nil, goblerr.New("Unable to get job list", errors.ErrCodeGet, err)
+		}
+	}
+
+	return jobs, nil
+}
+
+// loadAgent sets the job's agent. If the agent has been removed but its job history was kept only the id is set
+func (s *SQLite) loadAgent(j *model.Job, agentID string) error {
+	a, err := s.GetAgent(agentID)
+	if err != nil {
+		gerr, ok := err.(*goblerr.Error)
+		if !ok || gerr.Code != errors.ErrCodeNotFound {
+			return err
+		}
+		a = &model.Agent{ID: agentID}
+	}
+
+	j.Agent = a
+	return nil
+}
+
+func scanJob(row scanner) (*model.Job, string, error) {
+	j := &model.Job{Meta: &model.JobMeta{}}
+	var agentID, start, end, received, def string
+	err := row.Scan(&j.ID, &agentID, &j.Meta.State, &start, &end, &j.Meta.Message, &j.Meta.Total, &j.Meta.Batches, &received, &def,
+		&j.Meta.Complete, &j.Meta.Errors)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if received != "" {
+		if err = json.Unmarshal([]byte(received), &j.Meta.Received); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if j.Meta.Start, err = parseTime(start); err != nil {
+		return nil, "", err
+	}
+
+	if j.Meta.End, err = parseTime(end); err != nil {
+		return nil, "", err
+	}
+
+	if err = json.Unmarshal([]byte(def), &j.Definition); err != nil {
+		return nil, "", err
+	}
+
+	return j, agentID, nil
+}
@@ -0,0 +1,196 @@
+package sqlite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sethjback/gobl/config"
+	"github.com/sethjback/gobl/engine"
+	"github.com/sethjback/gobl/files"
+	"github.com/sethjback/gobl/model"
+	"github.com/sethjback/gobl/util/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobDefinitions(t *testing.T) {
+	assert := assert.New(t)
+	log.Init(config.Log{Level: log.Level.Error})
+
+	s, err := testDB()
+	if !assert.Nil(err) {
+		return
+	}
+	defer s.Close()
+
+	jd := model.JobDefinition{
+		ID:        uuid.New().String(),
+		Type:      model.TypeBackup,
+		To:        []engine.Definition{engine.Definition{Name: "test", Options: map[string]interface{}{"test": float64(1)}}},
+		Paths:     []model.Path{model.Path{Root: "/dir1/dir2", Excludes: []string{"*.jpg"}}},
+		Retention: &model.Retention{KeepLast: 3}}
+	assert.Nil(s.SaveJobDefinition(jd))
+
+	jd1, err := s.GetJobDefinition(jd.ID)
+	if assert.Nil(err) {
+		assert.Equal(jd, *jd1)
+	}
+
+	jds, err := s.JobDefinitionList()
+	assert.Nil(err)
+	assert.Equal([]model.JobDefinition{jd}, jds)
+
+	assert.Nil(s.DeleteJobDefinition(jd.ID))
+	_, err = s.GetJobDefinition(jd.ID)
+	assert.NotNil(err)
+}
+
+func TestJobs(t *testing.T) {
+	assert := assert.New(t)
+	log.Init(config.Log{Level: log.Level.Error})
+
+	s, err := testDB()
+	if !assert.Nil(err) {
+		return
+	}
+	defer s.Close()
+
+	a := model.Agent{ID: uuid.New().String(), Name: "Test Agent 1"}
+	a1 := model.Agent{ID: uuid.New().String(), Name: "Test Agent 2"}
+	assert.Nil(s.SaveAgent(a))
+	assert.Nil(s.SaveAgent(a1))
+
+	jd := &model.JobDefinition{ID: uuid.New().String(), Type: model.TypeBackup}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	j := model.Job{
+		ID:         uuid.New().String(),
+		Agent:      &a,
+		Definition: jd,
+		Meta:       &model.JobMeta{State: model.StateRunning, Start: now, End: now, Total: 12}}
+	assert.Nil(s.SaveJob(j))
+
+	j1, err := s.GetJob(j.ID)
+	if assert.Nil(err) {
+		assert.Equal(j, *j1)
+	}
+
+	j.Meta.State = model.StateFinished
+	j.Meta.Message = "done"
+	assert.Nil(s.SaveJob(j))
+
+	j1, err = s.GetJob(j.ID)
+	if assert.Nil(err) {
+		assert.Equal(j, *j1)
+	}
+
+	save := func(agent *model.Agent, state string, start, end time.Time) {
+		assert.Nil(s.SaveJob(model.Job{ID: uuid.New().String(), Agent: agent, Definition: jd, Meta: &model.JobMeta{State: state, Start: start, End: end}}))
+	}
+
+	jan := time.Date(2017, time.January, 1, 12, 12, 12, 0, time.UTC)
+	feb := time.Date(2017, time.February, 1, 12, 12, 12, 0, time.UTC)
+	save(&a1, model.StateFinished, jan, jan.AddDate(0, 0, 1))
+	save(&a1, model.StateFinished, jan, jan.AddDate(0, 0, 1))
+	save(&a, model.StateFinished, jan, jan.AddDate(0, 0, 1))
+	save(&a, model.StateFinished, feb, feb.AddDate(0, 0, 1))
+	save(&a, model.StateRunning, now, now)
+	save(&a1, model.StateRunning, now, now)
+
+	for _, c := range []struct {
+		filters map[string]string
+		count   int
+	}{
+		{map[string]string{"state": "finished"}, 5},
+		{map[string]string{"state": "running"}, 2},
+		{map[string]string{"agent": a.ID}, 4},
+		{map[string]string{"agent": a.ID, "state": "running"}, 1},
+		{map[string]string{}, 7},
+		{map[string]string{"limit": "2"}, 2},
+		{map[string]string{"limit": "5", "offset": "4"}, 3},
+		{map[string]string{"start": "2017-02-01 00:00"}, 4},
+		{map[string]string{"start": "2017-02-01 00:00", "end": "2017-03-01 00:00"}, 1},
+		{map[string]string{"end": "2017-02-01 00:00"}, 3},
+	} {
+		jobs, err := s.JobList(c.filters)
+		if assert.Nil(err, "%v", c.filters) {
+			assert.Len(jobs, c.count, "%v", c.filters)
+		}
+	}
+
+	// oldest first
+	jobs, err := s.JobList(map[string]string{"agent": a.ID})
+	if assert.Nil(err) {
+		assert.Equal(jan, jobs[0].Meta.Start)
+		assert.Equal(&a, jobs[0].Agent)
+	}
+
+	_, err = s.JobList(map[string]string{"unknown": "1"})
+	assert.NotNil(err)
+	_, err = s.JobList(map[string]string{"start": "yesterday"})
+	assert.NotNil(err)
+
+	// file counts are part of the meta
+	assert.Nil(s.SaveJobFile(j.ID, model.JobFile{State: model.StateFinished, File: files.File{Signature: files.Signature{Path: "/a"}}}))
+	assert.Nil(s.SaveJobFile(j.ID, model.JobFile{State: model.StateFailed, File: files.File{Signature: files.Signature{Path: "/b"}}}))
+	j1, err = s.GetJob(j.ID)
+	if assert.Nil(err) {
+		assert.Equal(1, j1.Meta.Complete)
+		assert.Equal(1, j1.Meta.Errors)
+	}
+
+	// jobs of removed agents are still readable
+	assert.Nil(s.DeleteAgent(a1.ID))
+	jobs, err = s.JobList(map[string]string{"agent": a1.ID})
+	if assert.Nil(err) && assert.Len(jobs, 3) {
+		assert.Equal(&model.Agent{ID: a1.ID}, jobs[0].Agent)
+	}
+}
+
+func TestDeleteJob(t *testing.T) {
+	assert := assert.New(t)
+	log.Init(config.Log{Level: log.Level.Error})
+
+	s, err := testDB()
+	if !assert.Nil(err) {
+		return
+	}
+	defer s.Close()
+
+	a := model.Agent{ID: uuid.New().String(), Name: "Test Agent 1"}
+	assert.Nil(s.SaveAgent(a))
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		j := model.Job{
+			ID:         uuid.New().String(),
+			Agent:      &a,
+			Definition: &model.JobDefinition{},
+			Meta:       &model.JobMeta{State: model.StateFinished, Start: time.Now()}}
+		assert.Nil(s.SaveJob(j))
+
+		assert.Nil(s.SaveJobFile(j.ID, model.JobFile{State: "complete", File: files.File{Signature: files.Signature{Path: "/dir1/dir2/file1"}}}))
+		assert.Nil(s.SaveJobFile(j.ID, model.JobFile{State: "errors", File: files.File{Signature: files.Signature{Path: "/dir1/file2"}}}))
+		ids = append(ids, j.ID)
+	}
+
+	assert.Nil(s.DeleteJob(ids[0]))
+	assert.NotNil(s.DeleteJob(ids[0]))
+
+	_, err = s.GetJob(ids[0])
+	assert.NotNil(err)
+
+	for _, table := range []string{"job_files", "job_directories"} {
+		var count int
+		assert.Nil(s.Connection.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE job_id = ?`, ids[0]).Scan(&count))
+		assert.Equal(0, count, table)
+	}
+
+	fl, err := s.JobFileList(ids[1], map[string]string{"parent": "*"})
+	assert.Nil(err)
+	assert.Len(fl, 2)
+
+	dirs, err := s.JobDirectories(ids[1], "/")
+	assert.Nil(err)
+	assert.Equal([]string{"dir1"}, dirs)
+}
@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sethjback/gobl/config"
+	"github.com/sethjback/gobl/util/log"
+)
+
+// timeFormat is how times are stored: always UTC and fixed width so they sort as text
+const timeFormat = "2006-01-02 15:04:05.000000000"
+
+type SQLite struct {
+	Connection *sql.DB
+}
+
+// New opens the database file at the configured path and migrates it to the current schema version
+func New(options config.DB) (*SQLite, error) {
+	path := options.Path
+	if len(path) == 0 {
+		log.Warn("sqlite", "DB Path empty, this will create in-memory db: probably not what you wanted!")
+		path = ":memory:"
+	}
+
+	conn, err := sql.Open("sqlite3", path+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite only allows one writer, and every connection to :memory: is a separate database
+	conn.SetMaxOpenConns(1)
+
+	s := &SQLite{Connection: conn}
+	if err = s.migrate(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *SQLite) Close() error {
+	return s.Connection.Close()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+func parseTime(s string) (time.Time, error) {
+	return time.ParseInLocation(timeFormat, s, time.UTC)
+}
@@ -0,0 +1,49 @@
+package sqlite
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sethjback/gobl/config"
+	"github.com/sethjback/gobl/model"
+	"github.com/sethjback/gobl/util/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	assert := assert.New(t)
+	log.Init(config.Log{Level: log.Level.Error})
+
+	s, err := New(config.DB{Path: ""})
+	assert.Nil(err)
+	assert.Nil(s.Close())
+
+	dir, err := ioutil.TempDir("", "gobl-sqlite")
+	if !assert.Nil(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.db")
+	s, err = New(config.DB{Path: path})
+	if !assert.Nil(err) {
+		return
+	}
+	assert.Nil(s.SaveAgent(model.Agent{ID: "1", Name: "agent"}))
+	assert.Nil(s.Close())
+
+	// reopening keeps the data and doesn't recreate the tables
+	s, err = New(config.DB{Path: path})
+	if assert.Nil(err) {
+		a, err := s.GetAgent("1")
+		assert.Nil(err)
+		assert.Equal("agent", a.Name)
+		assert.Nil(s.Close())
+	}
+}
+
+func testDB() (*SQLite, error) {
+	return New(config.DB{Path: ""})
+}
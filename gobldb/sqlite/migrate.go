@@ -0,0 +1,155 @@
+package sqlite
+
+import (
+	"fmt"
+
+	"github.com/sethjback/gobl/gobldb/errors"
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/util/log"
+)
+
+// schemaVersion is the version of the tables written by this driver. It is kept in the user_version pragma.
+// Any change to the tables, or to how the model structs are stored, needs a new migration
+const schemaVersion = 3
+
+type migration struct {
+	version     int
+	description string
+	statements  []string
+}
+
+// migrations are run in order against databases with an older schema version
+var migrations = []migration{
+	{1, "create the tables", initialSchema},
+	{2, "record the file batches of jobs", []string{
+		`ALTER TABLE jobs ADD COLUMN batches INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE jobs ADD COLUMN received TEXT NOT NULL DEFAULT ''`,
+	}},
+	// users created before there were roles could do everything
+	{3, "make the users created before roles admins", []string{
+		`UPDATE users SET role = 'admin' WHERE role = ''`,
+	}},
+}
+
+// initialSchema creates the tables of schema version 1
+var initialSchema = []string{
+	`CREATE TABLE IF NOT EXISTS agents (
+		id          TEXT PRIMARY KEY,
+		name        TEXT NOT NULL,
+		address     TEXT NOT NULL,
+		public_key  TEXT NOT NULL,
+		group_names TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS job_definitions (
+		id         TEXT PRIMARY KEY,
+		type       TEXT NOT NULL,
+		definition TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS jobs (
+		id            TEXT PRIMARY KEY,
+		agent_id      TEXT NOT NULL,
+		definition_id TEXT NOT NULL,
+		type          TEXT NOT NULL,
+		state         TEXT NOT NULL,
+		started       TEXT NOT NULL,
+		ended         TEXT NOT NULL,
+		message       TEXT NOT NULL,
+		total         INTEGER NOT NULL,
+		definition    TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS jobs_agent ON jobs (agent_id, started)`,
+	`CREATE INDEX IF NOT EXISTS jobs_state ON jobs (state, started)`,
+	`CREATE INDEX IF NOT EXISTS jobs_started ON jobs (started)`,
+	`CREATE INDEX IF NOT EXISTS jobs_ended ON jobs (ended)`,
+	`CREATE TABLE IF NOT EXISTS job_files (
+		job_id TEXT NOT NULL,
+		path   TEXT NOT NULL,
+		parent TEXT NOT NULL,
+		state  TEXT NOT NULL,
+		error  TEXT NOT NULL,
+		file   TEXT NOT NULL,
+		PRIMARY KEY (job_id, path)
+	)`,
+	`CREATE INDEX IF NOT EXISTS job_files_parent ON job_files (job_id, parent)`,
+	`CREATE INDEX IF NOT EXISTS job_files_state ON job_files (job_id, state)`,
+	`CREATE TABLE IF NOT EXISTS job_directories (
+		job_id TEXT NOT NULL,
+		parent TEXT NOT NULL,
+		name   TEXT NOT NULL,
+		PRIMARY KEY (job_id, parent, name)
+	)`,
+	`CREATE TABLE IF NOT EXISTS schedules (
+		id                TEXT PRIMARY KEY,
+		job_definition_id TEXT NOT NULL,
+		agent_id          TEXT NOT NULL,
+		seconds           TEXT NOT NULL,
+		minutes           TEXT NOT NULL,
+		hour              TEXT NOT NULL,
+		dom               TEXT NOT NULL,
+		mon               TEXT NOT NULL,
+		dow               TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS schedules_agent ON schedules (agent_id)`,
+	`CREATE TABLE IF NOT EXISTS users (
+		email       TEXT PRIMARY KEY,
+		password    TEXT NOT NULL,
+		role        TEXT NOT NULL,
+		group_names TEXT NOT NULL
+	)`,
+}
+
+func (s *SQLite) SchemaVersion() (int, error) {
+	var version int
+	if err := s.Connection.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return -1, goblerr.New("Unable to get schema version", errors.ErrCodeGet, err)
+	}
+	return version, nil
+}
+
+// migrate brings the database up to the current schema version, running each migration in its own transaction
+func (s *SQLite) migrate() error {
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if current > schemaVersion {
+		return goblerr.New("Unable to open database", errors.ErrCodeSchema,
+			fmt.Sprintf("schema version %d is newer than the supported version %d", current, schemaVersion))
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		log.Infof("sqlite", "migrating schema to version %d: %s", m.version, m.description)
+		if err = s.runMigration(m); err != nil {
+			return goblerr.New(fmt.Sprintf("Unable to migrate schema to version %d", m.version), errors.ErrCodeMigrate, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLite) runMigration(m migration) error {
+	tx, err := s.Connection.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range m.statements {
+		if _, err = tx.Exec(stmt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// pragmas can't take bound parameters
+	if _, err = tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, m.version)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
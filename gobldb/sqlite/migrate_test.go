@@ -0,0 +1,139 @@
+package sqlite
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sethjback/gobl/config"
+	"github.com/sethjback/gobl/files"
+	"github.com/sethjback/gobl/gobldb"
+	"github.com/sethjback/gobl/gobldb/errors"
+	"github.com/sethjback/gobl/gobldb/leveldb"
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/model"
+	"github.com/sethjback/gobl/util/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrate(t *testing.T) {
+	assert := assert.New(t)
+	log.Init(config.Log{Level: log.Level.Error})
+
+	dir, err := ioutil.TempDir("", "gobl-sqlite")
+	if !assert.Nil(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.db")
+
+	// tables created before the version was recorded are kept, and brought up to date
+	conn, err := sql.Open("sqlite3", path)
+	if !assert.Nil(err) {
+		return
+	}
+	for _, stmt := range initialSchema {
+		_, err = conn.Exec(stmt)
+		assert.Nil(err)
+	}
+	_, err = conn.Exec(`INSERT INTO agents VALUES ('agent-1', '', '', '', 'null')`)
+	assert.Nil(err)
+	// a user created before there were roles
+	_, err = conn.Exec(`INSERT INTO users VALUES ('admin', 'hash', '', 'null')`)
+	assert.Nil(err)
+	_, err = conn.Exec(`INSERT INTO jobs VALUES ('job-1', 'agent-1', '', 'backup', 'finished', ?, ?, '', 2, 'null')`,
+		formatTime(time.Time{}), formatTime(time.Time{}))
+	assert.Nil(err)
+	assert.Nil(conn.Close())
+
+	s, err := New(config.DB{Path: path})
+	if assert.Nil(err) {
+		v, err := s.SchemaVersion()
+		assert.Nil(err)
+		assert.Equal(schemaVersion, v)
+
+		_, err = s.GetAgent("agent-1")
+		assert.Nil(err)
+
+		u, err := s.GetUser("admin")
+		if assert.Nil(err) {
+			assert.Equal(model.RoleAdmin, u.Role)
+			assert.True(u.Can(model.PermUsers))
+		}
+
+		j, err := s.GetJob("job-1")
+		if assert.Nil(err) {
+			assert.Equal(2, j.Meta.Total)
+			assert.Equal(0, j.Meta.Batches)
+			assert.Empty(j.Meta.Received)
+		}
+
+		_, err = s.Connection.Exec(`PRAGMA user_version = 1000`)
+		assert.Nil(err)
+		assert.Nil(s.Close())
+	}
+
+	// databases from newer versions are left alone
+	_, err = New(config.DB{Path: path})
+	if assert.IsType(&goblerr.Error{}, err) {
+		assert.Equal(errors.ErrCodeSchema, err.(*goblerr.Error).Code)
+	}
+}
+
+func TestImportFromLevelDB(t *testing.T) {
+	assert := assert.New(t)
+	log.Init(config.Log{Level: log.Level.Error})
+
+	l, err := leveldb.New(config.DB{})
+	if !assert.Nil(err) {
+		return
+	}
+	defer l.Close()
+
+	a := model.Agent{ID: "agent-1", Name: "Agent", Groups: []string{"web"}}
+	j := model.Job{
+		ID:         "job-1",
+		Agent:      &a,
+		Definition: &model.JobDefinition{ID: "jd-1", Type: model.TypeBackup},
+		Meta:       &model.JobMeta{State: model.StateFinished, Start: time.Date(2017, time.January, 1, 12, 0, 0, 0, time.UTC), End: time.Date(2017, time.January, 1, 13, 0, 0, 0, time.UTC)}}
+	assert.Nil(l.SaveAgent(a))
+	assert.Nil(l.SaveUser(model.User{Email: "admin", Password: "hash", Role: model.RoleAdmin}))
+	assert.Nil(l.SaveJob(j))
+	assert.Nil(l.SaveJobFile(j.ID, model.JobFile{State: model.StateFinished, File: files.File{Signature: files.Signature{Path: "/home/file"}}}))
+
+	var buf bytes.Buffer
+	_, err = gobldb.Export(l, &buf)
+	if !assert.Nil(err) {
+		return
+	}
+
+	s, err := testDB()
+	if !assert.Nil(err) {
+		return
+	}
+	defer s.Close()
+
+	count, err := gobldb.Import(s, &buf)
+	assert.Nil(err)
+	assert.Equal(5, count)
+
+	j.Meta.Complete = 1
+	j1, err := s.GetJob(j.ID)
+	if assert.Nil(err) {
+		assert.Equal(j, *j1)
+	}
+
+	u, err := s.GetUser("admin")
+	if assert.Nil(err) {
+		assert.Equal("hash", u.Password)
+	}
+
+	dirs, err := s.JobDirectories(j.ID, "/")
+	assert.Nil(err)
+	assert.Equal([]string{"home"}, dirs)
+}
@@ -0,0 +1,71 @@
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/sethjback/gobl/gobldb/errors"
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/model"
+)
+
+const scheduleColumns = `id, job_definition_id, agent_id, seconds, minutes, hour, dom, mon, dow`
+
+func (s *SQLite) SaveSchedule(sc model.Schedule) error {
+	_, err := s.Connection.Exec(`INSERT OR REPLACE INTO schedules (`+scheduleColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sc.ID, sc.JobDefinitionID, sc.AgentID, sc.Seconds, sc.Minutes, sc.Hour, sc.DOM, sc.MON, sc.DOW)
+	if err != nil {
+		return goblerr.New("Unable to save schedule", errors.ErrCodeSave, err)
+	}
+	return nil
+}
+
+func (s *SQLite) GetSchedule(id string) (*model.Schedule, error) {
+	sc, err := scanSchedule(s.Connection.QueryRow(`SELECT `+scheduleColumns+` FROM schedules WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, goblerr.New("No schedule with that ID", errors.ErrCodeNotFound, err)
+		}
+		return nil, goblerr.New("Unable to get schedule", errors.ErrCodeGet, err)
+	}
+
+	return sc, nil
+}
+
+func (s *SQLite) DeleteSchedule(id string) error {
+	_, err := s.Connection.Exec(`DELETE FROM schedules WHERE id = ?`, id)
+	if err != nil {
+		return goblerr.New("Unable to delete schedule", errors.ErrCodeDelete, err)
+	}
+	return nil
+}
+
+func (s *SQLite) ScheduleList() ([]model.Schedule, error) {
+	rows, err := s.Connection.Query(`SELECT ` + scheduleColumns + ` FROM schedules ORDER BY id`)
+	if err != nil {
+		return nil, goblerr.New("Unable to get schedule list", errors.ErrCodeGet, err)
+	}
+	defer rows.Close()
+
+	var slist []model.Schedule
+	for rows.Next() {
+		sc, err := scanSchedule(rows)
+		if err != nil {
+			return nil, goblerr.New("Unable to get schedule list", errors.ErrCodeGet, err)
+		}
+		slist = append(slist, *sc)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, goblerr.New("Unable to get schedule list", errors.ErrCodeGet, err)
+	}
+	return slist, nil
+}
+
+func scanSchedule(row scanner) (*model.Schedule, error) {
+	var sc model.Schedule
+	err := row.Scan(&sc.ID, &sc.JobDefinitionID, &sc.AgentID, &sc.Seconds, &sc.Minutes, &sc.Hour, &sc.DOM, &sc.MON, &sc.DOW)
+	if err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
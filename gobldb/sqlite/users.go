@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/sethjback/gobl/gobldb/errors"
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/model"
+)
+
+func (s *SQLite) SaveUser(u model.User) error {
+	groups, err := json.Marshal(u.Groups)
+	if err != nil {
+		return goblerr.New("Unable to save user", errors.ErrCodeMarshal, err)
+	}
+
+	_, err = s.Connection.Exec(`INSERT OR REPLACE INTO users (email, password, role, group_names) VALUES (?, ?, ?, ?)`,
+		u.Email, u.Password, u.Role, string(groups))
+	if err != nil {
+		return goblerr.New("Unable to save user", errors.ErrCodeSave, err)
+	}
+	return nil
+}
+
+func (s *SQLite) GetUser(id string) (*model.User, error) {
+	u, err := scanUser(s.Connection.QueryRow(`SELECT email, password, role, group_names FROM users WHERE email = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, goblerr.New("No user with that email", errors.ErrCodeNotFound, err)
+		}
+		return nil, goblerr.New("Unable to get user", errors.ErrCodeGet, err)
+	}
+
+	return u, nil
+}
+
+func (s *SQLite) UserList() ([]model.User, error) {
+	rows, err := s.Connection.Query(`SELECT email, password, role, group_names FROM users ORDER BY email`)
+	if err != nil {
+		return nil, goblerr.New("Unable to get user list", errors.ErrCodeGet, err)
+	}
+	defer rows.Close()
+
+	var ulist []model.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, goblerr.New("Unable to get user list", errors.ErrCodeUnMarshal, err)
+		}
+		ulist = append(ulist, *u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, goblerr.New("Unable to get user list", errors.ErrCodeGet, err)
+	}
+	return ulist, nil
+}
+
+func (s *SQLite) DeleteUser(id string) error {
+	_, err := s.Connection.Exec(`DELETE FROM users WHERE email = ?`, id)
+	if err != nil {
+		return goblerr.New("Unable to delete user", errors.ErrCodeDelete, err)
+	}
+	return nil
+}
+
+func scanUser(row scanner) (*model.User, error) {
+	var u model.User
+	var groups string
+	if err := row.Scan(&u.Email, &u.Password, &u.Role, &groups); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(groups), &u.Groups); err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
@@ -0,0 +1,28 @@
+package sqlite
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/sethjback/gobl/gobldb"
+)
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func parseDate(date string) (time.Time, error) {
+	t, err := time.Parse(gobldb.QueryDateFormat, date)
+	if err == nil {
+		return t, nil
+	}
+
+	di, err := strconv.Atoi(date)
+	if err == nil {
+		return time.Unix(int64(di), 0), nil
+	}
+
+	return time.Time{}, errors.New("Invalid time provided. Must be unix timestamp or in format yyyy-mm-dd hh:mm")
+}
@@ -0,0 +1,68 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/sethjback/gobl/goblerr"
+)
+
+const (
+	ErrorTokenRequired = "TokenRequired"
+	ErrorTokenInvalid  = "TokenInvalid"
+
+	HeaderAuthorization = "Authorization"
+)
+
+// TokenRequired reports whether the request must carry a bearer token
+type TokenRequired func(r *Request) bool
+
+// TokenCheck validates the bearer token and returns the user it was issued to
+type TokenCheck func(token string) (string, error)
+
+// Authenticate
+// Middleware:
+// It implements the ServeHTTP interface for negroni middleware. It must run after Normalize:
+// requests that require a token must provide it in the Authorization header as "Bearer <token>".
+// The user the token was issued to is stored on the request
+type Authenticate struct {
+	required TokenRequired
+	check    TokenCheck
+}
+
+func NewAuthenticate(required TokenRequired, check TokenCheck) *Authenticate {
+	return &Authenticate{required: required, check: check}
+}
+
+// ServeHTTP is the interface implementation for negroni middleware
+func (a Authenticate) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	req := RequestFromContext(r.Context())
+
+	if !a.required(req) {
+		next(rw, r)
+		return
+	}
+
+	header := req.Headers.Get(HeaderAuthorization)
+	if !strings.HasPrefix(header, "Bearer ") {
+		resp := Response{
+			HTTPCode: 401,
+			Error:    goblerr.New("Authorization header not set", ErrorTokenRequired, "you must provide a bearer token in the Authorization header"),
+		}
+		resp.Write(rw)
+		return
+	}
+
+	user, err := a.check(strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")))
+	if err != nil {
+		resp := Response{
+			HTTPCode: 401,
+			Error:    goblerr.New("Token invalid", ErrorTokenInvalid, err),
+		}
+		resp.Write(rw)
+		return
+	}
+
+	req.User = user
+	next(rw, r)
+}
@@ -0,0 +1,65 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sethjback/gobl/config"
+	"github.com/sethjback/gobl/util/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticate(t *testing.T) {
+	assert := assert.New(t)
+	log.Init(config.Log{Level: log.Level.Warn})
+
+	a := NewAuthenticate(func(r *Request) bool {
+		return r.Path != "/login"
+	}, func(token string) (string, error) {
+		if token != "good" {
+			return "", errors.New("bad token")
+		}
+		return "admin", nil
+	})
+	n := NewNormalize()
+
+	var user string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.ServeHTTP(w, r, func(w http.ResponseWriter, r *http.Request) {
+			a.ServeHTTP(w, r, func(w http.ResponseWriter, r *http.Request) {
+				user = RequestFromContext(r.Context()).User
+				resp := Response{HTTPCode: 200, Data: map[string]interface{}{"ok": true}}
+				resp.Write(w)
+			})
+		})
+	}))
+	defer ts.Close()
+
+	send := func(path, authorization string) int {
+		hr, _ := http.NewRequest("GET", ts.URL+path, nil)
+		hr.Header.Set(HeaderGoblDate, strconv.Itoa(int(time.Now().UTC().Unix())))
+		if authorization != "" {
+			hr.Header.Set(HeaderAuthorization, authorization)
+		}
+		hres, err := http.DefaultClient.Do(hr)
+		if !assert.Nil(err) {
+			return 0
+		}
+		hres.Body.Close()
+		return hres.StatusCode
+	}
+
+	assert.Equal(200, send("/login", ""))
+	assert.Equal("", user)
+
+	assert.Equal(401, send("/agents", ""))
+	assert.Equal(401, send("/agents", "good"))
+	assert.Equal(401, send("/agents", "Bearer bad"))
+
+	assert.Equal(200, send("/agents", "Bearer good"))
+	assert.Equal("admin", user)
+}
@@ -75,6 +75,7 @@ func (n Normalize) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.
 	req.Query = r.URL.Query()
 	req.Host = r.Host
 	req.Path = r.URL.Path
+	req.Method = r.Method
 
 	ctx := r.Context()
 	next(rw, r.WithContext(context.WithValue(ctx, request, req)))
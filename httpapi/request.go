@@ -51,7 +51,10 @@ type Request struct {
 	Path            string
 	Method          string
 	Query           url.Values
-	Client          *http.Client
+	// Client sends the request, or a client from NewClient if nil. It is used as given, as it may be shared
+	Client *http.Client
+	// User is the authenticated user, set by the Authenticate middleware
+	User string
 }
 
 func NewRequest(host, path, method string) *Request {
@@ -69,8 +72,11 @@ func RequestFromContext(ctx context.Context) *Request {
 }
 
 // String returns the request string that is appropriate for signing
+// The sender and receiver see the host differently (the sender has the full address, including
+// the scheme and any path prefix), so both are reduced to host:port and the full path
 func (r *Request) String() string {
-	uri := strings.ToLower(r.Path)
+	host, uri := canonicalLocation(r.Host, r.Path)
+	uri = strings.ToLower(uri)
 	query := queryString(r.Query)
 
 	var body string
@@ -86,7 +92,7 @@ func (r *Request) String() string {
 
 	return strings.Join([]string{
 		r.Method,
-		r.Host,
+		host,
 		uri,
 		query,
 		headers.String(),
@@ -122,14 +128,32 @@ func (r *Request) JsonBody(decodeTo interface{}) error {
 	return nil
 }
 
+// canonicalLocation strips the scheme from the host and moves any path prefix on the host onto the path
+func canonicalLocation(host, path string) (string, string) {
+	if !strings.Contains(host, "://") {
+		return host, path
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return host, path
+	}
+
+	return u.Host, strings.TrimSuffix(u.Path, "/") + path
+}
+
 // bodyHash returns the sha256 sum of the body
+// An empty body returns an empty string so it matches a request without a body
 func bodyHash(reader io.ReadSeeker) string {
 	hash := sha256.New()
 
 	start, _ := reader.Seek(0, 1)
 	defer reader.Seek(start, 0)
 
-	io.Copy(hash, reader)
+	n, _ := io.Copy(hash, reader)
+	if n == 0 {
+		return ""
+	}
 	s := hash.Sum(nil)
 	return hex.EncodeToString(s)
 }
@@ -170,13 +194,17 @@ func (r *Request) Send(s keys.Signer) (*Response, error) {
 	switch r.Method {
 	case "POST":
 		return post(r)
-	case "GET":
+	case "GET", "DELETE":
 		return get(r)
 	}
-	return nil, goblerr.New("Invalid method", ErrorRequestInvalid, "must be POST or GET")
+	return nil, goblerr.New("Invalid method", ErrorRequestInvalid, "must be POST, GET or DELETE")
 }
 
 func prepAndSign(r *Request, s keys.Signer) error {
+	if r.Headers == nil {
+		r.Headers = http.Header{}
+	}
+
 	if d := r.Headers.Get(HeaderGoblDate); d == "" {
 		r.Headers.Set(HeaderGoblDate, strconv.Itoa(int(time.Now().UTC().Unix())))
 	}
@@ -200,16 +228,14 @@ func post(r *Request) (*Response, error) {
 	}
 
 	req.Header = r.Headers
-	req.Header.Set(HeaderGoblDate, strconv.Itoa(int(time.Now().UTC().Unix())))
 	req.Header.Set("Content-Type", "application/json")
 
-	if r.Client == nil {
-		r.Client = &http.Client{CheckRedirect: checkRedirect}
-	} else {
-		r.Client.CheckRedirect = checkRedirect
+	client := r.Client
+	if client == nil {
+		client = NewClient()
 	}
 
-	resp, err := r.Client.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, goblerr.New("Unable to send request", ErrorRequestFailed, err)
 	}
@@ -235,23 +261,21 @@ func post(r *Request) (*Response, error) {
 	return &response, nil
 }
 
-// Get a request
+// Get a request. Also used for DELETE, which doesn't send a body either
 func get(r *Request) (*Response, error) {
-	req, err := http.NewRequest("GET", r.Host+r.Path, nil)
+	req, err := http.NewRequest(r.Method, r.Host+r.Path, nil)
 	if err != nil {
 		return nil, goblerr.New("Invalid request", ErrorRequestInvalid, err)
 	}
 
 	req.Header = r.Headers
-	req.Header.Set(HeaderGoblDate, strconv.Itoa(int(time.Now().UTC().Unix())))
 
-	if r.Client == nil {
-		r.Client = &http.Client{CheckRedirect: checkRedirect}
-	} else {
-		r.Client.CheckRedirect = checkRedirect
+	client := r.Client
+	if client == nil {
+		client = NewClient()
 	}
 
-	resp, err := r.Client.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, goblerr.New("Unable to send request", ErrorRequestFailed, err)
 	}
@@ -264,9 +288,11 @@ func get(r *Request) (*Response, error) {
 	resp.Body.Close()
 
 	var response Response
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		return nil, goblerr.New("Unable to unmarshal", ErrorRequestFailed, err)
+	if len(body) != 0 {
+		err = json.Unmarshal(body, &response)
+		if err != nil {
+			return nil, goblerr.New("Unable to unmarshal", ErrorRequestFailed, err)
+		}
 	}
 	response.HTTPCode = resp.StatusCode
 
@@ -274,6 +300,11 @@ func get(r *Request) (*Response, error) {
 }
 
 // do not allow redirects
+// NewClient returns a client for sending requests, which refuses to follow redirects
+func NewClient() *http.Client {
+	return &http.Client{CheckRedirect: checkRedirect}
+}
+
 func checkRedirect(req *http.Request, via []*http.Request) error {
 	return errors.New("Redirects not supported")
 }
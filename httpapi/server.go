@@ -13,7 +13,8 @@ import (
 
 // Server handles accepting and replying to API requests
 type Server struct {
-	router *httprouter.Router
+	router     *httprouter.Router
+	middleware []negroni.Handler
 }
 
 // New returns a new httpapi.Server configured to respond to the routes provided
@@ -38,6 +39,11 @@ func New(routes []Route) *Server {
 	return s
 }
 
+// Use adds middleware that will run after the request has been normalized, in the order added
+func (s *Server) Use(handler negroni.Handler) {
+	s.middleware = append(s.middleware, handler)
+}
+
 // Start listening on given address.
 // The shutdown function will be called before the server exits
 func (s *Server) Start(c config.Server, shutdown func()) {
@@ -48,6 +54,9 @@ func (s *Server) Start(c config.Server, shutdown func()) {
 	}
 
 	n.Use(NewNormalize())
+	for _, m := range s.middleware {
+		n.Use(m)
+	}
 	n.UseHandler(s.router)
 
 	graceful.Run(c.Listen, time.Duration(c.ShutdownWait)*time.Second, n)
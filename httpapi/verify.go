@@ -0,0 +1,71 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/keys"
+)
+
+const (
+	ErrorSignatureRequired = "SignatureHeaderRequired"
+	ErrorSignatureInvalid  = "SignatureInvalid"
+)
+
+// VerifierLookup returns the verifier that should be used to check the signature of the request.
+// A nil verifier with a nil error indicates the request does not need to be signed
+type VerifierLookup func(r *Request) (keys.Verifier, error)
+
+// Verify
+// Middleware:
+// It implements the ServeHTTP interface for negroni middleware. It must run after Normalize:
+// it rebuilds the canonical request string and checks it against the x-gobl-signature header
+// using the verifier returned by the lookup function
+type Verify struct {
+	lookup VerifierLookup
+}
+
+func NewVerify(lookup VerifierLookup) *Verify {
+	return &Verify{lookup: lookup}
+}
+
+// ServeHTTP is the interface implementation for negroni middleware
+func (v Verify) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	req := RequestFromContext(r.Context())
+
+	verifier, err := v.lookup(req)
+	if err != nil {
+		resp := Response{
+			HTTPCode: 401,
+			Error:    goblerr.New("Unable to verify request", ErrorSignatureInvalid, err),
+		}
+		resp.Write(rw)
+		return
+	}
+
+	if verifier == nil {
+		next(rw, r)
+		return
+	}
+
+	sig := req.Headers.Get(HeaderGoblSig)
+	if sig == "" {
+		resp := Response{
+			HTTPCode: 401,
+			Error:    goblerr.New("Signature header not set", ErrorSignatureRequired, "you must provide the x-gobl-signature header in every request"),
+		}
+		resp.Write(rw)
+		return
+	}
+
+	if err := verifier.Verify([]byte(req.String()), sig); err != nil {
+		resp := Response{
+			HTTPCode: 401,
+			Error:    goblerr.New("Signature invalid", ErrorSignatureInvalid, "request signature could not be verified"),
+		}
+		resp.Write(rw)
+		return
+	}
+
+	next(rw, r)
+}
@@ -0,0 +1,118 @@
+package httpapi
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sethjback/gobl/config"
+	"github.com/sethjback/gobl/keys"
+	"github.com/sethjback/gobl/util/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func verifyServer(lookup VerifierLookup) *httptest.Server {
+	v := NewVerify(lookup)
+	n := NewNormalize()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.ServeHTTP(w, r, func(w http.ResponseWriter, r *http.Request) {
+			v.ServeHTTP(w, r, func(w http.ResponseWriter, r *http.Request) {
+				resp := Response{HTTPCode: 200, Data: map[string]interface{}{"verified": true}}
+				resp.Write(w)
+			})
+		})
+	}))
+}
+
+func TestVerify(t *testing.T) {
+	assert := assert.New(t)
+	log.Init(config.Log{Level: log.Level.Warn})
+
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.Nil(err) {
+		return
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.Nil(err) {
+		return
+	}
+
+	ts := verifyServer(func(r *Request) (keys.Verifier, error) {
+		return keys.NewVerifier(&pk.PublicKey), nil
+	})
+	defer ts.Close()
+
+	// signed with the right key, with and without a path prefix on the host
+	req := NewRequest(ts.URL, "/jobs/1234/files", "POST")
+	assert.Nil(req.SetBody(map[string]string{"test": "value"}))
+	resp, err := req.Send(keys.NewSigner(pk))
+	if assert.Nil(err) {
+		assert.Equal(200, resp.HTTPCode)
+	}
+
+	req = NewRequest(ts.URL+"/prefix", "/status", "GET")
+	resp, err = req.Send(keys.NewSigner(pk))
+	if assert.Nil(err) {
+		assert.Equal(200, resp.HTTPCode)
+	}
+
+	// empty body is signed the same as no body
+	req = NewRequest(ts.URL, "/jobs/1234/complete", "POST")
+	req.Body = bytes.NewReader(nil)
+	resp, err = req.Send(keys.NewSigner(pk))
+	if assert.Nil(err) {
+		assert.Equal(200, resp.HTTPCode)
+	}
+
+	// signed with the wrong key
+	req = NewRequest(ts.URL, "/jobs/1234/files", "POST")
+	assert.Nil(req.SetBody(map[string]string{"test": "value"}))
+	resp, err = req.Send(keys.NewSigner(other))
+	if assert.Nil(err) {
+		assert.Equal(401, resp.HTTPCode)
+	}
+
+	// tampered body
+	req = NewRequest(ts.URL, "/jobs/1234/files", "POST")
+	assert.Nil(req.SetBody(map[string]string{"test": "value"}))
+	assert.Nil(prepAndSign(req, keys.NewSigner(pk)))
+	hr, err := http.NewRequest("POST", ts.URL+"/jobs/1234/files", bytes.NewReader([]byte(`{"test":"changed"}`)))
+	if assert.Nil(err) {
+		hr.Header = req.Headers
+		hres, err := http.DefaultClient.Do(hr)
+		if assert.Nil(err) {
+			assert.Equal(401, hres.StatusCode)
+			hres.Body.Close()
+		}
+	}
+
+	// unsigned
+	hr, err = http.NewRequest("GET", ts.URL+"/status", nil)
+	if assert.Nil(err) {
+		hr.Header.Set(HeaderGoblDate, req.Headers.Get(HeaderGoblDate))
+		hres, err := http.DefaultClient.Do(hr)
+		if assert.Nil(err) {
+			assert.Equal(401, hres.StatusCode)
+			hres.Body.Close()
+		}
+	}
+
+	// routes that don't require a signature pass through
+	open := verifyServer(func(r *Request) (keys.Verifier, error) {
+		return nil, nil
+	})
+	defer open.Close()
+
+	hr, err = http.NewRequest("GET", open.URL+"/status", nil)
+	if assert.Nil(err) {
+		hr.Header.Set(HeaderGoblDate, req.Headers.Get(HeaderGoblDate))
+		hres, err := http.DefaultClient.Do(hr)
+		if assert.Nil(err) {
+			assert.Equal(200, hres.StatusCode)
+			hres.Body.Close()
+		}
+	}
+}
@@ -6,4 +6,6 @@ type Agent struct {
 	Name      string `json:"name"`
 	Address   string `json:"address"`
 	PublicKey string `json:"publickey"`
+	// Groups the agent belongs to, used to limit which users can access it
+	Groups []string `json:"groups,omitempty"`
 }
@@ -0,0 +1,14 @@
+package model
+
+import (
+	"github.com/sethjback/gobl/engine"
+	"github.com/sethjback/gobl/modification"
+)
+
+// Capabilities describes what an agent supports, so job definitions can be built for it
+type Capabilities struct {
+	// Version of the agent
+	Version       string                    `json:"version"`
+	Engines       []engine.Capability       `json:"engines"`
+	Modifications []modification.Capability `json:"modifications"`
+}
@@ -37,6 +37,13 @@ type JobDefinition struct {
 	Modifications []modification.Definition `json:"modifications"`
 	Paths         []Path                    `json:"paths,omitempty"`
 	Files         []files.File              `json:"files,omitempty"`
+	// Xattrs requests extended attributes be saved along with the rest of the file metadata
+	Xattrs bool `json:"xattrs,omitempty"`
+	// Retention determines when jobs run from this definition expire
+	Retention *Retention `json:"retention,omitempty"`
+	// MaxRuntime is the number of seconds a job run from this definition may run before it is canceled
+	// and marked failed. 0 means no limit
+	MaxRuntime int `json:"maxRuntime,omitempty"`
 }
 
 type JobMeta struct {
@@ -47,6 +54,10 @@ type JobMeta struct {
 	Total    int       `json:"total"`
 	Complete int       `json:"complete"`
 	Errors   int       `json:"errors"`
+	// Batches is the number of file batches the agent reported sending when the job completed
+	Batches int `json:"batches,omitempty"`
+	// Received are the sequence numbers of the file batches recorded so far
+	Received Sequences `json:"received,omitempty"`
 }
 
 type JobFile struct {
@@ -55,6 +66,20 @@ type JobFile struct {
 	Error string     `json:"error,omitempty"`
 }
 
+// FileBatch carries the results of a number of files from the agent. The batches of a job are numbered from 1
+type FileBatch struct {
+	Sequence int       `json:"sequence"`
+	Files    []JobFile `json:"files"`
+}
+
+// JobComplete is sent by the agent once it has finished the job
+type JobComplete struct {
+	// Batches is the number of file batches sent for the job
+	Batches int `json:"batches"`
+	// Error is set if the agent couldn't finish the job, e.g. it was restarted while the job was running
+	Error string `json:"error,omitempty"`
+}
+
 type Path struct {
 	Root     string   `json:"root"`
 	Excludes []string `json:"excludes"`
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"github.com/sethjback/gobl/engine"
+	"github.com/sethjback/gobl/files"
+)
+
+// PruneRequest asks an agent to remove the objects in its save engines that no job references any longer
+type PruneRequest struct {
+	// Engines to prune
+	Engines []engine.Definition `json:"engines"`
+	// Referenced are the signatures of every file still referenced by a job. They must not be removed
+	Referenced []files.Signature `json:"referenced"`
+	// DryRun only reports what would be removed
+	DryRun bool `json:"dryRun"`
+	// Session, if set, names the PruneReferences sent ahead of the request. Their signatures are kept too
+	Session string `json:"session,omitempty"`
+}
+
+// PruneReferences carries a page of the referenced signatures ahead of a PruneRequest, so no single
+// request gets too big for the agent to read
+type PruneReferences struct {
+	// Session groups the pages of one prune
+	Session    string            `json:"session"`
+	Referenced []files.Signature `json:"referenced"`
+}
+
+// PruneResult reports the outcome of pruning a single engine
+type PruneResult struct {
+	Engine string `json:"engine"`
+	// Objects is the number of unreferenced objects found
+	Objects int `json:"objects"`
+	// Bytes is the space used by the unreferenced objects
+	Bytes int64 `json:"bytes"`
+	// Deleted is the number of objects removed. Always 0 for a dry run
+	Deleted int    `json:"deleted"`
+	Error   string `json:"error,omitempty"`
+}
+
+// StatsRequest asks an agent how much space its save engines use
+type StatsRequest struct {
+	Engines []engine.Definition `json:"engines"`
+}
+
+// StatsResult reports the stats of a single engine
+type StatsResult struct {
+	Engine string `json:"engine"`
+	engine.Stats
+	Error string `json:"error,omitempty"`
+}
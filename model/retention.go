@@ -0,0 +1,121 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Retention defines how long jobs run from a job definition are kept before they expire.
+// A job is kept if any of the rules want to keep it. Rules left at zero are ignored, and a
+// retention with no rules set keeps everything. Only finished jobs count toward the rules that keep
+// a number of jobs: failed and canceled jobs are kept by KeepDays, or while no later job has finished.
+// The most recent finished job is always kept
+type Retention struct {
+	// KeepLast keeps the most recent n finished jobs
+	KeepLast int `json:"keepLast,omitempty"`
+	// KeepDays keeps every job that ended in the last n days
+	KeepDays int `json:"keepDays,omitempty"`
+	// Daily keeps the most recent finished job for each of the last n days that have one
+	Daily int `json:"daily,omitempty"`
+	// Weekly keeps the most recent finished job for each of the last n weeks that have one
+	Weekly int `json:"weekly,omitempty"`
+	// Monthly keeps the most recent finished job for each of the last n months that have one
+	Monthly int `json:"monthly,omitempty"`
+}
+
+// Empty is true if no retention rules are set
+func (r Retention) Empty() bool {
+	return r.KeepLast == 0 && r.KeepDays == 0 && r.Daily == 0 && r.Weekly == 0 && r.Monthly == 0
+}
+
+// Validate checks that none of the rules are negative
+func (r Retention) Validate() error {
+	if r.KeepLast < 0 || r.KeepDays < 0 || r.Daily < 0 || r.Weekly < 0 || r.Monthly < 0 {
+		return errors.New("retention values cannot be negative")
+	}
+	return nil
+}
+
+// Expired returns the jobs that fall outside of the retention rules as of now.
+// Jobs should all be in a final state: they are ordered by their end time
+func (r Retention) Expired(jobs []Job, now time.Time) []Job {
+	if r.Empty() {
+		return nil
+	}
+
+	sorted := make([]Job, len(jobs))
+	copy(sorted, jobs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Meta.End.After(sorted[j].Meta.End)
+	})
+
+	var finished []Job
+	keep := make(map[string]bool)
+	for _, j := range sorted {
+		if j.Meta.State == StateFinished {
+			finished = append(finished, j)
+		} else if len(finished) == 0 {
+			// nothing has finished since
+			keep[j.ID] = true
+		}
+	}
+
+	if len(finished) > 0 {
+		keep[finished[0].ID] = true
+	}
+
+	for i := 0; i < r.KeepLast && i < len(finished); i++ {
+		keep[finished[i].ID] = true
+	}
+
+	if r.KeepDays > 0 {
+		cutoff := now.AddDate(0, 0, -r.KeepDays)
+		for _, j := range sorted {
+			if j.Meta.End.After(cutoff) {
+				keep[j.ID] = true
+			}
+		}
+	}
+
+	keepPeriods(finished, r.Daily, keep, func(t time.Time) string {
+		return t.Format("2006-01-02")
+	})
+
+	keepPeriods(finished, r.Weekly, keep, func(t time.Time) string {
+		y, w := t.ISOWeek()
+		return fmt.Sprintf("%d-%02d", y, w)
+	})
+
+	keepPeriods(finished, r.Monthly, keep, func(t time.Time) string {
+		return t.Format("2006-01")
+	})
+
+	var expired []Job
+	for _, j := range sorted {
+		if !keep[j.ID] {
+			expired = append(expired, j)
+		}
+	}
+
+	return expired
+}
+
+// keepPeriods marks the newest job in each of the n most recent periods. Jobs must be sorted newest first
+func keepPeriods(sorted []Job, n int, keep map[string]bool, period func(time.Time) string) {
+	seen := make(map[string]bool)
+	for _, j := range sorted {
+		if len(seen) == n {
+			return
+		}
+
+		p := period(j.Meta.End.UTC())
+		if seen[p] {
+			continue
+		}
+
+		seen[p] = true
+		keep[j.ID] = true
+	}
+}
@@ -0,0 +1,56 @@
+package model
+
+import "sort"
+
+// Sequences is a set of sequence numbers. Since they mostly arrive in order they are kept as
+// sorted, non overlapping ranges of consecutive numbers
+type Sequences [][2]int
+
+// Has reports whether n is in the set
+func (s Sequences) Has(n int) bool {
+	i := sort.Search(len(s), func(i int) bool { return s[i][1] >= n })
+	return i < len(s) && s[i][0] <= n
+}
+
+// Len returns how many numbers are in the set
+func (s Sequences) Len() int {
+	n := 0
+	for _, r := range s {
+		n += r[1] - r[0] + 1
+	}
+	return n
+}
+
+// Add returns the set with n added
+func (s Sequences) Add(n int) Sequences {
+	if s.Has(n) {
+		return s
+	}
+
+	// the first range that ends at or after n-1 is the one n extends or goes in front of
+	i := sort.Search(len(s), func(i int) bool { return s[i][1] >= n-1 })
+	switch {
+	case i < len(s) && s[i][1] == n-1:
+		s[i][1] = n
+		// n may close the gap to the next range
+		if i+1 < len(s) && s[i+1][0] == n+1 {
+			s[i][1] = s[i+1][1]
+			s = append(s[:i+1], s[i+2:]...)
+		}
+	case i < len(s) && s[i][0] == n+1:
+		s[i][0] = n
+	default:
+		s = append(s, [2]int{})
+		copy(s[i+1:], s[i:])
+		s[i] = [2]int{n, n}
+	}
+	return s
+}
+
+// Complete reports whether the set holds every number from 1 to n
+func (s Sequences) Complete(n int) bool {
+	if n <= 0 {
+		return true
+	}
+	return len(s) > 0 && s[0][0] <= 1 && s[0][1] >= n
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSequences(t *testing.T) {
+	assert := assert.New(t)
+
+	var s Sequences
+	assert.Equal(0, s.Len())
+	assert.True(s.Complete(0))
+	assert.False(s.Complete(1))
+	assert.False(s.Has(1))
+
+	for _, n := range []int{3, 1, 7, 5, 3} {
+		s = s.Add(n)
+	}
+	assert.Equal(Sequences{{1, 1}, {3, 3}, {5, 5}, {7, 7}}, s)
+	assert.True(s.Has(5))
+	assert.False(s.Has(4))
+	assert.False(s.Has(8))
+
+	s = s.Add(2)
+	assert.Equal(Sequences{{1, 3}, {5, 5}, {7, 7}}, s)
+	assert.Equal(5, s.Len())
+	assert.True(s.Complete(3))
+	assert.False(s.Complete(5))
+
+	s = s.Add(6)
+	assert.Equal(Sequences{{1, 3}, {5, 7}}, s)
+	s = s.Add(4)
+	assert.Equal(Sequences{{1, 7}}, s)
+	assert.True(s.Complete(7))
+	assert.False(s.Complete(8))
+
+	s = s.Add(9).Add(8)
+	assert.Equal(Sequences{{1, 9}}, s)
+}
@@ -1,6 +1,68 @@
 package model
 
+const (
+	// RoleAdmin can do everything, including managing users
+	RoleAdmin = "admin"
+	// RoleOperator manages agents, job definitions, schedules and jobs
+	RoleOperator = "operator"
+	// RoleReadOnly can view everything but change nothing
+	RoleReadOnly = "readonly"
+	// RoleRestore can view jobs and their files, and start restores
+	RoleRestore = "restore"
+
+	// PermRead allows viewing agents, jobs, files, job definitions and schedules
+	PermRead = "read"
+	// PermRestore allows starting restore jobs
+	PermRestore = "restore"
+	// PermManage allows changing agents, job definitions and schedules, and running and canceling jobs
+	PermManage = "manage"
+	// PermUsers allows managing users
+	PermUsers = "users"
+)
+
+var rolePermissions = map[string][]string{
+	RoleAdmin:    []string{PermRead, PermRestore, PermManage, PermUsers},
+	RoleOperator: []string{PermRead, PermRestore, PermManage},
+	RoleReadOnly: []string{PermRead},
+	RoleRestore:  []string{PermRead, PermRestore},
+}
+
 type User struct {
 	Email    string `json:"email"`
-	Password string `json:"password"`
+	Password string `json:"password,omitempty"`
+	Role     string `json:"role"`
+	// Groups limits the user to agents in at least one of the groups. Empty means all agents
+	Groups []string `json:"groups,omitempty"`
+}
+
+// ValidRole is true if the role is one of the known roles
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Can is true if the user's role grants the permission. Users without a role can't do anything
+func (u User) Can(permission string) bool {
+	for _, p := range rolePermissions[u.Role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccess is true if the agent is in one of the user's groups, or the user isn't limited to any groups
+func (u User) CanAccess(agent Agent) bool {
+	if len(u.Groups) == 0 {
+		return true
+	}
+
+	for _, g := range u.Groups {
+		for _, ag := range agent.Groups {
+			if g == ag {
+				return true
+			}
+		}
+	}
+	return false
 }
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserPermissions(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(ValidRole(RoleOperator))
+	assert.False(ValidRole(""))
+
+	admin := User{Role: RoleAdmin}
+	operator := User{Role: RoleOperator}
+	readOnly := User{Role: RoleReadOnly}
+	restore := User{Role: RoleRestore}
+	none := User{}
+
+	for _, p := range []string{PermRead, PermRestore, PermManage, PermUsers} {
+		assert.True(admin.Can(p))
+		assert.False(none.Can(p))
+	}
+
+	assert.True(operator.Can(PermManage))
+	assert.False(operator.Can(PermUsers))
+
+	assert.True(readOnly.Can(PermRead))
+	assert.False(readOnly.Can(PermRestore))
+
+	assert.True(restore.Can(PermRestore))
+	assert.False(restore.Can(PermManage))
+
+	web := Agent{Groups: []string{"web", "prod"}}
+	db := Agent{Groups: []string{"db"}}
+	ungrouped := Agent{}
+
+	assert.True(admin.CanAccess(web))
+	assert.True(admin.CanAccess(ungrouped))
+
+	scoped := User{Role: RoleRestore, Groups: []string{"web"}}
+	assert.True(scoped.CanAccess(web))
+	assert.False(scoped.CanAccess(db))
+	assert.False(scoped.CanAccess(ungrouped))
+}
@@ -0,0 +1,167 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/sethjback/gobl/engine"
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/modification"
+)
+
+// ErrorInvalidJobDefinition is returned when a job definition can't be run
+const ErrorInvalidJobDefinition = "InvalidJobDefinition"
+
+// option is what validation needs from engine and modification options
+type option struct {
+	name     string
+	typ      string
+	required bool
+}
+
+// Validate checks the job definition can be run with the engines and modifications in caps:
+// the names are known, required options are set and option values have the right type.
+// The error detail names the offending field
+func (jd JobDefinition) Validate(caps Capabilities) error {
+	switch jd.Type {
+	case TypeBackup:
+		if len(jd.Paths) == 0 {
+			return invalidDefinition("paths", "a backup needs at least one path")
+		}
+		for i, p := range jd.Paths {
+			if p.Root == "" {
+				return invalidDefinition(fmt.Sprintf("paths[%d].root", i), "required")
+			}
+		}
+
+	case TypeRestore:
+		if jd.From == nil {
+			return invalidDefinition("from", "a restore needs the engine to restore from")
+		}
+		// files are restored by retrieving them from the engine they were saved to
+		if err := validateEngine(caps, "from", *jd.From, true); err != nil {
+			return err
+		}
+
+	default:
+		return invalidDefinition("type", fmt.Sprintf("must be %s or %s", TypeBackup, TypeRestore))
+	}
+
+	if jd.MaxRuntime < 0 {
+		return invalidDefinition("maxRuntime", "must not be negative")
+	}
+
+	if len(jd.To) == 0 {
+		return invalidDefinition("to", "at least one engine is required")
+	}
+	for i, e := range jd.To {
+		if err := validateEngine(caps, fmt.Sprintf("to[%d]", i), e, jd.Type == TypeBackup); err != nil {
+			return err
+		}
+	}
+
+	for i, m := range jd.Modifications {
+		if err := validateModification(caps, fmt.Sprintf("modifications[%d]", i), m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateEngine(caps Capabilities, field string, d engine.Definition, save bool) error {
+	for _, c := range caps.Engines {
+		if !strings.EqualFold(c.Name, d.Name) {
+			continue
+		}
+
+		opts := c.RestoreOptions
+		if save {
+			if !c.Save {
+				return invalidDefinition(field+".name", d.Name+" can't be used to save")
+			}
+			opts = c.SaveOptions
+		} else if !c.Restore {
+			return invalidDefinition(field+".name", d.Name+" can't be used to restore")
+		}
+
+		var options []option
+		for _, o := range opts {
+			options = append(options, option{name: o.Name, typ: o.Type, required: o.Required})
+		}
+		return validateOptions(field+".options", options, d.Options)
+	}
+
+	return invalidDefinition(field+".name", "unknown engine "+d.Name)
+}
+
+func validateModification(caps Capabilities, field string, d modification.Definition) error {
+	for _, c := range caps.Modifications {
+		if !strings.EqualFold(c.Name, d.Name) {
+			continue
+		}
+
+		var options []option
+		for _, o := range c.Options {
+			options = append(options, option{name: o.Name, typ: o.Type})
+		}
+		return validateOptions(field+".options", options, d.Options)
+	}
+
+	return invalidDefinition(field+".name", "unknown modification "+d.Name)
+}
+
+// validateOptions checks required options are set and values match the option type.
+// Option names are matched regardless of case, the same as the engines configure themselves
+func validateOptions(field string, options []option, values map[string]interface{}) error {
+	for _, o := range options {
+		v, ok := lookupOption(values, o.name)
+		if !ok {
+			if o.required {
+				return invalidDefinition(field+"."+o.name, "required")
+			}
+			continue
+		}
+
+		if !optionTypeMatches(o.typ, v) {
+			return invalidDefinition(field+"."+o.name, "must be a "+o.typ)
+		}
+	}
+	return nil
+}
+
+func lookupOption(values map[string]interface{}, name string) (interface{}, bool) {
+	for k, v := range values {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// optionTypeMatches reports whether v is of the option type. Numbers decoded from json are float64,
+// so those without a fraction count as ints. Types it doesn't know about match anything
+func optionTypeMatches(typ string, v interface{}) bool {
+	switch typ {
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "bool":
+		_, ok := v.(bool)
+		return ok
+	case "int":
+		switch n := v.(type) {
+		case int, int32, int64:
+			return true
+		case float64:
+			return n == math.Trunc(n)
+		}
+		return false
+	}
+	return true
+}
+
+func invalidDefinition(field, problem string) error {
+	return goblerr.New("Invalid job definition", ErrorInvalidJobDefinition, field+": "+problem)
+}
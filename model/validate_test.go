@@ -0,0 +1,106 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/sethjback/gobl/engine"
+	"github.com/sethjback/gobl/goblerr"
+	"github.com/sethjback/gobl/modification"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCapabilities() Capabilities {
+	return Capabilities{
+		Engines: []engine.Capability{
+			engine.Capability{
+				Name: "localfile", Save: true, Restore: true,
+				SaveOptions:    []engine.Option{engine.Option{Name: "savePath", Type: "string", Required: true}},
+				RestoreOptions: []engine.Option{engine.Option{Name: "restorePath", Type: "string", Required: true}, engine.Option{Name: "overwrite", Type: "bool", Required: true}}},
+			engine.Capability{
+				Name: "dedup", Save: true,
+				SaveOptions: []engine.Option{engine.Option{Name: "savePath", Type: "string", Required: true}, engine.Option{Name: "chunkSize", Type: "int"}}},
+		},
+		Modifications: []modification.Capability{
+			modification.Capability{Name: "compress", Options: []modification.Option{modification.Option{Name: "level", Type: "int"}}},
+		},
+	}
+}
+
+func invalidField(err error) string {
+	if gerr, ok := err.(*goblerr.Error); ok && gerr.Code == ErrorInvalidJobDefinition {
+		return gerr.Detail.(string)
+	}
+	return ""
+}
+
+func TestJobDefinitionValidate(t *testing.T) {
+	assert := assert.New(t)
+	caps := testCapabilities()
+
+	backup := JobDefinition{
+		Type:          TypeBackup,
+		Paths:         []Path{Path{Root: "/data"}},
+		To:            []engine.Definition{engine.Definition{Name: "dedup", Options: map[string]interface{}{"SavePath": "/backups", "chunkSize": float64(512)}}},
+		Modifications: []modification.Definition{modification.Definition{Name: "Compress", Options: map[string]interface{}{"level": 9}}},
+	}
+	assert.Nil(backup.Validate(caps))
+
+	jd := backup
+	jd.Paths = nil
+	assert.Equal("paths: a backup needs at least one path", invalidField(jd.Validate(caps)))
+
+	jd = backup
+	jd.Paths = []Path{Path{Root: "/data"}, Path{}}
+	assert.Equal("paths[1].root: required", invalidField(jd.Validate(caps)))
+
+	jd = backup
+	jd.Type = "archive"
+	assert.Equal("type: must be backup or restore", invalidField(jd.Validate(caps)))
+
+	jd = backup
+	jd.MaxRuntime = -1
+	assert.Equal("maxRuntime: must not be negative", invalidField(jd.Validate(caps)))
+
+	jd = backup
+	jd.To = nil
+	assert.Equal("to: at least one engine is required", invalidField(jd.Validate(caps)))
+
+	jd = backup
+	jd.To = []engine.Definition{backup.To[0], engine.Definition{Name: "ftp"}}
+	assert.Equal("to[1].name: unknown engine ftp", invalidField(jd.Validate(caps)))
+
+	jd = backup
+	jd.To = []engine.Definition{engine.Definition{Name: "dedup", Options: map[string]interface{}{}}}
+	assert.Equal("to[0].options.savePath: required", invalidField(jd.Validate(caps)))
+
+	jd = backup
+	jd.To = []engine.Definition{engine.Definition{Name: "dedup", Options: map[string]interface{}{"savePath": "/backups", "chunkSize": 1.5}}}
+	assert.Equal("to[0].options.chunkSize: must be a int", invalidField(jd.Validate(caps)))
+
+	jd = backup
+	jd.Modifications = []modification.Definition{modification.Definition{Name: "compress", Options: map[string]interface{}{"level": "9"}}}
+	assert.Equal("modifications[0].options.level: must be a int", invalidField(jd.Validate(caps)))
+
+	jd = backup
+	jd.Modifications = []modification.Definition{modification.Definition{Name: "rot13"}}
+	assert.Equal("modifications[0].name: unknown modification rot13", invalidField(jd.Validate(caps)))
+
+	restore := JobDefinition{
+		Type: TypeRestore,
+		From: &engine.Definition{Name: "localfile", Options: map[string]interface{}{"savePath": "/backups"}},
+		To:   []engine.Definition{engine.Definition{Name: "localfile", Options: map[string]interface{}{"restorePath": "/restore", "overwrite": true}}},
+	}
+	assert.Nil(restore.Validate(caps))
+
+	jd = restore
+	jd.From = nil
+	assert.Equal("from: a restore needs the engine to restore from", invalidField(jd.Validate(caps)))
+
+	jd = restore
+	jd.To = []engine.Definition{engine.Definition{Name: "dedup", Options: map[string]interface{}{"savePath": "/backups"}}}
+	assert.Equal("to[0].name: dedup can't be used to restore", invalidField(jd.Validate(caps)))
+
+	jd = restore
+	jd.To = []engine.Definition{engine.Definition{Name: "localfile", Options: map[string]interface{}{"restorePath": "/restore", "overwrite": "yes"}}}
+	assert.Equal("to[0].options.overwrite: must be a bool", invalidField(jd.Validate(caps)))
+}
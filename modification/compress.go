@@ -1,19 +1,95 @@
 package modification
 
 import (
+	"bytes"
+	"compress/bzip2"
 	"compress/gzip"
+	"fmt"
 	"io"
+	"path/filepath"
+	"strings"
 
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4"
 	"github.com/sethjback/gobl/goblerr"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
 )
 
 const NameCompress = "compress"
 
+// Compression methods
+const (
+	MethodGzip  = "gzip"
+	MethodZstd  = "zstd"
+	MethodXz    = "xz"
+	MethodLzma  = "lzma"
+	MethodLz4   = "lz4"
+	MethodBzip2 = "bzip2"
+	// MethodNone passes the data through untouched. It is what is recorded for already compressed files
+	MethodNone = "none"
+)
+
+// codec describes a compression method
+type codec struct {
+	// minLevel and maxLevel bound the level option
+	minLevel, maxLevel int
+	defaultLevel       int
+	// encode is false for methods that can only be restored
+	encode bool
+}
+
+var codecs = map[string]codec{
+	MethodGzip:  codec{minLevel: 1, maxLevel: 9, defaultLevel: 5, encode: true},
+	MethodZstd:  codec{minLevel: 1, maxLevel: 22, defaultLevel: 3, encode: true},
+	MethodXz:    codec{minLevel: 0, maxLevel: 9, defaultLevel: 6, encode: true},
+	MethodLzma:  codec{minLevel: 0, maxLevel: 9, defaultLevel: 6, encode: true},
+	MethodLz4:   codec{minLevel: 0, maxLevel: 9, defaultLevel: 0, encode: true},
+	MethodBzip2: codec{encode: false},
+	MethodNone:  codec{encode: true},
+}
+
+// xzDictCaps are the dictionary sizes for xz and lzma levels, the same as the xz presets
+var xzDictCaps = []int{256 << 10, 1 << 20, 2 << 20, 4 << 20, 4 << 20, 8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20}
+
+// compressedExtensions are file types that are already compressed
+var compressedExtensions = map[string]bool{
+	".7z": true, ".apk": true, ".avi": true, ".br": true, ".bz2": true, ".docx": true, ".flac": true, ".gif": true,
+	".gz": true, ".heic": true, ".jar": true, ".jpeg": true, ".jpg": true, ".lz4": true, ".lzma": true, ".m4a": true,
+	".m4v": true, ".mkv": true, ".mov": true, ".mp3": true, ".mp4": true, ".ogg": true, ".png": true, ".pptx": true,
+	".rar": true, ".tgz": true, ".webm": true, ".webp": true, ".xlsx": true, ".xz": true, ".zip": true, ".zst": true,
+}
+
+// compressedMagic are the leading bytes of already compressed formats
+var compressedMagic = [][]byte{
+	{0x1f, 0x8b},                       // gzip
+	[]byte("BZh"),                      // bzip2
+	{0xfd, '7', 'z', 'X', 'Z', 0x00},   // xz
+	{0x28, 0xb5, 0x2f, 0xfd},           // zstd
+	{0x04, 0x22, 0x4d, 0x18},           // lz4
+	{'P', 'K', 0x03, 0x04},             // zip, and the office and java formats built on it
+	{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}, // 7z
+	[]byte("Rar!"),                     // rar
+	{0x89, 'P', 'N', 'G'},              // png
+	{0xff, 0xd8, 0xff},                 // jpeg
+	[]byte("GIF8"),                     // gif
+	{0x1a, 0x45, 0xdf, 0xa3},           // matroska and webm
+	[]byte("ID3"),                      // mp3
+	[]byte("OggS"),                     // ogg
+	[]byte("fLaC"),                     // flac
+}
+
 // Compress modification takes a file and compresses it
 type Compress struct {
 	method    string
 	level     int
 	direction int
+	// skipCompressed passes through files that are already compressed
+	skipCompressed bool
+}
+
+func init() {
+	Register(NameCompress, func() Modifyer { return &Compress{} })
 }
 
 func (c *Compress) Process(input io.Reader, errc chan<- error) io.Reader {
@@ -25,6 +101,10 @@ func (c *Compress) Process(input io.Reader, errc chan<- error) io.Reader {
 
 // Encode compresses the file using the defined method and options
 func encode(method string, level int, input io.Reader, errc chan<- error) io.Reader {
+	if method == MethodNone {
+		return input
+	}
+
 	r, w := io.Pipe()
 
 	go func() {
@@ -39,8 +119,18 @@ func encode(method string, level int, input io.Reader, errc chan<- error) io.Rea
 			errc <- err
 			return
 		}
-		cw.Flush()
-		cw.Close()
+
+		// gzip has always been flushed before closing, keep its output the same
+		if f, ok := cw.(interface{ Flush() error }); ok && method == MethodGzip {
+			if err := f.Flush(); err != nil {
+				errc <- err
+				return
+			}
+		}
+
+		if err := cw.Close(); err != nil {
+			errc <- err
+		}
 	}()
 
 	return r
@@ -57,18 +147,58 @@ func decode(method string, reader io.Reader, errc chan<- error) io.Reader {
 
 func getDecoder(method string, stream io.Reader) (io.Reader, error) {
 	switch method {
-	case "gzip":
+	case MethodGzip:
 		return gzip.NewReader(stream)
+	case MethodZstd:
+		// a single goroutine decodes synchronously, so nothing is left running if the stream isn't read to the end
+		d, err := zstd.NewReader(stream, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return &zstdReader{d}, nil
+	case MethodXz:
+		return xz.NewReader(stream)
+	case MethodLzma:
+		return lzma.NewReader(stream)
+	case MethodLz4:
+		return lz4.NewReader(stream), nil
+	case MethodBzip2:
+		return bzip2.NewReader(stream), nil
+	case MethodNone:
+		return stream, nil
 	}
-	return nil, goblerr.New("unrecognized decoder", ErrorInvalidOptionValue, nil)
+	return nil, goblerr.New("unrecognized decoder", ErrorInvalidOptionValue, method)
 }
 
-func getEncoder(method string, level int, stream io.Writer) (*gzip.Writer, error) {
+func getEncoder(method string, level int, stream io.Writer) (io.WriteCloser, error) {
 	switch method {
-	case "gzip":
+	case MethodGzip:
 		return gzip.NewWriterLevel(stream, level)
+	case MethodZstd:
+		return zstd.NewWriter(stream, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	case MethodXz:
+		return xz.WriterConfig{DictCap: xzDictCaps[level]}.NewWriter(stream)
+	case MethodLzma:
+		return lzma.WriterConfig{DictCap: xzDictCaps[level]}.NewWriter(stream)
+	case MethodLz4:
+		w := lz4.NewWriter(stream)
+		w.Header.CompressionLevel = level
+		return w, nil
+	}
+	return nil, goblerr.New("unrecognized encoder", ErrorInvalidOptionValue, method)
+}
+
+// zstdReader releases the decoder once the stream is done
+type zstdReader struct {
+	d *zstd.Decoder
+}
+
+func (z *zstdReader) Read(p []byte) (int, error) {
+	n, err := z.d.Read(p)
+	if err != nil {
+		z.d.Close()
 	}
-	return nil, goblerr.New("unrecognized encoder", ErrorInvalidOptionValue, nil)
+	return n, err
 }
 
 // Name returns the modifications's name
@@ -81,15 +211,21 @@ func (c *Compress) Options() []Option {
 	return []Option{
 		Option{
 			Name:        "method",
-			Description: "compression method to use",
+			Description: "compression method to use: gzip, zstd, xz, lzma, lz4 or none. bzip2 can only be restored",
 			Type:        "string",
-			Default:     "gzip",
+			Default:     MethodGzip,
 		},
 		Option{
 			Name:        "level",
-			Description: "compression level to use",
+			Description: "compression level to use. gzip 1-9, zstd 1-22, xz and lzma 0-9, lz4 0-9 (0 is fastest). Defaults to 5 for gzip, 3 for zstd, 6 for xz and lzma, and 0 for lz4",
 			Type:        "int",
 			Default:     5,
+		},
+		Option{
+			Name:        "skipCompressed",
+			Description: "store files that are already compressed, like images, video and archives, without compressing them again",
+			Type:        "bool",
+			Default:     false,
 		}}
 }
 
@@ -101,32 +237,139 @@ func (c *Compress) Direction(d int) {
 func (c *Compress) Configure(options map[string]interface{}) error {
 	//defaults
 
-	c.level = 5
-	c.method = "gzip"
+	c.method = MethodGzip
+	c.skipCompressed = false
+	level := -1
 	for k, v := range options {
 		switch k {
 		case "method":
 			valS, ok := v.(string)
 			if !ok {
-				return goblerr.New("method must be string", ErrorInvalidOptionValue, "acceptible options are: gzip")
+				return goblerr.New("method must be string", ErrorInvalidOptionValue, "acceptible options are: "+methodList())
 			}
 
-			if valS != "gzip" {
-				return goblerr.New("method not supported", ErrorInvalidOptionValue, "acceptible options are: gzip")
+			valS = strings.ToLower(valS)
+			if _, ok := codecs[valS]; !ok {
+				return goblerr.New("method not supported", ErrorInvalidOptionValue, "acceptible options are: "+methodList())
 			}
 
 			c.method = valS
 		case "level":
-			valI, ok := v.(int)
-			if !ok {
-				return goblerr.New("level must be int", ErrorInvalidOptionValue, "level must be between 1 and 9")
+			switch valN := v.(type) {
+			case int:
+				level = valN
+			case float64:
+				level = int(valN)
+			default:
+				return goblerr.New("level must be int", ErrorInvalidOptionValue, "level must be a number")
 			}
-			if valI < 1 || valI > 9 {
-				return goblerr.New("level invalid", ErrorInvalidOptionValue, "level must be between 1 and 9")
+		case "skipCompressed":
+			valB, ok := v.(bool)
+			if !ok {
+				return goblerr.New("skipCompressed must be bool", ErrorInvalidOptionValue, "skipCompressed must be true or false")
 			}
-			c.level = valI
+			c.skipCompressed = valB
 		}
 	}
 
+	cd := codecs[c.method]
+	if level == -1 {
+		c.level = cd.defaultLevel
+		return nil
+	}
+
+	if !cd.encode {
+		return goblerr.New("level invalid", ErrorInvalidOptionValue, c.method+" does not take a level")
+	}
+
+	if level < cd.minLevel || level > cd.maxLevel {
+		return goblerr.New("level invalid", ErrorInvalidOptionValue, fmt.Sprintf("%s level must be between %d and %d", c.method, cd.minLevel, cd.maxLevel))
+	}
+	c.level = level
+
 	return nil
 }
+
+// Validate checks the method can be used in the configured direction
+func (c *Compress) Validate() error {
+	if c.direction == Forward && !codecs[c.method].encode {
+		return goblerr.New("method not supported", ErrorInvalidOptionValue, c.method+" can only be used to restore")
+	}
+	return nil
+}
+
+// methodFor returns the method the compressor uses for the file, given its path and first bytes
+func (c *Compress) methodFor(path string, header []byte) string {
+	if c.skipCompressed && IsCompressed(path, header) {
+		return MethodNone
+	}
+	return c.method
+}
+
+// IsCompressed reports whether the file is already compressed, going by its extension or its first bytes
+func IsCompressed(path string, header []byte) bool {
+	if compressedExtensions[strings.ToLower(filepath.Ext(path))] {
+		return true
+	}
+
+	for _, m := range compressedMagic {
+		if bytes.HasPrefix(header, m) {
+			return true
+		}
+	}
+
+	// mp4, mov and heic have the file type box after the box size
+	if len(header) >= 8 && bytes.Equal(header[4:8], []byte("ftyp")) {
+		return true
+	}
+
+	// webp
+	if len(header) >= 12 && bytes.Equal(header[:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WEBP")) {
+		return true
+	}
+
+	return false
+}
+
+func methodList() string {
+	return strings.Join([]string{MethodGzip, MethodZstd, MethodXz, MethodLzma, MethodLz4, MethodBzip2, MethodNone}, ", ")
+}
+
+// compressApplied returns what is recorded in the signature for the method.
+// gzip is just "compress", which is what was recorded before there was a choice of method
+func compressApplied(method string) string {
+	if method == MethodGzip {
+		return NameCompress
+	}
+	return NameCompress + ":" + method
+}
+
+// compressMethod returns the method recorded by compressApplied, and false if applied isn't a compress record
+func compressMethod(applied string) (string, bool) {
+	if applied == NameCompress {
+		return MethodGzip, true
+	}
+	if strings.HasPrefix(applied, NameCompress+":") {
+		return strings.TrimPrefix(applied, NameCompress+":"), true
+	}
+	return "", false
+}
+
+// withMethod returns a copy of the compress definition using method, and without skipCompressed
+func withMethod(d Definition, method string) Definition {
+	options := map[string]interface{}{"method": method}
+	for k, v := range d.Options {
+		if k != "method" && k != "skipCompressed" {
+			options[k] = v
+		}
+	}
+	// the level only applies to the method it was set for
+	configured := MethodGzip
+	if m, ok := d.Options["method"].(string); ok {
+		configured = strings.ToLower(m)
+	}
+	if configured != method {
+		delete(options, "level")
+	}
+	return Definition{Name: d.Name, Options: options}
+}
@@ -21,33 +21,33 @@ func TestCompressConfigure(t *testing.T) {
 
 	err = c.Configure(map[string]interface{}{"method": "zlib"})
 	if assert.NotNil(err) {
-		gerr, ok := err.(goblerr.Error)
+		gerr, ok := err.(*goblerr.Error)
 		if assert.True(ok) {
-			assert.Equal(ErrorInvalidOptionValue, gerr.Code())
+			assert.Equal(ErrorInvalidOptionValue, gerr.Code)
 		}
 	}
 
 	err = c.Configure(map[string]interface{}{"method": 3})
 	if assert.NotNil(err) {
-		gerr, ok := err.(goblerr.Error)
+		gerr, ok := err.(*goblerr.Error)
 		if assert.True(ok) {
-			assert.Equal(ErrorInvalidOptionValue, gerr.Code())
+			assert.Equal(ErrorInvalidOptionValue, gerr.Code)
 		}
 	}
 
 	err = c.Configure(map[string]interface{}{"level": "10"})
 	if assert.NotNil(err) {
-		gerr, ok := err.(goblerr.Error)
+		gerr, ok := err.(*goblerr.Error)
 		if assert.True(ok) {
-			assert.Equal(ErrorInvalidOptionValue, gerr.Code())
+			assert.Equal(ErrorInvalidOptionValue, gerr.Code)
 		}
 	}
 
 	err = c.Configure(map[string]interface{}{"level": 23})
 	if assert.NotNil(err) {
-		gerr, ok := err.(goblerr.Error)
+		gerr, ok := err.(*goblerr.Error)
 		if assert.True(ok) {
-			assert.Equal(ErrorInvalidOptionValue, gerr.Code())
+			assert.Equal(ErrorInvalidOptionValue, gerr.Code)
 		}
 	}
 
@@ -77,3 +77,85 @@ func TestCompress(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal(restored, toCompress)
 }
+
+func TestCompressMethods(t *testing.T) {
+	assert := assert.New(t)
+
+	toCompress := bytes.Repeat([]byte("this is the string to test compress "), 100)
+
+	for _, method := range []string{MethodGzip, MethodZstd, MethodXz, MethodLzma, MethodLz4, MethodNone} {
+		c := &Compress{}
+		if !assert.Nil(c.Configure(map[string]interface{}{"method": method}), method) {
+			continue
+		}
+		c.Direction(Forward)
+
+		errc := make(chan error, 2)
+		compressed, err := ioutil.ReadAll(c.Process(bytes.NewReader(toCompress), errc))
+		assert.Nil(err, method)
+		if method == MethodNone {
+			assert.Equal(toCompress, compressed)
+		} else {
+			assert.True(len(compressed) < len(toCompress), method)
+		}
+
+		c.Direction(Backward)
+		restored, err := ioutil.ReadAll(c.Process(bytes.NewReader(compressed), errc))
+		assert.Nil(err, method)
+		assert.Equal(toCompress, restored, method)
+	}
+}
+
+func TestCompressLevels(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &Compress{}
+
+	err := c.Configure(map[string]interface{}{"method": "ZSTD"})
+	assert.Nil(err)
+	assert.Equal(MethodZstd, c.method)
+	assert.Equal(3, c.level)
+
+	err = c.Configure(map[string]interface{}{"method": "zstd", "level": 22})
+	assert.Nil(err)
+	assert.Equal(22, c.level)
+
+	// levels decoded from json are float64
+	err = c.Configure(map[string]interface{}{"method": "xz", "level": float64(0)})
+	assert.Nil(err)
+	assert.Equal(0, c.level)
+
+	err = c.Configure(map[string]interface{}{"method": "gzip", "level": 10})
+	if assert.NotNil(err) {
+		gerr, ok := err.(*goblerr.Error)
+		if assert.True(ok) {
+			assert.Equal(ErrorInvalidOptionValue, gerr.Code)
+		}
+	}
+
+	err = c.Configure(map[string]interface{}{"method": "bzip2", "level": 1})
+	assert.NotNil(err)
+
+	err = c.Configure(map[string]interface{}{"skipCompressed": "yes"})
+	assert.NotNil(err)
+
+	// bzip2 can only be decoded
+	_, err = Build([]Definition{{Name: NameCompress, Options: map[string]interface{}{"method": "bzip2"}}}, Forward)
+	assert.NotNil(err)
+	_, err = Build([]Definition{{Name: NameCompress, Options: map[string]interface{}{"method": "bzip2"}}}, Backward)
+	assert.Nil(err)
+}
+
+func TestIsCompressed(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(IsCompressed("/photos/IMG_1.JPG", nil))
+	assert.True(IsCompressed("/backups/db.tar.gz", nil))
+	assert.True(IsCompressed("/data/noext", []byte{0x1f, 0x8b, 0x08, 0x00}))
+	assert.True(IsCompressed("/data/noext", []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}))
+	assert.True(IsCompressed("/data/clip", []byte("\x00\x00\x00\x18ftypmp42")))
+	assert.True(IsCompressed("/data/image", []byte("RIFF\x00\x00\x00\x00WEBPVP8 ")))
+
+	assert.False(IsCompressed("/docs/notes.txt", []byte("some plain text")))
+	assert.False(IsCompressed("/docs/empty", nil))
+}
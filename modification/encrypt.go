@@ -0,0 +1,393 @@
+package modification
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/sethjback/gobl/goblerr"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	NameEncrypt = "encrypt"
+
+	ErrorDecrypt = "DecryptionFailed"
+	ErrorEncrypt = "EncryptionFailed"
+
+	encryptMagic = "GOBLENC1"
+	// plaintext bytes per frame
+	encryptChunkSize = 64 * 1024
+	encryptKeySize   = 32
+	encryptSaltSize  = 16
+	// nonce is prefix (7) + frame counter (4) + last frame flag (1)
+	encryptPrefixSize = 7
+	encryptHeaderSize = len(encryptMagic) + 1 + encryptSaltSize + encryptPrefixSize
+
+	kdfNone = 0
+	// kdfScrypt streams derive their key from the passphrase with scrypt and the stream's salt.
+	// They are no longer written, as scrypt is too slow to run for every file
+	kdfScrypt = 1
+	// kdfScryptHKDF streams derive their key with HKDF from the stream's salt and the passphrase's scrypt key
+	kdfScryptHKDF = 2
+
+	// scrypt cost parameters for passphrase derived keys
+	scryptN = 32768
+	scryptR = 8
+	scryptP = 1
+
+	// scryptSalt is the salt for the passphrase's scrypt key. Each stream's key still differs, by its own salt
+	scryptSalt = "gobl encrypt passphrase"
+	hkdfInfo   = "gobl encrypt stream key"
+)
+
+// passphraseKeys caches the scrypt key of each passphrase by its hash, as the modification is configured for every file
+var (
+	passphraseKeysM = &sync.Mutex{}
+	passphraseKeys  = make(map[[sha256.Size]byte][]byte)
+)
+
+// Encrypt modification encrypts the stream with AES-256-GCM.
+//
+// The stream is split into frames of at most 64KB, each sealed independently. The nonce for each
+// frame is built from a random per stream prefix, the frame number, and a flag marking the final frame,
+// so reordered, dropped, or truncated frames fail authentication. The stream header is authenticated
+// as additional data on every frame.
+//
+// The key is either read from a key file (32 raw bytes, or 64 hex characters) or derived from
+// a passphrase: scrypt derives a key from the passphrase once, and HKDF derives each stream's key
+// from it and a random salt stored in the header
+type Encrypt struct {
+	key        []byte
+	passphrase []byte
+	// passphraseKey is the passphrase's scrypt key
+	passphraseKey []byte
+	// kdf is how the key of the streams written is derived
+	kdf       byte
+	direction int
+}
+
+func init() {
+	Register(NameEncrypt, func() Modifyer { return &Encrypt{} })
+}
+
+// Process encrypts the stream going forward, and authenticates and decrypts it going backward
+func (e *Encrypt) Process(input io.Reader, errc chan<- error) io.Reader {
+	r, w := io.Pipe()
+
+	go func() {
+		var err error
+		if e.direction == Backward {
+			err = e.decrypt(input, w)
+		} else {
+			err = e.encrypt(input, w)
+		}
+
+		if err != nil {
+			errc <- err
+			w.CloseWithError(err)
+			return
+		}
+		w.Close()
+	}()
+
+	return r
+}
+
+func (e *Encrypt) encrypt(input io.Reader, output io.Writer) error {
+	header := make([]byte, encryptHeaderSize)
+	copy(header, encryptMagic)
+	salt := header[len(encryptMagic)+1 : len(encryptMagic)+1+encryptSaltSize]
+	prefix := header[encryptHeaderSize-encryptPrefixSize:]
+
+	if _, err := rand.Read(header[len(encryptMagic)+1:]); err != nil {
+		return goblerr.New("Unable to generate nonce", ErrorEncrypt, err)
+	}
+
+	header[len(encryptMagic)] = e.kdf
+
+	aead, err := e.aead(header[len(encryptMagic)], salt)
+	if err != nil {
+		return err
+	}
+
+	if _, err := output.Write(header); err != nil {
+		return err
+	}
+
+	// read a frame ahead so we know which one is last
+	current := make([]byte, encryptChunkSize)
+	next := make([]byte, encryptChunkSize)
+	n, err := io.ReadFull(input, current)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	var sealed []byte
+	lenBuf := make([]byte, 4)
+	for counter := uint32(0); ; counter++ {
+		nn, err := io.ReadFull(input, next)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		last := nn == 0
+		sealed = aead.Seal(sealed[:0], encryptNonce(prefix, counter, last), current[:n], header)
+
+		binary.BigEndian.PutUint32(lenBuf, uint32(len(sealed)))
+		if _, err := output.Write(lenBuf); err != nil {
+			return err
+		}
+		if _, err := output.Write(sealed); err != nil {
+			return err
+		}
+
+		if last {
+			return nil
+		}
+
+		if counter == ^uint32(0) {
+			return goblerr.New("Stream too large", ErrorEncrypt, "frame counter overflow")
+		}
+
+		current, next = next, current
+		n = nn
+	}
+}
+
+func (e *Encrypt) decrypt(input io.Reader, output io.Writer) error {
+	header := make([]byte, encryptHeaderSize)
+	if _, err := io.ReadFull(input, header); err != nil {
+		return goblerr.New("Unable to read encryption header", ErrorDecrypt, "stream is truncated or not encrypted")
+	}
+
+	if !bytes.Equal(header[:len(encryptMagic)], []byte(encryptMagic)) {
+		return goblerr.New("Unable to read encryption header", ErrorDecrypt, "stream is not encrypted")
+	}
+
+	salt := header[len(encryptMagic)+1 : len(encryptMagic)+1+encryptSaltSize]
+	prefix := header[encryptHeaderSize-encryptPrefixSize:]
+
+	aead, err := e.aead(header[len(encryptMagic)], salt)
+	if err != nil {
+		return err
+	}
+
+	var plain []byte
+	lenBuf := make([]byte, 4)
+	sealed := make([]byte, encryptChunkSize+aead.Overhead())
+	for counter := uint32(0); ; counter++ {
+		if _, err := io.ReadFull(input, lenBuf); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return goblerr.New("Stream truncated", ErrorDecrypt, "final frame missing")
+			}
+			return err
+		}
+
+		size := binary.BigEndian.Uint32(lenBuf)
+		if size < uint32(aead.Overhead()) || size > uint32(len(sealed)) {
+			return goblerr.New("Invalid frame", ErrorDecrypt, "frame length out of range")
+		}
+
+		if _, err := io.ReadFull(input, sealed[:size]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return goblerr.New("Stream truncated", ErrorDecrypt, "frame is incomplete")
+			}
+			return err
+		}
+
+		last := false
+		plain, err = aead.Open(plain[:0], encryptNonce(prefix, counter, false), sealed[:size], header)
+		if err != nil {
+			plain, err = aead.Open(plain[:0], encryptNonce(prefix, counter, true), sealed[:size], header)
+			if err != nil {
+				return goblerr.New("Authentication failed", ErrorDecrypt, "ciphertext has been modified or the key is wrong")
+			}
+			last = true
+		}
+
+		if _, err := output.Write(plain); err != nil {
+			return err
+		}
+
+		if last {
+			if _, err := io.ReadFull(input, lenBuf[:1]); err != io.EOF {
+				return goblerr.New("Invalid stream", ErrorDecrypt, "unexpected data after final frame")
+			}
+			return nil
+		}
+
+		if counter == ^uint32(0) {
+			return goblerr.New("Invalid stream", ErrorDecrypt, "frame counter overflow")
+		}
+	}
+}
+
+// aead returns the cipher for the stream, deriving the key from the passphrase if needed
+func (e *Encrypt) aead(kdf byte, salt []byte) (cipher.AEAD, error) {
+	key := e.key
+	switch kdf {
+	case kdfNone:
+		if key == nil {
+			return nil, goblerr.New("Key required", ErrorDecrypt, "stream was encrypted with a key file but only a passphrase is configured")
+		}
+	case kdfScrypt:
+		if e.passphrase == nil {
+			return nil, goblerr.New("Passphrase required", ErrorDecrypt, "stream was encrypted with a passphrase but only a key file is configured")
+		}
+		var err error
+		key, err = scrypt.Key(e.passphrase, salt, scryptN, scryptR, scryptP, encryptKeySize)
+		if err != nil {
+			return nil, goblerr.New("Unable to derive key", ErrorEncrypt, err)
+		}
+	case kdfScryptHKDF:
+		if e.passphraseKey == nil {
+			return nil, goblerr.New("Passphrase required", ErrorDecrypt, "stream was encrypted with a passphrase but only a key file is configured")
+		}
+		key = make([]byte, encryptKeySize)
+		if _, err := io.ReadFull(hkdf.New(sha256.New, e.passphraseKey, salt, []byte(hkdfInfo)), key); err != nil {
+			return nil, goblerr.New("Unable to derive key", ErrorEncrypt, err)
+		}
+	default:
+		return nil, goblerr.New("Unknown key derivation", ErrorDecrypt, "unrecognized key derivation in header")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, goblerr.New("Invalid key", ErrorInvalidOptionValue, err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func encryptNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, encryptPrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[encryptPrefixSize:], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// Name returns the modifications's name
+func (e *Encrypt) Name() string {
+	return NameEncrypt
+}
+
+// Options retun a list of possible options
+func (e *Encrypt) Options() []Option {
+	return []Option{
+		Option{
+			Name:        "keyFile",
+			Description: "path to a file containing the 256 bit key, either raw or hex encoded",
+			Type:        "string",
+			Default:     "",
+		},
+		Option{
+			Name:        "passphrase",
+			Description: "passphrase to derive the key from. Used if keyFile is not set",
+			Type:        "string",
+			Default:     "",
+		}}
+}
+
+func (e *Encrypt) Direction(d int) {
+	e.direction = d
+}
+
+// Configure loads the key file or passphrase. One of them is required
+func (e *Encrypt) Configure(options map[string]interface{}) error {
+	e.key = nil
+	e.passphrase = nil
+	e.passphraseKey = nil
+
+	for k, v := range options {
+		switch k {
+		case "keyFile":
+			valS, ok := v.(string)
+			if !ok {
+				return goblerr.New("keyFile must be string", ErrorInvalidOptionValue, nil)
+			}
+
+			key, err := readKeyFile(valS)
+			if err != nil {
+				return err
+			}
+			e.key = key
+		case "passphrase":
+			valS, ok := v.(string)
+			if !ok {
+				return goblerr.New("passphrase must be string", ErrorInvalidOptionValue, nil)
+			}
+			if valS == "" {
+				return goblerr.New("passphrase invalid", ErrorInvalidOptionValue, "passphrase cannot be empty")
+			}
+			e.passphrase = []byte(valS)
+		}
+	}
+
+	if e.key == nil && e.passphrase == nil {
+		return goblerr.New("key required", ErrorInvalidOptionValue, "one of keyFile or passphrase must be provided")
+	}
+
+	e.kdf = kdfNone
+	if e.passphrase != nil {
+		key, err := passphraseKey(e.passphrase)
+		if err != nil {
+			return err
+		}
+		e.passphraseKey = key
+		if e.key == nil {
+			e.kdf = kdfScryptHKDF
+		}
+	}
+
+	return nil
+}
+
+// passphraseKey returns the passphrase's scrypt key, only deriving it the first time
+func passphraseKey(passphrase []byte) ([]byte, error) {
+	h := sha256.Sum256(passphrase)
+
+	passphraseKeysM.Lock()
+	defer passphraseKeysM.Unlock()
+
+	if key, ok := passphraseKeys[h]; ok {
+		return key, nil
+	}
+
+	key, err := scrypt.Key(passphrase, []byte(scryptSalt), scryptN, scryptR, scryptP, encryptKeySize)
+	if err != nil {
+		return nil, goblerr.New("Unable to derive key", ErrorInvalidOptionValue, err)
+	}
+	passphraseKeys[h] = key
+	return key, nil
+}
+
+func readKeyFile(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, goblerr.New("unable to read key file", ErrorInvalidOptionValue, err)
+	}
+
+	if len(b) == encryptKeySize {
+		return b, nil
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(key) != encryptKeySize {
+		return nil, goblerr.New("key file invalid", ErrorInvalidOptionValue, "key file must contain 32 raw bytes or 64 hex characters")
+	}
+
+	return key, nil
+}
@@ -0,0 +1,180 @@
+package modification
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encryptRoundTrip(e *Encrypt, input []byte) ([]byte, error) {
+	errc := make(chan error, 2)
+	e.Direction(Forward)
+	return ioutil.ReadAll(e.Process(bytes.NewReader(input), errc))
+}
+
+func decryptStream(e *Encrypt, input []byte) ([]byte, error) {
+	errc := make(chan error, 2)
+	e.Direction(Backward)
+	out, err := ioutil.ReadAll(e.Process(bytes.NewReader(input), errc))
+
+	select {
+	case cErr := <-errc:
+		return out, cErr
+	default:
+	}
+
+	return out, err
+}
+
+func TestEncryptConfigure(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "gobl-encrypt")
+	if !assert.Nil(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	e := &Encrypt{}
+	assert.NotNil(e.Configure(map[string]interface{}{}))
+	assert.NotNil(e.Configure(map[string]interface{}{"passphrase": 3}))
+	assert.NotNil(e.Configure(map[string]interface{}{"passphrase": ""}))
+	assert.NotNil(e.Configure(map[string]interface{}{"keyFile": filepath.Join(dir, "missing")}))
+
+	short := filepath.Join(dir, "short")
+	assert.Nil(ioutil.WriteFile(short, []byte("abcd"), 0600))
+	assert.NotNil(e.Configure(map[string]interface{}{"keyFile": short}))
+
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	raw := filepath.Join(dir, "raw")
+	assert.Nil(ioutil.WriteFile(raw, key, 0600))
+	if assert.Nil(e.Configure(map[string]interface{}{"keyFile": raw})) {
+		assert.Equal(key, e.key)
+	}
+
+	hexed := filepath.Join(dir, "hex")
+	assert.Nil(ioutil.WriteFile(hexed, []byte(hex.EncodeToString(key)+"\n"), 0600))
+	if assert.Nil(e.Configure(map[string]interface{}{"keyFile": hexed})) {
+		assert.Equal(key, e.key)
+	}
+
+	assert.Nil(e.Configure(map[string]interface{}{"passphrase": "secret"}))
+	assert.Nil(e.key)
+	assert.Equal([]byte("secret"), e.passphrase)
+}
+
+func TestEncrypt(t *testing.T) {
+	assert := assert.New(t)
+
+	e := &Encrypt{key: make([]byte, 32)}
+	rand.Read(e.key)
+
+	for _, size := range []int{0, 10, encryptChunkSize, encryptChunkSize*2 + 100} {
+		input := make([]byte, size)
+		rand.Read(input)
+
+		encrypted, err := encryptRoundTrip(e, input)
+		if !assert.Nil(err) {
+			return
+		}
+		assert.False(bytes.Contains(encrypted, input) && size > 0)
+
+		decrypted, err := decryptStream(e, encrypted)
+		assert.Nil(err)
+		assert.Equal(input, decrypted)
+	}
+
+	input := make([]byte, encryptChunkSize*2+100)
+	rand.Read(input)
+	encrypted, err := encryptRoundTrip(e, input)
+	if !assert.Nil(err) {
+		return
+	}
+
+	// flipped bit in the last frame
+	tampered := append([]byte{}, encrypted...)
+	tampered[len(tampered)-5] ^= 1
+	_, err = decryptStream(e, tampered)
+	assert.NotNil(err)
+
+	// tampered header
+	tampered = append([]byte{}, encrypted...)
+	tampered[len(encryptMagic)+2] ^= 1
+	out, err := decryptStream(e, tampered)
+	assert.NotNil(err)
+	assert.Empty(out)
+
+	// truncated on a frame boundary: everything read is authentic, but the final frame is missing
+	frame := 4 + encryptChunkSize + 16
+	_, err = decryptStream(e, encrypted[:encryptHeaderSize+frame])
+	assert.NotNil(err)
+
+	// truncated mid frame
+	_, err = decryptStream(e, encrypted[:len(encrypted)-10])
+	assert.NotNil(err)
+
+	// trailing data
+	_, err = decryptStream(e, append(append([]byte{}, encrypted...), 0))
+	assert.NotNil(err)
+
+	// wrong key
+	other := &Encrypt{key: make([]byte, 32)}
+	_, err = decryptStream(other, encrypted)
+	assert.NotNil(err)
+
+	// not encrypted
+	_, err = decryptStream(e, input)
+	assert.NotNil(err)
+}
+
+func TestEncryptPassphrase(t *testing.T) {
+	assert := assert.New(t)
+
+	e := &Encrypt{}
+	assert.Nil(e.Configure(map[string]interface{}{"passphrase": "correct horse battery staple"}))
+
+	input := []byte("this is the string to test encrypt")
+	encrypted, err := encryptRoundTrip(e, input)
+	if !assert.Nil(err) {
+		return
+	}
+
+	decrypted, err := decryptStream(e, encrypted)
+	assert.Nil(err)
+	assert.Equal(input, decrypted)
+
+	wrong := &Encrypt{}
+	assert.Nil(wrong.Configure(map[string]interface{}{"passphrase": "incorrect horse"}))
+	_, err = decryptStream(wrong, encrypted)
+	assert.NotNil(err)
+
+	keyOnly := &Encrypt{key: make([]byte, 32)}
+	_, err = decryptStream(keyOnly, encrypted)
+	assert.NotNil(err)
+
+	// each stream has its own key
+	again, err := encryptRoundTrip(e, input)
+	if assert.Nil(err) {
+		assert.NotEqual(encrypted[encryptHeaderSize:], again[encryptHeaderSize:])
+	}
+
+	// streams keyed with scrypt alone can still be decrypted
+	e.kdf = kdfScrypt
+	legacy, err := encryptRoundTrip(e, input)
+	if assert.Nil(err) {
+		assert.Equal(byte(kdfScrypt), legacy[len(encryptMagic)])
+		fresh := &Encrypt{}
+		assert.Nil(fresh.Configure(map[string]interface{}{"passphrase": "correct horse battery staple"}))
+		decrypted, err = decryptStream(fresh, legacy)
+		assert.Nil(err)
+		assert.Equal(input, decrypted)
+	}
+}
@@ -3,8 +3,6 @@ package modification
 import (
 	"io"
 	"strings"
-
-	"github.com/sethjback/gobl/goblerr"
 )
 
 const (
@@ -50,6 +48,12 @@ type Modifyer interface {
 	Direction(direction int)
 }
 
+// Validator is an optional interface for modifyers that can only check their options once they know the direction.
+// Build calls Validate after Configure and Direction
+type Validator interface {
+	Validate() error
+}
+
 // Pipeline is used to chain individual modifications together
 type Pipe struct {
 	// Head of the pipe, e.g. the file stream of the file to be modified
@@ -71,40 +75,61 @@ func Pipeline(head io.Reader, mods ...Modifyer) *Pipe {
 	return &Pipe{head, next, errc}
 }
 
-// Build takes defitions and configures the modifyers
-// Build always reqiures the definitions to be passed in the same order:
-// if the direction is forward, the modifications will be returned in this order
-// if direction is backward, the modifications will be reversed
-// If a modifyer is not recognized, an error will be returned
-func Build(m []Definition, direction int) ([]Modifyer, error) {
-	var mods []Modifyer
-	for _, modType := range m {
-		switch strings.ToLower(modType.Name) {
-		case NameCompress:
-			compress := &Compress{}
+// ForFile returns the modifications to apply to a single file, given its path and first bytes.
+// Compress with skipCompressed set becomes "none" for files that are already compressed, as long as
+// it is the first modification and so sees the file as it is on disk
+func ForFile(defs []Definition, path string, header []byte) ([]Definition, error) {
+	resolved := make([]Definition, len(defs))
+	for i, d := range defs {
+		if strings.ToLower(d.Name) != NameCompress {
+			resolved[i] = d
+			continue
+		}
 
-			if err := compress.Configure(modType.Options); err != nil {
-				return nil, err
-			}
+		c := &Compress{}
+		if err := c.Configure(d.Options); err != nil {
+			return nil, err
+		}
 
-			compress.Direction(direction)
+		method := c.method
+		if i == 0 {
+			method = c.methodFor(path, header)
+		}
+		resolved[i] = withMethod(d, method)
+	}
 
-			mods = append(mods, compress)
+	return resolved, nil
+}
 
-		default:
-			return nil, goblerr.New("Invalid modifyer", ErrorUnrecognizedModifyer, "I don't understand modifyer type: "+modType.Name)
-		}
+// Applied returns what is recorded in a file's signature for the modification.
+// Compress methods other than gzip are recorded along with the name, e.g. "compress:zstd",
+// so a restore can decode each file the way it was actually stored
+func Applied(d Definition) string {
+	if strings.ToLower(d.Name) != NameCompress {
+		return d.Name
+	}
 
+	method := MethodGzip
+	if m, ok := d.Options["method"].(string); ok {
+		method = strings.ToLower(m)
 	}
-	if direction == Backward {
-		for i, j := 0, len(mods)-1; i < j; i, j = i+1, j-1 {
-			mods[i], mods[j] = mods[j], mods[i]
+	return compressApplied(method)
+}
+
+// FromSignature returns the modifications to undo for a file, using the compress method recorded
+// in its signature rather than the one in the definitions
+func FromSignature(defs []Definition, applied []string) []Definition {
+	resolved := make([]Definition, len(defs))
+	for i, d := range defs {
+		resolved[i] = d
+		if strings.ToLower(d.Name) != NameCompress || i >= len(applied) {
+			continue
+		}
+
+		if method, ok := compressMethod(applied[i]); ok {
+			resolved[i] = withMethod(d, method)
 		}
 	}
-	return mods, nil
-}
 
-// Available retuns the list of available modifiers for an agent
-func Available() []Modifyer {
-	return []Modifyer{&Compress{}}
+	return resolved
 }
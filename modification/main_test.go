@@ -81,3 +81,60 @@ func TestPipe(t *testing.T) {
 
 	assert.NotEqual(fOut, bOut)
 }
+
+func TestForFile(t *testing.T) {
+	assert := assert.New(t)
+
+	defs := []Definition{
+		{Name: NameCompress, Options: map[string]interface{}{"method": "zstd", "level": 9, "skipCompressed": true}},
+		{Name: NameEncrypt},
+	}
+
+	resolved, err := ForFile(defs, "/docs/notes.txt", []byte("plain text"))
+	assert.Nil(err)
+	assert.Equal("zstd", resolved[0].Options["method"])
+	assert.Equal(9, resolved[0].Options["level"])
+	assert.Equal("compress:zstd", Applied(resolved[0]))
+	assert.Equal(NameEncrypt, Applied(resolved[1]))
+
+	resolved, err = ForFile(defs, "/photos/img.jpg", nil)
+	assert.Nil(err)
+	assert.Equal(MethodNone, resolved[0].Options["method"])
+	assert.Nil(resolved[0].Options["level"])
+	assert.Equal("compress:none", Applied(resolved[0]))
+
+	// only the first modification sees the file as it is on disk
+	resolved, err = ForFile([]Definition{defs[1], defs[0]}, "/photos/img.jpg", nil)
+	assert.Nil(err)
+	assert.Equal("zstd", resolved[1].Options["method"])
+
+	_, err = ForFile([]Definition{{Name: NameCompress, Options: map[string]interface{}{"method": "zlib"}}}, "/a", nil)
+	assert.NotNil(err)
+
+	// gzip is recorded the way it always has been
+	assert.Equal(NameCompress, Applied(Definition{Name: NameCompress}))
+}
+
+func TestFromSignature(t *testing.T) {
+	assert := assert.New(t)
+
+	defs := []Definition{{Name: NameCompress, Options: map[string]interface{}{"method": "zstd", "level": 9, "skipCompressed": true}}}
+
+	resolved := FromSignature(defs, []string{"compress:none"})
+	assert.Equal(MethodNone, resolved[0].Options["method"])
+	_, err := Build(resolved, Backward)
+	assert.Nil(err)
+
+	// files stored before the method was recorded were gzipped
+	resolved = FromSignature(defs, []string{NameCompress})
+	assert.Equal(MethodGzip, resolved[0].Options["method"])
+	assert.Nil(resolved[0].Options["level"])
+	_, err = Build(resolved, Backward)
+	assert.Nil(err)
+
+	resolved = FromSignature(defs, []string{"compress:zstd"})
+	assert.Equal(9, resolved[0].Options["level"])
+
+	resolved = FromSignature(defs, nil)
+	assert.Equal(defs, resolved)
+}
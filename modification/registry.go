@@ -0,0 +1,120 @@
+package modification
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sethjback/gobl/goblerr"
+)
+
+// Capability describes a registered modifyer and its options
+type Capability struct {
+	Name    string   `json:"name"`
+	Options []Option `json:"options"`
+}
+
+// Factory returns a new, unconfigured modifyer
+type Factory func() Modifyer
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a modifyer available to jobs under name. Modifyers register themselves from an init function,
+// so modifyers in other packages are available once the package is imported.
+// Register panics if the name is already taken or factory is nil
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	name = strings.ToLower(name)
+	if factory == nil {
+		panic("modification: Register factory is nil for " + name)
+	}
+	if _, ok := registry[name]; ok {
+		panic("modification: Register called twice for " + name)
+	}
+	registry[name] = factory
+}
+
+// newModifyer returns a new instance of the registered modifyer
+func newModifyer(name string) (Modifyer, bool) {
+	registryMu.RLock()
+	factory, ok := registry[strings.ToLower(name)]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+	return factory(), true
+}
+
+// Build takes defitions and configures the modifyers
+// Build always reqiures the definitions to be passed in the same order:
+// if the direction is forward, the modifications will be returned in this order
+// if direction is backward, the modifications will be reversed
+// If a modifyer is not recognized, an error will be returned
+func Build(m []Definition, direction int) ([]Modifyer, error) {
+	var mods []Modifyer
+	for _, modType := range m {
+		mod, ok := newModifyer(modType.Name)
+		if !ok {
+			return nil, goblerr.New("Invalid modifyer", ErrorUnrecognizedModifyer, "I don't understand modifyer type: "+modType.Name)
+		}
+
+		if err := mod.Configure(modType.Options); err != nil {
+			return nil, err
+		}
+
+		mod.Direction(direction)
+
+		if v, ok := mod.(Validator); ok {
+			if err := v.Validate(); err != nil {
+				return nil, err
+			}
+		}
+
+		mods = append(mods, mod)
+	}
+	if direction == Backward {
+		for i, j := 0, len(mods)-1; i < j; i, j = i+1, j-1 {
+			mods[i], mods[j] = mods[j], mods[i]
+		}
+	}
+	return mods, nil
+}
+
+// registered returns the registered modifyer names, sorted
+func registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Available retuns the list of available modifiers for an agent, sorted by name
+func Available() []Modifyer {
+	var mods []Modifyer
+	for _, name := range registered() {
+		mod, _ := newModifyer(name)
+		mods = append(mods, mod)
+	}
+	return mods
+}
+
+// Capabilities describes every registered modifyer, sorted by name
+func Capabilities() []Capability {
+	caps := []Capability{}
+	for _, name := range registered() {
+		mod, _ := newModifyer(name)
+		caps = append(caps, Capability{Name: name, Options: mod.Options()})
+	}
+	return caps
+}
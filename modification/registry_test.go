@@ -0,0 +1,67 @@
+package modification
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type passthrough struct {
+	configured map[string]interface{}
+}
+
+func (p *passthrough) Process(input io.Reader, errc chan<- error) io.Reader { return input }
+func (p *passthrough) Name() string                                         { return "passthrough" }
+func (p *passthrough) Options() []Option                                    { return nil }
+func (p *passthrough) Direction(direction int)                              {}
+func (p *passthrough) Configure(options map[string]interface{}) error {
+	p.configured = options
+	return nil
+}
+func (p *passthrough) Validate() error {
+	if p.configured["invalid"] == true {
+		return errors.New("invalid")
+	}
+	return nil
+}
+
+func TestRegister(t *testing.T) {
+	assert := assert.New(t)
+
+	Register("Passthrough", func() Modifyer { return &passthrough{} })
+
+	assert.Panics(func() { Register("passthrough", func() Modifyer { return &passthrough{} }) })
+	assert.Panics(func() { Register("nilfactory", nil) })
+
+	mods, err := Build([]Definition{{Name: "passthrough", Options: map[string]interface{}{"a": 1}}, {Name: NameCompress}}, Backward)
+	assert.Nil(err)
+	if assert.Len(mods, 2) {
+		assert.Equal(NameCompress, mods[0].Name())
+		if p, ok := mods[1].(*passthrough); assert.True(ok) {
+			assert.Equal(map[string]interface{}{"a": 1}, p.configured)
+		}
+	}
+
+	// modifyers from other packages can check their options too
+	_, err = Build([]Definition{{Name: "passthrough", Options: map[string]interface{}{"invalid": true}}}, Forward)
+	assert.NotNil(err)
+
+	var names []string
+	for _, m := range Available() {
+		names = append(names, m.Name())
+	}
+	assert.Equal([]string{NameCompress, NameEncrypt, "passthrough"}, names)
+}
+
+func TestCapabilities(t *testing.T) {
+	assert := assert.New(t)
+
+	caps := Capabilities()
+	if assert.True(len(caps) >= 2) {
+		assert.Equal(NameCompress, caps[0].Name)
+		assert.Equal((&Compress{}).Options(), caps[0].Options)
+		assert.Equal(NameEncrypt, caps[1].Name)
+	}
+}